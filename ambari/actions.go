@@ -18,159 +18,255 @@ import (
 	"bytes"
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
 )
 
 // ListAgents get all the registered hosts
-func (a AmbariRegistry) ListAgents() []Host {
-	request := a.CreateGetRequest("hosts?fields=Hosts/public_host_name,Hosts/ip,Hosts/host_state,Hosts/os_type,Hosts/os_arch,Hosts/last_agent_env", false)
-	ambariItems := ProcessAmbariItems(request)
-	return ambariItems.ConvertResponse().Hosts
+func (a AmbariRegistry) ListAgents() ([]Host, error) {
+	request, err := a.CreateGetRequest("hosts?fields=Hosts/public_host_name,Hosts/ip,Hosts/host_state,Hosts/os_type,Hosts/os_arch,Hosts/last_agent_env", false)
+	if err != nil {
+		return nil, err
+	}
+	ambariItems, err := a.processAmbariItems(request)
+	if err != nil {
+		return nil, err
+	}
+	return ambariItems.ConvertResponse().Hosts, nil
 }
 
 // ListServices get all installed services
-func (a AmbariRegistry) ListServices() []Service {
-	request := a.CreateGetRequest("services?fields=ServiceInfo/state,ServiceInfo/service_name", true)
-	ambariItems := ProcessAmbariItems(request)
-	return ambariItems.ConvertResponse().Services
+func (a AmbariRegistry) ListServices() ([]Service, error) {
+	request, err := a.CreateGetRequest("services?fields=ServiceInfo/state,ServiceInfo/service_name,ServiceInfo/maintenance_state", true)
+	if err != nil {
+		return nil, err
+	}
+	ambariItems, err := a.processAmbariItems(request)
+	if err != nil {
+		return nil, err
+	}
+	return ambariItems.ConvertResponse().Services, nil
 }
 
 //ListComponents get all installed components
-func (a AmbariRegistry) ListComponents() []Component {
-	request := a.CreateGetRequest("components?fields=ServiceComponentInfo/component_name,ServiceComponentInfo/service_name,ServiceComponentInfo/state", true)
-	ambariItems := ProcessAmbariItems(request)
-	return ambariItems.ConvertResponse().Components
+func (a AmbariRegistry) ListComponents() ([]Component, error) {
+	request, err := a.CreateGetRequest("components?fields=ServiceComponentInfo/component_name,ServiceComponentInfo/service_name,ServiceComponentInfo/state,ServiceComponentInfo/category", true)
+	if err != nil {
+		return nil, err
+	}
+	ambariItems, err := a.processAmbariItems(request)
+	if err != nil {
+		return nil, err
+	}
+	return ambariItems.ConvertResponse().Components, nil
 }
 
 //ListHostComponents get all installed host components by component type (or hosts)
-func (a AmbariRegistry) ListHostComponents(param string, useHost bool) []HostComponent {
+func (a AmbariRegistry) ListHostComponents(param string, useHost bool) ([]HostComponent, error) {
 	var request *http.Request
+	var err error
 	if useHost {
-		request = a.CreateGetRequest("host_components?fields=HostRoles/component_name,HostRoles/state,HostRoles/host_name&HostRoles/host_name="+param, true)
+		request, err = a.CreateGetRequest("host_components?fields=HostRoles/component_name,HostRoles/state,HostRoles/host_name&HostRoles/host_name="+param, true)
 	} else {
-		request = a.CreateGetRequest("host_components?fields=HostRoles/component_name,HostRoles/state,HostRoles/host_name&HostRoles/component_name="+param, true)
+		request, err = a.CreateGetRequest("host_components?fields=HostRoles/component_name,HostRoles/state,HostRoles/host_name&HostRoles/component_name="+param, true)
 	}
-	ambariItems := ProcessAmbariItems(request)
-	return ambariItems.ConvertResponse().HostComponents
+	if err != nil {
+		return nil, err
+	}
+	ambariItems, err := a.processAmbariItems(request)
+	if err != nil {
+		return nil, err
+	}
+	return ambariItems.ConvertResponse().HostComponents, nil
 }
 
 //ListHostComponentsByService get all installed host components by service name
-func (a AmbariRegistry) ListHostComponentsByService(service string) []HostComponent {
-	request := a.CreateGetRequest("host_components?fields=HostRoles/component_name,HostRoles/state,HostRoles/host_name&component/ServiceComponentInfo/service_name="+service, true)
-	ambariItems := ProcessAmbariItems(request)
-	return ambariItems.ConvertResponse().HostComponents
+func (a AmbariRegistry) ListHostComponentsByService(service string) ([]HostComponent, error) {
+	request, err := a.CreateGetRequest("host_components?fields=HostRoles/component_name,HostRoles/state,HostRoles/host_name&component/ServiceComponentInfo/service_name="+service, true)
+	if err != nil {
+		return nil, err
+	}
+	ambariItems, err := a.processAmbariItems(request)
+	if err != nil {
+		return nil, err
+	}
+	return ambariItems.ConvertResponse().HostComponents, nil
+}
+
+// ListHostComponentStates get all installed host components with their actual and desired states, stale config and maintenance flags
+func (a AmbariRegistry) ListHostComponentStates() ([]HostComponent, error) {
+	return a.listHostComponentStates("")
+}
+
+// ListHostComponentStatesByHost get the host components of a host with their actual, desired and admin (decommission) states
+func (a AmbariRegistry) ListHostComponentStatesByHost(host string) ([]HostComponent, error) {
+	return a.listHostComponentStates("&HostRoles/host_name=" + host)
+}
+
+func (a AmbariRegistry) listHostComponentStates(query string) ([]HostComponent, error) {
+	request, err := a.CreateGetRequest("host_components?fields=HostRoles/component_name,HostRoles/host_name,HostRoles/service_name,HostRoles/state,"+
+		"HostRoles/desired_state,HostRoles/stale_configs,HostRoles/maintenance_state,HostRoles/desired_admin_state"+query, true)
+	if err != nil {
+		return nil, err
+	}
+	ambariItems, err := a.processAmbariItems(request)
+	if err != nil {
+		return nil, err
+	}
+	return ambariItems.ConvertResponse().HostComponents, nil
 }
 
 // ListServiceConfigVersions gather service configuration details
-func (a AmbariRegistry) ListServiceConfigVersions() []ServiceConfig {
-	request := a.CreateGetRequest("configurations/service_config_versions?fields=service_name&is_current=true", true)
-	ambariItems := ProcessAmbariItems(request)
-	return ambariItems.ConvertResponse().ServiceConfigs
+func (a AmbariRegistry) ListServiceConfigVersions() ([]ServiceConfig, error) {
+	request, err := a.CreateGetRequest("configurations/service_config_versions?fields=service_name&is_current=true", true)
+	if err != nil {
+		return nil, err
+	}
+	ambariItems, err := a.processAmbariItems(request)
+	if err != nil {
+		return nil, err
+	}
+	return ambariItems.ConvertResponse().ServiceConfigs, nil
 }
 
 // GetClusterInfo obtain cluster detauls for ambari managed cluster
-func (a AmbariRegistry) GetClusterInfo() Cluster {
-	request := a.CreateGetRequest("?fields=Clusters/cluster_name,Clusters/version,Clusters/total_hosts,Clusters/security_type", true)
-	ambariItems := ProcessAmbariItems(request)
-	return ambariItems.ConvertResponse().Cluster
+func (a AmbariRegistry) GetClusterInfo() (Cluster, error) {
+	request, err := a.CreateGetRequest("?fields=Clusters/cluster_name,Clusters/version,Clusters/total_hosts,Clusters/security_type", true)
+	if err != nil {
+		return Cluster{}, err
+	}
+	ambariItems, err := a.processAmbariItems(request)
+	if err != nil {
+		return Cluster{}, err
+	}
+	return ambariItems.ConvertResponse().Cluster, nil
 }
 
 // ExportBlueprint generate re-usable JSON from the cluster
-func (a AmbariRegistry) ExportBlueprint() []byte {
-	request := a.CreateGetRequest("?format=blueprint", true)
-	return ProcessRequest(request)
+func (a AmbariRegistry) ExportBlueprint() ([]byte, error) {
+	request, err := a.CreateGetRequest("?format=blueprint", true)
+	if err != nil {
+		return nil, err
+	}
+	return a.processRequest(request)
 }
 
 // ExportBlueprintAsMap generate re-usable JSON map from the cluster
-func (a AmbariRegistry) ExportBlueprintAsMap() map[string]interface{} {
-	request := a.CreateGetRequest("?format=blueprint", true)
-	return ProcessAsMap(request)
+func (a AmbariRegistry) ExportBlueprintAsMap() (map[string]interface{}, error) {
+	request, err := a.CreateGetRequest("?format=blueprint", true)
+	if err != nil {
+		return nil, err
+	}
+	return a.processAsMap(request)
 }
 
 // GetStackDefaultConfigs obtain default configs for specific (versioned) stack
-func (a AmbariRegistry) GetStackDefaultConfigs(stack string, version string) map[string]StackConfig {
+func (a AmbariRegistry) GetStackDefaultConfigs(stack string, version string) (map[string]StackConfig, error) {
 	uriSuffix := fmt.Sprintf("stacks/%v/versions/%v/services?fields=configurations/*", stack, version)
-	request := a.CreateGetRequest(uriSuffix, false)
-	ambariItems := ProcessAmbariItems(request)
-	return ambariItems.ConvertResponse().StackConfigs
+	request, err := a.CreateGetRequest(uriSuffix, false)
+	if err != nil {
+		return nil, err
+	}
+	ambariItems, err := a.processAmbariItems(request)
+	if err != nil {
+		return nil, err
+	}
+	return ambariItems.ConvertResponse().StackConfigs, nil
 }
 
-// SetConfig sets a config value for a specific config key of a config type
-func (a AmbariRegistry) SetConfig(configType string, configKey string, configValue string) {
-	filter := Filter{}
-	filter.Server = true
-	filteredHosts := a.GetFilteredHosts(filter)
-	versionNote := fmt.Sprintf("AMBARICTL - Update config key: %s", configKey)
-	command := fmt.Sprintf("/var/lib/ambari-server/resources/scripts/configs.py --action set -c %s -k %s -v %s "+
-		"-u %s -p %s --host=%s --cluster=%s --protocol=%s -b '%s'", configType, configKey, configValue, a.Username, a.Password,
-		a.Hostname, a.Cluster, a.Protocol, versionNote)
-	a.RunRemoteHostCommand(command, filteredHosts, filter.Server)
+// SetConfig sets a config value for a specific config key of a config type (through the Ambari REST API)
+func (a AmbariRegistry) SetConfig(configType string, configKey string, configValue string) error {
+	return a.UpdateConfig(ConfigUpdate{ConfigType: configType, Set: map[string]string{configKey: configValue}})
 }
 
-// RunAmbariServiceCommand start / stop / restart Ambari services or components
-func (a AmbariRegistry) RunAmbariServiceCommand(command string, filter Filter, useServiceFilter bool, useComponentFilter bool) {
+// RunAmbariServiceCommand start / stop / restart Ambari services or components, waits until the created Ambari requests are finished
+func (a AmbariRegistry) RunAmbariServiceCommand(command string, filter Filter, useServiceFilter bool, useComponentFilter bool) error {
 	command = strings.ToUpper(command)
 	if command == "START" {
-		a.startAmbariServiceOrComponent(useComponentFilter, filter, useServiceFilter)
+		return a.startAmbariServiceOrComponent(useComponentFilter, filter, useServiceFilter)
 	} else if command == "STOP" {
-		a.stopAmbariServiceOrComponent(useComponentFilter, filter, useServiceFilter)
+		return a.stopAmbariServiceOrComponent(useComponentFilter, filter, useServiceFilter)
 	} else if command == "RESTART" {
-		a.restartAmbariServiceOrComponent(useComponentFilter, filter, useServiceFilter)
+		return a.restartAmbariServiceOrComponent(useComponentFilter, filter, useServiceFilter)
 	} else if command == "SERVICE_CHECK" {
-		a.checkService(filter)
-	} else {
-		fmt.Println("Only START/STOP/RESTART/SERVICE_CHECK operations are supported.")
-		os.Exit(1)
+		return a.checkService(filter)
 	}
+	return fmt.Errorf("Only START/STOP/RESTART/SERVICE_CHECK operations are supported (got: '%s')", command)
 }
 
 // StartService starting an ambari service
-func (a AmbariRegistry) StartService(service string) []byte {
-	request := a.serviceOperation(service, "STARTED", fmt.Sprintf("Start service (%s) by ambarictl", service))
-	return ProcessRequest(request)
+func (a AmbariRegistry) StartService(service string) ([]byte, error) {
+	request, err := a.serviceOperation(service, "STARTED", fmt.Sprintf("Start service (%s) by ambarictl", service))
+	if err != nil {
+		return nil, err
+	}
+	return a.processRequest(request)
 }
 
 // CheckService performs service check on an ambari service
-func (a AmbariRegistry) CheckService(service string) []byte {
+func (a AmbariRegistry) CheckService(service string) ([]byte, error) {
 	checkName := service
 	if service == "ZOOKEEPER" {
 		checkName = "ZOOKEEPER_QUORUM"
 	}
 	command := fmt.Sprintf("%s_SERVICE_CHECK", checkName)
 	context := fmt.Sprintf("Check service (%s) by ambarictl", service)
-	request := a.serviceCommand(service, command, context)
-	return ProcessRequest(request)
+	request, err := a.serviceCommand(service, command, context)
+	if err != nil {
+		return nil, err
+	}
+	return a.processRequest(request)
 }
 
 // StopService stopping an ambari service
-func (a AmbariRegistry) StopService(service string) []byte {
-	request := a.serviceOperation(service, "INSTALLED", fmt.Sprintf("Stop service (%s) by ambarictl", service))
-	return ProcessRequest(request)
+func (a AmbariRegistry) StopService(service string) ([]byte, error) {
+	request, err := a.serviceOperation(service, "INSTALLED", fmt.Sprintf("Stop service (%s) by ambarictl", service))
+	if err != nil {
+		return nil, err
+	}
+	return a.processRequest(request)
 }
 
-// RestartService restarting an ambari service
-func (a AmbariRegistry) RestartService(service string) {
-	a.StopService(service)
-	a.StartService(service)
+// RestartService restarting an ambari service (waits until the service is stopped before starting it)
+func (a AmbariRegistry) RestartService(service string) error {
+	if err := a.trackOperation(a.StopService(service)); err != nil {
+		return err
+	}
+	return a.trackOperation(a.StartService(service))
 }
 
 // StartComponent start an ambari component of a service
-func (a AmbariRegistry) StartComponent(component string) []byte {
-	request := a.componentOperation(component, "START", fmt.Sprintf("Start component (%s) by ambarictl", component))
-	return ProcessRequest(request)
+func (a AmbariRegistry) StartComponent(component string) ([]byte, error) {
+	request, err := a.componentOperation(component, "START", fmt.Sprintf("Start component (%s) by ambarictl", component))
+	if err != nil {
+		return nil, err
+	}
+	return a.processRequest(request)
 }
 
 // StopComponent stop an ambari component of a service
-func (a AmbariRegistry) StopComponent(component string) []byte {
-	request := a.componentOperation(component, "STOP", fmt.Sprintf("Stop component (%s) by ambarictl", component))
-	return ProcessRequest(request)
+func (a AmbariRegistry) StopComponent(component string) ([]byte, error) {
+	request, err := a.componentOperation(component, "STOP", fmt.Sprintf("Stop component (%s) by ambarictl", component))
+	if err != nil {
+		return nil, err
+	}
+	return a.processRequest(request)
 }
 
 // RestartComponent restarts an ambari component of a service
-func (a AmbariRegistry) RestartComponent(component string) []byte {
-	request := a.componentOperation(component, "RESTART", fmt.Sprintf("Restart component (%s) by ambarictl", component))
-	return ProcessRequest(request)
+func (a AmbariRegistry) RestartComponent(component string) ([]byte, error) {
+	request, err := a.componentOperation(component, "RESTART", fmt.Sprintf("Restart component (%s) by ambarictl", component))
+	if err != nil {
+		return nil, err
+	}
+	return a.processRequest(request)
+}
+
+// trackOperation tracks the request of an asynchronous operation response until it is finished
+func (a AmbariRegistry) trackOperation(response []byte, err error) error {
+	if err != nil {
+		return err
+	}
+	return a.TrackResponse(response)
 }
 
 func getServiceNameForComponent(searchComponent string, components []Component) string {
@@ -183,7 +279,7 @@ func getServiceNameForComponent(searchComponent string, components []Component)
 	return result
 }
 
-func (a AmbariRegistry) serviceOperation(service string, state string, context string) *http.Request {
+func (a AmbariRegistry) serviceOperation(service string, state string, context string) (*http.Request, error) {
 	uriSuffix := fmt.Sprintf("services/%s", service)
 	var bodyBytes bytes.Buffer
 	jsonStr := fmt.Sprintf(`{"RequestInfo": {"context" : "%s"}, "Body": {"ServiceInfo": {"state": "%s"}}}`, context, state)
@@ -191,15 +287,25 @@ func (a AmbariRegistry) serviceOperation(service string, state string, context s
 	return a.CreatePutRequest(bodyBytes, uriSuffix, true)
 }
 
-func (a AmbariRegistry) componentOperation(component string, operation string, context string) *http.Request {
-	components := a.ListComponents()
+func (a AmbariRegistry) componentOperation(component string, operation string, context string) (*http.Request, error) {
+	components, err := a.ListComponents()
+	if err != nil {
+		return nil, err
+	}
 	service := getServiceNameForComponent(component, components)
-	hostComponents := a.ListHostComponents(component, false)
-	hosts := ""
+	hostComponents, err := a.ListHostComponents(component, false)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []string
 	for _, hostComponent := range hostComponents {
-		hosts += hostComponent.HostComponntHost + ","
+		hosts = append(hosts, hostComponent.HostComponntHost)
 	}
-	hosts = strings.TrimSuffix(hosts, ",")
+	return a.hostComponentOperation(service, component, hosts, operation, context)
+}
+
+// hostComponentOperation creates a request for running a command (like RESTART) on the host components of a component on specific hosts
+func (a AmbariRegistry) hostComponentOperation(service string, component string, hosts []string, operation string, context string) (*http.Request, error) {
 	uriSuffix := "requests"
 	var bodyBytes bytes.Buffer
 	jsonStr := fmt.Sprintf(`{
@@ -218,12 +324,12 @@ func (a AmbariRegistry) componentOperation(component string, operation string, c
       "hosts": "%s"
     }
   ]
-}`, operation, context, a.Cluster, service, component, hosts)
+}`, operation, context, a.Cluster, service, component, strings.Join(hosts, ","))
 	bodyBytes.WriteString(jsonStr)
 	return a.CreatePostRequest(bodyBytes, uriSuffix, true)
 }
 
-func (a AmbariRegistry) serviceCommand(service string, command string, context string) *http.Request {
+func (a AmbariRegistry) serviceCommand(service string, command string, context string) (*http.Request, error) {
 	uriSuffix := "requests"
 	var bodyBytes bytes.Buffer
 	jsonStr := fmt.Sprintf(`{
@@ -241,44 +347,62 @@ func (a AmbariRegistry) serviceCommand(service string, command string, context s
 	return a.CreatePostRequest(bodyBytes, uriSuffix, true)
 }
 
-func (a AmbariRegistry) checkService(filter Filter) {
+func (a AmbariRegistry) checkService(filter Filter) error {
 	for _, service := range filter.Services {
-		a.CheckService(service)
+		if err := a.trackOperation(a.CheckService(service)); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func (a AmbariRegistry) restartAmbariServiceOrComponent(useComponentFilter bool, filter Filter, useServiceFilter bool) {
+func (a AmbariRegistry) restartAmbariServiceOrComponent(useComponentFilter bool, filter Filter, useServiceFilter bool) error {
 	if useComponentFilter {
 		for _, component := range filter.Components {
-			a.RestartComponent(component)
+			if err := a.trackOperation(a.RestartComponent(component)); err != nil {
+				return err
+			}
 		}
 	} else if useServiceFilter {
 		for _, service := range filter.Services {
-			a.RestartService(service)
+			if err := a.RestartService(service); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
 }
 
-func (a AmbariRegistry) stopAmbariServiceOrComponent(useComponentFilter bool, filter Filter, useServiceFilter bool) {
+func (a AmbariRegistry) stopAmbariServiceOrComponent(useComponentFilter bool, filter Filter, useServiceFilter bool) error {
 	if useComponentFilter {
 		for _, component := range filter.Components {
-			a.StopComponent(component)
+			if err := a.trackOperation(a.StopComponent(component)); err != nil {
+				return err
+			}
 		}
 	} else if useServiceFilter {
 		for _, service := range filter.Services {
-			a.StopService(service)
+			if err := a.trackOperation(a.StopService(service)); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
 }
 
-func (a AmbariRegistry) startAmbariServiceOrComponent(useComponentFilter bool, filter Filter, useServiceFilter bool) {
+func (a AmbariRegistry) startAmbariServiceOrComponent(useComponentFilter bool, filter Filter, useServiceFilter bool) error {
 	if useComponentFilter {
 		for _, component := range filter.Components {
-			a.StartComponent(component)
+			if err := a.trackOperation(a.StartComponent(component)); err != nil {
+				return err
+			}
 		}
 	} else if useServiceFilter {
 		for _, service := range filter.Services {
-			a.StartService(service)
+			if err := a.trackOperation(a.StartService(service)); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
 }
@@ -0,0 +1,131 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	// AlertStateOK alert state for passing alert checks
+	AlertStateOK = "OK"
+	// AlertStateWarning alert state for warning alerts
+	AlertStateWarning = "WARNING"
+	// AlertStateCritical alert state for critical alerts
+	AlertStateCritical = "CRITICAL"
+	// AlertStateUnknown alert state for alerts that cannot be evaluated
+	AlertStateUnknown = "UNKNOWN"
+)
+
+// AlertFilter filters the listed alerts (or alert history entries) by states, services, host names and alert definition names
+type AlertFilter struct {
+	States      []string
+	Services    []string
+	Hosts       []string
+	Definitions []string
+}
+
+// predicates creates the Ambari query predicates of the filter for a resource (Alert or AlertHistory)
+func (f AlertFilter) predicates(resource string) string {
+	var predicates []string
+	appendPredicate := func(property string, values []string) {
+		if len(values) > 0 {
+			predicates = append(predicates, fmt.Sprintf("%s/%s.in(%s)", resource, property, strings.Join(values, ",")))
+		}
+	}
+	appendPredicate("state", upperStrings(f.States))
+	appendPredicate("service_name", upperStrings(f.Services))
+	appendPredicate("host_name", f.Hosts)
+	appendPredicate("definition_name", f.Definitions)
+	if len(predicates) == 0 {
+		return ""
+	}
+	return "&" + strings.Join(predicates, "&")
+}
+
+// ListAlerts get the current alert instances of the cluster
+func (a AmbariRegistry) ListAlerts(filter AlertFilter) ([]Alert, error) {
+	uriSuffix := "alerts?fields=Alert/id,Alert/definition_name,Alert/label,Alert/state,Alert/service_name,Alert/component_name,Alert/host_name," +
+		"Alert/text,Alert/maintenance_state,Alert/original_timestamp" + filter.predicates("Alert")
+	request, err := a.CreateGetRequest(uriSuffix, true)
+	if err != nil {
+		return nil, err
+	}
+	ambariItems, err := a.processAmbariItems(request)
+	if err != nil {
+		return nil, err
+	}
+	return ambariItems.ConvertResponse().Alerts, nil
+}
+
+// ListAlertHistory get the latest alert state changes of the cluster (newest first, at most limit entries)
+func (a AmbariRegistry) ListAlertHistory(filter AlertFilter, limit int) ([]AlertHistory, error) {
+	uriSuffix := fmt.Sprintf("alert_history?fields=AlertHistory/id,AlertHistory/definition_name,AlertHistory/label,AlertHistory/state,AlertHistory/service_name,"+
+		"AlertHistory/component_name,AlertHistory/host_name,AlertHistory/text,AlertHistory/timestamp%s&sortBy=AlertHistory/timestamp.desc&page_size=%v&from=0",
+		filter.predicates("AlertHistory"), limit)
+	request, err := a.CreateGetRequest(uriSuffix, true)
+	if err != nil {
+		return nil, err
+	}
+	ambariItems, err := a.processAmbariItems(request)
+	if err != nil {
+		return nil, err
+	}
+	return ambariItems.ConvertResponse().AlertHistory, nil
+}
+
+// ListAlertDefinitions get the alert definitions of the cluster
+func (a AmbariRegistry) ListAlertDefinitions() ([]AlertDefinition, error) {
+	request, err := a.CreateGetRequest("alert_definitions?fields=AlertDefinition/id,AlertDefinition/name,AlertDefinition/label,AlertDefinition/service_name,"+
+		"AlertDefinition/component_name,AlertDefinition/scope,AlertDefinition/interval,AlertDefinition/enabled", true)
+	if err != nil {
+		return nil, err
+	}
+	ambariItems, err := a.processAmbariItems(request)
+	if err != nil {
+		return nil, err
+	}
+	return ambariItems.ConvertResponse().AlertDefinitions, nil
+}
+
+// SetAlertDefinitionEnabled enables or disables an alert definition by name
+func (a AmbariRegistry) SetAlertDefinitionEnabled(name string, enabled bool) error {
+	alertDefinitions, err := a.ListAlertDefinitions()
+	if err != nil {
+		return err
+	}
+	for _, alertDefinition := range alertDefinitions {
+		if alertDefinition.Name == name {
+			var bodyBytes bytes.Buffer
+			bodyBytes.WriteString(fmt.Sprintf(`{"AlertDefinition": {"enabled": %v}}`, enabled))
+			request, err := a.CreatePutRequest(bodyBytes, fmt.Sprintf("alert_definitions/%v", alertDefinition.ID), true)
+			if err != nil {
+				return err
+			}
+			_, err = a.processRequest(request)
+			return err
+		}
+	}
+	return fmt.Errorf("alert definition '%s' does not exist", name)
+}
+
+func upperStrings(values []string) []string {
+	var result []string
+	for _, value := range values {
+		result = append(result, strings.ToUpper(value))
+	}
+	return result
+}
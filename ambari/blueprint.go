@@ -0,0 +1,371 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// HostNameRewriter rewrites host names (e.g.: for replaying an exported cluster creation template on other hosts):
+// the explicit mapping is used first, then the pattern (regexp with a replacement like $1.example.com)
+type HostNameRewriter struct {
+	Mapping     map[string]string
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// LoadBlueprintFile reads a blueprint json file, returns the parsed topology and the (unmodified) content of the file
+func LoadBlueprintFile(file string) (Blueprint, []byte, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return Blueprint{}, nil, err
+	}
+	blueprint, err := ParseBlueprint(content)
+	if err != nil {
+		return Blueprint{}, nil, fmt.Errorf("cannot parse blueprint file '%s': %v", file, err)
+	}
+	return blueprint, content, nil
+}
+
+// ParseBlueprint parses the topology (stack and host groups) of a blueprint json
+func ParseBlueprint(content []byte) (Blueprint, error) {
+	var blueprint Blueprint
+	if err := json.Unmarshal(content, &blueprint); err != nil {
+		return blueprint, err
+	}
+	if len(blueprint.Blueprints.StackName) == 0 || len(blueprint.Blueprints.StackVersion) == 0 {
+		return blueprint, fmt.Errorf("Blueprints/stack_name and Blueprints/stack_version are required")
+	}
+	if len(blueprint.HostGroups) == 0 {
+		return blueprint, fmt.Errorf("blueprint does not contain any host groups")
+	}
+	return blueprint, nil
+}
+
+// LoadClusterTemplate reads a cluster creation template json file
+func LoadClusterTemplate(file string) (ClusterTemplate, error) {
+	var template ClusterTemplate
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return template, err
+	}
+	if err := json.Unmarshal(content, &template); err != nil {
+		return template, fmt.Errorf("cannot parse cluster creation template file '%s': %v", file, err)
+	}
+	return template, nil
+}
+
+// ValidateClusterTemplate checks that the host groups of a cluster creation template exist in the blueprint,
+// every host group of the blueprint has hosts (or a host count) and a host is mapped only to one host group
+func ValidateClusterTemplate(blueprint Blueprint, template ClusterTemplate) error {
+	templateHostGroups := make(map[string]ClusterTemplateHostGroup)
+	hostGroupsByHost := make(map[string]string)
+	for _, hostGroup := range template.HostGroups {
+		templateHostGroups[hostGroup.Name] = hostGroup
+		for _, host := range hostGroup.Hosts {
+			if otherHostGroup, ok := hostGroupsByHost[host.FQDN]; ok {
+				return fmt.Errorf("host '%s' is mapped to host group '%s' and '%s' as well", host.FQDN, otherHostGroup, hostGroup.Name)
+			}
+			hostGroupsByHost[host.FQDN] = hostGroup.Name
+		}
+	}
+	blueprintHostGroups := make(map[string]bool)
+	for _, hostGroup := range blueprint.HostGroups {
+		blueprintHostGroups[hostGroup.Name] = true
+		templateHostGroup, ok := templateHostGroups[hostGroup.Name]
+		if !ok || (len(templateHostGroup.Hosts) == 0 && templateHostGroup.HostCount == 0) {
+			return fmt.Errorf("no hosts are mapped to host group '%s' in the cluster creation template", hostGroup.Name)
+		}
+	}
+	for _, hostGroup := range template.HostGroups {
+		if !blueprintHostGroups[hostGroup.Name] {
+			return fmt.Errorf("host group '%s' of the cluster creation template does not exist in the blueprint", hostGroup.Name)
+		}
+	}
+	return nil
+}
+
+// RegisterBlueprint registers a blueprint (json content) under a name in Ambari
+func (a AmbariRegistry) RegisterBlueprint(name string, content []byte) error {
+	var bodyBytes bytes.Buffer
+	bodyBytes.Write(content)
+	request, err := a.CreatePostRequest(bodyBytes, fmt.Sprintf("blueprints/%s", name), false)
+	if err != nil {
+		return err
+	}
+	_, err = a.processRequest(request)
+	return err
+}
+
+// CreateCluster registers the blueprint, then creates the cluster of the ambari server entry from the cluster creation template and tracks the provisioning request,
+// the blueprint name is taken from the template or the blueprint if it is not provided (otherwise <cluster>-blueprint is used)
+func (a AmbariRegistry) CreateCluster(blueprintName string, blueprintContent []byte, template ClusterTemplate) error {
+	blueprint, err := ParseBlueprint(blueprintContent)
+	if err != nil {
+		return err
+	}
+	if err := ValidateClusterTemplate(blueprint, template); err != nil {
+		return err
+	}
+	if len(blueprintName) == 0 {
+		blueprintName = template.Blueprint
+	}
+	if len(blueprintName) == 0 {
+		blueprintName = blueprint.Blueprints.Name
+	}
+	if len(blueprintName) == 0 {
+		blueprintName = fmt.Sprintf("%s-blueprint", a.Cluster)
+	}
+	if err := a.RegisterBlueprint(blueprintName, blueprintContent); err != nil {
+		return err
+	}
+	fmt.Println(fmt.Sprintf("Blueprint '%s' has been registered (stack: %s-%s)", blueprintName, blueprint.Blueprints.StackName, blueprint.Blueprints.StackVersion))
+	template.Blueprint = blueprintName
+	var bodyBytes bytes.Buffer
+	encoder := json.NewEncoder(&bodyBytes)
+	encoder.SetEscapeHTML(false) // keep host predicates (like Hosts/cpu_count>1) readable
+	if err := encoder.Encode(template); err != nil {
+		return err
+	}
+	request, err := a.CreatePostRequest(bodyBytes, "", true)
+	if err != nil {
+		return err
+	}
+	return a.trackOperation(a.processRequest(request))
+}
+
+// CloneClusterTopology exports the blueprint of an other ambari server entry (by id), then maps the provided hosts to its host groups:
+// the host groups keep the number of hosts of the source cluster (the hosts are assigned in the order of the blueprint host groups),
+// if no hosts are provided, only the blueprint is exported
+func (a AmbariRegistry) CloneClusterTopology(sourceID string, hosts []string) ([]byte, ClusterTemplate, error) {
+	source, err := a.getRegistryEntry(sourceID)
+	if err != nil {
+		return nil, ClusterTemplate{}, err
+	}
+	content, err := source.ExportBlueprint()
+	if err != nil {
+		return nil, ClusterTemplate{}, err
+	}
+	blueprint, err := ParseBlueprint(content)
+	if err != nil {
+		return nil, ClusterTemplate{}, err
+	}
+	if len(hosts) == 0 {
+		return content, ClusterTemplate{}, nil
+	}
+	mapping, err := source.GetHostGroupMapping(blueprint)
+	if err != nil {
+		return nil, ClusterTemplate{}, err
+	}
+	sourceHostCount := 0
+	for _, hostGroupHosts := range mapping {
+		sourceHostCount += len(hostGroupHosts)
+	}
+	if len(hosts) != sourceHostCount {
+		return nil, ClusterTemplate{}, fmt.Errorf("cluster of '%s' has %v hosts, but %v hosts are provided", sourceID, sourceHostCount, len(hosts))
+	}
+	template := ClusterTemplate{}
+	next := 0
+	for _, hostGroup := range blueprint.HostGroups {
+		templateHostGroup := ClusterTemplateHostGroup{Name: hostGroup.Name}
+		for range mapping[hostGroup.Name] {
+			templateHostGroup.Hosts = append(templateHostGroup.Hosts, ClusterTemplateHost{FQDN: hosts[next]})
+			next++
+		}
+		template.HostGroups = append(template.HostGroups, templateHostGroup)
+	}
+	return content, template, nil
+}
+
+// GetHostGroupMapping maps the hosts of the cluster to the host groups of a blueprint (that is exported from the cluster) by comparing the components
+// of the hosts and the host groups, returns the sorted host names by host group names
+func (a AmbariRegistry) GetHostGroupMapping(blueprint Blueprint) (map[string][]string, error) {
+	hostComponents, err := a.ListHostComponentStates()
+	if err != nil {
+		return nil, err
+	}
+	componentsByHost := make(map[string]map[string]bool)
+	for _, hostComponent := range hostComponents {
+		if _, ok := componentsByHost[hostComponent.HostComponntHost]; !ok {
+			componentsByHost[hostComponent.HostComponntHost] = make(map[string]bool)
+		}
+		componentsByHost[hostComponent.HostComponntHost][hostComponent.HostComponentName] = true
+	}
+	mapping := make(map[string][]string)
+	for host, components := range componentsByHost {
+		hostGroupName := ""
+		for _, hostGroup := range blueprint.HostGroups {
+			if hasSameComponents(hostGroup, components) {
+				hostGroupName = hostGroup.Name
+				break
+			}
+		}
+		if len(hostGroupName) == 0 {
+			return nil, fmt.Errorf("components of host '%s' do not match any host group of the blueprint", host)
+		}
+		mapping[hostGroupName] = append(mapping[hostGroupName], host)
+	}
+	for _, hostGroupHosts := range mapping {
+		sort.Strings(hostGroupHosts)
+	}
+	return mapping, nil
+}
+
+// CreateClusterTemplate creates a cluster creation template for a blueprint (that is exported from the cluster): every host of the cluster
+// is mapped to its host group (see GetHostGroupMapping) with rewritten host names, registered hosts without components are skipped with a warning
+func (a AmbariRegistry) CreateClusterTemplate(blueprintContent []byte, blueprintName string, rewriter HostNameRewriter) (ClusterTemplate, error) {
+	blueprint, err := ParseBlueprint(blueprintContent)
+	if err != nil {
+		return ClusterTemplate{}, err
+	}
+	mapping, err := a.GetHostGroupMapping(blueprint)
+	if err != nil {
+		return ClusterTemplate{}, err
+	}
+	mappedHosts := make(map[string]bool)
+	for _, hostGroupHosts := range mapping {
+		for _, host := range hostGroupHosts {
+			mappedHosts[host] = true
+		}
+	}
+	agents, err := a.ListAgents()
+	if err != nil {
+		return ClusterTemplate{}, err
+	}
+	for _, agent := range agents {
+		if !mappedHosts[agent.HostName] {
+			fmt.Println(fmt.Sprintf("Host %s does not have any components, it is not added to the cluster creation template", agent.HostName))
+		}
+	}
+	if len(blueprintName) == 0 {
+		blueprintName = fmt.Sprintf("%s-blueprint", a.Cluster)
+	}
+	template := ClusterTemplate{Blueprint: blueprintName}
+	rewrittenHosts := make(map[string]string)
+	for _, hostGroup := range blueprint.HostGroups {
+		templateHostGroup := ClusterTemplateHostGroup{Name: hostGroup.Name}
+		for _, host := range mapping[hostGroup.Name] {
+			newHost := rewriter.Rewrite(host)
+			if otherHost, ok := rewrittenHosts[newHost]; ok {
+				return ClusterTemplate{}, fmt.Errorf("host '%s' and '%s' are both rewritten to '%s'", otherHost, host, newHost)
+			}
+			rewrittenHosts[newHost] = host
+			templateHostGroup.Hosts = append(templateHostGroup.Hosts, ClusterTemplateHost{FQDN: newHost})
+		}
+		template.HostGroups = append(template.HostGroups, templateHostGroup)
+	}
+	return template, nil
+}
+
+// CreateHostNameRewriter creates a host name rewriter from a mapping file (see LoadHostMapping) and a pattern (like '(.*)\.prod\.example\.com=$1.test.example.com')
+func CreateHostNameRewriter(mappingFile string, pattern string) (HostNameRewriter, error) {
+	rewriter := HostNameRewriter{}
+	if len(mappingFile) > 0 {
+		mapping, err := LoadHostMapping(mappingFile)
+		if err != nil {
+			return rewriter, err
+		}
+		rewriter.Mapping = mapping
+	}
+	if len(pattern) > 0 {
+		index := strings.LastIndex(pattern, "=")
+		if index <= 0 {
+			return rewriter, fmt.Errorf("invalid host name pattern '%s' (use <regexp>=<replacement>)", pattern)
+		}
+		compiledPattern, err := regexp.Compile("^(?:" + pattern[:index] + ")$")
+		if err != nil {
+			return rewriter, fmt.Errorf("invalid host name pattern '%s': %v", pattern, err)
+		}
+		rewriter.Pattern = compiledPattern
+		rewriter.Replacement = pattern[index+1:]
+	}
+	return rewriter, nil
+}
+
+// LoadHostMapping reads a host mapping file, every line contains an old and a new host name (separated by whitespace or =), lines starting with # are ignored
+func LoadHostMapping(file string) (map[string]string, error) {
+	mappingFile, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer mappingFile.Close()
+	mapping := make(map[string]string)
+	scanner := bufio.NewScanner(mappingFile)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(strings.Replace(line, "=", " ", 1))
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid line %v in host mapping file '%s': %s", lineNumber, file, line)
+		}
+		mapping[fields[0]] = fields[1]
+	}
+	return mapping, scanner.Err()
+}
+
+// Rewrite returns the new name of a host (or the original name if neither the mapping nor the pattern matches)
+func (r HostNameRewriter) Rewrite(host string) string {
+	if newHost, ok := r.Mapping[host]; ok {
+		return newHost
+	}
+	if r.Pattern != nil && r.Pattern.MatchString(host) {
+		return r.Pattern.ReplaceAllString(host, r.Replacement)
+	}
+	return host
+}
+
+func hasSameComponents(hostGroup HostGroup, components map[string]bool) bool {
+	hostGroupComponents := make(map[string]bool)
+	for _, component := range hostGroup.Components {
+		hostGroupComponents[component.Name] = true
+	}
+	if len(hostGroupComponents) != len(components) {
+		return false
+	}
+	for component := range components {
+		if !hostGroupComponents[component] {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatClusterTemplateHosts describes the host mapping of a cluster creation template (like 'master: host1, workers: host2, host3')
+func FormatClusterTemplateHosts(template ClusterTemplate) string {
+	var hostGroups []string
+	for _, hostGroup := range template.HostGroups {
+		var hosts []string
+		for _, host := range hostGroup.Hosts {
+			hosts = append(hosts, host.FQDN)
+		}
+		if hostGroup.HostCount > 0 {
+			hosts = append(hosts, strings.TrimSpace(fmt.Sprintf("%v host(s) %s", hostGroup.HostCount, hostGroup.HostPredicate)))
+		}
+		hostGroups = append(hostGroups, fmt.Sprintf("%s: %s", hostGroup.Name, strings.Join(hosts, ", ")))
+	}
+	return strings.Join(hostGroups, "; ")
+}
@@ -0,0 +1,238 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadHostMapping(t *testing.T) {
+	folder, err := ioutil.TempDir("", "ambarictl-mapping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	tests := []struct {
+		name     string
+		content  string
+		expected map[string]string
+		err      bool
+	}{
+		{name: "empty file", content: "", expected: map[string]string{}},
+		{name: "whitespace separated", content: "h1.prod h1.test\nh2.prod\th2.test\n", expected: map[string]string{"h1.prod": "h1.test", "h2.prod": "h2.test"}},
+		{name: "equals separated", content: "h1.prod=h1.test\nh2.prod = h2.test", expected: map[string]string{"h1.prod": "h1.test", "h2.prod": "h2.test"}},
+		{name: "comments and empty lines", content: "# old new\n\n  h1.prod h1.test  \n", expected: map[string]string{"h1.prod": "h1.test"}},
+		{name: "missing new host name", content: "h1.prod h1.test\nh2.prod\n", err: true},
+		{name: "too many fields", content: "h1.prod h1.test h1.other\n", err: true},
+	}
+	for index, test := range tests {
+		mappingFile := path.Join(folder, fmt.Sprintf("mapping%v.txt", index))
+		if err := ioutil.WriteFile(mappingFile, []byte(test.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		mapping, err := LoadHostMapping(mappingFile)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(mapping, test.expected) {
+			t.Errorf("%s: LoadHostMapping() = %v, %v, want %v", test.name, mapping, err, test.expected)
+		}
+	}
+	if _, err := LoadHostMapping(path.Join(folder, "missing.txt")); err == nil {
+		t.Errorf("LoadHostMapping() expected an error for a missing file")
+	}
+}
+
+func TestHostNameRewriter(t *testing.T) {
+	folder, err := ioutil.TempDir("", "ambarictl-mapping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	mappingFile := path.Join(folder, "mapping.txt")
+	if err := ioutil.WriteFile(mappingFile, []byte("h1.prod.example.com master.test.example.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		mappingFile string
+		pattern     string
+		rewrites    map[string]string
+		err         bool
+	}{
+		{name: "no rewrite", rewrites: map[string]string{"h1.prod.example.com": "h1.prod.example.com"}},
+		{name: "mapping", mappingFile: mappingFile, rewrites: map[string]string{
+			"h1.prod.example.com": "master.test.example.com",
+			"h2.prod.example.com": "h2.prod.example.com",
+		}},
+		{name: "pattern", pattern: `(.*)\.prod\.example\.com=$1.test.example.com`, rewrites: map[string]string{
+			"h1.prod.example.com":       "h1.test.example.com",
+			"h2.prod.example.com":       "h2.test.example.com",
+			"h2.prod.example.com.other": "h2.prod.example.com.other",
+			"other.example.com":         "other.example.com",
+		}},
+		{name: "mapping has priority over pattern", mappingFile: mappingFile, pattern: `(.*)\.prod\.example\.com=$1.test.example.com`, rewrites: map[string]string{
+			"h1.prod.example.com": "master.test.example.com",
+			"h2.prod.example.com": "h2.test.example.com",
+		}},
+		{name: "pattern without replacement", pattern: `(.*)\.prod\.example\.com`, err: true},
+		{name: "pattern without regexp", pattern: `=h1`, err: true},
+		{name: "invalid regexp", pattern: `(.*=$1`, err: true},
+		{name: "missing mapping file", mappingFile: path.Join(folder, "missing.txt"), err: true},
+	}
+	for _, test := range tests {
+		rewriter, err := CreateHostNameRewriter(test.mappingFile, test.pattern)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		for host, expected := range test.rewrites {
+			if actual := rewriter.Rewrite(host); actual != expected {
+				t.Errorf("%s: Rewrite(%q) = %q, want %q", test.name, host, actual, expected)
+			}
+		}
+	}
+}
+
+func TestValidateClusterTemplate(t *testing.T) {
+	blueprint := Blueprint{HostGroups: []HostGroup{
+		{Name: "master", Components: []BlueprintComponent{{Name: "NAMENODE"}}},
+		{Name: "workers", Components: []BlueprintComponent{{Name: "DATANODE"}}},
+	}}
+	hosts := func(names ...string) []ClusterTemplateHost {
+		var templateHosts []ClusterTemplateHost
+		for _, name := range names {
+			templateHosts = append(templateHosts, ClusterTemplateHost{FQDN: name})
+		}
+		return templateHosts
+	}
+	tests := []struct {
+		name       string
+		hostGroups []ClusterTemplateHostGroup
+		err        string
+	}{
+		{
+			name:       "hosts for every host group",
+			hostGroups: []ClusterTemplateHostGroup{{Name: "master", Hosts: hosts("h1")}, {Name: "workers", Hosts: hosts("h2", "h3")}},
+		},
+		{
+			name:       "host count with predicate",
+			hostGroups: []ClusterTemplateHostGroup{{Name: "master", Hosts: hosts("h1")}, {Name: "workers", HostCount: 3, HostPredicate: "Hosts/cpu_count>1"}},
+		},
+		{
+			name:       "missing host group",
+			hostGroups: []ClusterTemplateHostGroup{{Name: "master", Hosts: hosts("h1")}},
+			err:        "no hosts are mapped to host group 'workers'",
+		},
+		{
+			name:       "host group without hosts",
+			hostGroups: []ClusterTemplateHostGroup{{Name: "master", Hosts: hosts("h1")}, {Name: "workers"}},
+			err:        "no hosts are mapped to host group 'workers'",
+		},
+		{
+			name:       "unknown host group",
+			hostGroups: []ClusterTemplateHostGroup{{Name: "master", Hosts: hosts("h1")}, {Name: "workers", Hosts: hosts("h2")}, {Name: "edge", Hosts: hosts("h3")}},
+			err:        "host group 'edge' of the cluster creation template does not exist in the blueprint",
+		},
+		{
+			name:       "host in two host groups",
+			hostGroups: []ClusterTemplateHostGroup{{Name: "master", Hosts: hosts("h1")}, {Name: "workers", Hosts: hosts("h2", "h1")}},
+			err:        "host 'h1' is mapped to host group 'master' and 'workers' as well",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateClusterTemplate(blueprint, ClusterTemplate{HostGroups: test.hostGroups})
+			if len(test.err) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+// newHostComponentsServer starts an Ambari API stub that serves the host components of the 'cl1' cluster, returns the ambari server entry of the stub
+func newHostComponentsServer(t *testing.T, componentsByHost map[string][]string) (*httptest.Server, AmbariRegistry) {
+	var items []string
+	for host, components := range componentsByHost {
+		for _, component := range components {
+			items = append(items, fmt.Sprintf(`{"HostRoles": {"component_name": "%s", "host_name": "%s", "state": "STARTED"}}`, component, host))
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/clusters/cl1/host_components" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"items": [%s]}`, strings.Join(items, ","))
+	}))
+	return server, testAmbariRegistry(t, server)
+}
+
+func TestGetHostGroupMapping(t *testing.T) {
+	blueprint := Blueprint{HostGroups: []HostGroup{
+		{Name: "master", Components: []BlueprintComponent{{Name: "NAMENODE"}, {Name: "ZOOKEEPER_SERVER"}}},
+		{Name: "workers", Components: []BlueprintComponent{{Name: "DATANODE"}, {Name: "NODEMANAGER"}}},
+		{Name: "edge", Components: []BlueprintComponent{{Name: "HDFS_CLIENT"}}},
+	}}
+	server, ambariServer := newHostComponentsServer(t, map[string][]string{
+		"m1.example.com": {"ZOOKEEPER_SERVER", "NAMENODE"},
+		"w2.example.com": {"DATANODE", "NODEMANAGER"},
+		"w1.example.com": {"NODEMANAGER", "DATANODE"},
+	})
+	defer server.Close()
+	mapping, err := ambariServer.GetHostGroupMapping(blueprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{
+		"master":  {"m1.example.com"},
+		"workers": {"w1.example.com", "w2.example.com"},
+	}
+	if !reflect.DeepEqual(mapping, expected) {
+		t.Errorf("GetHostGroupMapping() = %v, want %v", mapping, expected)
+	}
+
+	// a host with a subset of the components of a host group does not belong to that host group
+	server, ambariServer = newHostComponentsServer(t, map[string][]string{
+		"m1.example.com": {"NAMENODE", "ZOOKEEPER_SERVER"},
+		"w1.example.com": {"DATANODE"},
+	})
+	defer server.Close()
+	if _, err := ambariServer.GetHostGroupMapping(blueprint); err == nil || !strings.Contains(err.Error(), "components of host 'w1.example.com' do not match") {
+		t.Errorf("expected a host group mismatch error, got %v", err)
+	}
+}
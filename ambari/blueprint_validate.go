@@ -0,0 +1,394 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// BlueprintIssueError severity of the blueprint issues that would make the blueprint (or the cluster creation) fail
+	BlueprintIssueError = "ERROR"
+	// BlueprintIssueWarning severity of the suspicious blueprint settings (like custom properties or components that are auto-deployed by Ambari)
+	BlueprintIssueWarning = "WARNING"
+)
+
+// stackLevelConfigTypes config types that are defined on stack level (not by a service)
+var stackLevelConfigTypes = map[string]bool{"cluster-env": true}
+
+// BlueprintIssue represents a problem found by the blueprint validation, location is like host_groups/<name> or configurations/<type>/<property>
+type BlueprintIssue struct {
+	Severity string `json:"severity"`
+	Location string `json:"location"`
+	Message  string `json:"message"`
+}
+
+// blueprintValidator collects the issues of a blueprint
+type blueprintValidator struct {
+	stack      StackDefinition
+	issues     []BlueprintIssue
+	components map[string][]string
+	hostCounts map[string]int
+	properties map[string]map[string]string
+	hostGroups []blueprintHostGroup
+}
+
+// blueprintHostGroup holds the location and the (valid) components of a host group
+type blueprintHostGroup struct {
+	location   string
+	components map[string]bool
+}
+
+// GetBlueprintStack returns the stack name and version of a blueprint json (empty strings if those cannot be parsed)
+func GetBlueprintStack(content []byte) (string, string) {
+	var blueprint struct {
+		Blueprints BlueprintInfo `json:"Blueprints"`
+	}
+	if err := json.Unmarshal(content, &blueprint); err != nil {
+		return "", ""
+	}
+	return blueprint.Blueprints.StackName, blueprint.Blueprints.StackVersion
+}
+
+// ValidateBlueprint checks a blueprint json without submitting it: json structure, host group cardinalities, components, config types and property names,
+// component cardinalities and co-location (dependency) rules and the password properties without default value,
+// the stack related checks are skipped if the stack definition is empty
+func ValidateBlueprint(content []byte, stack StackDefinition) []BlueprintIssue {
+	validator := &blueprintValidator{stack: stack, components: make(map[string][]string), hostCounts: make(map[string]int), properties: make(map[string]map[string]string)}
+	var blueprint map[string]interface{}
+	if err := json.Unmarshal(content, &blueprint); err != nil {
+		validator.addError("", fmt.Sprintf("invalid json: %v", err))
+		return validator.issues
+	}
+	validator.validateBlueprintsSection(blueprint["Blueprints"])
+	validator.validateHostGroups(blueprint["host_groups"])
+	if configurations, ok := blueprint["configurations"]; ok {
+		validator.validateConfigurations("configurations", configurations)
+	}
+	if len(stack.Services) > 0 {
+		validator.validateDependencies()
+		validator.validateCardinalities()
+		validator.validateRequiredPasswords()
+	}
+	sort.SliceStable(validator.issues, func(i, j int) bool {
+		return validator.issues[i].Severity == BlueprintIssueError && validator.issues[j].Severity != BlueprintIssueError
+	})
+	return validator.issues
+}
+
+// CountBlueprintIssues returns the number of errors and warnings
+func CountBlueprintIssues(issues []BlueprintIssue) (int, int) {
+	errors, warnings := 0, 0
+	for _, issue := range issues {
+		if issue.Severity == BlueprintIssueError {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+	return errors, warnings
+}
+
+func (v *blueprintValidator) addError(location string, message string) {
+	v.issues = append(v.issues, BlueprintIssue{Severity: BlueprintIssueError, Location: location, Message: message})
+}
+
+func (v *blueprintValidator) addWarning(location string, message string) {
+	v.issues = append(v.issues, BlueprintIssue{Severity: BlueprintIssueWarning, Location: location, Message: message})
+}
+
+func (v *blueprintValidator) validateBlueprintsSection(value interface{}) {
+	blueprintsSection, ok := value.(map[string]interface{})
+	if !ok {
+		v.addError("Blueprints", "Blueprints section is missing (or it is not an object)")
+		return
+	}
+	stackName, _ := blueprintsSection["stack_name"].(string)
+	stackVersion, _ := blueprintsSection["stack_version"].(string)
+	if len(stackName) == 0 || len(stackVersion) == 0 {
+		v.addError("Blueprints", "stack_name and stack_version are required")
+		return
+	}
+	if len(v.stack.StackName) > 0 && (v.stack.StackName != stackName || v.stack.StackVersion != stackVersion) {
+		v.addError("Blueprints", fmt.Sprintf("blueprint stack %s-%s does not match the stack definition %s-%s", stackName, stackVersion, v.stack.StackName, v.stack.StackVersion))
+	}
+}
+
+func (v *blueprintValidator) validateHostGroups(value interface{}) {
+	hostGroups, ok := value.([]interface{})
+	if !ok || len(hostGroups) == 0 {
+		v.addError("host_groups", "host_groups is missing (or it is not a non-empty array)")
+		return
+	}
+	names := make(map[string]bool)
+	for index, hostGroupVal := range hostGroups {
+		hostGroup, ok := hostGroupVal.(map[string]interface{})
+		if !ok {
+			v.addError(fmt.Sprintf("host_groups[%v]", index), "host group is not an object")
+			continue
+		}
+		name, _ := hostGroup["name"].(string)
+		location := fmt.Sprintf("host_groups[%v]", index)
+		if len(name) == 0 {
+			v.addError(location, "host group name is missing")
+		} else {
+			location = "host_groups/" + name
+			if names[name] {
+				v.addError(location, "duplicated host group name")
+			}
+			names[name] = true
+		}
+		cardinality := ""
+		switch cardinalityVal := hostGroup["cardinality"].(type) {
+		case string:
+			cardinality = cardinalityVal
+		case float64:
+			cardinality = strconv.FormatFloat(cardinalityVal, 'f', -1, 64)
+		}
+		hostCount, _, ok := parseCardinality(cardinality)
+		if len(cardinality) == 0 {
+			v.addError(location, "cardinality is missing")
+		} else if !ok {
+			v.addError(location, fmt.Sprintf("invalid cardinality '%s'", cardinality))
+		}
+		v.validateHostGroupComponents(location, hostGroup["components"], hostCount)
+		if configurations, ok := hostGroup["configurations"]; ok {
+			v.validateConfigurations(location+"/configurations", configurations)
+		}
+	}
+}
+
+func (v *blueprintValidator) validateHostGroupComponents(location string, value interface{}, hostCount int) {
+	components, ok := value.([]interface{})
+	if !ok || len(components) == 0 {
+		v.addError(location, "components are missing (or those are not a non-empty array)")
+		return
+	}
+	hostGroupComponents := make(map[string]bool)
+	for _, componentVal := range components {
+		component, _ := componentVal.(map[string]interface{})
+		name, _ := component["name"].(string)
+		if len(name) == 0 {
+			v.addError(location, "component name is missing")
+			continue
+		}
+		if hostGroupComponents[name] {
+			v.addWarning(location, fmt.Sprintf("component %s is listed more than once", name))
+			continue
+		}
+		hostGroupComponents[name] = true
+		if len(v.stack.Services) > 0 {
+			if _, ok := v.stack.GetComponent(name); !ok {
+				v.addError(location, fmt.Sprintf("component %s does not exist in stack %s-%s", name, v.stack.StackName, v.stack.StackVersion))
+				continue
+			}
+		}
+		v.components[name] = append(v.components[name], location)
+		v.hostCounts[name] += hostCount
+	}
+	v.hostGroups = append(v.hostGroups, blueprintHostGroup{location: location, components: hostGroupComponents})
+}
+
+// validateDependencies checks that the host scoped dependencies of the components are in the same host group, the cluster scoped ones are in any host group
+func (v *blueprintValidator) validateDependencies() {
+	for _, hostGroup := range v.hostGroups {
+		var names []string
+		for name := range hostGroup.components {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			component, _ := v.stack.GetComponent(name)
+			for _, dependency := range component.Dependencies {
+				if dependency.Scope == "host" && !hostGroup.components[dependency.ComponentName] {
+					v.addDependencyIssue(hostGroup.location, fmt.Sprintf("%s needs to be co-located with %s", name, dependency.ComponentName), dependency)
+				} else if dependency.Scope != "host" && len(v.components[dependency.ComponentName]) == 0 {
+					v.addDependencyIssue(hostGroup.location, fmt.Sprintf("%s depends on %s, but it is not in any host group", name, dependency.ComponentName), dependency)
+				}
+			}
+		}
+	}
+}
+
+func (v *blueprintValidator) addDependencyIssue(location string, message string, dependency StackComponentDependency) {
+	if dependencyComponent, ok := v.stack.GetComponent(dependency.ComponentName); ok && dependencyComponent.Category == "CLIENT" {
+		v.addWarning(location, message+" (clients are auto-deployed by Ambari)")
+		return
+	}
+	v.addError(location, message)
+}
+
+// validateCardinalities checks the number of hosts of the components (sum of the minimum host group cardinalities) against the stack cardinalities,
+// and the required (cardinality 1+) components of the services that are used by the blueprint
+func (v *blueprintValidator) validateCardinalities() {
+	services := v.getServices()
+	for _, service := range v.stack.Services {
+		if !services[service.ServiceName] {
+			continue
+		}
+		for _, component := range service.Components {
+			minCount, maxCount, ok := parseCardinality(component.Cardinality)
+			if !ok || component.Cardinality == "ALL" {
+				continue
+			}
+			hostCount := v.hostCounts[component.ComponentName]
+			if len(v.components[component.ComponentName]) == 0 {
+				if minCount > 0 && component.Category != "CLIENT" {
+					v.addWarning("host_groups", fmt.Sprintf("%s is missing, service %s requires %s host(s) of it (unless an HA setup replaces it)", component.ComponentName, service.ServiceName, component.Cardinality))
+				}
+				continue
+			}
+			location := strings.Join(v.components[component.ComponentName], ", ")
+			if hostCount < minCount {
+				v.addError(location, fmt.Sprintf("%s needs %s host(s), but the host groups have %v host(s)", component.ComponentName, component.Cardinality, hostCount))
+			} else if maxCount >= 0 && hostCount > maxCount {
+				v.addError(location, fmt.Sprintf("%s can have %s host(s), but the host groups have %v host(s)", component.ComponentName, component.Cardinality, hostCount))
+			}
+		}
+	}
+}
+
+func (v *blueprintValidator) validateConfigurations(location string, value interface{}) {
+	configurations, ok := value.([]interface{})
+	if !ok {
+		v.addError(location, "configurations is not an array")
+		return
+	}
+	for _, configurationVal := range configurations {
+		configuration, ok := configurationVal.(map[string]interface{})
+		if !ok {
+			v.addError(location, "configuration entry is not an object")
+			continue
+		}
+		for configType, typeVal := range configuration {
+			typeLocation := location + "/" + configType
+			typeConfiguration, ok := typeVal.(map[string]interface{})
+			if !ok {
+				v.addError(typeLocation, "configuration is not an object")
+				continue
+			}
+			properties := typeConfiguration
+			if blueprintProperties, ok := typeConfiguration["properties"]; ok {
+				if properties, ok = blueprintProperties.(map[string]interface{}); !ok {
+					v.addError(typeLocation, "properties is not an object")
+					continue
+				}
+			}
+			if _, ok := v.properties[configType]; !ok {
+				v.properties[configType] = make(map[string]string)
+			}
+			for key, propertyVal := range properties {
+				if key == "properties_attributes" {
+					continue
+				}
+				v.properties[configType][key] = fmt.Sprint(propertyVal)
+			}
+			v.validateConfigType(typeLocation, configType, properties)
+		}
+	}
+}
+
+func (v *blueprintValidator) validateConfigType(location string, configType string, properties map[string]interface{}) {
+	if len(v.stack.Services) == 0 || stackLevelConfigTypes[configType] {
+		return
+	}
+	stackConfig, ok := v.stack.Configurations[configType]
+	if !ok {
+		v.addError(location, fmt.Sprintf("config type %s does not exist in stack %s-%s", configType, v.stack.StackName, v.stack.StackVersion))
+		return
+	}
+	stackProperties := make(map[string]bool)
+	for _, property := range stackConfig.Properties {
+		stackProperties[property.Name] = true
+	}
+	var keys []string
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key != "properties_attributes" && !stackProperties[key] {
+			v.addWarning(location+"/"+key, "property is not defined by the stack (custom property?)")
+		}
+	}
+}
+
+// validateRequiredPasswords checks that the password properties without default value of the used services are set
+// (secret references of exported blueprints are not valid for a new cluster)
+func (v *blueprintValidator) validateRequiredPasswords() {
+	services := v.getServices()
+	var configTypes []string
+	for configType := range v.stack.Configurations {
+		configTypes = append(configTypes, configType)
+	}
+	sort.Strings(configTypes)
+	for _, configType := range configTypes {
+		stackConfig := v.stack.Configurations[configType]
+		if !services[stackConfig.ServiceName] {
+			continue
+		}
+		for _, property := range stackConfig.Properties {
+			if !isPasswordProperty(property) || len(property.Value) > 0 {
+				continue
+			}
+			value := v.properties[configType][property.Name]
+			if len(value) == 0 || strings.HasPrefix(value, "SECRET:") {
+				v.addWarning(fmt.Sprintf("configurations/%s/%s", configType, property.Name),
+					"password property is not set, provide it in the blueprint or use default_password in the cluster creation template")
+			}
+		}
+	}
+}
+
+func (v *blueprintValidator) getServices() map[string]bool {
+	services := make(map[string]bool)
+	for name := range v.components {
+		if component, ok := v.stack.GetComponent(name); ok {
+			services[component.ServiceName] = true
+		}
+	}
+	return services
+}
+
+// isPasswordProperty checks the property type of a stack property (or its name if the property type is unknown)
+func isPasswordProperty(property StackProperty) bool {
+	if len(property.PropertyType) > 0 {
+		return property.PropertyType == "PASSWORD"
+	}
+	return strings.HasSuffix(strings.ToLower(property.Name), "password")
+}
+
+// parseCardinality parses a cardinality (like 1, 1+, 0-1 or ALL) to minimum and maximum host counts (maximum is -1 if it is not limited)
+func parseCardinality(cardinality string) (int, int, bool) {
+	cardinality = strings.TrimSpace(cardinality)
+	if cardinality == "ALL" {
+		return 1, -1, true
+	}
+	if strings.HasSuffix(cardinality, "+") {
+		minCount, err := strconv.Atoi(strings.TrimSuffix(cardinality, "+"))
+		return minCount, -1, err == nil && minCount >= 0
+	}
+	if parts := strings.SplitN(cardinality, "-", 2); len(parts) == 2 {
+		minCount, minErr := strconv.Atoi(parts[0])
+		maxCount, maxErr := strconv.Atoi(parts[1])
+		return minCount, maxCount, minErr == nil && maxErr == nil && minCount >= 0 && minCount <= maxCount
+	}
+	count, err := strconv.Atoi(cardinality)
+	return count, count, err == nil && count >= 0
+}
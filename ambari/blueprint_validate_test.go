@@ -0,0 +1,162 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCardinality(t *testing.T) {
+	tests := []struct {
+		cardinality string
+		minCount    int
+		maxCount    int
+		valid       bool
+	}{
+		{"1", 1, 1, true},
+		{" 3 ", 3, 3, true},
+		{"0", 0, 0, true},
+		{"1+", 1, -1, true},
+		{"0+", 0, -1, true},
+		{"0-1", 0, 1, true},
+		{"1-2", 1, 2, true},
+		{"ALL", 1, -1, true},
+		{"", 0, 0, false},
+		{"2-1", 2, 1, false},
+		{"-1", 0, 0, false},
+		{"x+", 0, -1, false},
+		{"1-x", 1, 0, false},
+		{"many", 0, 0, false},
+	}
+	for _, test := range tests {
+		minCount, maxCount, valid := parseCardinality(test.cardinality)
+		if valid != test.valid {
+			t.Errorf("parseCardinality(%q) valid = %v, want %v", test.cardinality, valid, test.valid)
+			continue
+		}
+		if valid && (minCount != test.minCount || maxCount != test.maxCount) {
+			t.Errorf("parseCardinality(%q) = %v, %v, want %v, %v", test.cardinality, minCount, maxCount, test.minCount, test.maxCount)
+		}
+	}
+}
+
+func TestValidateBlueprint(t *testing.T) {
+	stack := StackDefinition{
+		StackName:    "HDP",
+		StackVersion: "2.6",
+		Services: []StackService{
+			{ServiceName: "HDFS", Components: []StackComponent{
+				{ComponentName: "NAMENODE", ServiceName: "HDFS", Category: "MASTER", Cardinality: "1-2"},
+				{ComponentName: "DATANODE", ServiceName: "HDFS", Category: "SLAVE", Cardinality: "1+"},
+				{ComponentName: "SECONDARY_NAMENODE", ServiceName: "HDFS", Category: "MASTER", Cardinality: "1"},
+				{ComponentName: "HDFS_CLIENT", ServiceName: "HDFS", Category: "CLIENT", Cardinality: "1+"},
+			}},
+			{ServiceName: "HBASE", Components: []StackComponent{
+				{ComponentName: "HBASE_MASTER", ServiceName: "HBASE", Category: "MASTER", Cardinality: "1+", Dependencies: []StackComponentDependency{
+					{ComponentName: "HDFS_CLIENT", ServiceName: "HDFS", Scope: "host"},
+					{ComponentName: "ZOOKEEPER_SERVER", ServiceName: "ZOOKEEPER", Scope: "cluster"},
+				}},
+			}},
+			{ServiceName: "ZOOKEEPER", Components: []StackComponent{
+				{ComponentName: "ZOOKEEPER_SERVER", ServiceName: "ZOOKEEPER", Category: "MASTER", Cardinality: "1+"},
+			}},
+		},
+	}
+	tests := []struct {
+		name      string
+		blueprint string
+		stack     StackDefinition
+		issues    []BlueprintIssue
+	}{
+		{
+			name:      "invalid json",
+			blueprint: `{"Blueprints":`,
+			stack:     stack,
+			issues:    []BlueprintIssue{{Severity: BlueprintIssueError, Location: "", Message: "invalid json"}},
+		},
+		{
+			name:      "valid blueprint",
+			blueprint: `{"Blueprints":{"stack_name":"HDP","stack_version":"2.6"},"host_groups":[{"name":"master","cardinality":"1","components":[{"name":"NAMENODE"},{"name":"SECONDARY_NAMENODE"}]},{"name":"workers","cardinality":"3","components":[{"name":"DATANODE"}]}]}`,
+			stack:     stack,
+		},
+		{
+			name:      "missing sections without stack definition",
+			blueprint: `{"host_groups":[]}`,
+			issues: []BlueprintIssue{
+				{Severity: BlueprintIssueError, Location: "Blueprints", Message: "Blueprints section is missing"},
+				{Severity: BlueprintIssueError, Location: "host_groups", Message: "host_groups is missing"},
+			},
+		},
+		{
+			name:      "stack mismatch",
+			blueprint: `{"Blueprints":{"stack_name":"HDP","stack_version":"3.0"},"host_groups":[{"name":"master","cardinality":"1","components":[{"name":"NAMENODE"},{"name":"SECONDARY_NAMENODE"},{"name":"DATANODE"}]}]}`,
+			stack:     stack,
+			issues:    []BlueprintIssue{{Severity: BlueprintIssueError, Location: "Blueprints", Message: "does not match the stack definition HDP-2.6"}},
+		},
+		{
+			name:      "host group issues",
+			blueprint: `{"Blueprints":{"stack_name":"HDP","stack_version":"2.6"},"host_groups":[{"name":"master","cardinality":"2-1","components":[{"name":"NAMENODE"},{"name":"NAMENODE"},{"name":"UNKNOWN"}]},{"name":"master","components":[{"name":"SECONDARY_NAMENODE"},{"name":"DATANODE"}]}]}`,
+			stack:     stack,
+			issues: []BlueprintIssue{
+				{Severity: BlueprintIssueError, Location: "host_groups/master", Message: "invalid cardinality '2-1'"},
+				{Severity: BlueprintIssueError, Location: "host_groups/master", Message: "component UNKNOWN does not exist"},
+				{Severity: BlueprintIssueError, Location: "host_groups/master", Message: "duplicated host group name"},
+				{Severity: BlueprintIssueError, Location: "host_groups/master", Message: "cardinality is missing"},
+				{Severity: BlueprintIssueError, Location: "host_groups/master", Message: "DATANODE needs 1+ host(s), but the host groups have 0 host(s)"},
+				{Severity: BlueprintIssueError, Location: "host_groups/master", Message: "SECONDARY_NAMENODE needs 1 host(s), but the host groups have 0 host(s)"},
+				{Severity: BlueprintIssueWarning, Location: "host_groups/master", Message: "component NAMENODE is listed more than once"},
+			},
+		},
+		{
+			name:      "component cardinalities",
+			blueprint: `{"Blueprints":{"stack_name":"HDP","stack_version":"2.6"},"host_groups":[{"name":"masters","cardinality":3,"components":[{"name":"NAMENODE"},{"name":"SECONDARY_NAMENODE"}]}]}`,
+			stack:     stack,
+			issues: []BlueprintIssue{
+				{Severity: BlueprintIssueError, Location: "host_groups/masters", Message: "NAMENODE can have 1-2 host(s), but the host groups have 3 host(s)"},
+				{Severity: BlueprintIssueError, Location: "host_groups/masters", Message: "SECONDARY_NAMENODE can have 1 host(s), but the host groups have 3 host(s)"},
+				{Severity: BlueprintIssueWarning, Location: "host_groups", Message: "DATANODE is missing"},
+			},
+		},
+		{
+			name:      "dependencies",
+			blueprint: `{"Blueprints":{"stack_name":"HDP","stack_version":"2.6"},"host_groups":[{"name":"master","cardinality":"1","components":[{"name":"HBASE_MASTER"}]}]}`,
+			stack:     stack,
+			issues: []BlueprintIssue{
+				{Severity: BlueprintIssueError, Location: "host_groups/master", Message: "HBASE_MASTER depends on ZOOKEEPER_SERVER, but it is not in any host group"},
+				{Severity: BlueprintIssueWarning, Location: "host_groups/master", Message: "HBASE_MASTER needs to be co-located with HDFS_CLIENT (clients are auto-deployed by Ambari)"},
+			},
+		},
+	}
+	for _, test := range tests {
+		issues := ValidateBlueprint([]byte(test.blueprint), test.stack)
+		if len(issues) != len(test.issues) {
+			t.Errorf("%s: got %v issue(s), want %v: %+v", test.name, len(issues), len(test.issues), issues)
+			continue
+		}
+		for index, issue := range issues {
+			want := test.issues[index]
+			if issue.Severity != want.Severity || issue.Location != want.Location || !strings.Contains(issue.Message, want.Message) {
+				t.Errorf("%s: issue %v = %+v, want %+v", test.name, index, issue, want)
+			}
+		}
+	}
+}
+
+func TestCountBlueprintIssues(t *testing.T) {
+	issues := []BlueprintIssue{{Severity: BlueprintIssueError}, {Severity: BlueprintIssueWarning}, {Severity: BlueprintIssueError}}
+	if errors, warnings := CountBlueprintIssues(issues); errors != 2 || warnings != 1 {
+		t.Errorf("CountBlueprintIssues() = %v, %v, want 2, 1", errors, warnings)
+	}
+}
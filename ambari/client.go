@@ -16,50 +16,307 @@ package ambari
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"os"
+	"sync"
 	"time"
 )
 
+const (
+	// DefaultTimeout default response header timeout (in seconds) for Ambari REST calls
+	DefaultTimeout = 10
+	// DefaultRetryBackoff initial wait time between 2 retries, it is doubled after every attempt
+	DefaultRetryBackoff = 1 * time.Second
+)
+
+// RetryHandler is called before a failed request is retried (attempt starts from 1)
+type RetryHandler func(request *http.Request, attempt int, maxAttempts int, backoff time.Duration, err error)
+
+var (
+	// DefaultRetryHandler is used by the new REST clients for reporting retries, by default it prints to stderr (set it to nil to turn off the messages)
+	DefaultRetryHandler RetryHandler = printRetryToStderr
+
+	clientCache     = make(map[string]*Client)
+	clientCacheLock sync.Mutex
+	defaultClient   = &Client{HttpClient: GetHttpClient(), RetryBackoff: DefaultRetryBackoff, OnRetry: DefaultRetryHandler}
+)
+
+// Client is a reusable, context aware REST client for a specific Ambari server entry
+type Client struct {
+	Registry     AmbariRegistry
+	HttpClient   *http.Client
+	MaxRetries   int
+	RetryBackoff time.Duration
+	OnRetry      RetryHandler
+}
+
+// NewClient creates a REST client based on the timeout, retry and TLS settings of an ambari server entry
+func NewClient(registry AmbariRegistry) (*Client, error) {
+	timeout := time.Duration(registry.Timeout) * time.Second
+	if registry.Timeout <= 0 {
+		timeout = DefaultTimeout * time.Second
+	}
+	tlsConfig, err := CreateTLSConfig(registry.TLS)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       30 * time.Second,
+			ResponseHeaderTimeout: timeout,
+			TLSHandshakeTimeout:   10 * time.Second,
+			TLSClientConfig:       tlsConfig,
+		},
+	}
+	return &Client{Registry: registry, HttpClient: httpClient, MaxRetries: registry.Retries, RetryBackoff: DefaultRetryBackoff, OnRetry: DefaultRetryHandler}, nil
+}
+
+// CreateTLSConfig creates a TLS client configuration: server certificates are verified against the system roots (+ the CA bundle if it is set),
+// a client certificate is used if both the certificate and the key paths are set, verification can be turned off only with the Insecure flag
+func CreateTLSConfig(settings TLSSettings) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: settings.ServerName, InsecureSkipVerify: settings.Insecure}
+	if len(settings.CACertPath) > 0 {
+		caCerts, err := ioutil.ReadFile(settings.CACertPath)
+		if err != nil {
+			return nil, err
+		}
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil || rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(caCerts) {
+			return nil, fmt.Errorf("no PEM certificates found in CA bundle '%s'", settings.CACertPath)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	if len(settings.ClientCertPath) > 0 || len(settings.ClientKeyPath) > 0 {
+		if len(settings.ClientCertPath) == 0 || len(settings.ClientKeyPath) == 0 {
+			return nil, errors.New("both client certificate and client key are required for TLS client authentication")
+		}
+		clientCert, err := tls.LoadX509KeyPair(settings.ClientCertPath, settings.ClientKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+	return tlsConfig, nil
+}
+
+// WithContext returns a copy of the ambari server entry, REST calls made through the copy will use the provided context (background context if it is nil)
+func (a AmbariRegistry) WithContext(ctx context.Context) AmbariRegistry {
+	a.ctx = ctx
+	return a
+}
+
+// Context returns the context of the ambari server entry (background context if it was not set)
+func (a AmbariRegistry) Context() context.Context {
+	if a.ctx != nil {
+		return a.ctx
+	}
+	return context.Background()
+}
+
+// GetClient returns a (cached) REST client for the ambari server entry
+func (a AmbariRegistry) GetClient() (*Client, error) {
+	key := fmt.Sprintf("%s|%s|%s|%v|%v|%v|%+v", a.Name, a.Protocol, a.Hostname, a.Port, a.Timeout, a.Retries, a.TLS)
+	clientCacheLock.Lock()
+	defer clientCacheLock.Unlock()
+	if client, ok := clientCache[key]; ok {
+		return client, nil
+	}
+	client, err := NewClient(a)
+	if err != nil {
+		return nil, err
+	}
+	clientCache[key] = client
+	return client, nil
+}
+
+// Get sends a GET request to the Ambari REST API and returns the response body
+func (c *Client) Get(ctx context.Context, urlSuffix string, useCluster bool) ([]byte, error) {
+	request, err := c.Registry.CreateGetRequest(urlSuffix, useCluster)
+	if err != nil {
+		return nil, err
+	}
+	return c.ProcessRequest(ctx, request)
+}
+
+// Post sends a POST request to the Ambari REST API and returns the response body
+func (c *Client) Post(ctx context.Context, body bytes.Buffer, urlSuffix string, useCluster bool) ([]byte, error) {
+	request, err := c.Registry.CreatePostRequest(body, urlSuffix, useCluster)
+	if err != nil {
+		return nil, err
+	}
+	return c.ProcessRequest(ctx, request)
+}
+
+// Put sends a PUT request to the Ambari REST API and returns the response body
+func (c *Client) Put(ctx context.Context, body bytes.Buffer, urlSuffix string, useCluster bool) ([]byte, error) {
+	request, err := c.Registry.CreatePutRequest(body, urlSuffix, useCluster)
+	if err != nil {
+		return nil, err
+	}
+	return c.ProcessRequest(ctx, request)
+}
+
+// ProcessAmbariItems get "items" from Ambari response
+func (c *Client) ProcessAmbariItems(ctx context.Context, request *http.Request) (AmbariItems, error) {
+	var ambariItems AmbariItems
+	bodyBytes, err := c.ProcessRequest(ctx, request)
+	if err != nil {
+		return ambariItems, err
+	}
+	err = json.Unmarshal(bodyBytes, &ambariItems)
+	if err != nil {
+		return ambariItems, err
+	}
+	return ambariItems, nil
+}
+
+// ProcessAsMap get map format response
+func (c *Client) ProcessAsMap(ctx context.Context, request *http.Request) (map[string]interface{}, error) {
+	bodyBytes, err := c.ProcessRequest(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	var responseMap map[string]interface{}
+	err = json.Unmarshal(bodyBytes, &responseMap)
+	if err != nil {
+		return nil, err
+	}
+	return responseMap, nil
+}
+
+// ProcessRequest get a simple response from a REST call, returns an *AmbariAPIError if the response status code is >= 400.
+// Connection errors and 5xx responses of idempotent requests are retried with exponential backoff, until MaxRetries is reached or ctx is done.
+// POST requests are retried only if the connection could not be established (nothing was sent to Ambari).
+func (c *Client) ProcessRequest(ctx context.Context, request *http.Request) ([]byte, error) {
+	backoff := c.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		bodyBytes, retryable, err := c.doRequest(ctx, request)
+		if err == nil || !retryable || attempt >= c.MaxRetries || ctx.Err() != nil {
+			return bodyBytes, err
+		}
+		if c.OnRetry != nil {
+			c.OnRetry(request, attempt+1, c.MaxRetries+1, backoff, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = backoff * 2
+		if request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			request.Body = body
+		}
+	}
+}
+
+// doRequest sends the request once, the returned flag shows that the request can be retried:
+// connection errors, body read errors or 5xx responses for non-POST requests, dial errors (before anything was written) for POST requests
+func (c *Client) doRequest(ctx context.Context, request *http.Request) ([]byte, bool, error) {
+	idempotent := request.Method != "POST"
+	wroteRequest := false
+	trace := &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			wroteRequest = true
+		},
+	}
+	response, err := c.HttpClient.Do(request.WithContext(httptrace.WithClientTrace(ctx, trace)))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, false, ctx.Err()
+		}
+		return nil, idempotent || (!wroteRequest && isDialError(err)), err
+	}
+	defer response.Body.Close()
+	bodyBytes, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, idempotent, err
+	}
+	if response.StatusCode >= 400 {
+		apiErr := &AmbariAPIError{Method: request.Method, URL: request.URL.String(), StatusCode: response.StatusCode, Body: string(bodyBytes)}
+		return nil, response.StatusCode >= 500 && idempotent, apiErr
+	}
+	return bodyBytes, false, nil
+}
+
+// isDialError checks that a request failed while connecting to the server (e.g.: connection refused), so the request was not sent
+func isDialError(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	opErr, ok := err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
+
+func printRetryToStderr(request *http.Request, attempt int, maxAttempts int, backoff time.Duration, err error) {
+	fmt.Fprintln(os.Stderr, fmt.Sprintf("Request %s %s failed (attempt %v/%v), retry in %v: %v", request.Method, request.URL.String(), attempt, maxAttempts, backoff, err))
+}
+
 // CreateGetRequest creates an Ambari GET request
-func (a AmbariRegistry) CreateGetRequest(urlSuffix string, useCluster bool) *http.Request {
+func (a AmbariRegistry) CreateGetRequest(urlSuffix string, useCluster bool) (*http.Request, error) {
 	uri := a.GetAmbariUri(urlSuffix, useCluster)
 	request, err := http.NewRequest("GET", uri, nil)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	request.Header.Add("Content-Type", "application/json")
 	request.SetBasicAuth(a.Username, a.Password)
-	return request
+	return request.WithContext(a.Context()), nil
 }
 
 // CreatePostRequest creates an Ambari POST request with body
-func (a AmbariRegistry) CreatePostRequest(body bytes.Buffer, urlSuffix string, useCluster bool) *http.Request {
+func (a AmbariRegistry) CreatePostRequest(body bytes.Buffer, urlSuffix string, useCluster bool) (*http.Request, error) {
 	uri := a.GetAmbariUri(urlSuffix, useCluster)
 	request, err := http.NewRequest("POST", uri, &body)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	//request.Header.Add("Content-Type", "application/json")
 	request.Header.Add("X-Requested-By", "ambari")
 	request.SetBasicAuth(a.Username, a.Password)
-	return request
+	return request.WithContext(a.Context()), nil
 }
 
 // CreatePutRequest creates an Ambari PUT request with body
-func (a AmbariRegistry) CreatePutRequest(body bytes.Buffer, urlSuffix string, useCluster bool) *http.Request {
+func (a AmbariRegistry) CreatePutRequest(body bytes.Buffer, urlSuffix string, useCluster bool) (*http.Request, error) {
 	uri := a.GetAmbariUri(urlSuffix, useCluster)
 	request, err := http.NewRequest("PUT", uri, &body)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	request.Header.Add("X-Requested-By", "ambari")
 	request.SetBasicAuth(a.Username, a.Password)
-	return request
+	return request.WithContext(a.Context()), nil
+}
+
+// CreateDeleteRequest creates an Ambari DELETE request
+func (a AmbariRegistry) CreateDeleteRequest(urlSuffix string, useCluster bool) (*http.Request, error) {
+	uri := a.GetAmbariUri(urlSuffix, useCluster)
+	request, err := http.NewRequest("DELETE", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add("X-Requested-By", "ambari")
+	request.SetBasicAuth(a.Username, a.Password)
+	return request.WithContext(a.Context()), nil
 }
 
 // GetAmbariUri creates the Ambari uri with /api/v1/ suffix (+ /api/v1/clusters/<cluster> suffix is useCluster is enabled)
@@ -70,69 +327,47 @@ func (a AmbariRegistry) GetAmbariUri(uriSuffix string, useCluster bool) string {
 	return fmt.Sprintf("%s://%s:%v/api/v1/%s", a.Protocol, a.Hostname, a.Port, uriSuffix)
 }
 
-// GetHttpClient create HTTP client instance for Ambari
+// GetHttpClient create HTTP client instance for Ambari (with default timeouts and TLS settings)
 func GetHttpClient() *http.Client {
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			Proxy:                 http.ProxyFromEnvironment,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       30 * time.Second,
-			ResponseHeaderTimeout: 10 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
-		},
-	}
-	return httpClient
+	client, _ := NewClient(AmbariRegistry{})
+	return client.HttpClient
 }
 
 // ProcessAmbariItems get "items" from Ambari response
-func ProcessAmbariItems(request *http.Request) AmbariItems {
-	bodyBytes := ProcessRequest(request)
-	var ambariItems AmbariItems
-	err := json.Unmarshal(bodyBytes, &ambariItems)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-	return ambariItems
+func ProcessAmbariItems(request *http.Request) (AmbariItems, error) {
+	return defaultClient.ProcessAmbariItems(request.Context(), request)
 }
 
 // ProcessAsMap get map format response
-func ProcessAsMap(request *http.Request) map[string]interface{} {
-	bodyBytes := ProcessRequest(request)
-	var responseMap map[string]interface{}
-	err := json.Unmarshal(bodyBytes, &responseMap)
+func ProcessAsMap(request *http.Request) (map[string]interface{}, error) {
+	return defaultClient.ProcessAsMap(request.Context(), request)
+}
+
+// ProcessRequest get a simple response from a REST call, returns an *AmbariAPIError if the response status code is >= 400
+func ProcessRequest(request *http.Request) ([]byte, error) {
+	return defaultClient.ProcessRequest(request.Context(), request)
+}
+
+func (a AmbariRegistry) processAmbariItems(request *http.Request) (AmbariItems, error) {
+	client, err := a.GetClient()
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return AmbariItems{}, err
 	}
-	return responseMap
+	return client.ProcessAmbariItems(a.Context(), request)
 }
 
-// ProcessRequest get a simple response from a REST call
-func ProcessRequest(request *http.Request) []byte {
-	client := GetHttpClient()
-	response, err := client.Do(request)
+func (a AmbariRegistry) processAsMap(request *http.Request) (map[string]interface{}, error) {
+	client, err := a.GetClient()
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return nil, err
 	}
-	defer response.Body.Close()
-	if response.StatusCode >= 400 {
-		errorResponseMessage := fmt.Sprintf("Response status code: %v", response.StatusCode)
-		fmt.Println(errorResponseMessage)
-		bodyBytes, err := ioutil.ReadAll(response.Body)
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-		fmt.Println(string(bodyBytes))
-		os.Exit(1)
-	}
-	bodyBytes, err := ioutil.ReadAll(response.Body)
+	return client.ProcessAsMap(a.Context(), request)
+}
+
+func (a AmbariRegistry) processRequest(request *http.Request) ([]byte, error) {
+	client, err := a.GetClient()
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return nil, err
 	}
-	return bodyBytes
+	return client.ProcessRequest(a.Context(), request)
 }
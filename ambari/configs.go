@@ -0,0 +1,338 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// configurationsBatchSize max number of config types which are requested in one configurations request
+const configurationsBatchSize = 20
+
+type desiredConfigsResponse struct {
+	Clusters struct {
+		DesiredConfigs map[string]struct {
+			Tag     string  `json:"tag"`
+			Version float64 `json:"version"`
+		} `json:"desired_configs"`
+	} `json:"Clusters"`
+}
+
+type configurationsResponse struct {
+	Items []Configuration `json:"items"`
+}
+
+type serviceConfigVersionsResponse struct {
+	Items []ServiceConfigVersion `json:"items"`
+}
+
+type configGroupsResponse struct {
+	Items []struct {
+		ConfigGroup ConfigGroup `json:"ConfigGroup"`
+	} `json:"items"`
+}
+
+// GetDesiredConfigTag obtain the tag of the current (desired) configuration of a config type
+func (a AmbariRegistry) GetDesiredConfigTag(configType string) (string, error) {
+	request, err := a.CreateGetRequest("?fields=Clusters/desired_configs", true)
+	if err != nil {
+		return "", err
+	}
+	bodyBytes, err := a.processRequest(request)
+	if err != nil {
+		return "", err
+	}
+	var response desiredConfigsResponse
+	if err := json.Unmarshal(bodyBytes, &response); err != nil {
+		return "", err
+	}
+	desiredConfig, ok := response.Clusters.DesiredConfigs[configType]
+	if !ok {
+		return "", fmt.Errorf("config type '%s' does not exist in cluster '%s'", configType, a.Cluster)
+	}
+	return desiredConfig.Tag, nil
+}
+
+// GetConfiguration obtain the properties (and property attributes) of a config type with a specific tag
+func (a AmbariRegistry) GetConfiguration(configType string, tag string) (Configuration, error) {
+	uriSuffix := fmt.Sprintf("configurations?type=%s&tag=%s", url.QueryEscape(configType), url.QueryEscape(tag))
+	request, err := a.CreateGetRequest(uriSuffix, true)
+	if err != nil {
+		return Configuration{}, err
+	}
+	bodyBytes, err := a.processRequest(request)
+	if err != nil {
+		return Configuration{}, err
+	}
+	var response configurationsResponse
+	if err := json.Unmarshal(bodyBytes, &response); err != nil {
+		return Configuration{}, err
+	}
+	if len(response.Items) == 0 {
+		return Configuration{}, fmt.Errorf("configuration '%s' with tag '%s' does not exist", configType, tag)
+	}
+	configuration := response.Items[0]
+	if configuration.Properties == nil {
+		configuration.Properties = make(map[string]string)
+	}
+	return configuration, nil
+}
+
+// GetDesiredConfigurations obtain the current (desired) configurations of all of the config types of the cluster
+func (a AmbariRegistry) GetDesiredConfigurations() (map[string]Configuration, error) {
+	request, err := a.CreateGetRequest("?fields=Clusters/desired_configs", true)
+	if err != nil {
+		return nil, err
+	}
+	bodyBytes, err := a.processRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	var response desiredConfigsResponse
+	if err := json.Unmarshal(bodyBytes, &response); err != nil {
+		return nil, err
+	}
+	var predicates []string
+	for configType, desiredConfig := range response.Clusters.DesiredConfigs {
+		predicates = append(predicates, fmt.Sprintf("(type=%s&tag=%s)", url.QueryEscape(configType), url.QueryEscape(desiredConfig.Tag)))
+	}
+	sort.Strings(predicates)
+	configurations := make(map[string]Configuration)
+	for start := 0; start < len(predicates); start += configurationsBatchSize {
+		end := start + configurationsBatchSize
+		if end > len(predicates) {
+			end = len(predicates)
+		}
+		request, err := a.CreateGetRequest("configurations?"+strings.Join(predicates[start:end], "|"), true)
+		if err != nil {
+			return nil, err
+		}
+		bodyBytes, err := a.processRequest(request)
+		if err != nil {
+			return nil, err
+		}
+		var response configurationsResponse
+		if err := json.Unmarshal(bodyBytes, &response); err != nil {
+			return nil, err
+		}
+		for _, configuration := range response.Items {
+			configurations[configuration.Type] = configuration
+		}
+	}
+	return configurations, nil
+}
+
+// GetServiceConfigVersion obtain a specific service config version of a service (with the configurations)
+func (a AmbariRegistry) GetServiceConfigVersion(service string, version int) (ServiceConfigVersion, error) {
+	uriSuffix := fmt.Sprintf("configurations/service_config_versions?service_name=%s&service_config_version=%v&fields=*", url.QueryEscape(service), version)
+	request, err := a.CreateGetRequest(uriSuffix, true)
+	if err != nil {
+		return ServiceConfigVersion{}, err
+	}
+	bodyBytes, err := a.processRequest(request)
+	if err != nil {
+		return ServiceConfigVersion{}, err
+	}
+	var response serviceConfigVersionsResponse
+	if err := json.Unmarshal(bodyBytes, &response); err != nil {
+		return ServiceConfigVersion{}, err
+	}
+	if len(response.Items) == 0 {
+		return ServiceConfigVersion{}, fmt.Errorf("service config version %v does not exist for service '%s'", version, service)
+	}
+	return response.Items[0], nil
+}
+
+// GetDesiredConfiguration obtain the current (desired) configuration of a config type
+func (a AmbariRegistry) GetDesiredConfiguration(configType string) (Configuration, error) {
+	tag, err := a.GetDesiredConfigTag(configType)
+	if err != nil {
+		return Configuration{}, err
+	}
+	return a.GetConfiguration(configType, tag)
+}
+
+// PutDesiredConfiguration saves a configuration with a new tag as the desired configuration of the cluster (creates a new service config version with a note)
+func (a AmbariRegistry) PutDesiredConfiguration(configuration Configuration, versionNote string) error {
+	desiredConfig := map[string]interface{}{
+		"type":                        configuration.Type,
+		"tag":                         newConfigTag(),
+		"properties":                  configuration.Properties,
+		"service_config_version_note": versionNote,
+	}
+	if len(configuration.PropertiesAttributes) > 0 {
+		desiredConfig["properties_attributes"] = configuration.PropertiesAttributes
+	}
+	body, err := json.Marshal(map[string]interface{}{"Clusters": map[string]interface{}{"desired_config": desiredConfig}})
+	if err != nil {
+		return err
+	}
+	request, err := a.CreatePutRequest(*bytes.NewBuffer(body), "clusters/"+a.Cluster, false)
+	if err != nil {
+		return err
+	}
+	_, err = a.processRequest(request)
+	return err
+}
+
+// GetConfigGroup obtain a config group by name
+func (a AmbariRegistry) GetConfigGroup(groupName string) (ConfigGroup, error) {
+	request, err := a.CreateGetRequest(fmt.Sprintf("config_groups?ConfigGroup/group_name=%s&fields=*", url.QueryEscape(groupName)), true)
+	if err != nil {
+		return ConfigGroup{}, err
+	}
+	bodyBytes, err := a.processRequest(request)
+	if err != nil {
+		return ConfigGroup{}, err
+	}
+	var response configGroupsResponse
+	if err := json.Unmarshal(bodyBytes, &response); err != nil {
+		return ConfigGroup{}, err
+	}
+	if len(response.Items) == 0 {
+		return ConfigGroup{}, fmt.Errorf("config group '%s' does not exist in cluster '%s'", groupName, a.Cluster)
+	}
+	if len(response.Items) > 1 {
+		return ConfigGroup{}, fmt.Errorf("config group name '%s' is ambiguous (%v config groups found)", groupName, len(response.Items))
+	}
+	return response.Items[0].ConfigGroup, nil
+}
+
+// UpdateConfig sets and deletes properties of a config type (cluster level or config group level), the change is saved as a new config version
+func (a AmbariRegistry) UpdateConfig(update ConfigUpdate) error {
+	if len(update.ConfigType) == 0 {
+		return errors.New("config type is required for updating configurations")
+	}
+	if len(update.Set) == 0 && len(update.Delete) == 0 {
+		return fmt.Errorf("no config keys to set or delete for config type '%s'", update.ConfigType)
+	}
+	if len(update.VersionNote) == 0 {
+		update.VersionNote = createVersionNote(update)
+	}
+	if len(update.ConfigGroup) > 0 {
+		return a.updateConfigGroup(update)
+	}
+	configuration, err := a.GetDesiredConfiguration(update.ConfigType)
+	if err != nil {
+		return err
+	}
+	if !applyConfigUpdate(&configuration, update) {
+		fmt.Println(fmt.Sprintf("No changes for config type '%s', skipping update", update.ConfigType))
+		return nil
+	}
+	if err := a.PutDesiredConfiguration(configuration, update.VersionNote); err != nil {
+		return err
+	}
+	fmt.Println(fmt.Sprintf("Config type '%s' has been updated (%s)", update.ConfigType, update.VersionNote))
+	return nil
+}
+
+func (a AmbariRegistry) updateConfigGroup(update ConfigUpdate) error {
+	configGroup, err := a.GetConfigGroup(update.ConfigGroup)
+	if err != nil {
+		return err
+	}
+	configuration := Configuration{Type: update.ConfigType, Properties: make(map[string]string)}
+	desiredConfigIndex := -1
+	for index, desiredConfig := range configGroup.DesiredConfigs {
+		if desiredConfig.Type == update.ConfigType {
+			desiredConfigIndex = index
+			if configuration, err = a.GetConfiguration(desiredConfig.Type, desiredConfig.Tag); err != nil {
+				return err
+			}
+		}
+	}
+	if !applyConfigUpdate(&configuration, update) {
+		fmt.Println(fmt.Sprintf("No changes for config type '%s' in config group '%s', skipping update", update.ConfigType, update.ConfigGroup))
+		return nil
+	}
+	newDesiredConfig := ConfigGroupDesiredConfig{Type: update.ConfigType, Tag: newConfigTag(), Properties: configuration.Properties,
+		PropertiesAttributes: configuration.PropertiesAttributes, VersionNote: update.VersionNote}
+	var desiredConfigs []ConfigGroupDesiredConfig
+	for index, desiredConfig := range configGroup.DesiredConfigs {
+		if index != desiredConfigIndex {
+			desiredConfigs = append(desiredConfigs, ConfigGroupDesiredConfig{Type: desiredConfig.Type, Tag: desiredConfig.Tag})
+		}
+	}
+	configGroup.DesiredConfigs = append(desiredConfigs, newDesiredConfig)
+	groupId := configGroup.ID
+	configGroup.ID = 0
+	body, err := json.Marshal(map[string]interface{}{"ConfigGroup": configGroup})
+	if err != nil {
+		return err
+	}
+	request, err := a.CreatePutRequest(*bytes.NewBuffer(body), fmt.Sprintf("config_groups/%v", groupId), true)
+	if err != nil {
+		return err
+	}
+	if _, err := a.processRequest(request); err != nil {
+		return err
+	}
+	fmt.Println(fmt.Sprintf("Config type '%s' has been updated in config group '%s' (%s)", update.ConfigType, update.ConfigGroup, update.VersionNote))
+	return nil
+}
+
+// applyConfigUpdate sets / deletes the properties (and the attributes of the deleted properties), returns false if nothing has been changed
+func applyConfigUpdate(configuration *Configuration, update ConfigUpdate) bool {
+	changed := false
+	for key, value := range update.Set {
+		if oldValue, ok := configuration.Properties[key]; !ok || oldValue != value {
+			configuration.Properties[key] = value
+			changed = true
+		}
+	}
+	for _, key := range update.Delete {
+		if _, ok := configuration.Properties[key]; !ok {
+			fmt.Println(fmt.Sprintf("Config key '%s' does not exist in config type '%s', skipping delete", key, update.ConfigType))
+			continue
+		}
+		delete(configuration.Properties, key)
+		for attributeName, attributes := range configuration.PropertiesAttributes {
+			delete(attributes, key)
+			if len(attributes) == 0 {
+				delete(configuration.PropertiesAttributes, attributeName)
+			}
+		}
+		changed = true
+	}
+	return changed
+}
+
+func createVersionNote(update ConfigUpdate) string {
+	var changes []string
+	if len(update.Set) > 0 {
+		var keys []string
+		for key := range update.Set {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		changes = append(changes, "update config keys: "+strings.Join(keys, ", "))
+	}
+	if len(update.Delete) > 0 {
+		changes = append(changes, "delete config keys: "+strings.Join(update.Delete, ", "))
+	}
+	return "AMBARICTL - " + strings.Join(changes, "; ")
+}
+
+func newConfigTag() string {
+	return fmt.Sprintf("version%v", time.Now().UnixNano()/int64(time.Millisecond))
+}
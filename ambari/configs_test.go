@@ -0,0 +1,188 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testAmbariRegistry returns an ambari server entry (with 'cl1' cluster) for an Ambari API stub
+func testAmbariRegistry(t *testing.T, server *httptest.Server) AmbariRegistry {
+	serverUrl, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(serverUrl.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return AmbariRegistry{Name: "stub", Hostname: serverUrl.Hostname(), Port: port, Protocol: "http", Cluster: "cl1", Username: "admin", Password: "admin"}
+}
+
+// configsStub serves the desired configs, the configurations and the config groups of the 'cl1' cluster, and records the bodies of the PUT requests by path
+type configsStub struct {
+	desiredTags    map[string]string
+	configurations map[string]Configuration
+	configGroup    ConfigGroup
+	mutex          sync.Mutex
+	puts           map[string]map[string]interface{}
+}
+
+func (s *configsStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch {
+	case r.Method == "PUT":
+		var body map[string]interface{}
+		content, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(content, &body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.puts[r.URL.Path] = body
+	case r.URL.Path == "/api/v1/clusters/cl1/" && r.URL.Query().Get("fields") == "Clusters/desired_configs":
+		desiredConfigs := make(map[string]interface{})
+		for configType, tag := range s.desiredTags {
+			desiredConfigs[configType] = map[string]interface{}{"tag": tag, "version": 1}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"Clusters": map[string]interface{}{"desired_configs": desiredConfigs}})
+	case r.URL.Path == "/api/v1/clusters/cl1/configurations":
+		var items []Configuration
+		if configuration, ok := s.configurations[r.URL.Query().Get("type")+"/"+r.URL.Query().Get("tag")]; ok {
+			items = append(items, configuration)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+	case r.URL.Path == "/api/v1/clusters/cl1/config_groups" && r.URL.Query().Get("ConfigGroup/group_name") == s.configGroup.GroupName:
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": []interface{}{map[string]interface{}{"ConfigGroup": s.configGroup}}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newConfigsStub() *configsStub {
+	return &configsStub{
+		desiredTags: map[string]string{"hdfs-site": "version1"},
+		configurations: map[string]Configuration{
+			"hdfs-site/version1": {Type: "hdfs-site", Tag: "version1",
+				Properties:           map[string]string{"dfs.replication": "3", "dfs.namenode.name.dir": "/hadoop/hdfs/namenode", "dfs.hosts.exclude": "/etc/hadoop/conf/dfs.exclude"},
+				PropertiesAttributes: map[string]map[string]string{"final": {"dfs.namenode.name.dir": "true", "dfs.hosts.exclude": "true"}}},
+			"hdfs-site/group2": {Type: "hdfs-site", Tag: "group2",
+				Properties:           map[string]string{"dfs.datanode.data.dir": "/data1"},
+				PropertiesAttributes: map[string]map[string]string{"final": {"dfs.datanode.data.dir": "true"}}},
+		},
+		configGroup: ConfigGroup{ID: 5, ClusterName: "cl1", GroupName: "ssd-nodes", Tag: "HDFS", Hosts: []ConfigGroupHost{{HostName: "c7202.ambari.apache.org"}},
+			DesiredConfigs: []ConfigGroupDesiredConfig{{Type: "core-site", Tag: "group1"}, {Type: "hdfs-site", Tag: "group2"}}},
+		puts: make(map[string]map[string]interface{}),
+	}
+}
+
+func TestUpdateConfig(t *testing.T) {
+	stub := newConfigsStub()
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	ambariServer := testAmbariRegistry(t, server)
+
+	update := ConfigUpdate{ConfigType: "hdfs-site", Set: map[string]string{"dfs.replication": "2"}, Delete: []string{"dfs.hosts.exclude"}}
+	if err := ambariServer.UpdateConfig(update); err != nil {
+		t.Fatal(err)
+	}
+	body, ok := stub.puts["/api/v1/clusters/cl1"]
+	if !ok {
+		t.Fatalf("desired config is not updated, PUT requests: %v", stub.puts)
+	}
+	desiredConfig := body["Clusters"].(map[string]interface{})["desired_config"].(map[string]interface{})
+	expectedProperties := map[string]interface{}{"dfs.replication": "2", "dfs.namenode.name.dir": "/hadoop/hdfs/namenode"}
+	if !reflect.DeepEqual(desiredConfig["properties"], expectedProperties) {
+		t.Errorf("properties = %v, want %v", desiredConfig["properties"], expectedProperties)
+	}
+	// the attributes of the deleted property are removed, the others are kept
+	expectedAttributes := map[string]interface{}{"final": map[string]interface{}{"dfs.namenode.name.dir": "true"}}
+	if !reflect.DeepEqual(desiredConfig["properties_attributes"], expectedAttributes) {
+		t.Errorf("properties_attributes = %v, want %v", desiredConfig["properties_attributes"], expectedAttributes)
+	}
+	if note := desiredConfig["service_config_version_note"]; note != "AMBARICTL - update config keys: dfs.replication; delete config keys: dfs.hosts.exclude" {
+		t.Errorf("unexpected version note: %v", note)
+	}
+	if tag, _ := desiredConfig["tag"].(string); !strings.HasPrefix(tag, "version") || tag == "version1" {
+		t.Errorf("expected a new config tag, got %q", tag)
+	}
+
+	// unchanged values do not create a new config version
+	stub.puts = make(map[string]map[string]interface{})
+	if err := ambariServer.UpdateConfig(ConfigUpdate{ConfigType: "hdfs-site", Set: map[string]string{"dfs.replication": "3"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(stub.puts) > 0 {
+		t.Errorf("no PUT request expected for an unchanged config, got %v", stub.puts)
+	}
+	if err := ambariServer.UpdateConfig(ConfigUpdate{ConfigType: "yarn-site", Set: map[string]string{"yarn.acl.enable": "true"}}); err == nil {
+		t.Errorf("expected an error for a missing config type")
+	}
+}
+
+func TestUpdateConfigGroup(t *testing.T) {
+	stub := newConfigsStub()
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	ambariServer := testAmbariRegistry(t, server)
+
+	update := ConfigUpdate{ConfigType: "hdfs-site", ConfigGroup: "ssd-nodes", Set: map[string]string{"dfs.datanode.failed.volumes.tolerated": "1"}}
+	if err := ambariServer.UpdateConfig(update); err != nil {
+		t.Fatal(err)
+	}
+	body, ok := stub.puts["/api/v1/clusters/cl1/config_groups/5"]
+	if !ok {
+		t.Fatalf("config group is not updated, PUT requests: %v", stub.puts)
+	}
+	configGroup := body["ConfigGroup"].(map[string]interface{})
+	if _, ok := configGroup["id"]; ok {
+		t.Errorf("config group id should not be sent in the update")
+	}
+	if hosts := fmt.Sprint(configGroup["hosts"]); hosts != "[map[host_name:c7202.ambari.apache.org]]" {
+		t.Errorf("config group hosts are not kept: %v", hosts)
+	}
+	desiredConfigs := configGroup["desired_configs"].([]interface{})
+	if len(desiredConfigs) != 2 {
+		t.Fatalf("expected 2 desired configs, got %v", desiredConfigs)
+	}
+	// other overridden config types keep their tags, the updated one gets a new tag with the full override
+	if coreSite := desiredConfigs[0].(map[string]interface{}); coreSite["type"] != "core-site" || coreSite["tag"] != "group1" || coreSite["properties"] != nil {
+		t.Errorf("unexpected core-site override: %v", coreSite)
+	}
+	hdfsSite := desiredConfigs[1].(map[string]interface{})
+	expectedProperties := map[string]interface{}{"dfs.datanode.data.dir": "/data1", "dfs.datanode.failed.volumes.tolerated": "1"}
+	if hdfsSite["type"] != "hdfs-site" || hdfsSite["tag"] == "group2" || !reflect.DeepEqual(hdfsSite["properties"], expectedProperties) {
+		t.Errorf("unexpected hdfs-site override: %v", hdfsSite)
+	}
+	expectedAttributes := map[string]interface{}{"final": map[string]interface{}{"dfs.datanode.data.dir": "true"}}
+	if !reflect.DeepEqual(hdfsSite["properties_attributes"], expectedAttributes) {
+		t.Errorf("properties_attributes of the override = %v, want %v", hdfsSite["properties_attributes"], expectedAttributes)
+	}
+	if _, ok := stub.puts["/api/v1/clusters/cl1"]; ok {
+		t.Errorf("cluster level config should not be changed by a config group update")
+	}
+	if err := ambariServer.UpdateConfig(ConfigUpdate{ConfigType: "hdfs-site", ConfigGroup: "missing", Set: map[string]string{"a": "b"}}); err == nil {
+		t.Errorf("expected an error for a missing config group")
+	}
+}
@@ -15,6 +15,7 @@
 package ambari
 
 import (
+	"strconv"
 	"strings"
 )
 
@@ -26,6 +27,11 @@ func (a AmbariItems) ConvertResponse() Response {
 	components := []Component{}
 	hostComponents := []HostComponent{}
 	serviceConfigs := []ServiceConfig{}
+	alerts := []Alert{}
+	alertHistory := []AlertHistory{}
+	alertDefinitions := []AlertDefinition{}
+	stackServices := []StackService{}
+	stackVersions := []StackVersion{}
 	clusterInfo := Cluster{}
 	clusterInfo = a.Cluster
 	stackConfigs := make(map[string]StackConfig)
@@ -36,6 +42,11 @@ func (a AmbariItems) ConvertResponse() Response {
 		hostComponents = createHostComponentsType(item, hostComponents)
 		serviceConfigs = createServiceConfigsType(item, serviceConfigs)
 		stackConfigs = createStackConfigsType(item, stackConfigs)
+		alerts = createAlertsType(item, alerts)
+		alertHistory = createAlertHistoryType(item, alertHistory)
+		alertDefinitions = createAlertDefinitionsType(item, alertDefinitions)
+		stackServices = createStackServicesType(item, stackServices)
+		stackVersions = createStackVersionsType(item, stackVersions)
 	}
 	if len(hosts) > 0 {
 		response.Hosts = hosts
@@ -58,6 +69,21 @@ func (a AmbariItems) ConvertResponse() Response {
 	if len(stackConfigs) > 0 {
 		response.StackConfigs = stackConfigs
 	}
+	if len(alerts) > 0 {
+		response.Alerts = alerts
+	}
+	if len(alertHistory) > 0 {
+		response.AlertHistory = alertHistory
+	}
+	if len(alertDefinitions) > 0 {
+		response.AlertDefinitions = alertDefinitions
+	}
+	if len(stackServices) > 0 {
+		response.StackServices = stackServices
+	}
+	if len(stackVersions) > 0 {
+		response.StackVersions = stackVersions
+	}
 	return response
 }
 
@@ -129,6 +155,9 @@ func createComponentsType(item Item, components []Component) []Component {
 		if state, ok := componentI["state"]; ok {
 			component.ComponentState = state.(string)
 		}
+		if category, ok := componentI["category"]; ok {
+			component.Category = category.(string)
+		}
 
 		components = append(components, component)
 	}
@@ -148,6 +177,21 @@ func createHostComponentsType(item Item, hostComponents []HostComponent) []HostC
 		if state, ok := hostComponentI["state"]; ok {
 			hostComponent.HostComponentState = state.(string)
 		}
+		if serviceName, ok := hostComponentI["service_name"]; ok {
+			hostComponent.ServiceName = serviceName.(string)
+		}
+		if desiredState, ok := hostComponentI["desired_state"]; ok {
+			hostComponent.DesiredState = desiredState.(string)
+		}
+		if staleConfigs, ok := hostComponentI["stale_configs"]; ok {
+			hostComponent.StaleConfigs = staleConfigs.(bool)
+		}
+		if maintenanceState, ok := hostComponentI["maintenance_state"]; ok {
+			hostComponent.MaintenanceState = maintenanceState.(string)
+		}
+		if desiredAdminState, ok := hostComponentI["desired_admin_state"]; ok {
+			hostComponent.DesiredAdminState = desiredAdminState.(string)
+		}
 		hostComponents = append(hostComponents, hostComponent)
 	}
 	return hostComponents
@@ -163,6 +207,9 @@ func createServicesType(item Item, services []Service) []Service {
 		if serviceState, ok := serviceI["state"]; ok {
 			service.ServiceState = serviceState.(string)
 		}
+		if maintenanceState, ok := serviceI["maintenance_state"]; ok {
+			service.MaintenanceState = maintenanceState.(string)
+		}
 		services = append(services, service)
 	}
 	return services
@@ -183,6 +230,9 @@ func createStackConfigsType(item Item, stackConfigMap map[string]StackConfig) ma
 				} else {
 					stackConfig := StackConfig{}
 					stackConfig.ServiceConfigType = stackConfigProp.Type
+					if serviceName, ok := stackConfigPropsMap["service_name"].(string); ok {
+						stackConfig.ServiceName = serviceName
+					}
 					stackConfig.Properties = append(stackConfig.Properties, stackConfigProp)
 					stackConfigMap[stackConfigProp.Type] = stackConfig
 				}
@@ -206,14 +256,220 @@ func createStackProperty(stackConfigPropsMap map[string]interface{}) StackProper
 	}
 	if propertyTypeVal, ok := stackConfigPropsMap["property_type"]; ok {
 		propertyTypeSlice := propertyTypeVal.([]interface{})
-		if len(propertyTypeSlice) < 0 {
+		if len(propertyTypeSlice) > 0 {
 			propertyType := propertyTypeSlice[0]
 			stackProperty.PropertyType = propertyType.(string)
 		}
 	}
+	if finalVal, ok := stackConfigPropsMap["final"].(string); ok {
+		stackProperty.Final = finalVal == "true"
+	}
+	if attributesVal, ok := stackConfigPropsMap["property_value_attributes"].(map[string]interface{}); ok {
+		for attributeName, attributeVal := range attributesVal {
+			var attributeValue string
+			switch value := attributeVal.(type) {
+			case string:
+				attributeValue = value
+			case bool:
+				attributeValue = strconv.FormatBool(value)
+			case float64:
+				attributeValue = strconv.FormatFloat(value, 'f', -1, 64)
+			default:
+				continue
+			}
+			if stackProperty.Attributes == nil {
+				stackProperty.Attributes = make(map[string]string)
+			}
+			stackProperty.Attributes[attributeName] = attributeValue
+		}
+	}
 	if typeVal, ok := stackConfigPropsMap["type"]; ok {
 		typeValue := strings.TrimSuffix(typeVal.(string), ".xml")
 		stackProperty.Type = typeValue
 	}
 	return stackProperty
 }
+
+func createStackServicesType(item Item, stackServices []StackService) []StackService {
+	if stackServiceVal, ok := item["StackServices"]; ok {
+		stackService := StackService{}
+		stackServiceI := stackServiceVal.(map[string]interface{})
+		if serviceName, ok := stackServiceI["service_name"]; ok {
+			stackService.ServiceName = serviceName.(string)
+		}
+		if componentsVal, ok := item["components"].([]interface{}); ok {
+			for _, componentVal := range componentsVal {
+				componentI := componentVal.(map[string]interface{})
+				componentInfo, ok := componentI["StackServiceComponents"].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				component := StackComponent{ServiceName: stackService.ServiceName}
+				if componentName, ok := componentInfo["component_name"].(string); ok {
+					component.ComponentName = componentName
+				}
+				if category, ok := componentInfo["component_category"].(string); ok {
+					component.Category = category
+				}
+				if cardinality, ok := componentInfo["cardinality"].(string); ok {
+					component.Cardinality = cardinality
+				}
+				if dependenciesVal, ok := componentI["dependencies"].([]interface{}); ok {
+					for _, dependencyVal := range dependenciesVal {
+						dependencyI, ok := dependencyVal.(map[string]interface{})["Dependencies"].(map[string]interface{})
+						if !ok {
+							continue
+						}
+						dependency := StackComponentDependency{}
+						if componentName, ok := dependencyI["component_name"].(string); ok {
+							dependency.ComponentName = componentName
+						}
+						if serviceName, ok := dependencyI["service_name"].(string); ok {
+							dependency.ServiceName = serviceName
+						}
+						if scope, ok := dependencyI["scope"].(string); ok {
+							dependency.Scope = scope
+						}
+						component.Dependencies = append(component.Dependencies, dependency)
+					}
+				}
+				stackService.Components = append(stackService.Components, component)
+			}
+		}
+		stackServices = append(stackServices, stackService)
+	}
+	return stackServices
+}
+
+func createStackVersionsType(item Item, stackVersions []StackVersion) []StackVersion {
+	if _, ok := item["Stacks"]; ok {
+		if versionsVal, ok := item["versions"].([]interface{}); ok {
+			for _, versionVal := range versionsVal {
+				versionI, ok := versionVal.(map[string]interface{})["Versions"].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				stackVersion := StackVersion{}
+				if stackName, ok := versionI["stack_name"].(string); ok {
+					stackVersion.StackName = stackName
+				}
+				if version, ok := versionI["stack_version"].(string); ok {
+					stackVersion.StackVersion = version
+				}
+				if active, ok := versionI["active"].(bool); ok {
+					stackVersion.Active = active
+				}
+				stackVersions = append(stackVersions, stackVersion)
+			}
+		}
+	}
+	return stackVersions
+}
+
+func createAlertsType(item Item, alerts []Alert) []Alert {
+	if alertVal, ok := item["Alert"]; ok {
+		alert := Alert{}
+		alertI := alertVal.(map[string]interface{})
+		if id, ok := alertI["id"]; ok {
+			alert.ID = int(id.(float64))
+		}
+		if definitionName, ok := alertI["definition_name"]; ok {
+			alert.DefinitionName = definitionName.(string)
+		}
+		if label, ok := alertI["label"]; ok {
+			alert.Label = label.(string)
+		}
+		if state, ok := alertI["state"]; ok {
+			alert.State = state.(string)
+		}
+		if serviceName, ok := alertI["service_name"]; ok {
+			alert.ServiceName = serviceName.(string)
+		}
+		if componentName, ok := alertI["component_name"].(string); ok {
+			alert.ComponentName = componentName
+		}
+		if hostName, ok := alertI["host_name"].(string); ok {
+			alert.HostName = hostName
+		}
+		if text, ok := alertI["text"]; ok {
+			alert.Text = text.(string)
+		}
+		if maintenanceState, ok := alertI["maintenance_state"]; ok {
+			alert.MaintenanceState = maintenanceState.(string)
+		}
+		if timestamp, ok := alertI["original_timestamp"]; ok {
+			alert.Timestamp = int64(timestamp.(float64))
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+func createAlertHistoryType(item Item, alertHistory []AlertHistory) []AlertHistory {
+	if alertHistoryVal, ok := item["AlertHistory"]; ok {
+		historyEntry := AlertHistory{}
+		historyI := alertHistoryVal.(map[string]interface{})
+		if id, ok := historyI["id"]; ok {
+			historyEntry.ID = int(id.(float64))
+		}
+		if definitionName, ok := historyI["definition_name"]; ok {
+			historyEntry.DefinitionName = definitionName.(string)
+		}
+		if label, ok := historyI["label"]; ok {
+			historyEntry.Label = label.(string)
+		}
+		if state, ok := historyI["state"]; ok {
+			historyEntry.State = state.(string)
+		}
+		if serviceName, ok := historyI["service_name"]; ok {
+			historyEntry.ServiceName = serviceName.(string)
+		}
+		if componentName, ok := historyI["component_name"].(string); ok {
+			historyEntry.ComponentName = componentName
+		}
+		if hostName, ok := historyI["host_name"].(string); ok {
+			historyEntry.HostName = hostName
+		}
+		if text, ok := historyI["text"]; ok {
+			historyEntry.Text = text.(string)
+		}
+		if timestamp, ok := historyI["timestamp"]; ok {
+			historyEntry.Timestamp = int64(timestamp.(float64))
+		}
+		alertHistory = append(alertHistory, historyEntry)
+	}
+	return alertHistory
+}
+
+func createAlertDefinitionsType(item Item, alertDefinitions []AlertDefinition) []AlertDefinition {
+	if alertDefinitionVal, ok := item["AlertDefinition"]; ok {
+		alertDefinition := AlertDefinition{}
+		definitionI := alertDefinitionVal.(map[string]interface{})
+		if id, ok := definitionI["id"]; ok {
+			alertDefinition.ID = int(id.(float64))
+		}
+		if name, ok := definitionI["name"]; ok {
+			alertDefinition.Name = name.(string)
+		}
+		if label, ok := definitionI["label"]; ok {
+			alertDefinition.Label = label.(string)
+		}
+		if serviceName, ok := definitionI["service_name"]; ok {
+			alertDefinition.ServiceName = serviceName.(string)
+		}
+		if componentName, ok := definitionI["component_name"].(string); ok {
+			alertDefinition.ComponentName = componentName
+		}
+		if scope, ok := definitionI["scope"]; ok {
+			alertDefinition.Scope = scope.(string)
+		}
+		if interval, ok := definitionI["interval"]; ok {
+			alertDefinition.Interval = int(interval.(float64))
+		}
+		if enabled, ok := definitionI["enabled"]; ok {
+			alertDefinition.Enabled = enabled.(bool)
+		}
+		alertDefinitions = append(alertDefinitions, alertDefinition)
+	}
+	return alertDefinitions
+}
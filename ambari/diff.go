@@ -0,0 +1,302 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// PropertyAdded the property exists only in the second (to) configuration source
+	PropertyAdded = "added"
+	// PropertyRemoved the property exists only in the first (from) configuration source
+	PropertyRemoved = "removed"
+	// PropertyChanged the property exists in both configuration sources with different values
+	PropertyChanged = "changed"
+
+	diffContextLines = 2
+)
+
+// LoadConfigSource loads properties by config type from a configuration source: 'current' (active cluster), 'registry:<name>' (cluster of an other
+// ambari server entry), 'version:<n>' (service config version of a service) or 'blueprint:<file>' (configurations of a blueprint json file)
+func (a AmbariRegistry) LoadConfigSource(source string, service string) (map[string]map[string]string, error) {
+	sourceType, sourceValue := source, ""
+	if index := strings.Index(source, ":"); index >= 0 {
+		sourceType, sourceValue = source[:index], source[index+1:]
+	}
+	switch sourceType {
+	case "current":
+		return a.loadCurrentProperties()
+	case "registry":
+		ambariServer, err := a.getRegistryEntry(sourceValue)
+		if err != nil {
+			return nil, err
+		}
+		return ambariServer.loadCurrentProperties()
+	case "version":
+		if len(service) == 0 {
+			return nil, fmt.Errorf("service is required for config source '%s'", source)
+		}
+		version, err := strconv.Atoi(sourceValue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service config version in config source '%s'", source)
+		}
+		serviceConfigVersion, err := a.GetServiceConfigVersion(service, version)
+		if err != nil {
+			return nil, err
+		}
+		return getServiceConfigVersionProperties(serviceConfigVersion), nil
+	case "blueprint":
+		return LoadBlueprintProperties(sourceValue)
+	}
+	return nil, fmt.Errorf("unsupported config source '%s' (use current, registry:<name>, version:<n> or blueprint:<file>)", source)
+}
+
+func (a AmbariRegistry) loadCurrentProperties() (map[string]map[string]string, error) {
+	configurations, err := a.GetDesiredConfigurations()
+	if err != nil {
+		return nil, err
+	}
+	properties := make(map[string]map[string]string)
+	for configType, configuration := range configurations {
+		properties[configType] = configuration.Properties
+	}
+	return properties, nil
+}
+
+// LoadBlueprintProperties loads the properties by config type from the configurations section of a blueprint json file
+func LoadBlueprintProperties(file string) (map[string]map[string]string, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var blueprint struct {
+		Configurations []map[string]map[string]interface{} `json:"configurations"`
+	}
+	if err := json.Unmarshal(content, &blueprint); err != nil {
+		return nil, fmt.Errorf("cannot parse blueprint file '%s': %v", file, err)
+	}
+	properties := make(map[string]map[string]string)
+	for _, configurationEntry := range blueprint.Configurations {
+		for configType, configuration := range configurationEntry {
+			values := configuration
+			if blueprintProperties, ok := configuration["properties"].(map[string]interface{}); ok {
+				values = blueprintProperties
+			}
+			typeProperties := make(map[string]string)
+			for key, value := range values {
+				if key == "properties_attributes" {
+					continue
+				}
+				if stringValue, ok := value.(string); ok {
+					typeProperties[key] = stringValue
+				} else {
+					typeProperties[key] = fmt.Sprint(value)
+				}
+			}
+			properties[configType] = typeProperties
+		}
+	}
+	return properties, nil
+}
+
+// DiffConfigSources compares the properties of 2 configuration sources (see LoadConfigSource), only the config types of the version sources
+// are compared if a version source is used, the config types can be filtered further by the types parameter
+func (a AmbariRegistry) DiffConfigSources(from string, to string, service string, types []string) ([]ConfigDiff, error) {
+	fromProperties, err := a.LoadConfigSource(from, service)
+	if err != nil {
+		return nil, err
+	}
+	toProperties, err := a.LoadConfigSource(to, service)
+	if err != nil {
+		return nil, err
+	}
+	typeFilter := make(map[string]bool)
+	for _, configType := range types {
+		typeFilter[configType] = true
+	}
+	if len(typeFilter) == 0 {
+		if strings.HasPrefix(from, "version:") {
+			for configType := range fromProperties {
+				typeFilter[configType] = true
+			}
+		}
+		if strings.HasPrefix(to, "version:") {
+			for configType := range toProperties {
+				typeFilter[configType] = true
+			}
+		}
+	}
+	return DiffConfigurations(fromProperties, toProperties, typeFilter), nil
+}
+
+// DiffConfigurations compares properties by config type, returns the added / removed / changed properties for every config type that has differences
+// (sorted by config type and key), typeFilter can be empty (all config types are compared)
+func DiffConfigurations(from map[string]map[string]string, to map[string]map[string]string, typeFilter map[string]bool) []ConfigDiff {
+	configTypes := make(map[string]bool)
+	for configType := range from {
+		configTypes[configType] = true
+	}
+	for configType := range to {
+		configTypes[configType] = true
+	}
+	var sortedConfigTypes []string
+	for configType := range configTypes {
+		if len(typeFilter) == 0 || typeFilter[configType] {
+			sortedConfigTypes = append(sortedConfigTypes, configType)
+		}
+	}
+	sort.Strings(sortedConfigTypes)
+	diffs := make([]ConfigDiff, 0)
+	for _, configType := range sortedConfigTypes {
+		fromTypeProperties, toTypeProperties := from[configType], to[configType]
+		keys := make(map[string]bool)
+		for key := range fromTypeProperties {
+			keys[key] = true
+		}
+		for key := range toTypeProperties {
+			keys[key] = true
+		}
+		var sortedKeys []string
+		for key := range keys {
+			sortedKeys = append(sortedKeys, key)
+		}
+		sort.Strings(sortedKeys)
+		var propertyDiffs []PropertyDiff
+		for _, key := range sortedKeys {
+			fromValue, inFrom := fromTypeProperties[key]
+			toValue, inTo := toTypeProperties[key]
+			if inFrom && !inTo {
+				propertyDiffs = append(propertyDiffs, PropertyDiff{Key: key, Change: PropertyRemoved, From: fromValue})
+			} else if !inFrom && inTo {
+				propertyDiffs = append(propertyDiffs, PropertyDiff{Key: key, Change: PropertyAdded, To: toValue})
+			} else if fromValue != toValue {
+				propertyDiffs = append(propertyDiffs, PropertyDiff{Key: key, Change: PropertyChanged, From: fromValue, To: toValue})
+			}
+		}
+		if len(propertyDiffs) > 0 {
+			diffs = append(diffs, ConfigDiff{Type: configType, Properties: propertyDiffs})
+		}
+	}
+	return diffs
+}
+
+// FormatConfigDiffs renders config diffs as text, changed multi-line values (e.g.: content) are rendered as line diffs
+func FormatConfigDiffs(diffs []ConfigDiff) string {
+	var buffer bytes.Buffer
+	for _, diff := range diffs {
+		buffer.WriteString(fmt.Sprintf("[%s]\n", diff.Type))
+		for _, property := range diff.Properties {
+			switch property.Change {
+			case PropertyAdded:
+				buffer.WriteString(formatPropertyValue("  + ", property.Key, property.To))
+			case PropertyRemoved:
+				buffer.WriteString(formatPropertyValue("  - ", property.Key, property.From))
+			case PropertyChanged:
+				if strings.Contains(property.From, "\n") || strings.Contains(property.To, "\n") {
+					buffer.WriteString(fmt.Sprintf("  ~ %s:\n", property.Key))
+					buffer.WriteString(diffLines(property.From, property.To, "      "))
+				} else {
+					buffer.WriteString(fmt.Sprintf("  ~ %s: '%s' -> '%s'\n", property.Key, property.From, property.To))
+				}
+			}
+		}
+	}
+	return buffer.String()
+}
+
+func formatPropertyValue(prefix string, key string, value string) string {
+	if !strings.Contains(value, "\n") {
+		return fmt.Sprintf("%s%s = '%s'\n", prefix, key, value)
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("%s%s =\n", prefix, key))
+	for _, line := range strings.Split(value, "\n") {
+		buffer.WriteString(fmt.Sprintf("      %s\n", line))
+	}
+	return buffer.String()
+}
+
+// diffLines creates a line based diff (longest common subsequence) of 2 multi-line values, only the changed lines and their context lines are included
+func diffLines(from string, to string, indent string) string {
+	fromLines, toLines := strings.Split(from, "\n"), strings.Split(to, "\n")
+	lcs := make([][]int, len(fromLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(toLines)+1)
+	}
+	for i := len(fromLines) - 1; i >= 0; i-- {
+		for j := len(toLines) - 1; j >= 0; j-- {
+			if fromLines[i] == toLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	type diffLine struct {
+		prefix string
+		text   string
+	}
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(fromLines) || j < len(toLines) {
+		if i < len(fromLines) && j < len(toLines) && fromLines[i] == toLines[j] {
+			lines = append(lines, diffLine{prefix: " ", text: fromLines[i]})
+			i++
+			j++
+		} else if i < len(fromLines) && (j == len(toLines) || lcs[i+1][j] >= lcs[i][j+1]) {
+			lines = append(lines, diffLine{prefix: "-", text: fromLines[i]})
+			i++
+		} else {
+			lines = append(lines, diffLine{prefix: "+", text: toLines[j]})
+			j++
+		}
+	}
+	visible := make([]bool, len(lines))
+	for index, line := range lines {
+		if line.prefix != " " {
+			for k := index - diffContextLines; k <= index+diffContextLines; k++ {
+				if k >= 0 && k < len(lines) {
+					visible[k] = true
+				}
+			}
+		}
+	}
+	var buffer bytes.Buffer
+	skipped := false
+	for index, line := range lines {
+		if !visible[index] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			buffer.WriteString(indent + "...\n")
+			skipped = false
+		}
+		buffer.WriteString(fmt.Sprintf("%s%s %s\n", indent, line.prefix, line.text))
+	}
+	if skipped {
+		buffer.WriteString(indent + "...\n")
+	}
+	return buffer.String()
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     string
+		to       string
+		expected string
+	}{
+		{"changed line", "a\nb\nc", "a\nx\nc", "  a\n- b\n+ x\n  c\n"},
+		{"added line", "a", "a\nb", "  a\n+ b\n"},
+		{"removed line", "a\nb\nc", "a\nc", "  a\n- b\n  c\n"},
+		{"leading context is skipped", "1\n2\n3\n4\n5\n6\n7\n8", "1\n2\n3\n4\n5\n6\n7\nX", "...\n  6\n  7\n- 8\n+ X\n"},
+		{"trailing context is skipped", "1\n2\n3\n4\n5\n6", "X\n2\n3\n4\n5\n6", "- 1\n+ X\n  2\n  3\n...\n"},
+		{"separated changes", "1\n2\n3\n4\n5\n6\n7\n8\n9", "X\n2\n3\n4\n5\n6\n7\n8\nY", "- 1\n+ X\n  2\n  3\n...\n  7\n  8\n- 9\n+ Y\n"},
+	}
+	for _, test := range tests {
+		if actual := diffLines(test.from, test.to, ""); actual != test.expected {
+			t.Errorf("%s: diffLines() = %q, want %q", test.name, actual, test.expected)
+		}
+	}
+}
+
+func TestDiffConfigurations(t *testing.T) {
+	from := map[string]map[string]string{
+		"core-site": {"fs.defaultFS": "hdfs://h1:8020", "fs.trash.interval": "360", "removed.key": "x"},
+		"hdfs-site": {"dfs.replication": "3"},
+		"zoo.cfg":   {"tickTime": "2000"},
+	}
+	to := map[string]map[string]string{
+		"core-site":   {"fs.defaultFS": "hdfs://h1:8020", "fs.trash.interval": "0", "added.key": "y"},
+		"hdfs-site":   {"dfs.replication": "3"},
+		"cluster-env": {"security_enabled": "false"},
+	}
+	tests := []struct {
+		name       string
+		typeFilter map[string]bool
+		expected   []ConfigDiff
+	}{
+		{"all config types", nil, []ConfigDiff{
+			{Type: "cluster-env", Properties: []PropertyDiff{{Key: "security_enabled", Change: PropertyAdded, To: "false"}}},
+			{Type: "core-site", Properties: []PropertyDiff{
+				{Key: "added.key", Change: PropertyAdded, To: "y"},
+				{Key: "fs.trash.interval", Change: PropertyChanged, From: "360", To: "0"},
+				{Key: "removed.key", Change: PropertyRemoved, From: "x"},
+			}},
+			{Type: "zoo.cfg", Properties: []PropertyDiff{{Key: "tickTime", Change: PropertyRemoved, From: "2000"}}},
+		}},
+		{"filtered config types", map[string]bool{"zoo.cfg": true, "hdfs-site": true}, []ConfigDiff{
+			{Type: "zoo.cfg", Properties: []PropertyDiff{{Key: "tickTime", Change: PropertyRemoved, From: "2000"}}},
+		}},
+		{"no differences", map[string]bool{"hdfs-site": true}, []ConfigDiff{}},
+	}
+	for _, test := range tests {
+		if actual := DiffConfigurations(from, to, test.typeFilter); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: DiffConfigurations() = %+v, want %+v", test.name, actual, test.expected)
+		}
+	}
+}
+
+func ExampleFormatConfigDiffs() {
+	diffs := []ConfigDiff{
+		{Type: "core-site", Properties: []PropertyDiff{
+			{Key: "a", Change: PropertyAdded, To: "1"},
+			{Key: "b", Change: PropertyRemoved, From: "2"},
+			{Key: "c", Change: PropertyChanged, From: "3", To: "4"},
+		}},
+		{Type: "hadoop-env", Properties: []PropertyDiff{{Key: "content", Change: PropertyChanged, From: "x\ny", To: "x\nz"}}},
+	}
+	fmt.Print(FormatConfigDiffs(diffs))
+	// Output:
+	// [core-site]
+	//   + a = '1'
+	//   - b = '2'
+	//   ~ c: '3' -> '4'
+	// [hadoop-env]
+	//   ~ content:
+	//         x
+	//       - y
+	//       + z
+}
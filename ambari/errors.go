@@ -0,0 +1,159 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrNoConnectionProfile is returned when an ssh based operation is requested, but no connection profile is attached to the ambari server entry
+	ErrNoConnectionProfile = errors.New("no connection profile is attached for the active ambari server entry")
+	// ErrEmptyInput is returned when a required user input is empty
+	ErrEmptyInput = errors.New("input cannot be empty")
+	// ErrLockTimeout is returned when the ambarictl registry is locked by an other process for too long
+	ErrLockTimeout = errors.New("timeout while waiting for the ambarictl registry lock")
+	// ErrVaultDecrypt is returned when the secret vault cannot be decrypted (usually wrong passphrase)
+	ErrVaultDecrypt = errors.New("cannot decrypt the secret vault (wrong passphrase?)")
+)
+
+// AmbariAPIError represents an unsuccessful response (status code >= 400) from the Ambari REST API
+type AmbariAPIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *AmbariAPIError) Error() string {
+	if len(e.Body) > 0 {
+		return fmt.Sprintf("ambari request %s %s failed with status code %v: %s", e.Method, e.URL, e.StatusCode, e.Body)
+	}
+	return fmt.Sprintf("ambari request %s %s failed with status code %v", e.Method, e.URL, e.StatusCode)
+}
+
+// RegistryError represents a failed lookup or a conflict in the ambarictl registry (ambari server entries or connection profiles)
+type RegistryError struct {
+	Kind string
+	ID   string
+	Msg  string
+}
+
+func (e *RegistryError) Error() string {
+	return fmt.Sprintf("%s '%s': %s", e.Kind, e.ID, e.Msg)
+}
+
+// TaskError represents a playbook task which cannot be executed (e.g.: missing parameters)
+type TaskError struct {
+	Task string
+	Msg  string
+}
+
+func (e *TaskError) Error() string {
+	if len(e.Task) > 0 {
+		return fmt.Sprintf("task '%s': %s", e.Task, e.Msg)
+	}
+	return fmt.Sprintf("task: %s", e.Msg)
+}
+
+// RequestFailedError is returned when a tracked Ambari request ends with a non-successful status (e.g.: FAILED or ABORTED)
+type RequestFailedError struct {
+	Request AmbariRequest
+}
+
+func (e *RequestFailedError) Error() string {
+	var failedTasks []string
+	for _, task := range e.Request.Tasks {
+		if task.Status != "COMPLETED" {
+			failedTasks = append(failedTasks, fmt.Sprintf("%s %s on %s: %s", task.Role, task.Command, task.HostName, task.Status))
+		}
+	}
+	if len(failedTasks) > 0 {
+		return fmt.Sprintf("ambari request %v (%s) finished with status %s (%s)", e.Request.ID, e.Request.Context, e.Request.Status, strings.Join(failedTasks, ", "))
+	}
+	return fmt.Sprintf("ambari request %v (%s) finished with status %s", e.Request.ID, e.Request.Context, e.Request.Status)
+}
+
+// RemoteExecutionError is returned when a remote (ssh) operation fails on one or more hosts
+type RemoteExecutionError struct {
+	Operation string
+	Failed    []RemoteResponse
+}
+
+func (e *RemoteExecutionError) Error() string {
+	var failures []string
+	for _, response := range e.Failed {
+		failures = append(failures, fmt.Sprintf("%s (%s)", response.Host, response.FailureReason()))
+	}
+	return fmt.Sprintf("%s failed on %v host(s): %s", e.Operation, len(e.Failed), strings.Join(failures, ", "))
+}
+
+// HostKeyError is returned when the host key of an ssh server is unknown or it does not match the recorded host key
+type HostKeyError struct {
+	Address     string
+	Fingerprint string
+	Mismatch    bool
+}
+
+func (e *HostKeyError) Error() string {
+	if e.Mismatch {
+		return fmt.Sprintf("host key of '%s' (%s) does not match the known host key, possible man-in-the-middle attack", e.Address, e.Fingerprint)
+	}
+	return fmt.Sprintf("unknown host key of '%s' (%s), use 'ambarictl profiles trust' to record the host keys", e.Address, e.Fingerprint)
+}
+
+// ChecksumMismatchError is returned when the checksum of a downloaded file differs from the checksum of the remote file
+type ChecksumMismatchError struct {
+	LocalPath  string
+	RemotePath string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum mismatch for downloaded file '%s' (remote: %s)", e.LocalPath, e.RemotePath)
+}
+
+// HealthCheckError is returned when the cluster health report contains issues with (at least) the requested severity
+type HealthCheckError struct {
+	Status   string
+	Critical int
+	Warning  int
+}
+
+func (e *HealthCheckError) Error() string {
+	return fmt.Sprintf("cluster health is %s (%v critical, %v warning issue(s))", e.Status, e.Critical, e.Warning)
+}
+
+// RollingRestartError is returned when a rolling restart is aborted, because the restart failed on more hosts than the tolerated number of failures
+type RollingRestartError struct {
+	Component   string
+	FailedHosts []string
+	MaxFailures int
+}
+
+func (e *RollingRestartError) Error() string {
+	return fmt.Sprintf("rolling restart aborted at %s: restart failed on %v host(s), tolerated: %v (%s)", e.Component, len(e.FailedHosts), e.MaxFailures, strings.Join(e.FailedHosts, ", "))
+}
+
+// BlueprintValidationError is returned when the blueprint validation found errors
+type BlueprintValidationError struct {
+	Errors   int
+	Warnings int
+}
+
+func (e *BlueprintValidationError) Error() string {
+	return fmt.Sprintf("blueprint validation failed: %v error(s), %v warning(s)", e.Errors, e.Warnings)
+}
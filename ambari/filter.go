@@ -44,12 +44,15 @@ func CreateFilter(serviceFilter string, componentFilter string, hostFilter strin
 }
 
 // GetFilteredHosts obtain specific hosts based on different filters
-func (a AmbariRegistry) GetFilteredHosts(filter Filter) map[string]bool {
+func (a AmbariRegistry) GetFilteredHosts(filter Filter) (map[string]bool, error) {
 	finalHosts := make(map[string]bool)
 	hosts := make(map[string]bool) // use boolean map as a set
 	if len(filter.Services) > 0 {
 		for _, service := range filter.Services {
-			hostComponents := a.ListHostComponentsByService(service)
+			hostComponents, err := a.ListHostComponentsByService(service)
+			if err != nil {
+				return nil, err
+			}
 			for _, hostComponent := range hostComponents {
 				hosts[hostComponent.HostComponntHost] = true
 			}
@@ -57,7 +60,10 @@ func (a AmbariRegistry) GetFilteredHosts(filter Filter) map[string]bool {
 	}
 	if len(filter.Components) > 0 {
 		for _, component := range filter.Components {
-			hostComponents := a.ListHostComponents(component, false)
+			hostComponents, err := a.ListHostComponents(component, false)
+			if err != nil {
+				return nil, err
+			}
 			for _, hostComponent := range hostComponents {
 				hosts[hostComponent.HostComponntHost] = true
 			}
@@ -67,10 +73,13 @@ func (a AmbariRegistry) GetFilteredHosts(filter Filter) map[string]bool {
 		hosts[a.Hostname] = true
 		finalHosts[a.Hostname] = true
 	} else {
-		agents := a.ListAgents()
+		agents, err := a.ListAgents()
+		if err != nil {
+			return nil, err
+		}
 		calculateAndFillFinalHosts(agents, filter, hosts, finalHosts)
 	}
-	return finalHosts
+	return finalHosts, nil
 }
 
 func calculateAndFillFinalHosts(agents []Host, filter Filter, hosts map[string]bool, finalHosts map[string]bool) {
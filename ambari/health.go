@@ -0,0 +1,250 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// HealthCritical severity of the health issues that make the cluster unusable (e.g.: lost agents, stopped master components, critical alerts)
+	HealthCritical = "CRITICAL"
+	// HealthWarning severity of the health issues that need attention (e.g.: stale configs, warning alerts)
+	HealthWarning = "WARNING"
+	// HealthInfo severity of informational health issues (e.g.: services in maintenance mode, unknown alerts)
+	HealthInfo = "INFO"
+	// HealthOK status of a cluster without any health issues
+	HealthOK = "OK"
+)
+
+var healthSeverityOrder = map[string]int{HealthCritical: 0, HealthWarning: 1, HealthInfo: 2}
+
+// HealthIssue represents a problem found by the cluster health check
+type HealthIssue struct {
+	Severity string `json:"severity"`
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Host     string `json:"host"`
+	State    string `json:"state"`
+	Message  string `json:"message"`
+}
+
+// HealthReport contains the health issues of the cluster (sorted by severity) and the number of the checked items
+type HealthReport struct {
+	Hosts          int           `json:"hosts"`
+	Services       int           `json:"services"`
+	HostComponents int           `json:"host_components"`
+	Alerts         int           `json:"alerts"`
+	Issues         []HealthIssue `json:"issues"`
+}
+
+// Count returns the number of the health issues with a specific severity
+func (r HealthReport) Count(severity string) int {
+	count := 0
+	for _, issue := range r.Issues {
+		if issue.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+// Status returns the most severe issue severity of the report (OK if there are no CRITICAL or WARNING issues)
+func (r HealthReport) Status() string {
+	if r.Count(HealthCritical) > 0 {
+		return HealthCritical
+	}
+	if r.Count(HealthWarning) > 0 {
+		return HealthWarning
+	}
+	return HealthOK
+}
+
+// Check returns a *HealthCheckError if the report has issues with the given (or more severe) severity
+func (r HealthReport) Check(failOn string) error {
+	failOn = strings.ToUpper(failOn)
+	limit, ok := healthSeverityOrder[failOn]
+	if !ok {
+		return fmt.Errorf("unsupported severity '%s' (use %s, %s or %s)", failOn, HealthCritical, HealthWarning, HealthInfo)
+	}
+	for _, issue := range r.Issues {
+		if healthSeverityOrder[issue.Severity] <= limit {
+			return &HealthCheckError{Status: issue.Severity, Critical: r.Count(HealthCritical), Warning: r.Count(HealthWarning)}
+		}
+	}
+	return nil
+}
+
+// GetHealthReport checks the agent hosts, services, host components (states and stale configs) and the active alerts of the cluster
+func (a AmbariRegistry) GetHealthReport() (HealthReport, error) {
+	report := HealthReport{}
+	hosts, err := a.ListAgents()
+	if err != nil {
+		return report, err
+	}
+	services, err := a.ListServices()
+	if err != nil {
+		return report, err
+	}
+	components, err := a.ListComponents()
+	if err != nil {
+		return report, err
+	}
+	hostComponents, err := a.ListHostComponentStates()
+	if err != nil {
+		return report, err
+	}
+	alerts, err := a.ListAlerts(AlertFilter{States: []string{AlertStateCritical, AlertStateWarning, AlertStateUnknown}})
+	if err != nil {
+		return report, err
+	}
+	report.Hosts, report.Services, report.HostComponents, report.Alerts = len(hosts), len(services), len(hostComponents), len(alerts)
+	lostHosts := make(map[string]bool)
+	for _, host := range hosts {
+		if issue, ok := checkHostHealth(host); ok {
+			report.Issues = append(report.Issues, issue)
+			if issue.Severity == HealthCritical {
+				lostHosts[host.HostName] = true
+			}
+		}
+	}
+	for _, service := range services {
+		if issue, ok := checkServiceHealth(service); ok {
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+	componentCategories := make(map[string]string)
+	for _, component := range components {
+		componentCategories[component.ComponentName] = component.Category
+	}
+	for _, hostComponent := range hostComponents {
+		if lostHosts[hostComponent.HostComponntHost] {
+			continue
+		}
+		report.Issues = append(report.Issues, checkHostComponentHealth(hostComponent, componentCategories[hostComponent.HostComponentName])...)
+	}
+	for _, alert := range alerts {
+		if issue, ok := checkAlertHealth(alert); ok {
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+	sortHealthIssues(report.Issues)
+	return report, nil
+}
+
+func checkHostHealth(host Host) (HealthIssue, bool) {
+	issue := HealthIssue{Type: "host", Name: host.HostName, Host: host.HostName, State: host.HostState}
+	switch host.HostState {
+	case "HEALTHY":
+		return issue, false
+	case "HEARTBEAT_LOST":
+		issue.Severity, issue.Message = HealthCritical, "agent heartbeat lost"
+	case "UNHEALTHY":
+		issue.Severity, issue.Message = HealthWarning, "agent reports the host as unhealthy"
+	default:
+		issue.Severity, issue.Message = HealthWarning, "agent is not fully registered"
+	}
+	return issue, true
+}
+
+func checkServiceHealth(service Service) (HealthIssue, bool) {
+	issue := HealthIssue{Type: "service", Name: service.ServiceName, State: service.ServiceState}
+	if isMaintenanceOn(service.MaintenanceState) {
+		issue.Severity, issue.Message = HealthInfo, "service is in maintenance mode"
+		return issue, true
+	}
+	switch service.ServiceState {
+	case "INSTALL_FAILED":
+		issue.Severity, issue.Message = HealthCritical, "service installation failed"
+	case "UNKNOWN":
+		issue.Severity, issue.Message = HealthCritical, "service state is unknown"
+	default:
+		return issue, false
+	}
+	return issue, true
+}
+
+func checkHostComponentHealth(hostComponent HostComponent, category string) []HealthIssue {
+	var issues []HealthIssue
+	if isMaintenanceOn(hostComponent.MaintenanceState) {
+		return issues
+	}
+	issue := HealthIssue{Type: "component", Name: hostComponent.HostComponentName, Host: hostComponent.HostComponntHost, State: hostComponent.HostComponentState}
+	switch state := hostComponent.HostComponentState; {
+	case state == "STARTED", state == "INSTALLED" && category == "CLIENT":
+	case state == "INSTALL_FAILED":
+		issue.Severity, issue.Message = HealthCritical, "component installation failed"
+	case state == "UNKNOWN":
+		issue.Severity, issue.Message = HealthCritical, "component state is unknown"
+	case state == "INSTALLED" && hostComponent.DesiredState == "STARTED":
+		issue.Severity, issue.Message = HealthCritical, "component is stopped (desired state: STARTED)"
+	case state == "INSTALLED":
+		issue.Severity, issue.Message = HealthWarning, "component is stopped"
+	case state == "DISABLED":
+		issue.Severity, issue.Message = HealthInfo, "component is disabled"
+	default:
+		issue.Severity, issue.Message = HealthWarning, fmt.Sprintf("component is in %s state", state)
+	}
+	if len(issue.Severity) > 0 {
+		issues = append(issues, issue)
+	}
+	if hostComponent.StaleConfigs {
+		issues = append(issues, HealthIssue{Severity: HealthWarning, Type: "stale_config", Name: hostComponent.HostComponentName, Host: hostComponent.HostComponntHost,
+			State: hostComponent.HostComponentState, Message: "restart required to apply configuration changes"})
+	}
+	return issues
+}
+
+func checkAlertHealth(alert Alert) (HealthIssue, bool) {
+	if isMaintenanceOn(alert.MaintenanceState) {
+		return HealthIssue{}, false
+	}
+	issue := HealthIssue{Type: "alert", Name: alert.Label, Host: alert.HostName, State: alert.State, Message: strings.TrimSpace(strings.SplitN(alert.Text, "\n", 2)[0])}
+	if len(issue.Name) == 0 {
+		issue.Name = alert.DefinitionName
+	}
+	switch alert.State {
+	case AlertStateCritical:
+		issue.Severity = HealthCritical
+	case AlertStateWarning:
+		issue.Severity = HealthWarning
+	case AlertStateUnknown:
+		issue.Severity = HealthInfo
+	default:
+		return issue, false
+	}
+	return issue, true
+}
+
+// isMaintenanceOn returns true for explicit (ON) or implied (IMPLIED_FROM_HOST, IMPLIED_FROM_SERVICE...) maintenance states
+func isMaintenanceOn(maintenanceState string) bool {
+	return len(maintenanceState) > 0 && maintenanceState != "OFF"
+}
+
+func sortHealthIssues(issues []HealthIssue) {
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Severity != issues[j].Severity {
+			return healthSeverityOrder[issues[i].Severity] < healthSeverityOrder[issues[j].Severity]
+		}
+		if issues[i].Type != issues[j].Type {
+			return issues[i].Type < issues[j].Type
+		}
+		if issues[i].Name != issues[j].Name {
+			return issues[i].Name < issues[j].Name
+		}
+		return issues[i].Host < issues[j].Host
+	})
+}
@@ -0,0 +1,414 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+const (
+	// DataNodeDecommissioned NameNode admin state of a DataNode after its blocks are re-replicated to other DataNodes
+	DataNodeDecommissioned = "Decommissioned"
+	// DataNodeDecommissionInProgress NameNode admin state of a DataNode while its blocks are re-replicated
+	DataNodeDecommissionInProgress = "Decommission In Progress"
+)
+
+type nameNodeMetricsResponse struct {
+	HostComponents []struct {
+		Metrics struct {
+			Dfs struct {
+				NameNode struct {
+					LiveNodes string `json:"LiveNodes"`
+					DeadNodes string `json:"DeadNodes"`
+				} `json:"namenode"`
+			} `json:"dfs"`
+		} `json:"metrics"`
+	} `json:"host_components"`
+}
+
+// DecommissionTarget describes a component that can be decommissioned: the decommission command is sent to the master component of its service
+type DecommissionTarget struct {
+	Component string
+	Service   string
+	Master    string
+}
+
+// DecommissionTargets contains the components that can be decommissioned / recommissioned
+var DecommissionTargets = []DecommissionTarget{
+	{Component: "DATANODE", Service: "HDFS", Master: "NAMENODE"},
+	{Component: "NODEMANAGER", Service: "YARN", Master: "RESOURCEMANAGER"},
+	{Component: "HBASE_REGIONSERVER", Service: "HBASE", Master: "HBASE_MASTER"},
+}
+
+// LoadHostGroupTemplate reads a host group from a json file, the file can contain a single host group (name and components)
+// or a blueprint, in that case the host group is selected by name (it can be omitted if the blueprint has only one host group)
+func LoadHostGroupTemplate(file string, hostGroupName string) (HostGroup, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return HostGroup{}, err
+	}
+	var template struct {
+		HostGroup
+		HostGroups []HostGroup `json:"host_groups"`
+	}
+	if err := json.Unmarshal(content, &template); err != nil {
+		return HostGroup{}, fmt.Errorf("cannot parse host group template file '%s': %v", file, err)
+	}
+	hostGroup := template.HostGroup
+	if len(template.HostGroups) > 0 {
+		if len(hostGroupName) == 0 && len(template.HostGroups) == 1 {
+			hostGroup = template.HostGroups[0]
+		} else if len(hostGroupName) == 0 {
+			return HostGroup{}, fmt.Errorf("blueprint '%s' contains %v host groups, select one of them by name", file, len(template.HostGroups))
+		} else {
+			found := false
+			for _, blueprintHostGroup := range template.HostGroups {
+				if blueprintHostGroup.Name == hostGroupName {
+					hostGroup = blueprintHostGroup
+					found = true
+				}
+			}
+			if !found {
+				return HostGroup{}, fmt.Errorf("host group '%s' does not exist in blueprint '%s'", hostGroupName, file)
+			}
+		}
+	}
+	if len(hostGroup.Components) == 0 {
+		return HostGroup{}, fmt.Errorf("host group template '%s' does not contain any components", file)
+	}
+	return hostGroup, nil
+}
+
+// AddHosts adds registered agent hosts to the cluster, then installs (and starts, except the clients) the components of a host group template on them
+func (a AmbariRegistry) AddHosts(hosts []string, hostGroup HostGroup, start bool) error {
+	components, err := a.ListComponents()
+	if err != nil {
+		return err
+	}
+	categories := make(map[string]string)
+	for _, component := range components {
+		categories[component.ComponentName] = component.Category
+	}
+	var startComponents []string
+	for _, component := range hostGroup.Components {
+		category, ok := categories[component.Name]
+		if !ok {
+			return fmt.Errorf("component '%s' of host group '%s' is not installed in the cluster (add its service first)", component.Name, hostGroup.Name)
+		}
+		if category != "CLIENT" {
+			startComponents = append(startComponents, component.Name)
+		}
+	}
+	for _, host := range hosts {
+		if err := a.addHost(host, hostGroup, startComponents, start); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a AmbariRegistry) addHost(host string, hostGroup HostGroup, startComponents []string, start bool) error {
+	request, err := a.CreateGetRequest(fmt.Sprintf("hosts/%s", host), false)
+	if err != nil {
+		return err
+	}
+	if _, err := a.processRequest(request); err != nil {
+		if apiErr, ok := err.(*AmbariAPIError); ok && apiErr.StatusCode == 404 {
+			return fmt.Errorf("host '%s' is not registered in Ambari (install and start the ambari agent on it first)", host)
+		}
+		return err
+	}
+	if err := a.hostLifecycleOperation("POST", fmt.Sprintf("hosts/%s", host)); err != nil {
+		return err
+	}
+	fmt.Println(fmt.Sprintf("Host %s has been added to cluster %s", host, a.Cluster))
+	for _, component := range hostGroup.Components {
+		if err := a.hostLifecycleOperation("POST", fmt.Sprintf("hosts/%s/host_components/%s", host, component.Name)); err != nil {
+			return err
+		}
+		fmt.Println(fmt.Sprintf("Host component %s has been added to host %s", component.Name, host))
+	}
+	err = a.trackOperation(a.setHostComponentsState(fmt.Sprintf("HostRoles/host_name=%s&HostRoles/state=INIT", host), "INSTALLED",
+		fmt.Sprintf("Install components on %s by ambarictl", host)))
+	if err != nil {
+		return err
+	}
+	if start && len(startComponents) > 0 {
+		err = a.trackOperation(a.setHostComponentsState(fmt.Sprintf("HostRoles/host_name=%s&HostRoles/component_name.in(%s)", host, strings.Join(startComponents, ",")), "STARTED",
+			fmt.Sprintf("Start components on %s by ambarictl", host)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecommissionHosts decommissions (or recommissions) components (DATANODE, NODEMANAGER, HBASE_REGIONSERVER) on hosts,
+// if no component is provided, every decommissionable component of the hosts is decommissioned
+func (a AmbariRegistry) DecommissionHosts(hosts []string, components []string, recommission bool) error {
+	requested := make(map[string]bool)
+	for _, component := range components {
+		requested[component] = true
+		if _, ok := getDecommissionTarget(component); !ok {
+			return fmt.Errorf("component '%s' cannot be decommissioned (supported: %s)", component, strings.Join(decommissionComponentNames(), ", "))
+		}
+	}
+	hostComponents, err := a.ListHostComponentStates()
+	if err != nil {
+		return err
+	}
+	hostFilter := make(map[string]bool)
+	for _, host := range hosts {
+		hostFilter[host] = true
+	}
+	operations := 0
+	for _, target := range DecommissionTargets {
+		if len(components) > 0 && !requested[target.Component] {
+			continue
+		}
+		var targetHosts []string
+		for _, hostComponent := range hostComponents {
+			if hostComponent.HostComponentName == target.Component && hostFilter[hostComponent.HostComponntHost] {
+				targetHosts = append(targetHosts, hostComponent.HostComponntHost)
+			}
+		}
+		if len(targetHosts) == 0 {
+			if len(components) > 0 {
+				return fmt.Errorf("component '%s' is not installed on host(s) %s", target.Component, strings.Join(hosts, ", "))
+			}
+			continue
+		}
+		if err := a.trackOperation(a.decommissionComponent(target, targetHosts, recommission)); err != nil {
+			return err
+		}
+		operations++
+	}
+	if operations == 0 {
+		return fmt.Errorf("none of the %s components are installed on host(s) %s", strings.Join(decommissionComponentNames(), ", "), strings.Join(hosts, ", "))
+	}
+	return nil
+}
+
+// RemoveHosts stops the running components of hosts, deletes their host components, then deletes the hosts from the cluster,
+// hosts with DATANODE, NODEMANAGER or HBASE_REGIONSERVER components need to be decommissioned first (unless force is used),
+// the removal waits until the NameNode finishes the decommission of the DataNodes
+func (a AmbariRegistry) RemoveHosts(hosts []string, force bool) error {
+	for _, host := range hosts {
+		if err := a.removeHost(host, force); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a AmbariRegistry) removeHost(host string, force bool) error {
+	hostComponents, err := a.ListHostComponentStatesByHost(host)
+	if err != nil {
+		return err
+	}
+	var runningComponents []string
+	for _, hostComponent := range hostComponents {
+		if _, ok := getDecommissionTarget(hostComponent.HostComponentName); ok && !force && hostComponent.DesiredAdminState != "DECOMMISSIONED" {
+			return fmt.Errorf("%s is not decommissioned on host %s, decommission it first (or force the removal)", hostComponent.HostComponentName, host)
+		}
+		if hostComponent.HostComponentName == "DATANODE" && !force {
+			if err := a.waitForDataNodeDecommission(host); err != nil {
+				return err
+			}
+		}
+		if hostComponent.HostComponentState == "STARTED" {
+			runningComponents = append(runningComponents, hostComponent.HostComponentName)
+		}
+	}
+	if len(runningComponents) > 0 {
+		err = a.trackOperation(a.setHostComponentsState(fmt.Sprintf("HostRoles/host_name=%s&HostRoles/component_name.in(%s)", host, strings.Join(runningComponents, ",")), "INSTALLED",
+			fmt.Sprintf("Stop components on %s by ambarictl", host)))
+		if err != nil {
+			return err
+		}
+	}
+	if len(hostComponents) > 0 {
+		if err := a.hostLifecycleOperation("DELETE", fmt.Sprintf("hosts/%s/host_components", host)); err != nil {
+			return err
+		}
+		fmt.Println(fmt.Sprintf("Host components of host %s have been deleted", host))
+	}
+	if err := a.hostLifecycleOperation("DELETE", fmt.Sprintf("hosts/%s", host)); err != nil {
+		return err
+	}
+	fmt.Println(fmt.Sprintf("Host %s has been removed from cluster %s", host, a.Cluster))
+	return nil
+}
+
+// GetDataNodeAdminState obtain the admin state of the DataNode of a host from the NameNode (In Service, Decommission In Progress or Decommissioned),
+// the desired admin state of the host component is set as soon as the decommission command is accepted, so it does not show that the blocks are re-replicated
+func (a AmbariRegistry) GetDataNodeAdminState(host string) (string, error) {
+	request, err := a.CreateGetRequest("services/HDFS/components/NAMENODE?fields=host_components/metrics/dfs/namenode/LiveNodes,host_components/metrics/dfs/namenode/DeadNodes", true)
+	if err != nil {
+		return "", err
+	}
+	bodyBytes, err := a.processRequest(request)
+	if err != nil {
+		return "", err
+	}
+	var response nameNodeMetricsResponse
+	if err := json.Unmarshal(bodyBytes, &response); err != nil {
+		return "", err
+	}
+	for _, hostComponent := range response.HostComponents {
+		nameNodeMetrics := hostComponent.Metrics.Dfs.NameNode
+		if len(nameNodeMetrics.LiveNodes) > 0 {
+			var liveNodes map[string]struct {
+				AdminState string `json:"adminState"`
+			}
+			if err := json.Unmarshal([]byte(nameNodeMetrics.LiveNodes), &liveNodes); err != nil {
+				return "", fmt.Errorf("cannot parse LiveNodes metrics of the NameNode: %v", err)
+			}
+			for node, liveNode := range liveNodes {
+				if strings.SplitN(node, ":", 2)[0] == host {
+					return liveNode.AdminState, nil
+				}
+			}
+		}
+		if len(nameNodeMetrics.DeadNodes) > 0 {
+			var deadNodes map[string]struct {
+				Decommissioned bool `json:"decommissioned"`
+			}
+			if err := json.Unmarshal([]byte(nameNodeMetrics.DeadNodes), &deadNodes); err != nil {
+				return "", fmt.Errorf("cannot parse DeadNodes metrics of the NameNode: %v", err)
+			}
+			for node, deadNode := range deadNodes {
+				if strings.SplitN(node, ":", 2)[0] == host && deadNode.Decommissioned {
+					return DataNodeDecommissioned, nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("cannot find the DataNode of host %s in the NameNode metrics", host)
+}
+
+// waitForDataNodeDecommission waits until the NameNode reports that the DataNode of a host is decommissioned (all of its blocks are re-replicated)
+func (a AmbariRegistry) waitForDataNodeDecommission(host string) error {
+	lastState := ""
+	for {
+		state, err := a.GetDataNodeAdminState(host)
+		if err != nil {
+			return err
+		}
+		if state == DataNodeDecommissioned {
+			return nil
+		}
+		if state != DataNodeDecommissionInProgress {
+			return fmt.Errorf("DATANODE on host %s is not decommissioned according to the NameNode (admin state: %s), decommission it first (or force the removal)", host, state)
+		}
+		if state != lastState {
+			fmt.Println(fmt.Sprintf("Waiting for the decommission of DATANODE on host %s (%s)", host, state))
+			lastState = state
+		}
+		select {
+		case <-a.Context().Done():
+			return a.Context().Err()
+		case <-time.After(DefaultPollInterval):
+		}
+	}
+}
+
+// hostLifecycleOperation sends a synchronous (body-less) POST or DELETE request for a cluster resource
+func (a AmbariRegistry) hostLifecycleOperation(method string, uriSuffix string) error {
+	var err error
+	if method == "DELETE" {
+		request, requestErr := a.CreateDeleteRequest(uriSuffix, true)
+		if requestErr != nil {
+			return requestErr
+		}
+		_, err = a.processRequest(request)
+	} else {
+		request, requestErr := a.CreatePostRequest(bytes.Buffer{}, uriSuffix, true)
+		if requestErr != nil {
+			return requestErr
+		}
+		_, err = a.processRequest(request)
+	}
+	return err
+}
+
+// setHostComponentsState changes the desired state of the host components that match a query (e.g.: INSTALLED for install / stop, STARTED for start)
+func (a AmbariRegistry) setHostComponentsState(query string, state string, context string) ([]byte, error) {
+	var bodyBytes bytes.Buffer
+	bodyBytes.WriteString(fmt.Sprintf(`{"RequestInfo": {"context" : "%s"}, "Body": {"HostRoles": {"state": "%s"}}}`, context, state))
+	request, err := a.CreatePutRequest(bodyBytes, "host_components?"+query, true)
+	if err != nil {
+		return nil, err
+	}
+	return a.processRequest(request)
+}
+
+func (a AmbariRegistry) decommissionComponent(target DecommissionTarget, hosts []string, recommission bool) ([]byte, error) {
+	hostsParameter := "excluded_hosts"
+	context := fmt.Sprintf("Decommission %s on %s by ambarictl", target.Component, strings.Join(hosts, ","))
+	if recommission {
+		hostsParameter = "included_hosts"
+		context = fmt.Sprintf("Recommission %s on %s by ambarictl", target.Component, strings.Join(hosts, ","))
+	}
+	var bodyBytes bytes.Buffer
+	jsonStr := fmt.Sprintf(`{
+  "RequestInfo": {
+    "context": "%s",
+    "command": "DECOMMISSION",
+    "parameters": {
+      "slave_type": "%s",
+      "%s": "%s"
+    },
+    "operation_level": {
+      "level": "HOST_COMPONENT",
+      "cluster_name": "%s"
+    }
+  },
+  "Requests/resource_filters": [
+    {
+      "service_name": "%s",
+      "component_name": "%s"
+    }
+  ]
+}`, context, target.Component, hostsParameter, strings.Join(hosts, ","), a.Cluster, target.Service, target.Master)
+	bodyBytes.WriteString(jsonStr)
+	request, err := a.CreatePostRequest(bodyBytes, "requests", true)
+	if err != nil {
+		return nil, err
+	}
+	return a.processRequest(request)
+}
+
+func getDecommissionTarget(component string) (DecommissionTarget, bool) {
+	for _, target := range DecommissionTargets {
+		if target.Component == component {
+			return target, true
+		}
+	}
+	return DecommissionTarget{}, false
+}
+
+func decommissionComponentNames() []string {
+	var names []string
+	for _, target := range DecommissionTargets {
+		names = append(names, target.Component)
+	}
+	return names
+}
@@ -0,0 +1,112 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nameNodeMetricsStub serves the LiveNodes and DeadNodes metrics of the NameNode (those are json strings inside the json response)
+func nameNodeMetricsStub(liveNodes string, deadNodes string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/clusters/cl1/services/HDFS/components/NAMENODE" {
+			http.NotFound(w, r)
+			return
+		}
+		metrics := map[string]interface{}{"dfs": map[string]interface{}{"namenode": map[string]interface{}{"LiveNodes": liveNodes, "DeadNodes": deadNodes}}}
+		json.NewEncoder(w).Encode(map[string]interface{}{"host_components": []interface{}{map[string]interface{}{"metrics": metrics}}})
+	})
+}
+
+func TestWaitForDataNodeDecommission(t *testing.T) {
+	liveNodes := `{"c7201.ambari.apache.org:50010": {"adminState": "In Service"}, "c7202.ambari.apache.org:50010": {"adminState": "Decommissioned"},` +
+		` "c7203.ambari.apache.org:50010": {"adminState": "Decommission In Progress"}}`
+	deadNodes := `{"c7204.ambari.apache.org:50010": {"decommissioned": true}, "c7205.ambari.apache.org:50010": {"decommissioned": false}}`
+	server := httptest.NewServer(nameNodeMetricsStub(liveNodes, deadNodes))
+	defer server.Close()
+	ambariServer := testAmbariRegistry(t, server)
+
+	tests := []struct {
+		host       string
+		adminState string
+		waitErr    string
+	}{
+		{"c7201.ambari.apache.org", "In Service", "is not decommissioned according to the NameNode (admin state: In Service)"},
+		{"c7202.ambari.apache.org", DataNodeDecommissioned, ""},
+		// the blocks are still re-replicated, the wait is interrupted by the deadline of the context
+		{"c7203.ambari.apache.org", DataNodeDecommissionInProgress, context.DeadlineExceeded.Error()},
+		{"c7204.ambari.apache.org", DataNodeDecommissioned, ""},
+		{"c7205.ambari.apache.org", "", "cannot find the DataNode of host c7205.ambari.apache.org"},
+		{"c7206.ambari.apache.org", "", "cannot find the DataNode of host c7206.ambari.apache.org"},
+	}
+	for _, test := range tests {
+		t.Run(test.host, func(t *testing.T) {
+			state, err := ambariServer.GetDataNodeAdminState(test.host)
+			if state != test.adminState || (err != nil) != (len(test.adminState) == 0) {
+				t.Errorf("GetDataNodeAdminState() = %q, %v, want %q", state, err, test.adminState)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			err = ambariServer.WithContext(ctx).waitForDataNodeDecommission(test.host)
+			if len(test.waitErr) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), test.waitErr) {
+				t.Errorf("expected error containing %q, got %v", test.waitErr, err)
+			}
+		})
+	}
+}
+
+func TestRemoveHostRequiresDecommission(t *testing.T) {
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "DELETE":
+			deleted = append(deleted, r.URL.Path)
+		case r.URL.Path == "/api/v1/clusters/cl1/host_components":
+			json.NewEncoder(w).Encode(map[string]interface{}{"items": []interface{}{
+				map[string]interface{}{"HostRoles": map[string]interface{}{"component_name": "DATANODE", "host_name": "c7203.ambari.apache.org",
+					"state": "INSTALLED", "desired_admin_state": "DECOMMISSIONED"}},
+			}})
+		default:
+			nameNodeMetricsStub(`{"c7203.ambari.apache.org:50010": {"adminState": "In Service"}}`, "").ServeHTTP(w, r)
+		}
+	}))
+	defer server.Close()
+	ambariServer := testAmbariRegistry(t, server)
+
+	// Ambari already reports DECOMMISSIONED, but the NameNode has not finished the decommission
+	err := ambariServer.RemoveHosts([]string{"c7203.ambari.apache.org"}, false)
+	if err == nil || !strings.Contains(err.Error(), "not decommissioned according to the NameNode") {
+		t.Errorf("expected a decommission error, got %v", err)
+	}
+	if len(deleted) > 0 {
+		t.Errorf("nothing should be deleted before the decommission is finished, deleted: %v", deleted)
+	}
+	if err := ambariServer.RemoveHosts([]string{"c7203.ambari.apache.org"}, true); err != nil {
+		t.Fatal(err)
+	}
+	expected := "/api/v1/clusters/cl1/hosts/c7203.ambari.apache.org/host_components,/api/v1/clusters/cl1/hosts/c7203.ambari.apache.org"
+	if strings.Join(deleted, ",") != expected {
+		t.Errorf("deleted resources %v, want %s", deleted, expected)
+	}
+}
@@ -23,7 +23,7 @@ import (
 )
 
 // GetStringFlag trying to read a flag value, if it does not exists ask an input from the user
-func GetStringFlag(flagValue string, defaultValue string, text string) string {
+func GetStringFlag(flagValue string, defaultValue string, text string) (string, error) {
 	if len(flagValue) == 0 {
 		reader := bufio.NewReader(os.Stdin)
 		fmt.Print(text)
@@ -35,40 +35,37 @@ func GetStringFlag(flagValue string, defaultValue string, text string) string {
 		answer, _ := reader.ReadString('\n')
 		if len(answer) == 0 || answer == "\n" {
 			if len(defaultValue) == 0 {
-				fmt.Println("Input cannot be empty!")
-				os.Exit(1)
+				return "", ErrEmptyInput
 			}
 			answer = defaultValue
 		}
-		return strings.TrimSpace(answer)
+		return strings.TrimSpace(answer), nil
 	}
-	return flagValue
+	return flagValue, nil
 }
 
 // GetPassword trying to read a password flag value, if it does not exists ask an input from the user
-func GetPassword(flagValue string, text string) string {
+func GetPassword(flagValue string, text string) (string, error) {
 	if len(flagValue) == 0 {
 		fmt.Print(text + ": ")
 		if terminal.IsTerminal(0) {
 			var fd = 0
 			bytePassword, err := terminal.ReadPassword(fd)
 			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
+				return "", err
 			}
 			password := string(bytePassword)
 			fmt.Println()
-			return strings.TrimSpace(password)
+			return strings.TrimSpace(password), nil
 		}
 		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
 		if len(answer) == 0 || answer == "\n" {
-			fmt.Println("Password cannot by empty")
-			os.Exit(1)
+			return "", ErrEmptyInput
 		}
-		return strings.TrimSpace(answer)
+		return strings.TrimSpace(answer), nil
 
 	}
-	return flagValue
+	return flagValue, nil
 }
 
 // EvaluateBoolValueFromString get a string boolean answer and evaluate as a boolean value
@@ -0,0 +1,381 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// HostKeyPolicyStrict only known host keys are accepted (default), use 'ambarictl profiles trust' to record the host keys
+	HostKeyPolicyStrict = "strict"
+	// HostKeyPolicyAcceptNew unknown host keys are recorded at the first connection, changed host keys are rejected
+	HostKeyPolicyAcceptNew = "accept-new"
+	// HostKeyPolicyKnownHosts only the host keys of a pinned known_hosts file are accepted, the file is never modified by ambarictl
+	HostKeyPolicyKnownHosts = "known_hosts"
+
+	knownHostsFileName = "known_hosts"
+)
+
+var (
+	// knownHostsLock serializes the known_hosts file modifications
+	knownHostsLock sync.Mutex
+	// errHostKeyCollected interrupts the ssh handshake after the host key is received (used for collecting host keys)
+	errHostKeyCollected = errors.New("host key collected")
+)
+
+// HostKeyEntry represents a host key that was collected from a host
+type HostKeyEntry struct {
+	Host        string `json:"host"`
+	KeyType     string `json:"key_type"`
+	Fingerprint string `json:"fingerprint"`
+	Status      string `json:"status"`
+	Error       string `json:"error"`
+}
+
+// hostKeyVerifier checks the host keys against a known_hosts file based on the host key policy of a connection profile
+type hostKeyVerifier struct {
+	policy string
+	file   string
+}
+
+// GetHostKeyPolicy returns the host key policy of the connection profile (strict by default)
+func (c ConnectionProfile) GetHostKeyPolicy() string {
+	if len(c.HostKeyPolicy) == 0 {
+		return HostKeyPolicyStrict
+	}
+	return c.HostKeyPolicy
+}
+
+// ValidateHostKeyPolicy checks that the host key policy is supported and the known_hosts file is set for the pinned policy
+func ValidateHostKeyPolicy(policy string, knownHostsFile string) error {
+	switch policy {
+	case "", HostKeyPolicyStrict, HostKeyPolicyAcceptNew:
+		return nil
+	case HostKeyPolicyKnownHosts:
+		if len(knownHostsFile) == 0 {
+			return fmt.Errorf("known_hosts file is required for '%s' host key policy", HostKeyPolicyKnownHosts)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported host key policy '%s' (use '%s', '%s' or '%s')", policy, HostKeyPolicyStrict, HostKeyPolicyAcceptNew, HostKeyPolicyKnownHosts)
+}
+
+// SetHostKeyPolicy changes the host key policy (and optionally the known_hosts file) of a connection profile
+func SetHostKeyPolicy(profileName string, policy string, knownHostsFile string) error {
+	return UpdateConnectionProfile(profileName, func(connectionProfile *ConnectionProfile) error {
+		if len(knownHostsFile) > 0 {
+			connectionProfile.KnownHostsFile = knownHostsFile
+		}
+		if err := ValidateHostKeyPolicy(policy, connectionProfile.KnownHostsFile); err != nil {
+			return err
+		}
+		connectionProfile.HostKeyPolicy = policy
+		return nil
+	})
+}
+
+// newHostKeyVerifier creates a host key verifier for a connection profile, the known_hosts file is ~/.ambarictl/known_hosts if the profile does not define one
+func newHostKeyVerifier(connectionProfile ConnectionProfile) (*hostKeyVerifier, error) {
+	policy := connectionProfile.GetHostKeyPolicy()
+	if err := ValidateHostKeyPolicy(policy, connectionProfile.KnownHostsFile); err != nil {
+		return nil, err
+	}
+	file := connectionProfile.KnownHostsFile
+	if len(file) == 0 {
+		folder, err := getDbFolder()
+		if err != nil {
+			return nil, err
+		}
+		file = path.Join(folder, knownHostsFileName)
+	}
+	if policy == HostKeyPolicyKnownHosts {
+		if !exists(file) {
+			return nil, fmt.Errorf("pinned known_hosts file '%s' does not exist", file)
+		}
+	} else if !exists(file) {
+		knownHostsFile, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		knownHostsFile.Close()
+	}
+	return &hostKeyVerifier{policy: policy, file: file}, nil
+}
+
+// configure sets the host key callback for an address, the accepted host key algorithms are restricted to the key types of the known host keys (if there is any)
+func (v *hostKeyVerifier) configure(config *ssh.ClientConfig, address string) error {
+	knownKeys, err := v.knownKeys(address)
+	if err != nil {
+		return err
+	}
+	config.HostKeyAlgorithms = nil
+	for _, knownKey := range knownKeys {
+		config.HostKeyAlgorithms = append(config.HostKeyAlgorithms, knownKey.Key.Type())
+	}
+	config.HostKeyCallback = v.verify
+	return nil
+}
+
+// verify checks the host key of an address, for accept-new policy the unknown host keys are added to the known_hosts file
+func (v *hostKeyVerifier) verify(address string, remote net.Addr, key ssh.PublicKey) error {
+	knownHostsLock.Lock()
+	defer knownHostsLock.Unlock()
+	err := v.check(address, remote, key)
+	if keyErr, ok := err.(*knownhosts.KeyError); ok {
+		if len(keyErr.Want) > 0 {
+			return &HostKeyError{Address: address, Fingerprint: ssh.FingerprintSHA256(key), Mismatch: true}
+		}
+		if v.policy != HostKeyPolicyAcceptNew {
+			return &HostKeyError{Address: address, Fingerprint: ssh.FingerprintSHA256(key)}
+		}
+		return v.add([]string{address}, key)
+	}
+	return err
+}
+
+func (v *hostKeyVerifier) check(address string, remote net.Addr, key ssh.PublicKey) error {
+	callback, err := knownhosts.New(v.file)
+	if err != nil {
+		return err
+	}
+	return callback(address, remote, key)
+}
+
+// knownKeys returns the recorded host keys of an address
+func (v *hostKeyVerifier) knownKeys(address string) ([]knownhosts.KnownKey, error) {
+	knownHostsLock.Lock()
+	defer knownHostsLock.Unlock()
+	placeholderKey, err := ssh.NewPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+	if err != nil {
+		return nil, err
+	}
+	err = v.check(address, &net.TCPAddr{IP: net.IPv4zero}, placeholderKey)
+	if keyErr, ok := err.(*knownhosts.KeyError); ok {
+		return keyErr.Want, nil
+	}
+	return nil, err
+}
+
+func (v *hostKeyVerifier) add(addresses []string, key ssh.PublicKey) error {
+	var normalizedAddresses []string
+	for _, address := range addresses {
+		normalizedAddresses = append(normalizedAddresses, knownhosts.Normalize(address))
+	}
+	knownHostsFile, err := os.OpenFile(v.file, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer knownHostsFile.Close()
+	_, err = knownHostsFile.WriteString(knownhosts.Line(normalizedAddresses, key) + "\n")
+	return err
+}
+
+// TrustHostKeys collects the host keys of the agent hosts, the Ambari server host and the jump hosts, and records the unknown ones in the known_hosts file
+// of the connection profile, changed host keys are not replaced. The host keys are collected without authentication, credentials are needed only
+// for the jump hosts that the other hosts are reached through.
+func (a AmbariRegistry) TrustHostKeys() ([]HostKeyEntry, error) {
+	connectionProfile, err := a.getConnectionProfile()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := newHostKeyVerifier(connectionProfile)
+	if err != nil {
+		return nil, err
+	}
+	if verifier.policy == HostKeyPolicyKnownHosts {
+		return nil, fmt.Errorf("connection profile '%s' uses a pinned known_hosts file (%s), it is not modified by ambarictl", connectionProfile.Name, verifier.file)
+	}
+	agents, err := a.ListAgents()
+	if err != nil {
+		return nil, err
+	}
+	var entries []HostKeyEntry
+	jumpHosts := connectionProfile.GetJumpHosts()
+	if len(jumpHosts) > 0 {
+		fmt.Println(fmt.Sprintf("Agent hosts are reached through jump host(s) %s, the credentials of the jump hosts are used for that (and asked for if those are not stored)", connectionProfile.GetJumpHostsDescription()))
+	}
+	var proxies []*ssh.Client
+	defer func() {
+		closeSshClients(proxies)
+	}()
+	for _, jumpHost := range jumpHosts {
+		jumpProfile := connectionProfile.jumpHostProfile(jumpHost)
+		address := net.JoinHostPort(jumpHost.Address, strconv.Itoa(jumpProfile.Port))
+		entry, err := verifier.trust(jumpHost.Address, []string{address}, func(callback ssh.HostKeyCallback) error {
+			return collectHostKey(proxies, address, jumpProfile.Username, callback)
+		})
+		if err == nil {
+			var proxy *ssh.Client
+			proxy, err = dialJumpHost(connectionProfile, verifier, proxies, jumpHost)
+			if err == nil {
+				proxies = append(proxies, proxy)
+			}
+		}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		entries = append(entries, entry)
+		if err != nil {
+			return entries, fmt.Errorf("cannot collect the host keys of the agents through jump host '%s': %v", jumpHost.Address, err)
+		}
+	}
+	hosts := make(map[string]bool)
+	for _, agent := range agents {
+		hosts[agent.IP] = true
+	}
+	hostProfiles, err := a.getHostProfiles(connectionProfile, hosts)
+	if err != nil {
+		return entries, err
+	}
+	agentAddresses := make(map[string][]string)
+	for _, agent := range agents {
+		port := strconv.Itoa(hostProfiles[agent.IP].Port)
+		agentAddresses[agent.IP] = []string{net.JoinHostPort(agent.IP, port)}
+		if len(agent.PublicHostname) > 0 && agent.PublicHostname != agent.IP {
+			agentAddresses[agent.IP] = append(agentAddresses[agent.IP], net.JoinHostPort(agent.PublicHostname, port))
+		}
+	}
+	agentEntries := make(map[string]HostKeyEntry)
+	var agentEntriesLock sync.Mutex
+	a.forEachHost(hosts, nil, func(host string) RemoteResponse {
+		entry, err := verifier.trust(host, agentAddresses[host], func(callback ssh.HostKeyCallback) error {
+			return collectHostKey(proxies, agentAddresses[host][0], hostProfiles[host].Username, callback)
+		})
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		agentEntriesLock.Lock()
+		agentEntries[host] = entry
+		agentEntriesLock.Unlock()
+		if err != nil {
+			return RemoteResponse{ExitCode: -1, Error: err.Error()}
+		}
+		return RemoteResponse{Done: true}
+	})
+	failed := 0
+	for _, host := range sortHosts(hosts) {
+		entries = append(entries, agentEntries[host])
+		if agentEntries[host].Status == "failed" || agentEntries[host].Status == "changed" {
+			failed++
+		}
+	}
+	// the Ambari server host is dialed directly (without the jump hosts) by the commands that run on the server
+	serverEntry, err := a.trustServerHostKey(connectionProfile, verifier, len(jumpHosts) == 0, agentAddresses)
+	if serverEntry != nil {
+		entries = append(entries, *serverEntry)
+		if err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return entries, fmt.Errorf("host keys of %v host(s) cannot be trusted", failed)
+	}
+	return entries, nil
+}
+
+// trustServerHostKey collects the host key of the Ambari server host directly, it returns nil if the server has no host name
+// or if the same address was already collected directly as an agent host
+func (a AmbariRegistry) trustServerHostKey(connectionProfile ConnectionProfile, verifier *hostKeyVerifier, agentsDialedDirectly bool, agentAddresses map[string][]string) (*HostKeyEntry, error) {
+	if len(a.Hostname) == 0 {
+		return nil, nil
+	}
+	hostProfiles, err := a.getHostProfiles(connectionProfile, map[string]bool{a.Hostname: true})
+	if err != nil {
+		return &HostKeyEntry{Host: a.Hostname, Status: "failed", Error: err.Error()}, err
+	}
+	serverProfile := hostProfiles[a.Hostname]
+	address := net.JoinHostPort(a.Hostname, strconv.Itoa(serverProfile.Port))
+	if agentsDialedDirectly {
+		for _, addresses := range agentAddresses {
+			for _, agentAddress := range addresses {
+				if agentAddress == address {
+					return nil, nil
+				}
+			}
+		}
+	}
+	entry, err := verifier.trust(a.Hostname, []string{address}, func(callback ssh.HostKeyCallback) error {
+		return collectHostKey(nil, address, serverProfile.Username, callback)
+	})
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return &entry, err
+}
+
+// collectHostKey starts an ssh handshake without authentication, the host key is passed to the callback before any credentials would be needed
+func collectHostKey(proxies []*ssh.Client, address string, user string, callback ssh.HostKeyCallback) error {
+	config := &ssh.ClientConfig{User: user, HostKeyCallback: callback, Timeout: sshConnectTimeout}
+	client, err := dialThrough(proxies, address, config)
+	if err == nil {
+		client.Close()
+	}
+	return err
+}
+
+// trust collects the host key by a connect function (the handshake is interrupted after the host key is received) then records it in the known_hosts file
+func (v *hostKeyVerifier) trust(host string, addresses []string, connect func(callback ssh.HostKeyCallback) error) (HostKeyEntry, error) {
+	entry := HostKeyEntry{Host: host}
+	var hostKey ssh.PublicKey
+	var remoteAddr net.Addr
+	err := connect(func(address string, remote net.Addr, key ssh.PublicKey) error {
+		hostKey = key
+		remoteAddr = remote
+		return errHostKeyCollected
+	})
+	if hostKey == nil {
+		entry.Status = "failed"
+		return entry, err
+	}
+	entry.KeyType = hostKey.Type()
+	entry.Fingerprint = ssh.FingerprintSHA256(hostKey)
+	knownHostsLock.Lock()
+	defer knownHostsLock.Unlock()
+	var unknownAddresses []string
+	for _, address := range addresses {
+		err := v.check(address, remoteAddr, hostKey)
+		if keyErr, ok := err.(*knownhosts.KeyError); ok {
+			if len(keyErr.Want) > 0 {
+				entry.Status = "changed"
+				return entry, &HostKeyError{Address: address, Fingerprint: entry.Fingerprint, Mismatch: true}
+			}
+			unknownAddresses = append(unknownAddresses, address)
+		} else if err != nil {
+			entry.Status = "failed"
+			return entry, err
+		}
+	}
+	if len(unknownAddresses) == 0 {
+		entry.Status = "trusted"
+		return entry, nil
+	}
+	if err := v.add(unknownAddresses, hostKey); err != nil {
+		entry.Status = "failed"
+		return entry, err
+	}
+	entry.Status = "new"
+	return entry, nil
+}
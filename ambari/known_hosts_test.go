@@ -0,0 +1,165 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestHostKey(t *testing.T, keyType string) ssh.PublicKey {
+	var key ssh.PublicKey
+	var err error
+	if keyType == ssh.KeyAlgoED25519 {
+		var publicKey ed25519.PublicKey
+		if publicKey, _, err = ed25519.GenerateKey(rand.Reader); err == nil {
+			key, err = ssh.NewPublicKey(publicKey)
+		}
+	} else {
+		var privateKey *ecdsa.PrivateKey
+		if privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err == nil {
+			key, err = ssh.NewPublicKey(&privateKey.PublicKey)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestHostKeyVerifierPolicies(t *testing.T) {
+	folder, err := ioutil.TempDir("", "ambarictl-known-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	remote := &net.TCPAddr{IP: net.ParseIP("192.168.0.10"), Port: 22}
+	knownKey := newTestHostKey(t, ssh.KeyAlgoED25519)
+	otherKey := newTestHostKey(t, ssh.KeyAlgoED25519)
+	newKey := newTestHostKey(t, ssh.KeyAlgoECDSA256)
+	knownHosts := "c7201.ambari.apache.org " + string(ssh.MarshalAuthorizedKey(knownKey))
+
+	// expected results of verifying a host key: "ok", "unknown" or "mismatch"
+	steps := []struct {
+		address string
+		key     ssh.PublicKey
+		result  string
+	}{
+		{"c7201.ambari.apache.org:22", knownKey, "ok"},
+		{"c7201.ambari.apache.org:22", otherKey, "mismatch"},
+		{"c7202.ambari.apache.org:22", newKey, "unknown"},
+		// accept-new records the key, so the same unknown key is accepted again, but a different one is not
+		{"c7202.ambari.apache.org:22", newKey, "unknown"},
+		{"c7202.ambari.apache.org:22", otherKey, "unknown"},
+	}
+	expectedResults := map[string][]string{
+		HostKeyPolicyStrict:     {"ok", "mismatch", "unknown", "unknown", "unknown"},
+		HostKeyPolicyAcceptNew:  {"ok", "mismatch", "ok", "ok", "mismatch"},
+		HostKeyPolicyKnownHosts: {"ok", "mismatch", "unknown", "unknown", "unknown"},
+	}
+	for policy, expected := range expectedResults {
+		knownHostsFile := path.Join(folder, policy)
+		if err := ioutil.WriteFile(knownHostsFile, []byte(knownHosts), 0600); err != nil {
+			t.Fatal(err)
+		}
+		verifier, err := newHostKeyVerifier(ConnectionProfile{Name: "vagrant", HostKeyPolicy: policy, KnownHostsFile: knownHostsFile})
+		if err != nil {
+			t.Fatalf("%s: newHostKeyVerifier() error: %v", policy, err)
+		}
+		var results []string
+		for _, step := range steps {
+			err := verifier.verify(step.address, remote, step.key)
+			switch hostKeyErr, ok := err.(*HostKeyError); {
+			case err == nil:
+				results = append(results, "ok")
+			case ok && hostKeyErr.Mismatch:
+				results = append(results, "mismatch")
+			case ok:
+				results = append(results, "unknown")
+			default:
+				t.Fatalf("%s: unexpected error: %v", policy, err)
+			}
+		}
+		if !reflect.DeepEqual(results, expected) {
+			t.Errorf("%s: host key verification results %v, want %v", policy, results, expected)
+		}
+		content, err := ioutil.ReadFile(knownHostsFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if modified := string(content) != knownHosts; modified != (policy == HostKeyPolicyAcceptNew) {
+			t.Errorf("%s: known_hosts file modified: %v", policy, modified)
+		}
+	}
+}
+
+func TestHostKeyVerifierConfigure(t *testing.T) {
+	folder, err := ioutil.TempDir("", "ambarictl-known-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	knownHostsFile := path.Join(folder, "known_hosts")
+	knownHosts := "c7201.ambari.apache.org " + string(ssh.MarshalAuthorizedKey(newTestHostKey(t, ssh.KeyAlgoECDSA256))) +
+		"[c7201.ambari.apache.org]:2222 " + string(ssh.MarshalAuthorizedKey(newTestHostKey(t, ssh.KeyAlgoED25519)))
+	if err := ioutil.WriteFile(knownHostsFile, []byte(knownHosts), 0600); err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := newHostKeyVerifier(ConnectionProfile{HostKeyPolicy: HostKeyPolicyStrict, KnownHostsFile: knownHostsFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the negotiated host key algorithm has to match the recorded key type, otherwise the host would present an other (unknown) key
+	algorithms := map[string][]string{
+		"c7201.ambari.apache.org:22":   {ssh.KeyAlgoECDSA256},
+		"c7201.ambari.apache.org:2222": {ssh.KeyAlgoED25519},
+		"c7202.ambari.apache.org:22":   nil,
+	}
+	for address, expected := range algorithms {
+		config := &ssh.ClientConfig{HostKeyAlgorithms: []string{ssh.KeyAlgoRSA}}
+		if err := verifier.configure(config, address); err != nil {
+			t.Fatalf("configure(%s) error: %v", address, err)
+		}
+		if !reflect.DeepEqual(config.HostKeyAlgorithms, expected) {
+			t.Errorf("configure(%s) host key algorithms %v, want %v", address, config.HostKeyAlgorithms, expected)
+		}
+	}
+}
+
+func TestNewHostKeyVerifierPinnedFile(t *testing.T) {
+	missingFile := path.Join(os.TempDir(), "ambarictl-missing-known-hosts")
+	if _, err := newHostKeyVerifier(ConnectionProfile{HostKeyPolicy: HostKeyPolicyKnownHosts}); err == nil {
+		t.Errorf("known_hosts policy without a known_hosts file should be rejected")
+	}
+	if _, err := newHostKeyVerifier(ConnectionProfile{HostKeyPolicy: HostKeyPolicyKnownHosts, KnownHostsFile: missingFile}); err == nil {
+		t.Errorf("known_hosts policy with a missing known_hosts file should be rejected")
+	}
+	if exists(missingFile) {
+		os.Remove(missingFile)
+		t.Errorf("pinned known_hosts file should not be created")
+	}
+	if _, err := newHostKeyVerifier(ConnectionProfile{HostKeyPolicy: "trust-all"}); err == nil {
+		t.Errorf("unsupported host key policy should be rejected")
+	}
+}
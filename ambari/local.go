@@ -16,11 +16,14 @@ package ambari
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"strings"
 )
 
 // RunLocalCommand run local system command
@@ -31,10 +34,6 @@ func RunLocalCommand(command string, arg ...string) (string, string, error) {
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	err := cmd.Run()
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
 	outStr, errStr = string(stdout.Bytes()), string(stderr.Bytes())
 	if len(outStr) > 0 {
 		fmt.Println(outStr)
@@ -42,24 +41,58 @@ func RunLocalCommand(command string, arg ...string) (string, string, error) {
 	if len(errStr) > 0 {
 		fmt.Println(errStr)
 	}
-	return outStr, errStr, nil
+	return outStr, errStr, err
 }
 
 // DownloadFile download a file from an url to the local filesystem
 func DownloadFile(filepath string, url string) error {
-	out, err := os.Create(filepath)
+	return downloadFileWithClient(context.Background(), GetHttpClient(), filepath, url)
+}
+
+// DownloadFile download a file from an url to the local filesystem, the TLS settings of the ambari server entry are used only for the urls of the Ambari server host
+func (a AmbariRegistry) DownloadFile(filepath string, downloadUrl string) error {
+	client, err := a.getDownloadClient(downloadUrl)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
-	resp, err := http.Get(url)
+	return downloadFileWithClient(a.Context(), client, filepath, downloadUrl)
+}
+
+// getDownloadClient returns the HTTP client of the ambari server entry for the Ambari server host, otherwise a default client
+// (the CA bundle, server name and client certificate of the entry should not be used for other hosts)
+func (a AmbariRegistry) getDownloadClient(downloadUrl string) (*http.Client, error) {
+	parsedUrl, err := url.Parse(downloadUrl)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(parsedUrl.Hostname(), a.Hostname) {
+		return GetHttpClient(), nil
+	}
+	client, err := a.GetClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.HttpClient, nil
+}
+
+func downloadFileWithClient(ctx context.Context, client *http.Client, filepath string, url string) error {
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(request.WithContext(ctx))
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	_, err = io.Copy(out, resp.Body)
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("download of '%s' failed with status code %v", url, resp.StatusCode)
+	}
+	out, err := os.Create(filepath)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer out.Close()
+	_, err = io.Copy(out, resp.Body)
+	return err
 }
@@ -0,0 +1,89 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestDownloadFileUsesEntryTLSForAmbariHost(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "stack definition")
+	}))
+	// the rejected handshake of the foreign host download is expected
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	folder, err := ioutil.TempDir("", "ambarictl-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	caFile := path.Join(folder, "ca.pem")
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, caPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	serverUrl, _ := url.Parse(server.URL)
+	ambariServer := AmbariRegistry{Name: "tls", Hostname: serverUrl.Hostname(), Protocol: "https", TLS: TLSSettings{CACertPath: caFile}}
+	target := path.Join(folder, "downloaded")
+	if err := ambariServer.DownloadFile(target, server.URL+"/file"); err != nil {
+		t.Fatalf("download from the Ambari server host with the entry CA bundle failed: %v", err)
+	}
+	if content, _ := ioutil.ReadFile(target); string(content) != "stack definition" {
+		t.Errorf("downloaded content = %q", content)
+	}
+	// the same server is not trusted by the default client, the CA bundle of the entry is not used for other hosts
+	otherServer := AmbariRegistry{Name: "other", Hostname: "ambari.example.com", Protocol: "https", TLS: TLSSettings{CACertPath: caFile}}
+	if err := otherServer.DownloadFile(target, server.URL+"/file"); err == nil {
+		t.Errorf("download from a foreign host should not trust the CA bundle of the ambari server entry")
+	}
+}
+
+func TestGetDownloadClient(t *testing.T) {
+	ambariServer := AmbariRegistry{Name: "tls", Hostname: "ambari.example.com", TLS: TLSSettings{ServerName: "ambari.internal", Insecure: true}}
+	tests := []struct {
+		url        string
+		serverName string
+		insecure   bool
+	}{
+		{"https://ambari.example.com:8443/resources/stack.json", "ambari.internal", true},
+		{"https://AMBARI.example.com/file", "ambari.internal", true},
+		{"https://raw.githubusercontent.com/oleewere/ambarictl/master/README.md", "", false},
+		{"http://repo.example.com/ambari.repo", "", false},
+	}
+	for _, test := range tests {
+		client, err := ambariServer.getDownloadClient(test.url)
+		if err != nil {
+			t.Errorf("getDownloadClient(%q) error: %v", test.url, err)
+			continue
+		}
+		tlsConfig := client.Transport.(*http.Transport).TLSClientConfig
+		if tlsConfig.ServerName != test.serverName || tlsConfig.InsecureSkipVerify != test.insecure {
+			t.Errorf("getDownloadClient(%q) uses server name %q, insecure: %v, want %q, %v", test.url, tlsConfig.ServerName, tlsConfig.InsecureSkipVerify, test.serverName, test.insecure)
+		}
+	}
+	if _, err := ambariServer.getDownloadClient("http://[::1"); err == nil {
+		t.Errorf("getDownloadClient() expected an error for an invalid url")
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	lockfileFailImmediately = 0x00000001
+	lockfileExclusiveLock   = 0x00000002
+	errorLockViolation      = syscall.Errno(33)
+)
+
+var (
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+// lockFile acquires a lock (LockFileEx) on a file, waits at most lockTimeout for the lock
+func lockFile(f *os.File, exclusive bool) error {
+	flag := uint32(lockfileFailImmediately)
+	if exclusive {
+		flag |= lockfileExclusiveLock
+	}
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		var overlapped syscall.Overlapped
+		r, _, err := procLockFileEx.Call(f.Fd(), uintptr(flag), 0, 1, 0, uintptr(unsafe.Pointer(&overlapped)))
+		if r != 0 {
+			return nil
+		}
+		if err != errorLockViolation {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return ErrLockTimeout
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// unlockFile releases the lock and closes the file
+func unlockFile(f *os.File) error {
+	defer f.Close()
+	var overlapped syscall.Overlapped
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&overlapped)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
@@ -18,10 +18,103 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// LogFilter filters the collected log files by modification time window, file name pattern and file size
+type LogFilter struct {
+	Since   time.Time
+	Until   time.Time
+	Pattern string
+	MaxSize int64
+}
+
+// ParseLogFilter creates a log filter from user inputs: since / until can be a duration (e.g.: 12h, relative to now), a date (2006-01-02),
+// a date with time (2006-01-02 15:04) or an RFC3339 timestamp, max size can have K, M or G suffix (e.g.: 100M)
+func ParseLogFilter(since string, until string, pattern string, maxSize string) (LogFilter, error) {
+	logFilter := LogFilter{Pattern: pattern}
+	var err error
+	if logFilter.Since, err = parseLogTime(since); err != nil {
+		return logFilter, err
+	}
+	if logFilter.Until, err = parseLogTime(until); err != nil {
+		return logFilter, err
+	}
+	if !logFilter.Since.IsZero() && !logFilter.Until.IsZero() && logFilter.Until.Before(logFilter.Since) {
+		return logFilter, fmt.Errorf("until (%s) is before since (%s)", logFilter.Until.Format(time.RFC3339), logFilter.Since.Format(time.RFC3339))
+	}
+	if len(pattern) > 0 {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return logFilter, fmt.Errorf("invalid file name pattern '%s': %v", pattern, err)
+		}
+	}
+	if logFilter.MaxSize, err = parseSize(maxSize); err != nil {
+		return logFilter, err
+	}
+	return logFilter, nil
+}
+
+// remoteArchiveCommand creates a shell command which writes a gzipped tar stream (of the filtered files in a folder) to the standard output,
+// the command exits with 2 if the folder does not exist, tar exits with 1 if some files were changed during the archiving (still a valid archive)
+func (f LogFilter) remoteArchiveCommand(folder string) string {
+	command := []string{"cd", shellQuote(folder), "||", "exit", "2;", "find", ".", "-type", "f"}
+	if len(f.Pattern) > 0 {
+		command = append(command, "-name", shellQuote(f.Pattern))
+	}
+	if !f.Since.IsZero() {
+		command = append(command, "-newermt", fmt.Sprintf("@%v", f.Since.Unix()))
+	}
+	if !f.Until.IsZero() {
+		command = append(command, "!", "-newermt", fmt.Sprintf("@%v", f.Until.Unix()))
+	}
+	if f.MaxSize > 0 {
+		command = append(command, "!", "-size", fmt.Sprintf("+%vc", f.MaxSize))
+	}
+	command = append(command, "-print0", "|", "tar", "-czf", "-", "--null", "-T", "-", "--ignore-failed-read", "--warning=no-file-changed")
+	return strings.Join(command, " ")
+}
+
+func parseLogTime(value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if parsed, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse time '%s' (use a duration like 12h, 2006-01-02, 2006-01-02 15:04 or RFC3339 format)", value)
+}
+
+func parseSize(value string) (int64, error) {
+	if len(value) == 0 {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	switch strings.ToUpper(value[len(value)-1:]) {
+	case "K":
+		multiplier = 1024
+	case "M":
+		multiplier = 1024 * 1024
+	case "G":
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size '%s' (use bytes or K, M, G suffix)", value)
+	}
+	return size * multiplier, nil
+}
+
 var logDirMap = map[string]map[string]map[string]string{
 	"ZOOKEEPER": {
 		"ZOOKEEPER_SERVER": {
@@ -227,79 +320,111 @@ var logDirMap = map[string]map[string]map[string]string{
 	},
 }
 
-// DownloadLogs download specific logs that can be filtered by hosts, components or service (by default, it downloads agent logs)
-func (a AmbariRegistry) DownloadLogs(dest string, filter Filter) {
-	componentLogDirMap := getComponentLogDirMap(a, filter)
+// DownloadLogs download specific logs that can be filtered by hosts, components or service (by default, it downloads agent logs),
+// the log files can be filtered by the log filter
+func (a AmbariRegistry) DownloadLogs(dest string, filter Filter, logFilter LogFilter) error {
+	componentLogDirMap, err := getComponentLogDirMap(a, filter)
+	if err != nil {
+		return err
+	}
 	downloadFolder := createDownloadRootFolder(dest, a.Name)
 	if filter.Server {
-		serverHosts := a.GetFilteredHosts(filter)
+		serverHosts, err := a.GetFilteredHosts(filter)
+		if err != nil {
+			return err
+		}
 		getLogDirCommand := "cat /etc/ambari-server/conf/log4j.properties | grep ambari.root.dir"
-		responses := a.RunRemoteHostCommand(getLogDirCommand, serverHosts, filter.Server)
+		responses, err := a.runRemoteCommand(getLogDirCommand, serverHosts, filter.Server, nil)
+		if _, ok := err.(*RemoteExecutionError); err != nil && !ok {
+			return err
+		}
+		// the log directory lookup is not mandatory, the default log directory is used if the config file cannot be read
 		ambariLogDir := "/var/log/ambari-server"
 		for _, response := range responses {
 			splittedResponses := strings.Split(response.StdOut, "\n")
 			propertyMap := ConvertStingsToMap(splittedResponses)
 			ambariRootDir := propertyMap["ambari.root.dir"]
-			ambariLogDirUnformatted := strings.Replace(propertyMap["ambari.log.dir"], "${ambari.root.dir}", ambariRootDir, 1)
-			ambariLogDir = strings.Replace(ambariLogDirUnformatted, "//", "/", -1)
+			if ambariLogDirUnformatted, ok := propertyMap["ambari.log.dir"]; ok {
+				ambariLogDirUnformatted = strings.Replace(ambariLogDirUnformatted, "${ambari.root.dir}", ambariRootDir, 1)
+				ambariLogDir = strings.Replace(ambariLogDirUnformatted, "//", "/", -1)
+			}
 		}
 		fmt.Println(ambariLogDir)
 		componentName := "ambari-server"
 		componentDownloadFolder := createDownloadFolder(downloadFolder, componentName)
-		a.CopyFolderFromRemote(componentName, ambariLogDir, componentDownloadFolder, serverHosts, filter.Server)
-	} else {
-		if len(componentLogDirMap) > 0 {
-			if len(filter.Services) > 0 {
-				for _, service := range filter.Services {
-					hostComponents := a.ListHostComponentsByService(service)
-					componentMap := make(map[string]bool)
-					for _, hostComponent := range hostComponents {
-						componentMap[hostComponent.HostComponentName] = true
-					}
-					for component := range componentMap {
-						componentFilter := Filter{Hosts: filter.Hosts, Components: []string{component}}
-						hosts := a.GetFilteredHosts(componentFilter)
-						componentDownloadFolder := createDownloadFolder(downloadFolder, component)
-						a.CopyFolderFromRemote(component, componentLogDirMap[component], componentDownloadFolder, hosts, filter.Server)
+		return a.CopyFolderFromRemote(componentName, ambariLogDir, componentDownloadFolder, logFilter, serverHosts, filter.Server)
+	}
+	if len(componentLogDirMap) > 0 {
+		if len(filter.Services) > 0 {
+			for _, service := range filter.Services {
+				hostComponents, err := a.ListHostComponentsByService(service)
+				if err != nil {
+					return err
+				}
+				componentMap := make(map[string]bool)
+				for _, hostComponent := range hostComponents {
+					componentMap[hostComponent.HostComponentName] = true
+				}
+				for component := range componentMap {
+					if err := a.downloadComponentLogs(component, componentLogDirMap[component], downloadFolder, filter, logFilter); err != nil {
+						return err
 					}
 				}
 			}
-			if len(filter.Components) > 0 {
-				for _, component := range filter.Components {
-					componentFilter := Filter{Hosts: filter.Hosts, Components: []string{component}}
-					hosts := a.GetFilteredHosts(componentFilter)
-					componentDownloadFolder := createDownloadFolder(downloadFolder, component)
-					a.CopyFolderFromRemote(component, componentLogDirMap[component], componentDownloadFolder, hosts, filter.Server)
+		}
+		if len(filter.Components) > 0 {
+			for _, component := range filter.Components {
+				if err := a.downloadComponentLogs(component, componentLogDirMap[component], downloadFolder, filter, logFilter); err != nil {
+					return err
 				}
 			}
-		} else {
-			hosts := a.GetFilteredHosts(filter)
-			ambariAgentLogDir := "/var/log/ambari-agent"
-			componentName := "ambari-agent"
-			getLogDirCommand := "cat /etc/ambari-agent/conf/ambari-agent.ini | grep logdir"
-			for host := range hosts {
-				smallMap := make(map[string]bool)
-				smallMap[host] = true
-				responses := a.RunRemoteHostCommand(getLogDirCommand, smallMap, filter.Server)
-				for _, response := range responses {
-					splittedResponses := strings.Split(response.StdOut, "\n")
-					propertyMap := ConvertStingsToMap(splittedResponses)
-					ambariAgentLogDirValue := propertyMap["logdir"]
-					ambariAgentLogDir = strings.TrimSpace(ambariAgentLogDirValue)
-				}
-				break
+		}
+		return nil
+	}
+	hosts, err := a.GetFilteredHosts(filter)
+	if err != nil {
+		return err
+	}
+	ambariAgentLogDir := "/var/log/ambari-agent"
+	componentName := "ambari-agent"
+	getLogDirCommand := "cat /etc/ambari-agent/conf/ambari-agent.ini | grep logdir"
+	for host := range hosts {
+		smallMap := make(map[string]bool)
+		smallMap[host] = true
+		responses, err := a.runRemoteCommand(getLogDirCommand, smallMap, filter.Server, nil)
+		if _, ok := err.(*RemoteExecutionError); err != nil && !ok {
+			return err
+		}
+		for _, response := range responses {
+			splittedResponses := strings.Split(response.StdOut, "\n")
+			propertyMap := ConvertStingsToMap(splittedResponses)
+			if ambariAgentLogDirValue := strings.TrimSpace(propertyMap["logdir"]); len(ambariAgentLogDirValue) > 0 {
+				ambariAgentLogDir = ambariAgentLogDirValue
 			}
-			componentDownloadFolder := createDownloadFolder(downloadFolder, componentName)
-			a.CopyFolderFromRemote(componentName, ambariAgentLogDir, componentDownloadFolder, hosts, filter.Server)
 		}
+		break
+	}
+	componentDownloadFolder := createDownloadFolder(downloadFolder, componentName)
+	return a.CopyFolderFromRemote(componentName, ambariAgentLogDir, componentDownloadFolder, logFilter, hosts, filter.Server)
+}
+
+func (a AmbariRegistry) downloadComponentLogs(component string, logDir string, downloadFolder string, filter Filter, logFilter LogFilter) error {
+	componentFilter := Filter{Hosts: filter.Hosts, Components: []string{component}}
+	hosts, err := a.GetFilteredHosts(componentFilter)
+	if err != nil {
+		return err
 	}
-	return
+	componentDownloadFolder := createDownloadFolder(downloadFolder, component)
+	return a.CopyFolderFromRemote(component, logDir, componentDownloadFolder, logFilter, hosts, filter.Server)
 }
 
-func getComponentLogDirMap(ambariRegistry AmbariRegistry, filter Filter) map[string]string {
+func getComponentLogDirMap(ambariRegistry AmbariRegistry, filter Filter) (map[string]string, error) {
 	componentLogDirMap := map[string]string{}
 	if len(filter.Services) > 0 || len(filter.Components) > 0 {
-		blueprint := ambariRegistry.ExportBlueprintAsMap()
+		blueprint, err := ambariRegistry.ExportBlueprintAsMap()
+		if err != nil {
+			return nil, err
+		}
 		services := make([]string, len(logDirMap))
 		if len(filter.Services) > 0 {
 			services = filter.Services
@@ -314,7 +439,7 @@ func getComponentLogDirMap(ambariRegistry AmbariRegistry, filter Filter) map[str
 			}
 		}
 	}
-	return componentLogDirMap
+	return componentLogDirMap, nil
 }
 
 func findLogDirConfigsWithFilters(filter Filter, components map[string]map[string]string, blueprint map[string]interface{}, componentLogDirMap map[string]string) {
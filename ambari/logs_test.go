@@ -0,0 +1,181 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLogFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		since    string
+		until    string
+		pattern  string
+		maxSize  string
+		expected LogFilter
+		err      bool
+	}{
+		{name: "empty filter", expected: LogFilter{}},
+		{name: "date", since: "2019-03-01", expected: LogFilter{Since: time.Date(2019, 3, 1, 0, 0, 0, 0, time.Local)}},
+		{name: "date with time", since: "2019-03-01 10:30", until: "2019-03-01 12:00:30",
+			expected: LogFilter{Since: time.Date(2019, 3, 1, 10, 30, 0, 0, time.Local), Until: time.Date(2019, 3, 1, 12, 0, 30, 0, time.Local)}},
+		{name: "RFC3339", until: "2019-03-01T10:30:00Z", expected: LogFilter{Until: time.Date(2019, 3, 1, 10, 30, 0, 0, time.UTC)}},
+		{name: "pattern", pattern: "*.log", expected: LogFilter{Pattern: "*.log"}},
+		{name: "size in bytes", maxSize: "512", expected: LogFilter{MaxSize: 512}},
+		{name: "size with K suffix", maxSize: "10K", expected: LogFilter{MaxSize: 10 * 1024}},
+		{name: "size with lowercase M suffix", maxSize: "100m", expected: LogFilter{MaxSize: 100 * 1024 * 1024}},
+		{name: "size with G suffix", maxSize: "2G", expected: LogFilter{MaxSize: 2 * 1024 * 1024 * 1024}},
+		{name: "invalid since", since: "yesterday", err: true},
+		{name: "invalid until", until: "2019-13-01", err: true},
+		{name: "until before since", since: "2019-03-02", until: "2019-03-01", err: true},
+		{name: "invalid pattern", pattern: "[", err: true},
+		{name: "invalid size", maxSize: "10T", err: true},
+		{name: "negative size", maxSize: "-1K", err: true},
+	}
+	for _, test := range tests {
+		logFilter, err := ParseLogFilter(test.since, test.until, test.pattern, test.maxSize)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !logFilter.Since.Equal(test.expected.Since) || !logFilter.Until.Equal(test.expected.Until) || logFilter.Pattern != test.expected.Pattern || logFilter.MaxSize != test.expected.MaxSize {
+			t.Errorf("%s: ParseLogFilter() = %+v, want %+v", test.name, logFilter, test.expected)
+		}
+	}
+}
+
+func TestParseLogFilterWithDuration(t *testing.T) {
+	before := time.Now()
+	logFilter, err := ParseLogFilter("12h", "30m", "", "")
+	after := time.Now()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logFilter.Since.Before(before.Add(-12*time.Hour)) || logFilter.Since.After(after.Add(-12*time.Hour)) {
+		t.Errorf("since = %v, want 12 hours before now", logFilter.Since)
+	}
+	if logFilter.Until.Before(before.Add(-30*time.Minute)) || logFilter.Until.After(after.Add(-30*time.Minute)) {
+		t.Errorf("until = %v, want 30 minutes before now", logFilter.Until)
+	}
+}
+
+// TestLogFilterRemoteArchiveCommand runs the generated archive command with the local shell, then lists the files of the archive
+func TestLogFilterRemoteArchiveCommand(t *testing.T) {
+	for _, tool := range []string{"sh", "find", "tar"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not available: %v", tool, err)
+		}
+	}
+	folder, err := ioutil.TempDir("", "ambarictl-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	now := time.Now().Truncate(time.Second)
+	files := []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{"hadoop-hdfs-namenode.log", 100, time.Hour},
+		{"hadoop-hdfs-namenode.log.1", 100, 30 * time.Hour},
+		{"hadoop-hdfs-namenode.out", 100, time.Hour},
+		{"gc.log", 5000, time.Hour},
+		{"audit/hdfs-audit.log", 100, 2 * time.Hour},
+		{"it's quoted.log", 100, time.Hour},
+	}
+	for _, file := range files {
+		filePath := filepath.Join(folder, filepath.FromSlash(file.name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filePath, make([]byte, file.size), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filePath, now.Add(-file.age), now.Add(-file.age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archivedFiles := func(filter LogFilter, folder string) ([]string, error) {
+		output, err := exec.Command("sh", "-c", filter.remoteArchiveCommand(folder)).Output()
+		if err != nil {
+			return nil, err
+		}
+		gzipReader, err := gzip.NewReader(bytes.NewReader(output))
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		tarReader := tar.NewReader(gzipReader)
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, strings.TrimPrefix(header.Name, "./"))
+		}
+		sort.Strings(names)
+		return names, nil
+	}
+
+	tests := []struct {
+		name     string
+		filter   LogFilter
+		expected []string
+	}{
+		{"no filter", LogFilter{}, []string{"audit/hdfs-audit.log", "gc.log", "hadoop-hdfs-namenode.log", "hadoop-hdfs-namenode.log.1", "hadoop-hdfs-namenode.out", "it's quoted.log"}},
+		{"pattern", LogFilter{Pattern: "*.log"}, []string{"audit/hdfs-audit.log", "gc.log", "hadoop-hdfs-namenode.log", "it's quoted.log"}},
+		{"since", LogFilter{Since: now.Add(-3 * time.Hour)}, []string{"audit/hdfs-audit.log", "gc.log", "hadoop-hdfs-namenode.log", "hadoop-hdfs-namenode.out", "it's quoted.log"}},
+		{"until", LogFilter{Until: now.Add(-90 * time.Minute)}, []string{"audit/hdfs-audit.log", "hadoop-hdfs-namenode.log.1"}},
+		{"max size", LogFilter{MaxSize: 1024, Pattern: "*.log"}, []string{"audit/hdfs-audit.log", "hadoop-hdfs-namenode.log", "it's quoted.log"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			names, err := archivedFiles(test.filter, folder)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("archived files %q, want %q", names, test.expected)
+			}
+		})
+	}
+	if _, err := archivedFiles(LogFilter{}, filepath.Join(folder, "missing")); err == nil {
+		t.Errorf("archiving a missing folder should fail")
+	} else if exitErr, ok := err.(*exec.ExitError); !ok || !strings.Contains(exitErr.Error(), "exit status 2") {
+		t.Errorf("expected exit status 2 for a missing folder, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// SetMaintenanceMode turns on or off the maintenance mode of components (on all or the filtered hosts), services or hosts:
+// if the filter has components, the maintenance mode is set for the host components, otherwise for the services or the hosts of the filter
+func (a AmbariRegistry) SetMaintenanceMode(filter Filter, on bool) error {
+	if len(filter.Components) > 0 {
+		for _, component := range filter.Components {
+			if err := a.SetComponentMaintenance(component, filter.Hosts, on); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(filter.Services) > 0 {
+		for _, service := range filter.Services {
+			if err := a.SetServiceMaintenance(service, on); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(filter.Hosts) > 0 {
+		for _, host := range filter.Hosts {
+			if err := a.SetHostMaintenance(host, on); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("provide services, components or hosts for the maintenance mode change")
+}
+
+// SetServiceMaintenance turns on or off the maintenance mode of a service
+func (a AmbariRegistry) SetServiceMaintenance(service string, on bool) error {
+	state, context := maintenanceStateContext(on, "service "+service)
+	return a.maintenanceOperation(fmt.Sprintf("services/%s", service), fmt.Sprintf(`{"RequestInfo": {"context" : "%s"}, "Body": {"ServiceInfo": {"maintenance_state": "%s"}}}`, context, state))
+}
+
+// SetHostMaintenance turns on or off the maintenance mode of a host (by host name)
+func (a AmbariRegistry) SetHostMaintenance(host string, on bool) error {
+	state, context := maintenanceStateContext(on, "host "+host)
+	return a.maintenanceOperation(fmt.Sprintf("hosts/%s", host), fmt.Sprintf(`{"RequestInfo": {"context" : "%s"}, "Body": {"Hosts": {"maintenance_state": "%s"}}}`, context, state))
+}
+
+// SetComponentMaintenance turns on or off the maintenance mode of a component on specific hosts (or on all of its hosts if no host is provided)
+func (a AmbariRegistry) SetComponentMaintenance(component string, hosts []string, on bool) error {
+	uriSuffix := fmt.Sprintf("host_components?HostRoles/component_name=%s", component)
+	target := "component " + component
+	if len(hosts) > 0 {
+		uriSuffix += fmt.Sprintf("&HostRoles/host_name.in(%s)", strings.Join(hosts, ","))
+		target += " on " + strings.Join(hosts, ", ")
+	}
+	state, context := maintenanceStateContext(on, target)
+	return a.maintenanceOperation(uriSuffix, fmt.Sprintf(`{"RequestInfo": {"context" : "%s"}, "Body": {"HostRoles": {"maintenance_state": "%s"}}}`, context, state))
+}
+
+func (a AmbariRegistry) maintenanceOperation(uriSuffix string, body string) error {
+	var bodyBytes bytes.Buffer
+	bodyBytes.WriteString(body)
+	request, err := a.CreatePutRequest(bodyBytes, uriSuffix, true)
+	if err != nil {
+		return err
+	}
+	_, err = a.processRequest(request)
+	return err
+}
+
+func maintenanceStateContext(on bool, target string) (string, string) {
+	if on {
+		return "ON", fmt.Sprintf("Turn on maintenance mode for %s by ambarictl", target)
+	}
+	return "OFF", fmt.Sprintf("Turn off maintenance mode for %s by ambarictl", target)
+}
@@ -19,9 +19,10 @@ import (
 	"fmt"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
-	"os"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 )
 
 const (
@@ -37,6 +38,16 @@ const (
 	Config = "Config"
 	// AmbariCommand runs an ambari command (like START or STOP) against components or services
 	AmbariCommand = "AmbariCommand"
+	// ConfigRollback command type is for rolling back the configuration of a service to a previous service config version
+	ConfigRollback = "ConfigRollback"
+	// AddHost command type adds registered agent hosts to the cluster and installs the components of a host group template on them
+	AddHost = "AddHost"
+	// DecommissionHost command type decommissions DATANODE, NODEMANAGER or HBASE_REGIONSERVER components on hosts
+	DecommissionHost = "DecommissionHost"
+	// RecommissionHost command type recommissions DATANODE, NODEMANAGER or HBASE_REGIONSERVER components on hosts
+	RecommissionHost = "RecommissionHost"
+	// RemoveHost command type stops the components of hosts, deletes the host components and removes the hosts from the cluster
+	RemoveHost = "RemoveHost"
 )
 
 // Playbook contains an array of tasks that will be executed on ambari hosts
@@ -68,18 +79,16 @@ type Input struct {
 }
 
 // LoadPlaybookFile read a playbook yaml file and transform it to a Playbook object
-func LoadPlaybookFile(location string, varsInput string) Playbook {
+func LoadPlaybookFile(location string, varsInput string) (Playbook, error) {
 	varInputMap := createVarMap(varsInput)
 	data, err := ioutil.ReadFile(location)
 	if err != nil {
-		fmt.Print(err)
-		os.Exit(1)
+		return Playbook{}, err
 	}
 	playbookTempl := Playbook{}
 	err = yaml.Unmarshal([]byte(data), &playbookTempl)
 	if err != nil {
-		fmt.Print(err)
-		os.Exit(1)
+		return Playbook{}, err
 	}
 	if len(playbookTempl.Inputs) > 0 {
 		for _, input := range playbookTempl.Inputs {
@@ -88,7 +97,10 @@ func LoadPlaybookFile(location string, varsInput string) Playbook {
 				continue
 			}
 			if len(input.Default) == 0 {
-				varSetByUser := GetStringFlag("", "", fmt.Sprintf("Enter %v", input.Name))
+				varSetByUser, err := GetStringFlag("", "", fmt.Sprintf("Enter %v", input.Name))
+				if err != nil {
+					return Playbook{}, err
+				}
 				varInputMap[input.Name] = varSetByUser
 				continue
 			}
@@ -96,61 +108,86 @@ func LoadPlaybookFile(location string, varsInput string) Playbook {
 		}
 	}
 	templ := template.New("playbook template")
-	textTemplate, _ := templ.Parse(fmt.Sprintf("%s", data))
+	textTemplate, err := templ.Parse(fmt.Sprintf("%s", data))
+	if err != nil {
+		return Playbook{}, err
+	}
 	var tpl bytes.Buffer
-	textTemplate.Execute(&tpl, varInputMap)
+	err = textTemplate.Execute(&tpl, varInputMap)
+	if err != nil {
+		return Playbook{}, err
+	}
 
 	playbook := Playbook{}
 	err = yaml.Unmarshal(tpl.Bytes(), &playbook)
 	if err != nil {
-		fmt.Print(err)
-		os.Exit(1)
+		return Playbook{}, err
 	}
 	fmt.Println(fmt.Sprintf("[Executing playbook: %v, file: %v]", playbook.Name, location))
-	return playbook
+	return playbook, nil
 }
 
 // ExecutePlaybook runs tasks on ambari hosts based on a playbook object
-func (a AmbariRegistry) ExecutePlaybook(playbook Playbook) {
+func (a AmbariRegistry) ExecutePlaybook(playbook Playbook) error {
 	tasks := playbook.Tasks
+	var startVersions []ServiceConfigVersion
 	for _, task := range tasks {
-		if len(task.Type) > 0 {
-			filteredHosts := make(map[string]bool)
-			if !task.AmbariAgentFilter {
-				filter := CreateFilter(task.ServiceFilter, task.ComponentFilter, task.HostFilter, task.AmbariServerFilter)
-				filteredHosts = a.GetFilteredHosts(filter)
-			}
-			if task.Type == RemoteCommand {
-				a.ExecuteRemoteCommandTask(task, filteredHosts)
-			}
-			if task.Type == LocalCommand {
-				ExecuteLocalCommandTask(task)
-			}
-			if task.Type == Download {
-				ExecuteDownloadFileTask(task)
-			}
-			if task.Type == Upload {
-				a.ExecuteUploadFileTask(task, filteredHosts)
+		if task.Type == ConfigRollback {
+			var err error
+			if startVersions, err = a.ListCurrentServiceConfigVersions(); err != nil {
+				return err
 			}
-			if task.Type == Config {
-				a.ExecuteConfigCommand(task)
-			}
-			if task.Type == AmbariCommand {
-				a.ExecuteAmbariCommand(task)
-			}
-		} else {
-			if len(task.Name) > 0 {
-				fmt.Println(fmt.Sprintf("Type field for task '%s' is required!", task.Name))
-			} else {
-				fmt.Println("Type field for task is required!")
+			break
+		}
+	}
+	for _, task := range tasks {
+		if len(task.Type) == 0 {
+			return &TaskError{Task: task.Name, Msg: "type field is required"}
+		}
+		filteredHosts := make(map[string]bool)
+		if !task.AmbariAgentFilter {
+			filter := CreateFilter(task.ServiceFilter, task.ComponentFilter, task.HostFilter, task.AmbariServerFilter)
+			var err error
+			filteredHosts, err = a.GetFilteredHosts(filter)
+			if err != nil {
+				return err
 			}
-			os.Exit(1)
+		}
+		var err error
+		if task.Type == RemoteCommand {
+			err = a.ExecuteRemoteCommandTask(task, filteredHosts)
+		}
+		if task.Type == LocalCommand {
+			err = ExecuteLocalCommandTask(task)
+		}
+		if task.Type == Download {
+			err = a.ExecuteDownloadFileTask(task)
+		}
+		if task.Type == Upload {
+			err = a.ExecuteUploadFileTask(task, filteredHosts)
+		}
+		if task.Type == Config {
+			err = a.ExecuteConfigCommand(task)
+		}
+		if task.Type == AmbariCommand {
+			err = a.ExecuteAmbariCommand(task)
+		}
+		if task.Type == ConfigRollback {
+			err = a.ExecuteConfigRollbackTask(task, startVersions)
+		}
+		if task.Type == AddHost || task.Type == DecommissionHost || task.Type == RecommissionHost || task.Type == RemoveHost {
+			err = a.ExecuteHostLifecycleTask(task)
+		}
+		if err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
 // ExecuteAmbariCommand executes an ambari command against services or components
-func (a AmbariRegistry) ExecuteAmbariCommand(task Task) {
+// (RESTART can be done in rolling mode with rolling: "true", batch_size, batch_wait (seconds) and max_failures parameters)
+func (a AmbariRegistry) ExecuteAmbariCommand(task Task) error {
 	if len(task.Command) > 0 {
 		useComponentFilter := false
 		useServiceFilter := false
@@ -159,119 +196,213 @@ func (a AmbariRegistry) ExecuteAmbariCommand(task Task) {
 		} else if len(task.ServiceFilter) > 0 {
 			useServiceFilter = true
 		}
-
+		var filter Filter
 		if useComponentFilter {
-			filter := CreateFilter("", task.ComponentFilter, "", false)
-			a.RunAmbariServiceCommand(task.Command, filter, useServiceFilter, useComponentFilter)
+			filter = CreateFilter("", task.ComponentFilter, "", false)
+		} else if useServiceFilter {
+			filter = CreateFilter(task.ServiceFilter, "", "", false)
+		} else {
+			return nil
+		}
+		if task.Parameters["rolling"] == "true" {
+			if strings.ToUpper(task.Command) != "RESTART" {
+				return &TaskError{Task: task.Name, Msg: "rolling mode is supported only for RESTART command"}
+			}
+			rolling, err := createRollingRestart(task)
+			if err != nil {
+				return err
+			}
+			return a.RollingRestartServiceOrComponent(filter, useServiceFilter, useComponentFilter, rolling)
+		}
+		return a.RunAmbariServiceCommand(task.Command, filter, useServiceFilter, useComponentFilter)
+	}
+	return nil
+}
+
+func createRollingRestart(task Task) (RollingRestart, error) {
+	waitSeconds, maxFailures := 0, 0
+	var err error
+	if batchWait, ok := task.Parameters["batch_wait"]; ok {
+		if waitSeconds, err = strconv.Atoi(batchWait); err != nil {
+			return RollingRestart{}, &TaskError{Task: task.Name, Msg: fmt.Sprintf("'batch_wait' parameter needs to be a number of seconds (got: '%s')", batchWait)}
 		}
-		if useServiceFilter {
-			filter := CreateFilter(task.ServiceFilter, "", "", false)
-			a.RunAmbariServiceCommand(task.Command, filter, useServiceFilter, useComponentFilter)
+	}
+	if maxFailuresVal, ok := task.Parameters["max_failures"]; ok {
+		if maxFailures, err = strconv.Atoi(maxFailuresVal); err != nil {
+			return RollingRestart{}, &TaskError{Task: task.Name, Msg: fmt.Sprintf("'max_failures' parameter needs to be a number (got: '%s')", maxFailuresVal)}
 		}
 	}
+	rolling, err := ParseRollingRestart(task.Parameters["batch_size"], time.Duration(waitSeconds)*time.Second, maxFailures)
+	if err != nil {
+		return RollingRestart{}, &TaskError{Task: task.Name, Msg: err.Error()}
+	}
+	return rolling, nil
 }
 
-// ExecuteConfigCommand executes a configuration upgrade
-func (a AmbariRegistry) ExecuteConfigCommand(task Task) {
+// ExecuteHostLifecycleTask adds, decommissions, recommissions or removes the hosts (host names) of a task
+// (AddHost: template and host_group parameters, start: "false" skips starting the components, DecommissionHost / RecommissionHost:
+// components filter is optional, RemoveHost: force: "true" skips the decommission check)
+func (a AmbariRegistry) ExecuteHostLifecycleTask(task Task) error {
+	if len(task.HostFilter) == 0 {
+		return &TaskError{Task: task.Name, Msg: fmt.Sprintf("'hosts' field is required for '%s' task", task.Type)}
+	}
+	hosts := strings.Split(task.HostFilter, ",")
+	switch task.Type {
+	case AddHost:
+		templateFile, ok := task.Parameters["template"]
+		if !ok {
+			return &TaskError{Task: task.Name, Msg: "'template' parameter is required for 'AddHost' task"}
+		}
+		hostGroup, err := LoadHostGroupTemplate(templateFile, task.Parameters["host_group"])
+		if err != nil {
+			return err
+		}
+		return a.AddHosts(hosts, hostGroup, task.Parameters["start"] != "false")
+	case DecommissionHost, RecommissionHost:
+		var components []string
+		if len(task.ComponentFilter) > 0 {
+			components = strings.Split(strings.ToUpper(task.ComponentFilter), ",")
+		}
+		return a.DecommissionHosts(hosts, components, task.Type == RecommissionHost)
+	case RemoveHost:
+		return a.RemoveHosts(hosts, task.Parameters["force"] == "true")
+	}
+	return nil
+}
+
+// ExecuteConfigCommand executes a configuration upgrade (config_key / config_value or set.<key> parameters for setting values,
+// delete_keys parameter (comma separated) for deleting keys, config_group and version_note parameters are optional)
+func (a AmbariRegistry) ExecuteConfigCommand(task Task) error {
 	if task.Parameters != nil {
-		haveConfigType := false
-		haveConfigKey := false
-		haveConfigValue := false
-		if configType, ok := task.Parameters["config_type"]; ok {
-			haveConfigType = true
-			if configKey, ok := task.Parameters["config_key"]; ok {
-				haveConfigKey = true
-				if configValue, ok := task.Parameters["config_value"]; ok {
-					haveConfigValue = true
-					a.SetConfig(configType, configKey, configValue)
+		configType, ok := task.Parameters["config_type"]
+		if !ok {
+			return &TaskError{Task: task.Name, Msg: "'config_type' parameter is required for 'Config' task"}
+		}
+		update := ConfigUpdate{ConfigType: configType, Set: make(map[string]string), ConfigGroup: task.Parameters["config_group"], VersionNote: task.Parameters["version_note"]}
+		if configKey, ok := task.Parameters["config_key"]; ok {
+			configValue, ok := task.Parameters["config_value"]
+			if !ok {
+				return &TaskError{Task: task.Name, Msg: "'config_value' parameter is required for 'Config' task if 'config_key' is used"}
+			}
+			update.Set[configKey] = configValue
+		}
+		for parameter, value := range task.Parameters {
+			if strings.HasPrefix(parameter, "set.") {
+				update.Set[strings.TrimPrefix(parameter, "set.")] = value
+			}
+		}
+		if deleteKeys, ok := task.Parameters["delete_keys"]; ok {
+			for _, key := range strings.Split(deleteKeys, ",") {
+				if key = strings.TrimSpace(key); len(key) > 0 {
+					update.Delete = append(update.Delete, key)
 				}
 			}
 		}
-		if !haveConfigType {
-			fmt.Println("'config_type' parameter is required for 'Upload' task")
-			os.Exit(1)
+		if len(update.Set) == 0 && len(update.Delete) == 0 {
+			return &TaskError{Task: task.Name, Msg: "'config_key' / 'config_value', 'set.<key>' or 'delete_keys' parameters are required for 'Config' task"}
 		}
-		if !haveConfigKey {
-			fmt.Println("'config_key' parameter is required for 'Upload' task")
-			os.Exit(1)
+		return a.UpdateConfig(update)
+	}
+	return nil
+}
+
+// ExecuteConfigRollbackTask rolls back the configuration of a service ('service' parameter) to a service config version: 'version' parameter
+// (a number, 'previous' or 'playbook_start' - the version that was current when the playbook was started) or 'tag' parameter, 'note' parameter is optional
+func (a AmbariRegistry) ExecuteConfigRollbackTask(task Task, startVersions []ServiceConfigVersion) error {
+	service := strings.ToUpper(task.Parameters["service"])
+	if len(service) == 0 {
+		return &TaskError{Task: task.Name, Msg: "'service' parameter is required for 'ConfigRollback' task"}
+	}
+	version, tag := task.Parameters["version"], task.Parameters["tag"]
+	if len(version) == 0 && len(tag) == 0 {
+		return &TaskError{Task: task.Name, Msg: "'version' or 'tag' parameter is required for 'ConfigRollback' task"}
+	}
+	if version == PlaybookStartVersion {
+		version = ""
+		for _, startVersion := range startVersions {
+			if startVersion.ServiceName == service && getGroupName(startVersion) == defaultConfigGroupName {
+				version = strconv.Itoa(startVersion.Version)
+			}
 		}
-		if !haveConfigValue {
-			fmt.Println("'config_value' parameter is required for 'Upload' task")
-			os.Exit(1)
+		if len(version) == 0 {
+			return &TaskError{Task: task.Name, Msg: fmt.Sprintf("no service config version found for service '%s' at playbook start", service)}
 		}
 	}
+	target, err := a.ResolveServiceConfigVersion(service, version, tag)
+	if err != nil {
+		return err
+	}
+	diffs, current, err := a.DiffServiceConfigRollback(target)
+	if err != nil {
+		return err
+	}
+	if current.Version == target.Version {
+		fmt.Println(fmt.Sprintf("Service config version %v is already the current one for service '%s'", target.Version, service))
+		return nil
+	}
+	fmt.Println(fmt.Sprintf("Rollback service '%s' configs from version %v to version %v:", service, current.Version, target.Version))
+	fmt.Print(FormatConfigDiffs(diffs))
+	return a.RollbackServiceConfig(service, target.Version, task.Parameters["note"])
 }
 
 // ExecuteRemoteCommandTask executes a remote command on filtered hosts
-func (a AmbariRegistry) ExecuteRemoteCommandTask(task Task, filteredHosts map[string]bool) {
+func (a AmbariRegistry) ExecuteRemoteCommandTask(task Task, filteredHosts map[string]bool) error {
 	if len(task.Command) > 0 {
 		fmt.Println("Execute remote command: " + task.Command)
-		a.RunRemoteHostCommand(task.Command, filteredHosts, task.AmbariServerFilter)
+		_, err := a.RunRemoteHostCommand(task.Command, filteredHosts, task.AmbariServerFilter)
+		return err
 	}
+	return nil
 }
 
 // ExecuteUploadFileTask upload a file to specific (filtered) hosts
-func (a AmbariRegistry) ExecuteUploadFileTask(task Task, filteredHosts map[string]bool) {
+func (a AmbariRegistry) ExecuteUploadFileTask(task Task, filteredHosts map[string]bool) error {
 	if task.Parameters != nil {
-		haveSourceFile := false
-		haveTargetFile := false
-		if sourceVal, ok := task.Parameters["source"]; ok {
-			haveSourceFile = true
-			if targetVal, ok := task.Parameters["target"]; ok {
-				haveTargetFile = true
-				fmt.Println(fmt.Sprintf("Execute upload file command - source: %s, target: %s",
-					task.Parameters["source"], task.Parameters["target"]))
-				a.CopyToRemote(sourceVal, targetVal, filteredHosts, task.AmbariServerFilter)
-			}
+		sourceVal, ok := task.Parameters["source"]
+		if !ok {
+			return &TaskError{Task: task.Name, Msg: "'source' parameter is required for 'Upload' task"}
 		}
-		if !haveSourceFile {
-			fmt.Println("'source' parameter is required for 'Upload' task")
-			os.Exit(1)
+		targetVal, ok := task.Parameters["target"]
+		if !ok {
+			return &TaskError{Task: task.Name, Msg: "'target' parameter is required for 'Upload' task"}
 		}
-		if !haveTargetFile {
-			fmt.Println("'target' parameter is required for 'Upload' task")
-			os.Exit(1)
-		}
-
+		fmt.Println(fmt.Sprintf("Execute upload file command - source: %s, target: %s", sourceVal, targetVal))
+		return a.CopyToRemote(sourceVal, targetVal, filteredHosts, task.AmbariServerFilter)
 	}
+	return nil
 }
 
 // ExecuteLocalCommandTask executes a local shell command
-func ExecuteLocalCommandTask(task Task) {
+func ExecuteLocalCommandTask(task Task) error {
 	if len(task.Command) > 0 {
 		fmt.Println("Execute local command: " + task.Command)
 		splitted := strings.Split(task.Command, " ")
+		var err error
 		if len(splitted) == 1 {
-			RunLocalCommand(splitted[0])
+			_, _, err = RunLocalCommand(splitted[0])
 		} else {
-			RunLocalCommand(splitted[0], splitted[1:]...)
+			_, _, err = RunLocalCommand(splitted[0], splitted[1:]...)
 		}
+		return err
 	}
+	return nil
 }
 
 // ExecuteDownloadFileTask download a file from an url to the local filesystem
-func ExecuteDownloadFileTask(task Task) {
+func (a AmbariRegistry) ExecuteDownloadFileTask(task Task) error {
 	if task.Parameters != nil {
-		haveUrl := false
-		haveFile := false
-		if urlVal, ok := task.Parameters["url"]; ok {
-			haveUrl = true
-			if fileVal, ok := task.Parameters["file"]; ok {
-				haveFile = true
-				fmt.Println(fmt.Sprintf("Execute download file command - url: %s, location: %s",
-					task.Parameters["url"], task.Parameters["file"]))
-				DownloadFile(fileVal, urlVal)
-			}
-		}
-		if !haveFile {
-			fmt.Println("'file' parameter is required for 'Download' task")
-			os.Exit(1)
+		urlVal, ok := task.Parameters["url"]
+		if !ok {
+			return &TaskError{Task: task.Name, Msg: "'url' parameter is required for 'Download' task"}
 		}
-		if !haveUrl {
-			fmt.Println("'url' parameter is required for 'Download' task")
-			os.Exit(1)
+		fileVal, ok := task.Parameters["file"]
+		if !ok {
+			return &TaskError{Task: task.Name, Msg: "'file' parameter is required for 'Download' task"}
 		}
+		fmt.Println(fmt.Sprintf("Execute download file command - url: %s, location: %s", urlVal, fileVal))
+		return a.DownloadFile(fileVal, urlVal)
 	}
+	return nil
 }
 
 func createVarMap(varMapStr string) map[string]interface{} {
@@ -17,7 +17,9 @@ package ambari
 import (
 	"encoding/json"
 	"fmt"
-	"os"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -58,31 +60,50 @@ func GetConfigValue(blueprint map[string]interface{}, configType string, configP
 	return ""
 }
 
-// GetMinimalBlueprint obtain minimal blueprint - compare properties with stack default properties and get a minimal blueprint configuration
-func (a AmbariRegistry) GetMinimalBlueprint(blueprint map[string]interface{}, stackDefaults map[string]StackConfig) []byte {
-	if configurationsVal, ok := blueprint["configurations"]; ok {
-		miniConfig := make(map[string]map[string]interface{})
-		configEntries := configurationsVal.([]interface{})
-		for _, configEntry := range configEntries {
-			confI := configEntry.(map[string]interface{})
+// MinimalBlueprintOptions options for the minimal blueprint export: properties that match any of the keep patterns (<config type>/<property> or <property>,
+// e.g.: core-site/fs.* or *_user) are always emitted, password properties are removed if redact is set (use default_password in the cluster creation template instead)
+type MinimalBlueprintOptions struct {
+	Keep   []string
+	Redact bool
+}
+
+// GetMinimalBlueprint obtain minimal blueprint - compare properties, property attributes (like final) and host group configurations with stack default properties and get a minimal blueprint configuration,
+// properties that do not exist in the stack are kept, host group configurations are kept only if they differ from the cluster level (or stack default) values
+func (a AmbariRegistry) GetMinimalBlueprint(blueprint map[string]interface{}, stackDefaults map[string]StackConfig, options MinimalBlueprintOptions) ([]byte, error) {
+	for _, pattern := range options.Keep {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid keep pattern '%s': %v", pattern, err)
+		}
+	}
+	stackProperties := make(map[string]map[string]StackProperty)
+	for configType, stackConfig := range stackDefaults {
+		stackProperties[configType] = make(map[string]StackProperty)
+		for _, stackProperty := range stackConfig.Properties {
+			stackProperties[configType][stackProperty.Name] = stackProperty
+		}
+	}
+	clusterProperties := make(map[string]map[string]interface{})
+	if configurationsVal, ok := blueprint["configurations"].([]interface{}); ok {
+		for _, configEntry := range configurationsVal {
+			confI, _ := configEntry.(map[string]interface{})
 			for configType, props := range confI {
-				stackDefaultsConfigType := stackDefaults[configType]
-				propsI := props.(map[string]interface{})
-				properties := propsI["properties"].(map[string]interface{})
-				stackDefaultProperties := stackDefaultsConfigType.Properties
-				for propertyKey, propertyVal := range properties {
-					property := propertyVal.(string)
-					for _, stackDefaultProperty := range stackDefaultProperties {
-						fillConfWithChangedProperties(stackDefaultProperty, propertyKey, property, miniConfig, configType)
-					}
+				propsI, _ := props.(map[string]interface{})
+				if properties, ok := propsI["properties"].(map[string]interface{}); ok {
+					clusterProperties[configType] = properties
 				}
 			}
 		}
-		if len(miniConfig) > 0 {
-			configurations := convertToConfigurationsFromMap(miniConfig)
-			blueprint["configurations"] = configurations
-		} else {
-			blueprint["configurations"] = make([]interface{}, 0)
+		blueprint["configurations"] = getMinimalConfigurations(configurationsVal, stackProperties, nil, options)
+	}
+	if hostGroupsVal, ok := blueprint["host_groups"].([]interface{}); ok {
+		for _, hostGroupVal := range hostGroupsVal {
+			hostGroup, ok := hostGroupVal.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if configurationsVal, ok := hostGroup["configurations"].([]interface{}); ok {
+				hostGroup["configurations"] = getMinimalConfigurations(configurationsVal, stackProperties, clusterProperties, options)
+			}
 		}
 	}
 	if blueprintsVal, ok := blueprint["Blueprints"]; ok {
@@ -104,43 +125,94 @@ func (a AmbariRegistry) GetMinimalBlueprint(blueprint map[string]interface{}, st
 		}
 		blueprint["Blueprints"] = blueprintsConfigs
 	}
-	bodyBytes, err := json.Marshal(blueprint)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-	return bodyBytes
+	return json.Marshal(blueprint)
 }
 
-func fillConfWithChangedProperties(stackDefaultProperty StackProperty, propertyKey string, property string, miniConfig map[string]map[string]interface{}, configType string) {
-	if strings.Compare(stackDefaultProperty.Name, propertyKey) == 0 {
-		if (propertyKey == "content" && strings.Compare(strings.TrimSpace(stackDefaultProperty.Value), strings.TrimSpace(property)) != 0) ||
-			(propertyKey != "content" && strings.Compare(stackDefaultProperty.Value, property) != 0) {
-			if configTypeVal, ok := miniConfig[configType]; ok {
-				properties := configTypeVal["properties"].(map[string]interface{})
-				properties[propertyKey] = property
-				miniConfig[configType]["properties"] = properties
-			} else {
-				properties := make(map[string]interface{})
-				propertyAttributes := make(map[string]interface{})
+// getMinimalConfigurations filters the changed properties and property attributes of blueprint configurations (cluster level configurations if clusterProperties is nil, otherwise host group configurations)
+func getMinimalConfigurations(configurations []interface{}, stackProperties map[string]map[string]StackProperty, clusterProperties map[string]map[string]interface{}, options MinimalBlueprintOptions) []interface{} {
+	minimalConfigurations := make([]interface{}, 0)
+	for _, configEntry := range configurations {
+		confI, ok := configEntry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var configTypes []string
+		for configType := range confI {
+			configTypes = append(configTypes, configType)
+		}
+		sort.Strings(configTypes)
+		for _, configType := range configTypes {
+			propsI, ok := confI[configType].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			properties, _ := propsI["properties"].(map[string]interface{})
+			minimalProperties := make(map[string]interface{})
+			for propertyKey, propertyVal := range properties {
+				stackProperty, inStack := stackProperties[configType][propertyKey]
+				if options.Redact && isPasswordProperty(StackProperty{Name: propertyKey, PropertyType: stackProperty.PropertyType}) {
+					continue
+				}
+				defaultVal, hasDefault := clusterProperties[configType][propertyKey]
+				if !hasDefault && inStack {
+					defaultVal, hasDefault = stackProperty.Value, true
+				}
+				if !hasDefault || options.isKept(configType, propertyKey) || isChangedProperty(propertyKey, fmt.Sprint(propertyVal), fmt.Sprint(defaultVal)) {
+					minimalProperties[propertyKey] = propertyVal
+				}
+			}
+			propertyAttributes, _ := propsI["properties_attributes"].(map[string]interface{})
+			minimalPropertyAttributes := make(map[string]interface{})
+			for attributeName, attributeVal := range propertyAttributes {
+				attributeValues, ok := attributeVal.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				minimalAttributeValues := make(map[string]interface{})
+				for propertyKey, value := range attributeValues {
+					stackProperty, inStack := stackProperties[configType][propertyKey]
+					if options.Redact && isPasswordProperty(StackProperty{Name: propertyKey, PropertyType: stackProperty.PropertyType}) {
+						continue
+					}
+					defaultValue, hasDefault := stackProperty.Attributes[attributeName]
+					if attributeName == "final" {
+						defaultValue, hasDefault = strconv.FormatBool(inStack && stackProperty.Final), true
+					}
+					if !hasDefault || options.isKept(configType, propertyKey) || fmt.Sprint(value) != defaultValue {
+						minimalAttributeValues[propertyKey] = value
+					}
+				}
+				if len(minimalAttributeValues) > 0 {
+					minimalPropertyAttributes[attributeName] = minimalAttributeValues
+				}
+			}
+			if len(minimalProperties) > 0 || len(minimalPropertyAttributes) > 0 {
 				propertiesAndAttributes := make(map[string]interface{})
-				properties[propertyKey] = property
-				propertiesAndAttributes["properties"] = properties
-				propertiesAndAttributes["properties_attributes"] = propertyAttributes
-				miniConfig[configType] = propertiesAndAttributes
+				propertiesAndAttributes["properties"] = minimalProperties
+				propertiesAndAttributes["properties_attributes"] = minimalPropertyAttributes
+				minimalConfigurations = append(minimalConfigurations, map[string]interface{}{configType: propertiesAndAttributes})
 			}
 		}
 	}
+	return minimalConfigurations
 }
 
-func convertToConfigurationsFromMap(minimalConfig map[string]map[string]interface{}) []map[string]map[string]interface{} {
-	configurations := make([]map[string]map[string]interface{}, len(minimalConfig))
-	cnt := 0
-	for propertyKey, propertyValue := range minimalConfig {
-		confMap := make(map[string]map[string]interface{})
-		confMap[propertyKey] = propertyValue
-		configurations[cnt] = confMap
-		cnt++
+func isChangedProperty(propertyKey string, property string, defaultProperty string) bool {
+	if propertyKey == "content" {
+		return strings.TrimSpace(property) != strings.TrimSpace(defaultProperty)
+	}
+	return property != defaultProperty
+}
+
+func (o MinimalBlueprintOptions) isKept(configType string, propertyKey string) bool {
+	for _, pattern := range o.Keep {
+		name := propertyKey
+		if strings.Contains(pattern, "/") {
+			name = configType + "/" + propertyKey
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
 	}
-	return configurations
+	return false
 }
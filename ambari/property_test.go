@@ -0,0 +1,101 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGetMinimalConfigurations(t *testing.T) {
+	stackProperties := map[string]map[string]StackProperty{
+		"core-site": {
+			"fs.defaultFS":      {Name: "fs.defaultFS", Value: "hdfs://localhost:8020", Final: true},
+			"fs.trash.interval": {Name: "fs.trash.interval", Value: "360"},
+		},
+		"hdfs-site": {
+			"dfs.replication": {Name: "dfs.replication", Value: "3", Attributes: map[string]string{"maximum": "10"}},
+		},
+		"hadoop-env": {
+			"content":       {Name: "content", Value: "export HADOOP_HEAPSIZE=1024\n"},
+			"hdfs_password": {Name: "hdfs_password", PropertyType: "PASSWORD"},
+		},
+	}
+	tests := []struct {
+		name              string
+		configurations    string
+		clusterProperties map[string]map[string]interface{}
+		options           MinimalBlueprintOptions
+		expected          string
+	}{
+		{
+			name:           "stack default values are removed",
+			configurations: `[{"core-site":{"properties":{"fs.trash.interval":"360","fs.defaultFS":"hdfs://h1:8020","custom.key":"x"}}},{"hdfs-site":{"properties":{"dfs.replication":"3"}}}]`,
+			expected:       `[{"core-site":{"properties":{"fs.defaultFS":"hdfs://h1:8020","custom.key":"x"},"properties_attributes":{}}}]`,
+		},
+		{
+			name:           "content is compared without surrounding whitespace",
+			configurations: `[{"hadoop-env":{"properties":{"content":"\n export HADOOP_HEAPSIZE=1024 \n"}}},{"hadoop-env":{"properties":{"content":"export HADOOP_HEAPSIZE=2048"}}}]`,
+			expected:       `[{"hadoop-env":{"properties":{"content":"export HADOOP_HEAPSIZE=2048"},"properties_attributes":{}}}]`,
+		},
+		{
+			name:           "property attributes",
+			configurations: `[{"core-site":{"properties":{},"properties_attributes":{"final":{"fs.defaultFS":"true","fs.trash.interval":"true","custom.key":"false"}}}},{"hdfs-site":{"properties":{},"properties_attributes":{"maximum":{"dfs.replication":"10"},"minimum":{"dfs.replication":"1"}}}}]`,
+			expected:       `[{"core-site":{"properties":{},"properties_attributes":{"final":{"fs.trash.interval":"true"}}}},{"hdfs-site":{"properties":{},"properties_attributes":{"minimum":{"dfs.replication":"1"}}}}]`,
+		},
+		{
+			name:           "keep patterns",
+			configurations: `[{"core-site":{"properties":{"fs.trash.interval":"360","fs.defaultFS":"hdfs://localhost:8020"}}},{"hdfs-site":{"properties":{"dfs.replication":"3"},"properties_attributes":{"maximum":{"dfs.replication":"10"}}}}]`,
+			options:        MinimalBlueprintOptions{Keep: []string{"fs.trash.*", "hdfs-site/*"}},
+			expected:       `[{"core-site":{"properties":{"fs.trash.interval":"360"},"properties_attributes":{}}},{"hdfs-site":{"properties":{"dfs.replication":"3"},"properties_attributes":{"maximum":{"dfs.replication":"10"}}}}]`,
+		},
+		{
+			name:           "passwords are redacted",
+			configurations: `[{"hadoop-env":{"properties":{"hdfs_password":"secret","ssl.keystore.password":"secret","hdfs_user":"hdfs"},"properties_attributes":{"hidden":{"hdfs_password":"true"}}}}]`,
+			options:        MinimalBlueprintOptions{Redact: true},
+			expected:       `[{"hadoop-env":{"properties":{"hdfs_user":"hdfs"},"properties_attributes":{}}}]`,
+		},
+		{
+			name:           "passwords are kept without redaction",
+			configurations: `[{"hadoop-env":{"properties":{"hdfs_password":"secret"}}}]`,
+			expected:       `[{"hadoop-env":{"properties":{"hdfs_password":"secret"},"properties_attributes":{}}}]`,
+		},
+		{
+			name:              "host group configurations are compared with the cluster level values",
+			configurations:    `[{"hdfs-site":{"properties":{"dfs.replication":"2"}}},{"core-site":{"properties":{"fs.trash.interval":"360","fs.defaultFS":"hdfs://h1:8020"}}}]`,
+			clusterProperties: map[string]map[string]interface{}{"hdfs-site": {"dfs.replication": "2"}, "core-site": {"fs.trash.interval": "0", "fs.defaultFS": "hdfs://h1:8020"}},
+			expected:          `[{"core-site":{"properties":{"fs.trash.interval":"360"},"properties_attributes":{}}}]`,
+		},
+		{
+			name:           "invalid entries are skipped",
+			configurations: `["core-site",{"core-site":"x"}]`,
+			expected:       `[]`,
+		},
+	}
+	for _, test := range tests {
+		var configurations, expected []interface{}
+		if err := json.Unmarshal([]byte(test.configurations), &configurations); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(test.expected), &expected); err != nil {
+			t.Fatal(err)
+		}
+		actual := getMinimalConfigurations(configurations, stackProperties, test.clusterProperties, test.options)
+		if !reflect.DeepEqual(actual, expected) {
+			actualJson, _ := json.Marshal(actual)
+			t.Errorf("%s: getMinimalConfigurations() = %s, want %s", test.name, actualJson, test.expected)
+		}
+	}
+}
@@ -17,11 +17,7 @@ package ambari
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
-	"io/ioutil"
 	"os"
-	"os/user"
-	"path"
 )
 
 const (
@@ -29,265 +25,278 @@ const (
 	connectionProfilesJsonFileName = "connection_profiles.json"
 )
 
-// CreateAmbariRegistryDb initialize ambarictl database
-func CreateAmbariRegistryDb() {
-	ambariServerJsonFile := getJsonDbFile(ambariServerJsonFileName)
-	connectionProfileJsonFile := getJsonDbFile(connectionProfilesJsonFileName)
-	if !exists(ambariServerJsonFile) {
-		ambariServerRegistries := make([]AmbariRegistry, 0)
-		ambariServerJson, _ := json.Marshal(ambariServerRegistries)
-		err := ioutil.WriteFile(ambariServerJsonFile, ambariServerJson, 0644)
-		checkErr(err)
-	}
-	if !exists(connectionProfileJsonFile) {
-		connectionProfiles := make([]ConnectionProfile, 0)
-		connectionProfilesJson, _ := json.Marshal(connectionProfiles)
-		err := ioutil.WriteFile(connectionProfileJsonFile, connectionProfilesJson, 0644)
-		checkErr(err)
-	}
+// CreateAmbariRegistryDb initialize ambarictl database (runs the schema migrations if it is required)
+func CreateAmbariRegistryDb() error {
+	return updateRegistry(func(data *RegistryData) error {
+		return nil
+	})
 }
 
 // DropAmbariRegistryRecords drop all ambari server entries from ambarictl database
-func DropAmbariRegistryRecords() {
+func DropAmbariRegistryRecords() error {
 	ambariServerRegistries := make([]AmbariRegistry, 0)
-	WriteAmbariServerEntries(ambariServerRegistries)
+	return WriteAmbariServerEntries(ambariServerRegistries)
 }
 
 // DropConnectionProfileRecords drop all connection profile from ambarictl database
-func DropConnectionProfileRecords() {
+func DropConnectionProfileRecords() error {
 	connectionProfiles := make([]ConnectionProfile, 0)
-	WriteConnectionProfileEntries(connectionProfiles)
+	return WriteConnectionProfileEntries(connectionProfiles)
 }
 
 // ListAmbariRegistryEntries get all ambari registries from ambarictl database
-func ListAmbariRegistryEntries() []AmbariRegistry {
-	ambariServerJsonFile := getJsonDbFile(ambariServerJsonFileName)
-	file, err := ioutil.ReadFile(ambariServerJsonFile)
-	checkErr(err)
+func ListAmbariRegistryEntries() ([]AmbariRegistry, error) {
 	ambariRegistries := make([]AmbariRegistry, 0)
-	json.Unmarshal(file, &ambariRegistries)
-	return ambariRegistries
+	err := viewRegistry(func(data *RegistryData) error {
+		ambariRegistries = append(ambariRegistries, data.AmbariServers...)
+		return nil
+	})
+	return ambariRegistries, err
 }
 
 // ListConnectionProfileEntries get all ambari registries from ambarictl database
-func ListConnectionProfileEntries() []ConnectionProfile {
-	connectionProfileJsonFile := getJsonDbFile(connectionProfilesJsonFileName)
-	file, err := ioutil.ReadFile(connectionProfileJsonFile)
-	checkErr(err)
+func ListConnectionProfileEntries() ([]ConnectionProfile, error) {
 	connectionProfiles := make([]ConnectionProfile, 0)
-	json.Unmarshal(file, &connectionProfiles)
-	return connectionProfiles
+	err := viewRegistry(func(data *RegistryData) error {
+		connectionProfiles = append(connectionProfiles, data.ConnectionProfiles...)
+		return nil
+	})
+	return connectionProfiles, err
 }
 
 // GetAmbariEntryId get ambari entry id if the id exists
-func GetAmbariEntryId(id string) string {
-	ambariEntries := ListAmbariRegistryEntries()
+func GetAmbariEntryId(id string) (string, error) {
 	ambariEntryId := ""
-	if len(ambariEntries) > 0 {
-		for _, ambariEntry := range ambariEntries {
-			if ambariEntry.Name == id {
-				ambariEntryId = ambariEntry.Name
-			}
+	err := viewRegistry(func(data *RegistryData) error {
+		if findAmbariEntry(data, id) >= 0 {
+			ambariEntryId = id
 		}
-	}
-	return ambariEntryId
+		return nil
+	})
+	return ambariEntryId, err
 }
 
 // GetConnectionProfileEntryId get connection profile entry id if the id exists
-func GetConnectionProfileEntryId(id string) string {
-	connectionProfiles := ListConnectionProfileEntries()
+func GetConnectionProfileEntryId(id string) (string, error) {
 	connectionProfileId := ""
-	if len(connectionProfiles) > 0 {
-		for _, connectionProfileEntry := range connectionProfiles {
-			if connectionProfileEntry.Name == id {
-				connectionProfileId = connectionProfileEntry.Name
-			}
+	err := viewRegistry(func(data *RegistryData) error {
+		if findConnectionProfile(data, id) >= 0 {
+			connectionProfileId = id
 		}
-	}
-	return connectionProfileId
+		return nil
+	})
+	return connectionProfileId, err
 }
 
-// RegisterNewAmbariEntry create new ambari registry entry in ambarictl database
-func RegisterNewAmbariEntry(id string, hostname string, port int, protocol string, username string, password string, cluster string) {
-	checkId := GetAmbariEntryId(id)
-	if len(checkId) > 0 {
-		alreadyExistMsg := fmt.Sprintf("Registry with id '%s' is already defined as a registry entry", checkId)
-		fmt.Println(alreadyExistMsg)
-		os.Exit(1)
-	}
-	ambaiServerEntries := ListAmbariRegistryEntries()
-	newAmbariServerEntry := AmbariRegistry{Name: id, Hostname: hostname, Port: port, Protocol: protocol, Username: username, Password: password, Cluster: cluster, Active: true}
-	ambaiServerEntries = append(ambaiServerEntries, newAmbariServerEntry)
-	WriteAmbariServerEntries(ambaiServerEntries)
+// RegisterNewAmbariEntry create new ambari registry entry in ambarictl database (the password is stored by a secret backend, see StoreSecret)
+func RegisterNewAmbariEntry(id string, hostname string, port int, protocol string, username string, passwordRef SecretRef, cluster string, timeout int, retries int, tlsSettings TLSSettings) error {
+	return updateRegistry(func(data *RegistryData) error {
+		if findAmbariEntry(data, id) >= 0 {
+			return &RegistryError{Kind: "ambari server entry", ID: id, Msg: "already defined as a registry entry"}
+		}
+		newAmbariServerEntry := AmbariRegistry{Name: id, Hostname: hostname, Port: port, Protocol: protocol, Username: username, PasswordRef: passwordRef, Cluster: cluster, Active: true,
+			Timeout: timeout, Retries: retries, TLS: tlsSettings}
+		data.AmbariServers = append(data.AmbariServers, newAmbariServerEntry)
+		return nil
+	})
 }
 
 // RegisterNewConnectionProfile create new connection profile entry in ambarictl database
-func RegisterNewConnectionProfile(id string, keyPath string, port int, username string, hostJump bool, proxyAddress string) {
-	checkId := GetConnectionProfileEntryId(id)
-	if len(checkId) > 0 {
-		alreadyExistMsg := fmt.Sprintf("Connection profile with id '%s' is already defined as a profile entry", checkId)
-		fmt.Println(alreadyExistMsg)
-		os.Exit(1)
-	}
-	connectionProfiles := ListConnectionProfileEntries()
-	newConnectionProfile := ConnectionProfile{Name: id, KeyPath: keyPath, Port: port, Username: username, HostJump: hostJump, ProxyAddress: proxyAddress}
-	connectionProfiles = append(connectionProfiles, newConnectionProfile)
-	WriteConnectionProfileEntries(connectionProfiles)
+func RegisterNewConnectionProfile(connectionProfile ConnectionProfile) error {
+	return updateRegistry(func(data *RegistryData) error {
+		if findConnectionProfile(data, connectionProfile.Name) >= 0 {
+			return &RegistryError{Kind: "connection profile", ID: connectionProfile.Name, Msg: "already defined as a profile entry"}
+		}
+		data.ConnectionProfiles = append(data.ConnectionProfiles, connectionProfile)
+		return nil
+	})
+}
+
+// UpdateConnectionProfile modify a connection profile entry in ambarictl database
+func UpdateConnectionProfile(id string, fn func(connectionProfile *ConnectionProfile) error) error {
+	return updateRegistry(func(data *RegistryData) error {
+		index := findConnectionProfile(data, id)
+		if index < 0 {
+			return &RegistryError{Kind: "connection profile", ID: id, Msg: "not found"}
+		}
+		return fn(&data.ConnectionProfiles[index])
+	})
 }
 
 // DeRegisterAmbariEntry remove an ambari server enrty by id
-func DeRegisterAmbariEntry(id string) {
-	ambariServers := ListAmbariRegistryEntries()
-	newAmbariServers := make([]AmbariRegistry, 0)
-	if len(ambariServers) > 0 {
-		for index := range ambariServers {
-			if ambariServers[index].Name != id {
-				newAmbariServers = append(newAmbariServers, ambariServers[index])
+func DeRegisterAmbariEntry(id string) error {
+	return updateRegistry(func(data *RegistryData) error {
+		newAmbariServers := make([]AmbariRegistry, 0)
+		for _, ambariServer := range data.AmbariServers {
+			if ambariServer.Name != id {
+				newAmbariServers = append(newAmbariServers, ambariServer)
 			}
 		}
-	}
-	WriteAmbariServerEntries(newAmbariServers)
+		data.AmbariServers = newAmbariServers
+		return nil
+	})
 }
 
 // DeRegisterConnectionProfile remove a connection profile by id
-func DeRegisterConnectionProfile(id string) {
-	connectionProfiles := ListConnectionProfileEntries()
-	newConnectionProfiles := make([]ConnectionProfile, 0)
-	if len(connectionProfiles) > 0 {
-		for index := range connectionProfiles {
-			if connectionProfiles[index].Name != id {
-				newConnectionProfiles = append(newConnectionProfiles, connectionProfiles[index])
+func DeRegisterConnectionProfile(id string) error {
+	return updateRegistry(func(data *RegistryData) error {
+		newConnectionProfiles := make([]ConnectionProfile, 0)
+		for _, connectionProfile := range data.ConnectionProfiles {
+			if connectionProfile.Name != id {
+				newConnectionProfiles = append(newConnectionProfiles, connectionProfile)
 			}
 		}
-	}
-	WriteConnectionProfileEntries(newConnectionProfiles)
+		data.ConnectionProfiles = newConnectionProfiles
+		return nil
+	})
 }
 
 // GetActiveAmbari get the active ambari registry from ambarictl database (should be only one)
-func GetActiveAmbari() AmbariRegistry {
-	ambariServers := ListAmbariRegistryEntries()
+func GetActiveAmbari() (AmbariRegistry, error) {
 	var result AmbariRegistry
-	if len(ambariServers) > 0 {
-		for _, ambariServerEntry := range ambariServers {
+	err := viewRegistry(func(data *RegistryData) error {
+		for _, ambariServerEntry := range data.AmbariServers {
 			if ambariServerEntry.Active {
 				result = ambariServerEntry
 			}
 		}
-	}
-	return result
+		return nil
+	})
+	return result, err
 }
 
 // GetAmbariById get the ambari registry from ambarictl database by id
-func GetAmbariById(searchId string) AmbariRegistry {
-	ambariServers := ListAmbariRegistryEntries()
+func GetAmbariById(searchId string) (AmbariRegistry, error) {
 	var result AmbariRegistry
-	if len(ambariServers) > 0 {
-		for _, ambariServerEntry := range ambariServers {
-			if ambariServerEntry.Name == searchId {
-				result = ambariServerEntry
-			}
+	err := viewRegistry(func(data *RegistryData) error {
+		if index := findAmbariEntry(data, searchId); index >= 0 {
+			result = data.AmbariServers[index]
 		}
+		return nil
+	})
+	return result, err
+}
+
+// getRegistryEntry gets an other ambari server entry by id with resolved secrets (it uses the context of the current entry)
+func (a AmbariRegistry) getRegistryEntry(id string) (AmbariRegistry, error) {
+	ambariServer, err := GetAmbariById(id)
+	if err != nil {
+		return ambariServer, err
+	}
+	if len(ambariServer.Name) == 0 {
+		return ambariServer, &RegistryError{Kind: "ambari server entry", ID: id, Msg: "not found"}
+	}
+	if ambariServer, err = ambariServer.ResolveSecrets(); err != nil {
+		return ambariServer, err
 	}
-	return result
+	return ambariServer.WithContext(a.Context()), nil
 }
 
 // GetConnectionProfileById get the connection profile from ambarictl database by id
-func GetConnectionProfileById(searchId string) ConnectionProfile {
-	connectionProfiles := ListConnectionProfileEntries()
+func GetConnectionProfileById(searchId string) (ConnectionProfile, error) {
 	var result ConnectionProfile
-	if len(connectionProfiles) > 0 {
-		for _, connectionProfileEntry := range connectionProfiles {
-			if connectionProfileEntry.Name == searchId {
-				result = connectionProfileEntry
-			}
+	err := viewRegistry(func(data *RegistryData) error {
+		if index := findConnectionProfile(data, searchId); index >= 0 {
+			result = data.ConnectionProfiles[index]
 		}
-	}
-	return result
+		return nil
+	})
+	return result, err
 }
 
 // SetProfileIdForAmbariEntry attach a connection profile to a specific ambari server entry
-func SetProfileIdForAmbariEntry(ambariEntryId string, profileId string) {
-	ambariServers := ListAmbariRegistryEntries()
-	if len(ambariServers) > 0 {
-		for index := range ambariServers {
-			if ambariServers[index].Name == ambariEntryId {
-				ambariServers[index].ConnectionProfile = profileId
+func SetProfileIdForAmbariEntry(ambariEntryId string, profileId string) error {
+	return updateRegistry(func(data *RegistryData) error {
+		for index := range data.AmbariServers {
+			if data.AmbariServers[index].Name == ambariEntryId {
+				data.AmbariServers[index].ConnectionProfile = profileId
 			}
 		}
-	}
-	WriteAmbariServerEntries(ambariServers)
+		return nil
+	})
 }
 
 // ActiveAmbariRegistry turn on active status on selected ambari registry
-func ActiveAmbariRegistry(id string) {
-	checkId := GetAmbariEntryId(id)
-	if len(checkId) == 0 {
-		alreadyExistMsg := fmt.Sprintf("Not found Ambari server registry  with id '%s'.", checkId)
-		fmt.Println(alreadyExistMsg)
-		os.Exit(1)
-	}
-	ambariServers := ListAmbariRegistryEntries()
-	if len(ambariServers) > 0 {
-		for index := range ambariServers {
-			if ambariServers[index].Name == id {
-				ambariServers[index].Active = true
-			} else {
-				ambariServers[index].Active = false
-			}
+func ActiveAmbariRegistry(id string) error {
+	return updateRegistry(func(data *RegistryData) error {
+		if findAmbariEntry(data, id) < 0 {
+			return &RegistryError{Kind: "ambari server entry", ID: id, Msg: "not found"}
 		}
-	}
-	WriteAmbariServerEntries(ambariServers)
+		for index := range data.AmbariServers {
+			data.AmbariServers[index].Active = data.AmbariServers[index].Name == id
+		}
+		return nil
+	})
 }
 
 // DeactiveAllAmbariRegistry turn off active status on all ambari registries
-func DeactiveAllAmbariRegistry() {
-	ambariServers := ListAmbariRegistryEntries()
-	if len(ambariServers) > 0 {
-		for index := range ambariServers {
-			ambariServers[index].Active = false
+func DeactiveAllAmbariRegistry() error {
+	return updateRegistry(func(data *RegistryData) error {
+		for index := range data.AmbariServers {
+			data.AmbariServers[index].Active = false
 		}
-	}
-	WriteAmbariServerEntries(ambariServers)
+		return nil
+	})
 }
 
-// WriteAmbariServerEntries write ambari server entries to the ambari server registry json file
-func WriteAmbariServerEntries(ambariServers []AmbariRegistry) {
-	ambariServerJson, _ := json.Marshal(ambariServers)
-	ambariServerJsonFile := getJsonDbFile(ambariServerJsonFileName)
-	err := ioutil.WriteFile(ambariServerJsonFile, FormatJson(ambariServerJson).Bytes(), 0600)
-	checkErr(err)
+// WriteAmbariServerEntries replace all ambari server entries in the ambarictl database
+func WriteAmbariServerEntries(ambariServers []AmbariRegistry) error {
+	return updateRegistry(func(data *RegistryData) error {
+		data.AmbariServers = ambariServers
+		return nil
+	})
 }
 
-// WriteConnectionProfileEntries write connection profile entries to the connection profile registry json file
-func WriteConnectionProfileEntries(connectionProfiles []ConnectionProfile) {
-	connectionProfilesJson, _ := json.Marshal(connectionProfiles)
-	connectionProfilesJsonFile := getJsonDbFile(connectionProfilesJsonFileName)
-	err := ioutil.WriteFile(connectionProfilesJsonFile, FormatJson(connectionProfilesJson).Bytes(), 0600)
-	checkErr(err)
+// WriteConnectionProfileEntries replace all connection profile entries in the ambarictl database
+func WriteConnectionProfileEntries(connectionProfiles []ConnectionProfile) error {
+	return updateRegistry(func(data *RegistryData) error {
+		data.ConnectionProfiles = connectionProfiles
+		return nil
+	})
 }
 
 // FormatJson format json file
-func FormatJson(b []byte) *bytes.Buffer {
+func FormatJson(b []byte) (*bytes.Buffer, error) {
 	var out bytes.Buffer
 	err := json.Indent(&out, b, "", "    ")
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return nil, err
 	}
-	return &out
+	return &out, nil
 }
 
-func getJsonDbFile(file string) string {
-	usr, err := user.Current()
+func viewRegistry(fn func(data *RegistryData) error) error {
+	store, err := GetRegistryStore()
 	if err != nil {
-		panic(err)
+		return err
 	}
-	home := usr.HomeDir
-	ambariManagerFolder := path.Join(home, ".ambarictl")
-	if _, err := os.Stat(ambariManagerFolder); os.IsNotExist(err) {
-		os.Mkdir(ambariManagerFolder, os.ModePerm)
+	return store.View(fn)
+}
+
+func updateRegistry(fn func(data *RegistryData) error) error {
+	store, err := GetRegistryStore()
+	if err != nil {
+		return err
 	}
-	return path.Join(ambariManagerFolder, file)
+	return store.Update(fn)
+}
+
+func findAmbariEntry(data *RegistryData, id string) int {
+	for index, ambariServer := range data.AmbariServers {
+		if ambariServer.Name == id {
+			return index
+		}
+	}
+	return -1
+}
+
+func findConnectionProfile(data *RegistryData, id string) int {
+	for index, connectionProfile := range data.ConnectionProfiles {
+		if connectionProfile.Name == id {
+			return index
+		}
+	}
+	return -1
 }
 
 // Exists reports whether the named file or directory exists.
@@ -299,10 +308,3 @@ func exists(name string) bool {
 	}
 	return true
 }
-
-func checkErr(err error) {
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-}
@@ -0,0 +1,123 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultPollInterval wait time between 2 status checks of a tracked Ambari request
+const DefaultPollInterval = 3 * time.Second
+
+var (
+	successfulRequestStatuses = map[string]bool{"COMPLETED": true}
+	failedRequestStatuses     = map[string]bool{"FAILED": true, "ABORTED": true, "TIMEDOUT": true, "SKIPPED_FAILED": true}
+)
+
+type requestResponse struct {
+	Requests AmbariRequest `json:"Requests"`
+	Tasks    []struct {
+		Tasks RequestTask `json:"Tasks"`
+	} `json:"tasks,omitempty"`
+}
+
+// GetRequestIdFromResponse obtain the request id from an Ambari response body (returns false if there is no request id, e.g.: the operation has nothing to do)
+func GetRequestIdFromResponse(body []byte) (int, bool, error) {
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return 0, false, nil
+	}
+	var response requestResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return 0, false, err
+	}
+	if response.Requests.ID == 0 {
+		return 0, false, nil
+	}
+	return response.Requests.ID, true, nil
+}
+
+// GetRequest obtain status, progress and the tasks of an Ambari request by id
+func (a AmbariRegistry) GetRequest(id int) (AmbariRequest, error) {
+	uriSuffix := fmt.Sprintf("requests/%v?fields=Requests/id,Requests/request_status,Requests/request_context,Requests/progress_percent,"+
+		"tasks/Tasks/id,tasks/Tasks/host_name,tasks/Tasks/role,tasks/Tasks/command,tasks/Tasks/status", id)
+	request, err := a.CreateGetRequest(uriSuffix, true)
+	if err != nil {
+		return AmbariRequest{}, err
+	}
+	bodyBytes, err := a.processRequest(request)
+	if err != nil {
+		return AmbariRequest{}, err
+	}
+	var response requestResponse
+	if err := json.Unmarshal(bodyBytes, &response); err != nil {
+		return AmbariRequest{}, err
+	}
+	ambariRequest := response.Requests
+	for _, task := range response.Tasks {
+		ambariRequest.Tasks = append(ambariRequest.Tasks, task.Tasks)
+	}
+	return ambariRequest, nil
+}
+
+// TrackRequest polls an Ambari request until it reaches a terminal status, prints the progress and the task status changes,
+// returns a *RequestFailedError if the request did not complete successfully
+func (a AmbariRegistry) TrackRequest(id int) (AmbariRequest, error) {
+	lastProgress := -1.0
+	taskStatuses := make(map[int]string)
+	for {
+		ambariRequest, err := a.GetRequest(id)
+		if err != nil {
+			return ambariRequest, err
+		}
+		if ambariRequest.ProgressPercent != lastProgress {
+			fmt.Println(fmt.Sprintf("[Request %v: %s] %s - %.0f%%", ambariRequest.ID, ambariRequest.Context, ambariRequest.Status, ambariRequest.ProgressPercent))
+			lastProgress = ambariRequest.ProgressPercent
+		}
+		for _, task := range ambariRequest.Tasks {
+			if taskStatuses[task.ID] != task.Status {
+				fmt.Println(fmt.Sprintf("  %s - %s %s: %s", task.HostName, task.Role, task.Command, task.Status))
+				taskStatuses[task.ID] = task.Status
+			}
+		}
+		if successfulRequestStatuses[ambariRequest.Status] {
+			return ambariRequest, nil
+		}
+		if failedRequestStatuses[ambariRequest.Status] {
+			return ambariRequest, &RequestFailedError{Request: ambariRequest}
+		}
+		select {
+		case <-a.Context().Done():
+			return ambariRequest, a.Context().Err()
+		case <-time.After(DefaultPollInterval):
+		}
+	}
+}
+
+// TrackResponse tracks the Ambari request of a response (returned by an asynchronous operation) until it is finished
+func (a AmbariRegistry) TrackResponse(body []byte) error {
+	id, ok, err := GetRequestIdFromResponse(body)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Println("No request has been created by Ambari (nothing to do)")
+		return nil
+	}
+	_, err = a.TrackRequest(id)
+	return err
+}
@@ -0,0 +1,179 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+const (
+	// PreviousVersion rollback target for the service config version before the current one
+	PreviousVersion = "previous"
+	// PlaybookStartVersion rollback target (in playbooks) for the service config version that was current when the playbook was started
+	PlaybookStartVersion = "playbook_start"
+
+	defaultConfigGroupName = "Default"
+)
+
+// ListServiceConfigVersionHistory obtain all service config versions of a service (without the configurations), sorted by version
+func (a AmbariRegistry) ListServiceConfigVersionHistory(service string) ([]ServiceConfigVersion, error) {
+	uriSuffix := fmt.Sprintf("configurations/service_config_versions?service_name=%s&fields=service_name,service_config_version,group_name,is_current,"+
+		"service_config_version_note,user,createtime", url.QueryEscape(service))
+	return a.listServiceConfigVersions(uriSuffix)
+}
+
+// ListCurrentServiceConfigVersions obtain the current service config versions of all services and config groups (without the configurations)
+func (a AmbariRegistry) ListCurrentServiceConfigVersions() ([]ServiceConfigVersion, error) {
+	return a.listServiceConfigVersions("configurations/service_config_versions?is_current=true&fields=service_name,service_config_version,group_name,is_current")
+}
+
+// GetCurrentServiceConfigVersion obtain the current service config version of a service for a config group (Default: cluster level configs)
+func (a AmbariRegistry) GetCurrentServiceConfigVersion(service string, groupName string) (ServiceConfigVersion, error) {
+	if len(groupName) == 0 {
+		groupName = defaultConfigGroupName
+	}
+	versions, err := a.ListServiceConfigVersionHistory(service)
+	if err != nil {
+		return ServiceConfigVersion{}, err
+	}
+	for _, version := range versions {
+		if version.IsCurrent && getGroupName(version) == groupName {
+			return a.GetServiceConfigVersion(service, version.Version)
+		}
+	}
+	return ServiceConfigVersion{}, fmt.Errorf("no current service config version found for service '%s' (config group: %s)", service, groupName)
+}
+
+// ResolveServiceConfigVersion finds a service config version (with configurations) by version: a number or 'previous' (the version before the current
+// one in the Default config group), or by a config tag (the version that contains a configuration with that tag)
+func (a AmbariRegistry) ResolveServiceConfigVersion(service string, version string, tag string) (ServiceConfigVersion, error) {
+	if len(tag) > 0 {
+		return a.findServiceConfigVersionByTag(service, tag)
+	}
+	if version == PreviousVersion {
+		versions, err := a.ListServiceConfigVersionHistory(service)
+		if err != nil {
+			return ServiceConfigVersion{}, err
+		}
+		current := -1
+		for _, serviceConfigVersion := range versions {
+			if serviceConfigVersion.IsCurrent && getGroupName(serviceConfigVersion) == defaultConfigGroupName {
+				current = serviceConfigVersion.Version
+			}
+		}
+		previous := -1
+		for _, serviceConfigVersion := range versions {
+			if getGroupName(serviceConfigVersion) == defaultConfigGroupName && serviceConfigVersion.Version < current && serviceConfigVersion.Version > previous {
+				previous = serviceConfigVersion.Version
+			}
+		}
+		if previous < 0 {
+			return ServiceConfigVersion{}, fmt.Errorf("service '%s' does not have a previous service config version", service)
+		}
+		return a.GetServiceConfigVersion(service, previous)
+	}
+	versionNumber, err := strconv.Atoi(version)
+	if err != nil {
+		return ServiceConfigVersion{}, fmt.Errorf("invalid service config version '%s' (use a number or '%s')", version, PreviousVersion)
+	}
+	return a.GetServiceConfigVersion(service, versionNumber)
+}
+
+// DiffServiceConfigRollback compares the current service config version (of the same config group) with a target version, returns the differences
+// that the rollback would apply and the current version
+func (a AmbariRegistry) DiffServiceConfigRollback(target ServiceConfigVersion) ([]ConfigDiff, ServiceConfigVersion, error) {
+	current, err := a.GetCurrentServiceConfigVersion(target.ServiceName, getGroupName(target))
+	if err != nil {
+		return nil, current, err
+	}
+	return DiffConfigurations(getServiceConfigVersionProperties(current), getServiceConfigVersionProperties(target), nil), current, nil
+}
+
+// RollbackServiceConfig makes a service config version the current one (creates a new service config version with the configurations of the target version)
+func (a AmbariRegistry) RollbackServiceConfig(service string, version int, versionNote string) error {
+	if len(versionNote) == 0 {
+		versionNote = fmt.Sprintf("AMBARICTL - Rollback to service config version %v", version)
+	}
+	desiredServiceConfigVersion := map[string]interface{}{
+		"service_name":                service,
+		"service_config_version":      version,
+		"service_config_version_note": versionNote,
+	}
+	body, err := json.Marshal(map[string]interface{}{"Clusters": map[string]interface{}{"desired_service_config_versions": desiredServiceConfigVersion}})
+	if err != nil {
+		return err
+	}
+	request, err := a.CreatePutRequest(*bytes.NewBuffer(body), "clusters/"+a.Cluster, false)
+	if err != nil {
+		return err
+	}
+	_, err = a.processRequest(request)
+	return err
+}
+
+func (a AmbariRegistry) findServiceConfigVersionByTag(service string, tag string) (ServiceConfigVersion, error) {
+	uriSuffix := fmt.Sprintf("configurations/service_config_versions?service_name=%s&fields=*", url.QueryEscape(service))
+	versions, err := a.listServiceConfigVersions(uriSuffix)
+	if err != nil {
+		return ServiceConfigVersion{}, err
+	}
+	for _, version := range versions {
+		for _, configuration := range version.Configurations {
+			if configuration.Tag == tag {
+				return version, nil
+			}
+		}
+	}
+	return ServiceConfigVersion{}, fmt.Errorf("no service config version found for service '%s' with config tag '%s'", service, tag)
+}
+
+func (a AmbariRegistry) listServiceConfigVersions(uriSuffix string) ([]ServiceConfigVersion, error) {
+	request, err := a.CreateGetRequest(uriSuffix, true)
+	if err != nil {
+		return nil, err
+	}
+	bodyBytes, err := a.processRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	var response serviceConfigVersionsResponse
+	if err := json.Unmarshal(bodyBytes, &response); err != nil {
+		return nil, err
+	}
+	sort.Slice(response.Items, func(i, j int) bool {
+		return response.Items[i].Version < response.Items[j].Version
+	})
+	return response.Items, nil
+}
+
+func getServiceConfigVersionProperties(version ServiceConfigVersion) map[string]map[string]string {
+	properties := make(map[string]map[string]string)
+	for _, configuration := range version.Configurations {
+		properties[configuration.Type] = configuration.Properties
+	}
+	return properties
+}
+
+func getGroupName(version ServiceConfigVersion) string {
+	if len(version.GroupName) == 0 {
+		return defaultConfigGroupName
+	}
+	return version.GroupName
+}
@@ -0,0 +1,236 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRollingBatchSize number of hosts where the host components are restarted at the same time during a rolling restart
+	DefaultRollingBatchSize = "1"
+
+	rollingStateChecks = 5
+)
+
+// RollingRestart holds the settings of a rolling restart: the host components are restarted in batches (number of hosts or percentage of the hosts),
+// after every batch the restarted host components need to be STARTED, otherwise their hosts are counted as failed
+type RollingRestart struct {
+	BatchSize    int
+	BatchPercent int
+	Wait         time.Duration
+	MaxFailures  int
+}
+
+// rollingRestartProgress holds the state of a rolling restart across components
+type rollingRestartProgress struct {
+	failedHosts map[string]bool
+	batches     int
+}
+
+// ParseRollingRestart creates rolling restart settings from a batch size (like 2 or 25%), the wait time between batches and the number of tolerated host failures
+func ParseRollingRestart(batchSize string, wait time.Duration, maxFailures int) (RollingRestart, error) {
+	rolling := RollingRestart{Wait: wait, MaxFailures: maxFailures}
+	if wait < 0 {
+		return rolling, fmt.Errorf("wait time between batches cannot be negative (got: %v)", wait)
+	}
+	if maxFailures < 0 {
+		return rolling, fmt.Errorf("number of tolerated host failures cannot be negative (got: %v)", maxFailures)
+	}
+	batchSize = strings.TrimSpace(batchSize)
+	if len(batchSize) == 0 {
+		batchSize = DefaultRollingBatchSize
+	}
+	if strings.HasSuffix(batchSize, "%") {
+		percent, err := strconv.Atoi(strings.TrimSuffix(batchSize, "%"))
+		if err != nil || percent <= 0 || percent > 100 {
+			return rolling, fmt.Errorf("invalid batch size '%s' (use a number of hosts or a percentage between 1%% and 100%%)", batchSize)
+		}
+		rolling.BatchPercent = percent
+		return rolling, nil
+	}
+	size, err := strconv.Atoi(batchSize)
+	if err != nil || size <= 0 {
+		return rolling, fmt.Errorf("invalid batch size '%s' (use a number of hosts or a percentage between 1%% and 100%%)", batchSize)
+	}
+	rolling.BatchSize = size
+	return rolling, nil
+}
+
+// batches splits the hosts into restart batches (percentages are rounded up, a batch contains at least 1 host)
+func (r RollingRestart) batches(hosts []string) [][]string {
+	size := r.BatchSize
+	if r.BatchPercent > 0 {
+		size = (len(hosts)*r.BatchPercent + 99) / 100
+	}
+	if size <= 0 {
+		size = 1
+	}
+	var batches [][]string
+	for start := 0; start < len(hosts); start += size {
+		end := start + size
+		if end > len(hosts) {
+			end = len(hosts)
+		}
+		batches = append(batches, hosts[start:end])
+	}
+	return batches
+}
+
+// RollingRestartServiceOrComponent restarts the components (or the non-client components of the services) of a filter in batches of hosts,
+// the restart is aborted if more hosts failed than the tolerated number of failures
+func (a AmbariRegistry) RollingRestartServiceOrComponent(filter Filter, useServiceFilter bool, useComponentFilter bool, rolling RollingRestart) error {
+	components, err := a.ListComponents()
+	if err != nil {
+		return err
+	}
+	var restartComponents []string
+	if useComponentFilter {
+		restartComponents = filter.Components
+	} else if useServiceFilter {
+		for _, service := range filter.Services {
+			for _, component := range components {
+				if component.ServiceName == service && component.Category != "CLIENT" {
+					restartComponents = append(restartComponents, component.ComponentName)
+				}
+			}
+		}
+	}
+	progress := &rollingRestartProgress{failedHosts: make(map[string]bool)}
+	for _, component := range restartComponents {
+		service := getServiceNameForComponent(component, components)
+		if len(service) == 0 {
+			return fmt.Errorf("component '%s' does not exist in the cluster", component)
+		}
+		if err := a.rollingRestartComponent(service, component, rolling, progress); err != nil {
+			return err
+		}
+	}
+	if len(progress.failedHosts) > 0 {
+		fmt.Println(fmt.Sprintf("Rolling restart finished with %v failed host(s) (tolerated: %v): %s", len(progress.failedHosts), rolling.MaxFailures,
+			strings.Join(sortHosts(progress.failedHosts), ", ")))
+	}
+	return nil
+}
+
+func (a AmbariRegistry) rollingRestartComponent(service string, component string, rolling RollingRestart, progress *rollingRestartProgress) error {
+	hostComponents, err := a.ListHostComponents(component, false)
+	if err != nil {
+		return err
+	}
+	var hosts []string
+	for _, hostComponent := range hostComponents {
+		hosts = append(hosts, hostComponent.HostComponntHost)
+	}
+	sort.Strings(hosts)
+	batches := rolling.batches(hosts)
+	for index, batch := range batches {
+		if progress.batches > 0 && rolling.Wait > 0 {
+			fmt.Println(fmt.Sprintf("Waiting %v before the next batch ...", rolling.Wait))
+			select {
+			case <-a.Context().Done():
+				return a.Context().Err()
+			case <-time.After(rolling.Wait):
+			}
+		}
+		progress.batches++
+		fmt.Println(fmt.Sprintf("Rolling restart of %s: batch %v/%v (%s)", component, index+1, len(batches), strings.Join(batch, ",")))
+		batchFailures, err := a.restartBatch(service, component, batch, fmt.Sprintf("Rolling restart of %s (batch %v of %v) by ambarictl", component, index+1, len(batches)))
+		if err != nil {
+			return err
+		}
+		for _, host := range batch {
+			if reason, failed := batchFailures[host]; failed {
+				fmt.Println(fmt.Sprintf("  %s restart failed on %s: %s", component, host, reason))
+				progress.failedHosts[host] = true
+			}
+		}
+		if len(progress.failedHosts) > rolling.MaxFailures {
+			return &RollingRestartError{Component: component, FailedHosts: sortHosts(progress.failedHosts), MaxFailures: rolling.MaxFailures}
+		}
+	}
+	return nil
+}
+
+// restartBatch restarts the host components of a component on a batch of hosts, then checks that those are STARTED, returns the failed hosts with the failure reasons
+func (a AmbariRegistry) restartBatch(service string, component string, hosts []string, context string) (map[string]string, error) {
+	failures := make(map[string]string)
+	request, err := a.hostComponentOperation(service, component, hosts, "RESTART", context)
+	if err != nil {
+		return nil, err
+	}
+	response, err := a.processRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	id, ok, err := GetRequestIdFromResponse(response)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		ambariRequest, err := a.TrackRequest(id)
+		if _, requestFailed := err.(*RequestFailedError); requestFailed {
+			for _, task := range ambariRequest.Tasks {
+				if task.Status != "COMPLETED" {
+					failures[task.HostName] = fmt.Sprintf("%s task %s", task.Command, task.Status)
+				}
+			}
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	for check := 1; ; check++ {
+		states, err := a.getHostComponentStates(component)
+		if err != nil {
+			return nil, err
+		}
+		notStarted := false
+		for _, host := range hosts {
+			if _, failed := failures[host]; !failed && states[host] != "STARTED" {
+				notStarted = true
+			}
+		}
+		if !notStarted || check == rollingStateChecks {
+			for _, host := range hosts {
+				if _, failed := failures[host]; !failed && states[host] != "STARTED" {
+					failures[host] = fmt.Sprintf("state is %s (expected: STARTED)", states[host])
+				}
+			}
+			return failures, nil
+		}
+		select {
+		case <-a.Context().Done():
+			return nil, a.Context().Err()
+		case <-time.After(DefaultPollInterval):
+		}
+	}
+}
+
+// getHostComponentStates returns the actual states of the host components of a component by host names
+func (a AmbariRegistry) getHostComponentStates(component string) (map[string]string, error) {
+	hostComponents, err := a.ListHostComponents(component, false)
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]string)
+	for _, hostComponent := range hostComponents {
+		states[hostComponent.HostComponntHost] = hostComponent.HostComponentState
+	}
+	return states, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRollingRestart(t *testing.T) {
+	tests := []struct {
+		batchSize    string
+		wait         time.Duration
+		maxFailures  int
+		size         int
+		percent      int
+		expectsError bool
+	}{
+		{batchSize: "", size: 1},
+		{batchSize: "3", size: 3},
+		{batchSize: " 2 ", size: 2},
+		{batchSize: "25%", percent: 25},
+		{batchSize: "100%", percent: 100},
+		{batchSize: "0", expectsError: true},
+		{batchSize: "-1", expectsError: true},
+		{batchSize: "0%", expectsError: true},
+		{batchSize: "101%", expectsError: true},
+		{batchSize: "x%", expectsError: true},
+		{batchSize: "many", expectsError: true},
+		{batchSize: "1", wait: -time.Second, expectsError: true},
+		{batchSize: "1", maxFailures: -1, expectsError: true},
+	}
+	for _, test := range tests {
+		rolling, err := ParseRollingRestart(test.batchSize, test.wait, test.maxFailures)
+		if test.expectsError {
+			if err == nil {
+				t.Errorf("ParseRollingRestart(%q, %v, %v) expected an error", test.batchSize, test.wait, test.maxFailures)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRollingRestart(%q, %v, %v) unexpected error: %v", test.batchSize, test.wait, test.maxFailures, err)
+			continue
+		}
+		if rolling.BatchSize != test.size || rolling.BatchPercent != test.percent {
+			t.Errorf("ParseRollingRestart(%q) = size %v, percent %v, want size %v, percent %v", test.batchSize, rolling.BatchSize, rolling.BatchPercent, test.size, test.percent)
+		}
+	}
+}
+
+func TestRollingRestartBatches(t *testing.T) {
+	hosts := []string{"h1", "h2", "h3", "h4", "h5"}
+	tests := []struct {
+		name    string
+		rolling RollingRestart
+		hosts   []string
+		batches [][]string
+	}{
+		{"one host per batch", RollingRestart{BatchSize: 1}, hosts, [][]string{{"h1"}, {"h2"}, {"h3"}, {"h4"}, {"h5"}}},
+		{"last batch is smaller", RollingRestart{BatchSize: 2}, hosts, [][]string{{"h1", "h2"}, {"h3", "h4"}, {"h5"}}},
+		{"batch size bigger than host count", RollingRestart{BatchSize: 10}, hosts, [][]string{hosts}},
+		{"percent is rounded up", RollingRestart{BatchPercent: 30}, hosts, [][]string{{"h1", "h2"}, {"h3", "h4"}, {"h5"}}},
+		{"small percent means 1 host", RollingRestart{BatchPercent: 1}, hosts, [][]string{{"h1"}, {"h2"}, {"h3"}, {"h4"}, {"h5"}}},
+		{"all hosts", RollingRestart{BatchPercent: 100}, hosts, [][]string{hosts}},
+		{"zero batch size", RollingRestart{}, []string{"h1", "h2"}, [][]string{{"h1"}, {"h2"}}},
+		{"no hosts", RollingRestart{BatchSize: 2}, nil, nil},
+	}
+	for _, test := range tests {
+		if batches := test.rolling.batches(test.hosts); !reflect.DeepEqual(batches, test.batches) {
+			t.Errorf("%s: batches = %v, want %v", test.name, batches, test.batches)
+		}
+	}
+}
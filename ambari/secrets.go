@@ -0,0 +1,182 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strings"
+)
+
+const (
+	// SecretBackendPlain the secret is stored in cleartext in the registry (only for entries created before secret backends)
+	SecretBackendPlain = "plain"
+	// SecretBackendVault the secret is stored in the encrypted local vault
+	SecretBackendVault = "vault"
+	// SecretBackendEnv the secret is read from an environment variable (key: variable name)
+	SecretBackendEnv = "env"
+	// SecretBackendHelper the secret is the output of a credential helper command (key: command)
+	SecretBackendHelper = "helper"
+	// SecretBackendPrompt the secret is asked from the user when it is needed (key: description of the secret)
+	SecretBackendPrompt = "prompt"
+)
+
+// String describes the secret reference without the secret itself
+func (r SecretRef) String() string {
+	switch r.Backend {
+	case "":
+		return ""
+	case SecretBackendEnv:
+		return fmt.Sprintf("%s:%s", r.Backend, r.Key)
+	default:
+		return r.Backend
+	}
+}
+
+// ResolveSecret obtain a secret value from a secret backend (plain value is used for the plain backend)
+func ResolveSecret(ref SecretRef, plain string) (string, error) {
+	switch ref.Backend {
+	case "", SecretBackendPlain:
+		return plain, nil
+	case SecretBackendVault:
+		vault, err := OpenVault()
+		if err != nil {
+			return "", err
+		}
+		return vault.Get(ref.Key)
+	case SecretBackendEnv:
+		value, ok := os.LookupEnv(ref.Key)
+		if !ok {
+			return "", fmt.Errorf("environment variable '%s' (secret reference) is not set", ref.Key)
+		}
+		return value, nil
+	case SecretBackendHelper:
+		return runCredentialHelper(ref.Key)
+	case SecretBackendPrompt:
+		return GetPassword("", "Enter "+ref.Key)
+	}
+	return "", fmt.Errorf("unsupported secret backend '%s' (use 'vault', 'env', 'helper' or 'prompt')", ref.Backend)
+}
+
+// StoreSecret creates a secret reference for a secret backend, the value is written into the vault for the vault backend
+// (env and helper backends store only the reference: an environment variable name or a command)
+func StoreSecret(backend string, key string, value string) (SecretRef, error) {
+	switch backend {
+	case SecretBackendVault:
+		vault, err := OpenVault()
+		if err != nil {
+			return SecretRef{}, err
+		}
+		if err := vault.Set(map[string]string{key: value}); err != nil {
+			return SecretRef{}, err
+		}
+	case SecretBackendPrompt:
+		return SecretRef{Backend: backend, Key: key}, nil
+	case SecretBackendEnv, SecretBackendHelper:
+		if len(key) == 0 {
+			return SecretRef{}, fmt.Errorf("secret backend '%s' requires a reference (environment variable name or command)", backend)
+		}
+	default:
+		return SecretRef{}, fmt.Errorf("unsupported secret backend '%s' (use 'vault', 'env', 'helper' or 'prompt')", backend)
+	}
+	return SecretRef{Backend: backend, Key: key}, nil
+}
+
+// AmbariPasswordVaultKey returns the vault key of an ambari server entry password
+func AmbariPasswordVaultKey(name string) string {
+	return "ambari/" + name
+}
+
+// ResolveSecrets returns a copy of the ambari server entry with the password obtained from its secret backend
+func (a AmbariRegistry) ResolveSecrets() (AmbariRegistry, error) {
+	password, err := ResolveSecret(a.PasswordRef, a.Password)
+	if err != nil {
+		return a, fmt.Errorf("cannot obtain password of ambari server entry '%s': %v", a.Name, err)
+	}
+	a.Password = password
+	return a, nil
+}
+
+// MigratePlainPasswordsToVault moves the cleartext ambari passwords from the registry into the vault,
+// also removes the registry files of the old (before schema version 1) format as those contain cleartext passwords, returns the migrated entry names
+func MigratePlainPasswordsToVault() ([]string, error) {
+	vault, err := OpenVault()
+	if err != nil {
+		return nil, err
+	}
+	var migrated []string
+	err = updateRegistry(func(data *RegistryData) error {
+		secrets := make(map[string]string)
+		for index := range data.AmbariServers {
+			ambariServer := &data.AmbariServers[index]
+			if len(ambariServer.Password) > 0 && (ambariServer.PasswordRef.Backend == "" || ambariServer.PasswordRef.Backend == SecretBackendPlain) {
+				key := AmbariPasswordVaultKey(ambariServer.Name)
+				secrets[key] = ambariServer.Password
+				ambariServer.Password = ""
+				ambariServer.PasswordRef = SecretRef{Backend: SecretBackendVault, Key: key}
+				migrated = append(migrated, ambariServer.Name)
+			}
+		}
+		if len(secrets) == 0 {
+			return nil
+		}
+		return vault.Set(secrets)
+	})
+	if err != nil {
+		return nil, err
+	}
+	folder, err := getDbFolder()
+	if err != nil {
+		return migrated, err
+	}
+	_, err = removeLegacyJsonFiles(folder)
+	return migrated, err
+}
+
+// removeLegacyJsonFiles removes the registry files of the old (before schema version 1) format, returns the removed file paths
+func removeLegacyJsonFiles(folder string) ([]string, error) {
+	var removed []string
+	for _, legacyFile := range []string{ambariServerJsonFileName, connectionProfilesJsonFileName} {
+		if legacyFilePath := path.Join(folder, legacyFile); exists(legacyFilePath) {
+			if err := os.Remove(legacyFilePath); err != nil {
+				return removed, err
+			}
+			removed = append(removed, legacyFilePath)
+		}
+	}
+	return removed, nil
+}
+
+// runCredentialHelper runs a credential helper command in a shell, its standard output (without the trailing line break) is the secret
+func runCredentialHelper(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("credential helper command failed: %v", err)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
@@ -0,0 +1,270 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+const (
+	// partialDownloadSuffix suffix of the local files that are not fully downloaded yet (those downloads are resumed by the next copy)
+	partialDownloadSuffix = ".part"
+	// checksumBytesPerSecond the minimal expected throughput of the remote checksum calculation, the checksum timeout is scaled by the file size
+	checksumBytesPerSecond = 20 * 1024 * 1024
+)
+
+// sftpTransfer transfers files and directories through an sftp session of an ssh connection
+type sftpTransfer struct {
+	conn   *sshConnection
+	client *sftp.Client
+}
+
+// newSftpTransfer starts an sftp session on the ssh connection
+func newSftpTransfer(conn *sshConnection) (*sftpTransfer, error) {
+	client, err := sftp.NewClient(conn.client)
+	if err != nil {
+		return nil, fmt.Errorf("cannot start sftp session: %v", err)
+	}
+	return &sftpTransfer{conn: conn, client: client}, nil
+}
+
+// Close closes the sftp session
+func (t *sftpTransfer) Close() error {
+	return t.client.Close()
+}
+
+// Upload copies a local file or directory (recursively) to a remote location, file permissions and modification times are preserved,
+// if the remote destination is an existing directory, the source is copied into it
+func (t *sftpTransfer) Upload(source string, dest string) error {
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if destInfo, err := t.client.Stat(dest); err == nil && destInfo.IsDir() {
+		dest = path.Join(dest, filepath.Base(source))
+	}
+	if !sourceInfo.IsDir() {
+		return t.uploadFile(source, dest, sourceInfo)
+	}
+	return filepath.Walk(source, func(localPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(source, localPath)
+		if err != nil {
+			return err
+		}
+		remotePath := path.Join(dest, filepath.ToSlash(relativePath))
+		if info.IsDir() {
+			if err := t.client.MkdirAll(remotePath); err != nil {
+				return fmt.Errorf("cannot create remote directory '%s': %v", remotePath, err)
+			}
+			return t.client.Chmod(remotePath, info.Mode().Perm())
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return t.uploadFile(localPath, remotePath, info)
+	})
+}
+
+func (t *sftpTransfer) uploadFile(source string, dest string, info os.FileInfo) error {
+	localFile, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer localFile.Close()
+	remoteFile, err := t.client.Create(dest)
+	if err != nil {
+		return fmt.Errorf("cannot create remote file '%s': %v", dest, err)
+	}
+	written, err := remoteFile.ReadFrom(localFile)
+	if closeErr := remoteFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot upload '%s' to '%s': %v", source, dest, err)
+	}
+	if written != info.Size() {
+		return fmt.Errorf("incomplete upload of '%s' to '%s' (%v of %v bytes)", source, dest, written, info.Size())
+	}
+	if err := t.client.Chmod(dest, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return t.client.Chtimes(dest, info.ModTime(), info.ModTime())
+}
+
+// Download copies a remote file or directory (recursively) to a local location, file permissions and modification times are preserved,
+// if the local destination is an existing directory, the source is copied into it. The downloads are resumed from the partial (.part) files
+// and verified by sha256 checksums, already downloaded files with the same checksum are skipped
+func (t *sftpTransfer) Download(source string, dest string) error {
+	sourceInfo, err := t.client.Stat(source)
+	if err != nil {
+		return fmt.Errorf("cannot access remote path '%s': %v", source, err)
+	}
+	if destInfo, err := os.Stat(dest); err == nil && destInfo.IsDir() {
+		dest = filepath.Join(dest, path.Base(source))
+	}
+	if !sourceInfo.IsDir() {
+		return t.downloadFile(source, dest, sourceInfo)
+	}
+	walker := t.client.Walk(source)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+		relativePath := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), source), "/")
+		localPath := filepath.Join(dest, filepath.FromSlash(relativePath))
+		info := walker.Stat()
+		if info.IsDir() {
+			if err := os.MkdirAll(localPath, 0700); err != nil {
+				return err
+			}
+			if err := os.Chmod(localPath, info.Mode().Perm()|0700); err != nil {
+				return err
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if err := t.downloadFile(walker.Path(), localPath, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *sftpTransfer) downloadFile(source string, dest string, info os.FileInfo) error {
+	if localInfo, err := os.Stat(dest); err == nil && localInfo.Size() == info.Size() {
+		if err := t.verifyChecksum(source, dest, info.Size()); err == nil {
+			return nil
+		}
+	}
+	partFile := dest + partialDownloadSuffix
+	localFile, err := os.OpenFile(partFile, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	offset, err := localFile.Seek(0, io.SeekEnd)
+	if err != nil {
+		localFile.Close()
+		return err
+	}
+	if offset > info.Size() {
+		if err := localFile.Truncate(0); err != nil {
+			localFile.Close()
+			return err
+		}
+		if offset, err = localFile.Seek(0, io.SeekStart); err != nil {
+			localFile.Close()
+			return err
+		}
+	}
+	err = t.copyRemoteFile(source, localFile, offset)
+	if closeErr := localFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot download '%s' (it will be resumed by the next copy): %v", source, err)
+	}
+	if err := t.verifyChecksum(source, partFile, info.Size()); err != nil {
+		if _, ok := err.(*ChecksumMismatchError); ok {
+			os.Remove(partFile)
+			return err
+		}
+		return fmt.Errorf("cannot verify '%s' (it will be verified again by the next copy): %v", source, err)
+	}
+	if err := os.Chmod(partFile, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Rename(partFile, dest); err != nil {
+		return err
+	}
+	return os.Chtimes(dest, info.ModTime(), info.ModTime())
+}
+
+func (t *sftpTransfer) copyRemoteFile(source string, writer io.Writer, offset int64) error {
+	remoteFile, err := t.client.Open(source)
+	if err != nil {
+		return err
+	}
+	defer remoteFile.Close()
+	if offset > 0 {
+		if _, err := remoteFile.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	_, err = io.Copy(writer, remoteFile)
+	return err
+}
+
+// verifyChecksum compares the sha256 checksums of a remote and a local file (the remote checksum is calculated by sha256sum on the remote host),
+// a *ChecksumMismatchError is returned only if both checksums are calculated and those differ
+func (t *sftpTransfer) verifyChecksum(remotePath string, localPath string, size int64) error {
+	localChecksum, err := fileChecksum(localPath)
+	if err != nil {
+		return err
+	}
+	timeout := checksumTimeout(size)
+	stdout, stderr, exitCode, done, err := runSshCommand(t.conn, "sha256sum -- "+shellQuote(remotePath), timeout)
+	if err != nil {
+		return err
+	}
+	if !done {
+		return fmt.Errorf("checksum calculation of remote file '%s' timed out after %v", remotePath, timeout)
+	}
+	fields := strings.Fields(stdout)
+	if exitCode != 0 || len(fields) == 0 {
+		return fmt.Errorf("cannot calculate checksum of remote file '%s': %s", remotePath, strings.TrimSpace(stderr))
+	}
+	if fields[0] != localChecksum {
+		return &ChecksumMismatchError{LocalPath: localPath, RemotePath: remotePath}
+	}
+	return nil
+}
+
+// checksumTimeout returns the timeout of the remote checksum calculation: the remote command timeout plus the time of reading the file
+func checksumTimeout(size int64) time.Duration {
+	return remoteCommandTimeout + time.Duration(size/checksumBytesPerSecond)*time.Second
+}
+
+func fileChecksum(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// shellQuote quotes a string for the remote (posix) shell
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,235 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// testSshServer is an in-process ssh server with an sftp subsystem, exec requests are answered by the exec function
+type testSshServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	exec     func(command string) (string, uint32)
+}
+
+func startTestSshServer(t *testing.T, exec func(command string) (string, uint32)) *testSshServer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &testSshServer{listener: listener, config: config, exec: exec}
+	go server.serve()
+	return server
+}
+
+func (s *testSshServer) Close() {
+	s.listener.Close()
+}
+
+func (s *testSshServer) serve() {
+	for {
+		netConn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			_, channels, requests, err := ssh.NewServerConn(netConn, s.config)
+			if err != nil {
+				return
+			}
+			go ssh.DiscardRequests(requests)
+			for newChannel := range channels {
+				channel, channelRequests, err := newChannel.Accept()
+				if err != nil {
+					continue
+				}
+				go s.serveSession(channel, channelRequests)
+			}
+		}()
+	}
+}
+
+func (s *testSshServer) serveSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for request := range requests {
+		// string payloads are prefixed by their length
+		payload := ""
+		if len(request.Payload) > 4 {
+			payload = string(request.Payload[4:])
+		}
+		switch {
+		case request.Type == "subsystem" && payload == "sftp":
+			request.Reply(true, nil)
+			server, err := sftp.NewServer(channel)
+			if err != nil {
+				return
+			}
+			server.Serve()
+			return
+		case request.Type == "exec":
+			request.Reply(true, nil)
+			stdout, status := s.exec(payload)
+			fmt.Fprint(channel, stdout)
+			exitStatus := make([]byte, 4)
+			binary.BigEndian.PutUint32(exitStatus, status)
+			channel.SendRequest("exit-status", false, exitStatus)
+			return
+		default:
+			request.Reply(false, nil)
+		}
+	}
+}
+
+func (s *testSshServer) transfer(t *testing.T) *sftpTransfer {
+	client, err := ssh.Dial("tcp", s.listener.Addr().String(), &ssh.ClientConfig{
+		User:            "test",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transfer, err := newSftpTransfer(&sshConnection{client: client})
+	if err != nil {
+		client.Close()
+		t.Fatal(err)
+	}
+	return transfer
+}
+
+func TestDownloadFileChecksumVerification(t *testing.T) {
+	folder, err := ioutil.TempDir("", "ambarictl-sftp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	source := filepath.Join(folder, "remote.log")
+	if err := ioutil.WriteFile(source, []byte("remote log content\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checksum, err := fileChecksum(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalTimeout := remoteCommandTimeout
+	defer func() { remoteCommandTimeout = originalTimeout }()
+	remoteCommandTimeout = 200 * time.Millisecond
+
+	var release chan struct{}
+	scenarios := map[string]struct {
+		exec     func(command string) (string, uint32)
+		wantErr  string
+		mismatch bool
+		keepPart bool
+	}{
+		"matching checksum": {
+			exec: func(command string) (string, uint32) {
+				return checksum + "  " + source + "\n", 0
+			},
+		},
+		"checksum mismatch": {
+			exec: func(command string) (string, uint32) {
+				return strings.Repeat("0", 64) + "  " + source + "\n", 0
+			},
+			wantErr:  "checksum mismatch",
+			mismatch: true,
+		},
+		"checksum timeout": {
+			exec: func(command string) (string, uint32) {
+				<-release
+				return "", 0
+			},
+			wantErr:  "timed out",
+			keepPart: true,
+		},
+		"checksum command failure": {
+			exec: func(command string) (string, uint32) {
+				return "", 127
+			},
+			wantErr:  "cannot calculate checksum",
+			keepPart: true,
+		},
+	}
+	for name, scenario := range scenarios {
+		release = make(chan struct{})
+		server := startTestSshServer(t, scenario.exec)
+		transfer := server.transfer(t)
+		dest := filepath.Join(folder, strings.Replace(name, " ", "-", -1)+".log")
+		info, err := os.Stat(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = transfer.downloadFile(source, dest, info)
+		close(release)
+		transfer.Close()
+		transfer.conn.Close()
+		server.Close()
+
+		if scenario.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", name, err)
+			} else if content, _ := ioutil.ReadFile(dest); string(content) != "remote log content\n" {
+				t.Errorf("%s: unexpected downloaded content %q", name, content)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), scenario.wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", name, scenario.wantErr, err)
+		}
+		if _, ok := err.(*ChecksumMismatchError); ok != scenario.mismatch {
+			t.Errorf("%s: expected checksum mismatch error: %v, got %T", name, scenario.mismatch, err)
+		}
+		if _, statErr := os.Stat(dest + partialDownloadSuffix); (statErr == nil) != scenario.keepPart {
+			t.Errorf("%s: expected the partial file to be kept: %v", name, scenario.keepPart)
+		}
+		if _, statErr := os.Stat(dest); statErr == nil {
+			t.Errorf("%s: unverified download should not be renamed to the destination", name)
+		}
+	}
+}
+
+func TestChecksumTimeoutScalesWithFileSize(t *testing.T) {
+	if timeout := checksumTimeout(0); timeout != remoteCommandTimeout {
+		t.Errorf("empty files should use the remote command timeout, got %v", timeout)
+	}
+	large := checksumTimeout(10 * 1024 * 1024 * 1024)
+	if expected := remoteCommandTimeout + 512*time.Second; large != expected {
+		t.Errorf("expected %v for a 10 GB file, got %v", expected, large)
+	}
+}
@@ -15,216 +15,399 @@
 package ambari
 
 import (
+	"bufio"
 	"fmt"
-	"github.com/appleboy/easyssh-proxy"
 	"os"
 	"path"
-	"strconv"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+const (
+	// DefaultSshParallelism default number of hosts that are processed concurrently by the remote (ssh) operations
+	DefaultSshParallelism = 10
+	// DefaultRemoteCommandTimeout default timeout for a remote command on one host
+	DefaultRemoteCommandTimeout = 60 * time.Second
+)
+
+var (
+	sshParallelism       = DefaultSshParallelism
+	remoteCommandTimeout = DefaultRemoteCommandTimeout
 )
 
-// RemoteResponse represents an ssh command output
+// RemoteResponse represents the result of a remote (ssh) operation on one host
 type RemoteResponse struct {
-	StdOut string
-	StdErr string
-	Done   bool
+	Host     string        `json:"host"`
+	StdOut   string        `json:"stdout"`
+	StdErr   string        `json:"stderr"`
+	ExitCode int           `json:"exit_code"`
+	Duration time.Duration `json:"duration"`
+	Done     bool          `json:"done"`
+	Error    string        `json:"error,omitempty"`
 }
 
-// RunRemoteHostCommand executes bash commands on ambari agent hosts
-func (a AmbariRegistry) RunRemoteHostCommand(command string, filteredHosts map[string]bool, skipJump bool) map[string]RemoteResponse {
-	connectionProfileId := a.ConnectionProfile
-	if len(connectionProfileId) == 0 {
-		fmt.Println("No connection profile is attached for the active ambari server entry!")
-		os.Exit(1)
+// Succeeded returns true if the operation finished in time without error (and with 0 exit code)
+func (r RemoteResponse) Succeeded() bool {
+	return r.Done && r.ExitCode == 0 && len(r.Error) == 0
+}
+
+// FailureReason returns a short description about why the operation failed on the host
+func (r RemoteResponse) FailureReason() string {
+	if len(r.Error) > 0 {
+		return r.Error
 	}
-	connectionProfile := GetConnectionProfileById(connectionProfileId)
-	var hosts map[string]bool
-	if len(filteredHosts) > 0 {
-		hosts = filteredHosts
-	} else {
-		hosts = a.GetFilteredHosts(Filter{})
+	if !r.Done {
+		return "timeout"
 	}
-	response := make(map[string]RemoteResponse)
-	var wg sync.WaitGroup
-	wg.Add(len(hosts))
-	for host := range hosts {
-		ssh := createSshConfig(connectionProfile, host, skipJump)
-		go func(ssh *easyssh.MakeConfig, command string, host string, response map[string]RemoteResponse) {
-			defer wg.Done()
-			stdout, stderr, done, err := ssh.Run(command, 60)
-			// Handle errors
-			msgHeader := fmt.Sprintf("%v (done: %v) - output:", host, done)
-			fmt.Println(msgHeader)
-			if err != nil {
-				panic("Can't run remote command: " + err.Error())
-			} else {
-				if len(stdout) > 0 {
-					fmt.Println(stdout)
-				}
-				if len(stderr) > 0 {
-					fmt.Println("std error:")
-					fmt.Println(stderr)
-				}
-				response[host] = RemoteResponse{StdOut: stdout, StdErr: stderr, Done: done}
-			}
-		}(ssh, command, host, response)
+	if r.ExitCode != 0 {
+		return fmt.Sprintf("exit code %v", r.ExitCode)
 	}
-	wg.Wait()
-	return response
+	return ""
 }
 
-// CopyToRemote copy local file to remote host(s)
-func (a AmbariRegistry) CopyToRemote(source string, dest string, filteredHosts map[string]bool, skipJump bool) {
-	connectionProfileId := a.ConnectionProfile
-	if len(connectionProfileId) == 0 {
-		fmt.Println("No connection profile is attached for the active ambari server entry!")
-		os.Exit(1)
+// remoteResults collects the per host responses of the workers
+type remoteResults struct {
+	mutex     sync.Mutex
+	responses map[string]RemoteResponse
+}
+
+func (r *remoteResults) add(response RemoteResponse, report func(response RemoteResponse)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.responses[response.Host] = response
+	if report != nil {
+		report(response)
 	}
-	connectionProfile := GetConnectionProfileById(connectionProfileId)
-	var hosts map[string]bool
-	if len(filteredHosts) > 0 {
-		hosts = filteredHosts
-	} else {
-		hosts = a.GetFilteredHosts(Filter{})
+}
+
+// SetSshParallelism sets the maximum number of hosts that are processed concurrently by the remote (ssh) operations
+func SetSshParallelism(parallelism int) {
+	if parallelism > 0 {
+		sshParallelism = parallelism
 	}
-	var wg sync.WaitGroup
-	wg.Add(len(hosts))
-	for host := range hosts {
-		ssh := createSshConfig(connectionProfile, host, skipJump)
-		go func(ssh *easyssh.MakeConfig, source string, dest string, host string) {
-			defer wg.Done()
-			err := ssh.Scp(source, dest)
-			// Handle errors
-			if err != nil {
-				errMsg := fmt.Sprintf("Can't run remote command on host '%v (scp %v to %v)", host, source, dest)
-				fmt.Println(errMsg)
-			} else {
-				succMsg := fmt.Sprintf("Copying to remote host '%v' is successful. (from - %v, to %v)", host, source, dest)
-				fmt.Println(succMsg)
-			}
-		}(ssh, source, dest, host)
+}
+
+// SetRemoteCommandTimeout sets the timeout of the remote commands (per host)
+func SetRemoteCommandTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		remoteCommandTimeout = timeout
 	}
-	wg.Wait()
 }
 
-// CopyFromRemote copy 1 file from 1 remote host to locally
-func (a AmbariRegistry) CopyFromRemote(source string, dest string, host string, skipJump bool) {
-	connectionProfileId := a.ConnectionProfile
-	if len(connectionProfileId) == 0 {
-		fmt.Println("No connection profile is attached for the active ambari server entry!")
-		os.Exit(1)
+// RunRemoteHostCommand executes bash commands on ambari agent hosts, the outputs are printed per host then a summary of the results,
+// returns a *RemoteExecutionError if the command failed on any of the hosts
+func (a AmbariRegistry) RunRemoteHostCommand(command string, filteredHosts map[string]bool, skipJump bool) (map[string]RemoteResponse, error) {
+	responses, err := a.runRemoteCommand(command, filteredHosts, skipJump, printRemoteResponse)
+	if responses != nil {
+		printRemoteSummary(responses)
 	}
-	connectionProfile := GetConnectionProfileById(connectionProfileId)
-	ssh := createSshConfig(connectionProfile, host, skipJump)
-	err := DownloadViaScp(ssh, source, dest, skipJump)
+	return responses, err
+}
+
+// runRemoteCommand executes a command on ambari agent hosts (with a bounded number of workers) and collects the results per host
+func (a AmbariRegistry) runRemoteCommand(command string, filteredHosts map[string]bool, skipJump bool, report func(response RemoteResponse)) (map[string]RemoteResponse, error) {
+	hosts, hostProfiles, err := a.getSshHosts(filteredHosts)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return nil, err
 	}
+	responses := a.forEachHost(hosts, report, func(host string) RemoteResponse {
+		conn, err := dialSsh(hostProfiles[host], host, skipJump)
+		if err != nil {
+			return RemoteResponse{ExitCode: -1, Error: err.Error()}
+		}
+		defer conn.Close()
+		stdout, stderr, exitCode, done, err := runSshCommand(conn, command, remoteCommandTimeout)
+		response := RemoteResponse{StdOut: stdout, StdErr: stderr, ExitCode: exitCode, Done: done}
+		if err != nil {
+			response.Error = err.Error()
+		}
+		return response
+	})
+	return responses, checkRemoteResponses("remote command", responses)
 }
 
-// CopyFromRemoteHosts copy remote file to remote host(s)
-func (a AmbariRegistry) CopyFromRemoteHosts(source string, dest string, filteredHosts map[string]bool, skipJump bool) {
-	connectionProfileId := a.ConnectionProfile
-	if len(connectionProfileId) == 0 {
-		fmt.Println("No connection profile is attached for the active ambari server entry!")
-		os.Exit(1)
+// CopyToRemote copy local file or directory to remote host(s) through sftp
+func (a AmbariRegistry) CopyToRemote(source string, dest string, filteredHosts map[string]bool, skipJump bool) error {
+	hosts, hostProfiles, err := a.getSshHosts(filteredHosts)
+	if err != nil {
+		return err
 	}
-	connectionProfile := GetConnectionProfileById(connectionProfileId)
-	var hosts map[string]bool
-	if len(filteredHosts) > 0 {
-		hosts = filteredHosts
-	} else {
-		hosts = a.GetFilteredHosts(Filter{})
+	responses := a.forEachHost(hosts, nil, func(host string) RemoteResponse {
+		err := withSftpTransfer(hostProfiles[host], host, skipJump, func(transfer *sftpTransfer) error {
+			return transfer.Upload(source, dest)
+		})
+		if err != nil {
+			return RemoteResponse{ExitCode: -1, Error: err.Error()}
+		}
+		fmt.Println(fmt.Sprintf("Copying to remote host '%v' is successful. (from - %v, to %v)", host, source, dest))
+		return RemoteResponse{Done: true}
+	})
+	return checkRemoteResponses("copy to remote", responses)
+}
+
+// CopyFromRemote copy 1 file (or directory) from 1 remote host to locally
+func (a AmbariRegistry) CopyFromRemote(source string, dest string, host string, skipJump bool) error {
+	_, hostProfiles, err := a.getSshHosts(map[string]bool{host: true})
+	if err != nil {
+		return err
 	}
-	var wg sync.WaitGroup
-	wg.Add(len(hosts))
-	for host := range hosts {
-		ssh := createSshConfig(connectionProfile, host, skipJump)
-		go func(ssh *easyssh.MakeConfig, source string, dest string, host string) {
-			defer wg.Done()
-			hostFolder := path.Join(dest, host)
-			os.MkdirAll(hostFolder, os.ModePerm)
-			err := DownloadViaScp(ssh, source, hostFolder, skipJump)
-			if err != nil {
-				fmt.Println(fmt.Sprintf("Failed to copy from host '%v', reason:", host))
-				fmt.Println(err)
-			}
-		}(ssh, source, dest, host)
+	err = withSftpTransfer(hostProfiles[host], host, skipJump, func(transfer *sftpTransfer) error {
+		return transfer.Download(source, dest)
+	})
+	if err != nil {
+		return err
 	}
-	wg.Wait()
+	fmt.Println(fmt.Sprintf("Copy %v (host: %v) to location: %v", source, host, dest))
+	return nil
 }
 
-// CopyFolderFromRemote copy folder (zipping it first) to local filesystem from remote location
-func (a AmbariRegistry) CopyFolderFromRemote(component string, source string, dest string, filteredHosts map[string]bool, skipJump bool) {
-	connectionProfileId := a.ConnectionProfile
-	if len(connectionProfileId) == 0 {
-		fmt.Println("No connection profile is attached for the active ambari server entry!")
-		os.Exit(1)
+// CopyFromRemoteHosts copy remote file (or directory) from remote host(s) to locally (into <dest>/<host> folders)
+func (a AmbariRegistry) CopyFromRemoteHosts(source string, dest string, filteredHosts map[string]bool, skipJump bool) error {
+	hosts, hostProfiles, err := a.getSshHosts(filteredHosts)
+	if err != nil {
+		return err
 	}
-	connectionProfile := GetConnectionProfileById(connectionProfileId)
-	var hosts map[string]bool
-	if len(filteredHosts) > 0 {
-		hosts = filteredHosts
-	} else {
-		hosts = a.GetFilteredHosts(Filter{})
+	responses := a.forEachHost(hosts, nil, func(host string) RemoteResponse {
+		hostFolder := path.Join(dest, host)
+		os.MkdirAll(hostFolder, os.ModePerm)
+		err := withSftpTransfer(hostProfiles[host], host, skipJump, func(transfer *sftpTransfer) error {
+			return transfer.Download(source, hostFolder)
+		})
+		if err != nil {
+			return RemoteResponse{ExitCode: -1, Error: err.Error()}
+		}
+		fmt.Println(fmt.Sprintf("Copy %v (host: %v) to location: %v", source, host, hostFolder))
+		return RemoteResponse{Done: true}
+	})
+	return checkRemoteResponses("copy from remote", responses)
+}
+
+// CopyFolderFromRemote streams the (filtered) files of a remote folder as a gzipped tar archive into the local filesystem (dest/<host>/<component>.tar.gz),
+// nothing is written on the remote hosts
+func (a AmbariRegistry) CopyFolderFromRemote(component string, source string, dest string, logFilter LogFilter, filteredHosts map[string]bool, skipJump bool) error {
+	hosts, hostProfiles, err := a.getSshHosts(filteredHosts)
+	if err != nil {
+		return err
 	}
+	command := logFilter.remoteArchiveCommand(source)
+	responses := a.forEachHost(hosts, nil, func(host string) RemoteResponse {
+		conn, err := dialSsh(hostProfiles[host], host, skipJump)
+		if err != nil {
+			return RemoteResponse{ExitCode: -1, Error: err.Error()}
+		}
+		defer conn.Close()
+		hostFolder := path.Join(dest, host)
+		if err := os.MkdirAll(hostFolder, os.ModePerm); err != nil {
+			return RemoteResponse{ExitCode: -1, Error: err.Error()}
+		}
+		archive := path.Join(hostFolder, component+".tar.gz")
+		size, stderr, exitCode, err := a.streamRemoteCommand(conn, command, archive)
+		response := RemoteResponse{StdErr: stderr, ExitCode: exitCode, Done: true}
+		if err != nil {
+			response.Error = err.Error()
+			return response
+		}
+		if exitCode == 2 {
+			response.Error = fmt.Sprintf("cannot access folder '%s'", source)
+			return response
+		}
+		if exitCode == 1 {
+			fmt.Println(fmt.Sprintf("Some '%v' log files were changed during the archiving on host %v", component, host))
+			response.ExitCode = 0
+		}
+		if response.Succeeded() {
+			fmt.Println(fmt.Sprintf("Streamed '%v' log files of host %v to location: %v (%v bytes)", component, host, archive, size))
+		}
+		return response
+	})
+	return checkRemoteResponses("log collection", responses)
+}
+
+// streamRemoteCommand writes the output of a remote command into a local file (through a partial file, which is renamed only if the command succeeded)
+func (a AmbariRegistry) streamRemoteCommand(conn *sshConnection, command string, dest string) (int64, string, int, error) {
+	partialFile := dest + partialDownloadSuffix
+	file, err := os.Create(partialFile)
+	if err != nil {
+		return 0, "", -1, err
+	}
+	defer os.Remove(partialFile)
+	writer := bufio.NewWriter(file)
+	stderr, exitCode, err := streamSshCommand(a.Context(), conn, command, writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || exitCode > 1 {
+		return 0, stderr, exitCode, err
+	}
+	info, err := os.Stat(partialFile)
+	if err != nil {
+		return 0, stderr, exitCode, err
+	}
+	return info.Size(), stderr, exitCode, os.Rename(partialFile, dest)
+}
+
+// withSftpTransfer opens an sftp session to a host (through the jump hosts if it is needed) and runs a transfer function on it
+func withSftpTransfer(connectionProfile ConnectionProfile, host string, skipJump bool, fn func(transfer *sftpTransfer) error) error {
+	conn, err := dialSsh(connectionProfile, host, skipJump)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	transfer, err := newSftpTransfer(conn)
+	if err != nil {
+		return err
+	}
+	defer transfer.Close()
+	return fn(transfer)
+}
 
+// forEachHost runs an operation on the hosts by a bounded number of workers (see SetSshParallelism), the report function is called (serialized) after every finished host,
+// hosts that are not processed because the context of the ambari registry is cancelled are marked as failed
+func (a AmbariRegistry) forEachHost(hosts map[string]bool, report func(response RemoteResponse), operation func(host string) RemoteResponse) map[string]RemoteResponse {
+	results := &remoteResults{responses: make(map[string]RemoteResponse)}
+	sortedHosts := sortHosts(hosts)
+	workers := sshParallelism
+	if workers > len(sortedHosts) {
+		workers = len(sortedHosts)
+	}
+	hostChan := make(chan string)
 	var wg sync.WaitGroup
-	wg.Add(len(hosts))
-	for host := range hosts {
-		ssh := createSshConfig(connectionProfile, host, skipJump)
-		go func(ssh *easyssh.MakeConfig, component string, source string, dest string, host string) {
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
 			defer wg.Done()
-			tmpSource := fmt.Sprintf("/tmp/%v.tar.gz", component)
-			command := fmt.Sprintf("cd %v && tar -cvf %v *", source, tmpSource)
-			stdout, stderr, _, err := ssh.Run(command, 60)
-			// Handle errors
-			if err != nil {
-				panic("Can't run remote command: " + err.Error())
-			} else {
-				if len(stdout) > 0 {
-					fmt.Println(fmt.Sprintf("Zipping '%v' log files has been finished on host %v", component, host))
-				}
-				if len(stderr) > 0 {
-					fmt.Println("std error:")
-					fmt.Println(stderr)
-				}
+			for host := range hostChan {
+				start := time.Now()
+				response := operation(host)
+				response.Host = host
+				response.Duration = time.Since(start)
+				results.add(response, report)
 			}
-			hostFolder := path.Join(dest, host)
-			os.MkdirAll(hostFolder, os.ModePerm)
-			err = DownloadViaScp(ssh, tmpSource, hostFolder, skipJump)
-			if err != nil {
-				fmt.Println(err)
-			}
-		}(ssh, component, source, dest, host)
+		}()
 	}
+	ctx := a.Context()
+	started := 0
+dispatch:
+	for _, host := range sortedHosts {
+		// select picks randomly if both cases are ready, so no host should be started after the cancellation
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case hostChan <- host:
+			started++
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(hostChan)
 	wg.Wait()
+	for _, host := range sortedHosts[started:] {
+		results.add(RemoteResponse{Host: host, ExitCode: -1, Error: ctx.Err().Error()}, report)
+	}
+	return results.responses
 }
 
-func createSshConfig(connectionProfile ConnectionProfile, host string, skipJump bool) *easyssh.MakeConfig {
-	if len(connectionProfile.ProxyAddress) > 0 && !skipJump {
-		return &easyssh.MakeConfig{
-			User:    connectionProfile.Username,
-			Server:  host,
-			KeyPath: connectionProfile.KeyPath,
-			Port:    strconv.Itoa(connectionProfile.Port),
-			Timeout: 60 * time.Second,
-			Proxy: easyssh.DefaultConfig{
-				User:    connectionProfile.Username,
-				Server:  connectionProfile.ProxyAddress,
-				Port:    strconv.Itoa(connectionProfile.Port),
-				KeyPath: connectionProfile.KeyPath,
-				Timeout: 60 * time.Second,
-			},
+func checkRemoteResponses(operation string, responses map[string]RemoteResponse) error {
+	var failed []RemoteResponse
+	for _, host := range sortResponseHosts(responses) {
+		if !responses[host].Succeeded() {
+			failed = append(failed, responses[host])
 		}
 	}
-	return &easyssh.MakeConfig{
-		User:    connectionProfile.Username,
-		Server:  host,
-		KeyPath: connectionProfile.KeyPath,
-		Port:    strconv.Itoa(connectionProfile.Port),
-		Timeout: 60 * time.Second,
+	if len(failed) > 0 {
+		return &RemoteExecutionError{Operation: operation, Failed: failed}
+	}
+	return nil
+}
+
+func printRemoteResponse(response RemoteResponse) {
+	fmt.Println(fmt.Sprintf("%v (done: %v, exit code: %v, duration: %v) - output:", response.Host, response.Done, response.ExitCode, response.Duration.Round(time.Millisecond)))
+	if len(response.Error) > 0 {
+		fmt.Println("error: " + response.Error)
+	}
+	if len(response.StdOut) > 0 {
+		fmt.Println(strings.TrimRight(response.StdOut, "\n"))
+	}
+	if len(response.StdErr) > 0 {
+		fmt.Println("std error:")
+		fmt.Println(strings.TrimRight(response.StdErr, "\n"))
+	}
+}
+
+func printRemoteSummary(responses map[string]RemoteResponse) {
+	fmt.Println("SUMMARY:")
+	succeeded := 0
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"HOST", "STATUS", "EXIT CODE", "DURATION", "ERROR"})
+	for _, host := range sortResponseHosts(responses) {
+		response := responses[host]
+		status := "FAILED"
+		if response.Succeeded() {
+			status = "SUCCEEDED"
+			succeeded++
+		} else if !response.Done && len(response.Error) == 0 {
+			status = "TIMEOUT"
+		}
+		table.Append([]string{host, status, fmt.Sprintf("%v", response.ExitCode), response.Duration.Round(time.Millisecond).String(), response.Error})
+	}
+	table.Render()
+	fmt.Println(fmt.Sprintf("%v succeeded, %v failed", succeeded, len(responses)-succeeded))
+}
+
+func sortHosts(hosts map[string]bool) []string {
+	var sortedHosts []string
+	for host := range hosts {
+		sortedHosts = append(sortedHosts, host)
+	}
+	sort.Strings(sortedHosts)
+	return sortedHosts
+}
+
+func sortResponseHosts(responses map[string]RemoteResponse) []string {
+	var sortedHosts []string
+	for host := range responses {
+		sortedHosts = append(sortedHosts, host)
+	}
+	sort.Strings(sortedHosts)
+	return sortedHosts
+}
+
+func (a AmbariRegistry) getConnectionProfile() (ConnectionProfile, error) {
+	connectionProfileId := a.ConnectionProfile
+	if len(connectionProfileId) == 0 {
+		return ConnectionProfile{}, ErrNoConnectionProfile
+	}
+	return GetConnectionProfileById(connectionProfileId)
+}
+
+// getSshHosts returns the (filtered or all) agent hosts with their connection profiles (host overrides are applied)
+func (a AmbariRegistry) getSshHosts(filteredHosts map[string]bool) (map[string]bool, map[string]ConnectionProfile, error) {
+	connectionProfile, err := a.getConnectionProfile()
+	if err != nil {
+		return nil, nil, err
+	}
+	hosts, err := a.getHostsOrAll(filteredHosts)
+	if err != nil {
+		return nil, nil, err
+	}
+	hostProfiles, err := a.getHostProfiles(connectionProfile, hosts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hosts, hostProfiles, nil
+}
+
+func (a AmbariRegistry) getHostsOrAll(filteredHosts map[string]bool) (map[string]bool, error) {
+	if len(filteredHosts) > 0 {
+		return filteredHosts, nil
 	}
+	return a.GetFilteredHosts(Filter{})
 }
@@ -0,0 +1,232 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// SshAuthSockEnv environment variable for the ssh agent socket
+const SshAuthSockEnv = "SSH_AUTH_SOCK"
+
+// sshAuth holds the ssh authentication methods of a connection profile (or the error while those were created)
+type sshAuth struct {
+	methods []ssh.AuthMethod
+	err     error
+}
+
+var (
+	// sshAuthCache holds the ssh authentication methods per connection profile, so secrets are resolved (or asked) only once
+	sshAuthCache     = make(map[string]sshAuth)
+	sshAuthCacheLock sync.Mutex
+	sshAgentClient   agent.Agent
+	sshAgentLock     sync.Mutex
+)
+
+// ConnectionProfileVaultKey returns the vault key of a connection profile secret (e.g.: password or key_passphrase)
+func ConnectionProfileVaultKey(name string, secret string) string {
+	return "profile/" + name + "/" + secret
+}
+
+// GetCertificatePath returns the ssh certificate of the connection profile, by default it is the <key path>-cert.pub file (if it exists)
+func (c ConnectionProfile) GetCertificatePath() string {
+	if len(c.CertificatePath) > 0 {
+		return c.CertificatePath
+	}
+	if len(c.KeyPath) > 0 && exists(c.KeyPath+"-cert.pub") {
+		return c.KeyPath + "-cert.pub"
+	}
+	return ""
+}
+
+// GetAuthDescription describes the ssh authentication methods of the connection profile (e.g.: key, certificate, agent, password)
+func (c ConnectionProfile) GetAuthDescription() string {
+	var methods []string
+	if len(c.GetCertificatePath()) > 0 {
+		methods = append(methods, "certificate")
+	}
+	if len(c.KeyPath) > 0 {
+		methods = append(methods, "key")
+	}
+	if c.usesAgent() {
+		if c.ForwardAgent {
+			methods = append(methods, "agent (forwarded)")
+		} else {
+			methods = append(methods, "agent")
+		}
+	}
+	if len(c.PasswordRef.Backend) > 0 {
+		methods = append(methods, fmt.Sprintf("password (%s)", c.PasswordRef.String()))
+	}
+	return strings.Join(methods, ", ")
+}
+
+// usesAgent returns true if the ssh agent is used for authentication (explicitly or when there is no key and password for the connection profile)
+func (c ConnectionProfile) usesAgent() bool {
+	return c.UseAgent || c.ForwardAgent || (len(c.KeyPath) == 0 && len(c.PasswordRef.Backend) == 0)
+}
+
+// createSshAuthMethods returns the ssh authentication methods of a connection profile: certificate, private key, ssh agent, then password (also as keyboard-interactive)
+func createSshAuthMethods(connectionProfile ConnectionProfile) ([]ssh.AuthMethod, error) {
+	sshAuthCacheLock.Lock()
+	defer sshAuthCacheLock.Unlock()
+	if auth, ok := sshAuthCache[connectionProfile.Name]; ok {
+		return auth.methods, auth.err
+	}
+	auths, err := createSshAuthMethodsUncached(connectionProfile)
+	sshAuthCache[connectionProfile.Name] = sshAuth{methods: auths, err: err}
+	return auths, err
+}
+
+func createSshAuthMethodsUncached(connectionProfile ConnectionProfile) ([]ssh.AuthMethod, error) {
+	var auths []ssh.AuthMethod
+	var signers []ssh.Signer
+	if len(connectionProfile.KeyPath) > 0 {
+		signer, err := loadPrivateKey(connectionProfile)
+		if err != nil {
+			return nil, err
+		}
+		if certificatePath := connectionProfile.GetCertificatePath(); len(certificatePath) > 0 {
+			certSigner, err := loadCertificate(certificatePath, signer)
+			if err != nil {
+				return nil, err
+			}
+			signers = append(signers, certSigner)
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		auths = append(auths, ssh.PublicKeys(signers...))
+	}
+	if connectionProfile.usesAgent() {
+		agentClient, err := getSshAgent()
+		if err != nil {
+			if connectionProfile.UseAgent || connectionProfile.ForwardAgent {
+				return nil, err
+			}
+		} else {
+			auths = append(auths, ssh.PublicKeysCallback(agentClient.Signers))
+		}
+	}
+	if len(connectionProfile.PasswordRef.Backend) > 0 {
+		password, err := ResolveSecret(connectionProfile.PasswordRef, "")
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain ssh password of connection profile '%s': %v", connectionProfile.Name, err)
+		}
+		auths = append(auths, ssh.Password(password), ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i := range questions {
+				answers[i] = password
+			}
+			return answers, nil
+		}))
+	}
+	if len(auths) == 0 {
+		return nil, fmt.Errorf("no ssh authentication method for connection profile '%s' (set a key, a password or use the ssh agent)", connectionProfile.Name)
+	}
+	return auths, nil
+}
+
+// loadPrivateKey parses the private key of the connection profile, the passphrase of an encrypted key is obtained from its secret backend (by default it is asked from the user)
+func loadPrivateKey(connectionProfile ConnectionProfile) (ssh.Signer, error) {
+	keyContent, err := ioutil.ReadFile(connectionProfile.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(keyContent)
+	if err == nil {
+		return signer, nil
+	}
+	if !strings.Contains(err.Error(), "cannot decode encrypted private keys") {
+		return nil, fmt.Errorf("cannot parse ssh key '%s': %v", connectionProfile.KeyPath, err)
+	}
+	if strings.Contains(string(keyContent), "OPENSSH PRIVATE KEY") {
+		return nil, fmt.Errorf("encrypted ssh key '%s' is in OpenSSH format, use the ssh agent or convert it to PEM format (ssh-keygen -p -m PEM -f %s)", connectionProfile.KeyPath, connectionProfile.KeyPath)
+	}
+	passphraseRef := connectionProfile.KeyPassphraseRef
+	if len(passphraseRef.Backend) == 0 {
+		passphraseRef = SecretRef{Backend: SecretBackendPrompt, Key: fmt.Sprintf("passphrase for ssh key '%s'", connectionProfile.KeyPath)}
+	}
+	passphrase, err := ResolveSecret(passphraseRef, "")
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain passphrase of ssh key '%s': %v", connectionProfile.KeyPath, err)
+	}
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(keyContent, []byte(passphrase))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt ssh key '%s': %v", connectionProfile.KeyPath, err)
+	}
+	return signer, nil
+}
+
+// loadCertificate creates a signer from an OpenSSH user certificate and its private key
+func loadCertificate(certificatePath string, signer ssh.Signer) (ssh.Signer, error) {
+	certContent, err := ioutil.ReadFile(certificatePath)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(certContent)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse ssh certificate '%s': %v", certificatePath, err)
+	}
+	certificate, ok := publicKey.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not an ssh certificate", certificatePath)
+	}
+	if certificate.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("'%s' is not an ssh user certificate", certificatePath)
+	}
+	certSigner, err := ssh.NewCertSigner(certificate, signer)
+	if err != nil {
+		return nil, fmt.Errorf("cannot use ssh certificate '%s': %v", certificatePath, err)
+	}
+	return certSigner, nil
+}
+
+// getSshAgent connects to the ssh agent (SSH_AUTH_SOCK), the connection is shared by the ssh connections
+func getSshAgent() (agent.Agent, error) {
+	sshAgentLock.Lock()
+	defer sshAgentLock.Unlock()
+	if sshAgentClient != nil {
+		return sshAgentClient, nil
+	}
+	socket := os.Getenv(SshAuthSockEnv)
+	if len(socket) == 0 {
+		return nil, errors.New("ssh agent is not available (SSH_AUTH_SOCK is not set)")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to ssh agent: %v", err)
+	}
+	sshAgentClient = agent.NewClient(conn)
+	return sshAgentClient, nil
+}
+
+// forwardSshAgent forwards the agent requests of the ssh client connection to the local ssh agent (SSH_AUTH_SOCK)
+func forwardSshAgent(client *ssh.Client) error {
+	socket := os.Getenv(SshAuthSockEnv)
+	if len(socket) == 0 {
+		return errors.New("ssh agent is not available for forwarding (SSH_AUTH_SOCK is not set)")
+	}
+	return agent.ForwardToRemote(client, socket)
+}
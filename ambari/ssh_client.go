@@ -0,0 +1,237 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// sshConnectTimeout timeout for establishing an ssh connection (including the handshake)
+const sshConnectTimeout = 60 * time.Second
+
+// sshConnection is an ssh client connection to an agent host, it holds the jump host connections as well (if there is any)
+type sshConnection struct {
+	client       *ssh.Client
+	proxies      []*ssh.Client
+	forwardAgent bool
+}
+
+// Close closes the host connection and the jump host connections
+func (c *sshConnection) Close() error {
+	err := c.client.Close()
+	closeSshClients(c.proxies)
+	return err
+}
+
+// dialSsh opens an ssh connection to a host, through the jump host chain of the connection profile (if it is set and skipJump is false),
+// the host keys are verified by the host key policy of the connection profile
+func dialSsh(connectionProfile ConnectionProfile, host string, skipJump bool) (*sshConnection, error) {
+	return openSsh(connectionProfile, host, skipJump, nil)
+}
+
+// openSsh opens an ssh connection to a host, if hostKeyCallback is set, it is used for the host instead of the host key policy check (the jump hosts are always verified)
+func openSsh(connectionProfile ConnectionProfile, host string, skipJump bool, hostKeyCallback ssh.HostKeyCallback) (*sshConnection, error) {
+	verifier, err := newHostKeyVerifier(connectionProfile)
+	if err != nil {
+		return nil, err
+	}
+	config, err := createSshClientConfig(connectionProfile)
+	if err != nil {
+		return nil, err
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(connectionProfile.Port))
+	if err := verifier.configure(config, address); err != nil {
+		return nil, err
+	}
+	if hostKeyCallback != nil {
+		config.HostKeyCallback = hostKeyCallback
+	}
+	var proxies []*ssh.Client
+	if !skipJump {
+		proxies, err = dialJumpHosts(connectionProfile, verifier, connectionProfile.GetJumpHosts())
+		if err != nil {
+			return nil, err
+		}
+	}
+	client, err := dialThrough(proxies, address, config)
+	if err != nil {
+		closeSshClients(proxies)
+		return nil, err
+	}
+	return newSshConnection(connectionProfile, client, proxies)
+}
+
+// dialJumpHosts opens the connections of a jump host chain in order, every hop is dialed through the previous one
+func dialJumpHosts(connectionProfile ConnectionProfile, verifier *hostKeyVerifier, jumpHosts []JumpHost) ([]*ssh.Client, error) {
+	var proxies []*ssh.Client
+	for _, jumpHost := range jumpHosts {
+		proxy, err := dialJumpHost(connectionProfile, verifier, proxies, jumpHost)
+		if err != nil {
+			closeSshClients(proxies)
+			return nil, err
+		}
+		proxies = append(proxies, proxy)
+	}
+	return proxies, nil
+}
+
+// dialJumpHost opens the connection of a jump host through the previous hops of the chain
+func dialJumpHost(connectionProfile ConnectionProfile, verifier *hostKeyVerifier, proxies []*ssh.Client, jumpHost JumpHost) (*ssh.Client, error) {
+	jumpProfile := connectionProfile.jumpHostProfile(jumpHost)
+	config, err := createSshClientConfig(jumpProfile)
+	if err != nil {
+		return nil, err
+	}
+	address := net.JoinHostPort(jumpHost.Address, strconv.Itoa(jumpProfile.Port))
+	if err := verifier.configure(config, address); err != nil {
+		return nil, err
+	}
+	proxy, err := dialThrough(proxies, address, config)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to jump host '%s': %v", jumpHost.Address, err)
+	}
+	return proxy, nil
+}
+
+// dialThrough opens an ssh connection directly or through the last jump host connection
+func dialThrough(proxies []*ssh.Client, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if len(proxies) == 0 {
+		return ssh.Dial("tcp", address, config)
+	}
+	conn, err := proxies[len(proxies)-1].Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(clientConn, chans, reqs), nil
+}
+
+// closeSshClients closes jump host connections in reverse order
+func closeSshClients(clients []*ssh.Client) {
+	for i := len(clients) - 1; i >= 0; i-- {
+		clients[i].Close()
+	}
+}
+
+func newSshConnection(connectionProfile ConnectionProfile, client *ssh.Client, proxies []*ssh.Client) (*sshConnection, error) {
+	conn := &sshConnection{client: client, proxies: proxies, forwardAgent: connectionProfile.ForwardAgent}
+	if conn.forwardAgent {
+		if err := forwardSshAgent(client); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func createSshClientConfig(connectionProfile ConnectionProfile) (*ssh.ClientConfig, error) {
+	auths, err := createSshAuthMethods(connectionProfile)
+	if err != nil {
+		return nil, err
+	}
+	return &ssh.ClientConfig{
+		User:    connectionProfile.Username,
+		Auth:    auths,
+		Timeout: sshConnectTimeout,
+	}, nil
+}
+
+// runSshCommand runs a command in a new ssh session, the session is closed if the command does not finish within the timeout (done is false in that case),
+// non-zero exit codes are returned as exitCode (err is set only if the command could not be run at all)
+func runSshCommand(conn *sshConnection, command string, timeout time.Duration) (stdout string, stderr string, exitCode int, done bool, err error) {
+	session, err := conn.client.NewSession()
+	if err != nil {
+		return "", "", -1, false, err
+	}
+	defer session.Close()
+	if conn.forwardAgent {
+		if err := agent.RequestAgentForwarding(session); err != nil {
+			return "", "", -1, false, err
+		}
+	}
+	var stdoutBuffer, stderrBuffer bytes.Buffer
+	session.Stdout = &stdoutBuffer
+	session.Stderr = &stderrBuffer
+	result := make(chan error, 1)
+	go func() {
+		result <- session.Run(command)
+	}()
+	done = true
+	var runErr error
+	select {
+	case runErr = <-result:
+	case <-time.After(timeout):
+		done = false
+		session.Close()
+		runErr = <-result
+	}
+	stdout = stdoutBuffer.String()
+	stderr = stderrBuffer.String()
+	if !done {
+		return stdout, stderr, -1, false, nil
+	}
+	if runErr != nil {
+		if exitErr, ok := runErr.(*ssh.ExitError); ok {
+			return stdout, stderr, exitErr.ExitStatus(), true, nil
+		}
+		return stdout, stderr, -1, true, runErr
+	}
+	return stdout, stderr, 0, true, nil
+}
+
+// streamSshCommand runs a command in a new ssh session and writes its standard output to a writer (without any timeout),
+// the session is closed if the context is cancelled
+func streamSshCommand(ctx context.Context, conn *sshConnection, command string, stdout io.Writer) (stderr string, exitCode int, err error) {
+	session, err := conn.client.NewSession()
+	if err != nil {
+		return "", -1, err
+	}
+	defer session.Close()
+	var stderrBuffer bytes.Buffer
+	session.Stdout = stdout
+	session.Stderr = &stderrBuffer
+	result := make(chan error, 1)
+	go func() {
+		result <- session.Run(command)
+	}()
+	var runErr error
+	select {
+	case runErr = <-result:
+	case <-ctx.Done():
+		session.Close()
+		<-result
+		return stderrBuffer.String(), -1, ctx.Err()
+	}
+	if runErr != nil {
+		if exitErr, ok := runErr.(*ssh.ExitError); ok {
+			return stderrBuffer.String(), exitErr.ExitStatus(), nil
+		}
+		return stderrBuffer.String(), -1, runErr
+	}
+	return stderrBuffer.String(), 0, nil
+}
@@ -0,0 +1,263 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// GetJumpHosts returns the jump host chain of the connection profile (a profile with only a proxy address has a single hop)
+func (c ConnectionProfile) GetJumpHosts() []JumpHost {
+	if len(c.JumpHosts) > 0 {
+		return c.JumpHosts
+	}
+	if len(c.ProxyAddress) > 0 {
+		return []JumpHost{{Address: c.ProxyAddress}}
+	}
+	return nil
+}
+
+// GetJumpHostsDescription describes the jump host chain of the connection profile (e.g.: admin@bastion1:22 -> ops@bastion2:2222)
+func (c ConnectionProfile) GetJumpHostsDescription() string {
+	var hops []string
+	for _, jumpHost := range c.GetJumpHosts() {
+		jumpProfile := c.jumpHostProfile(jumpHost)
+		hops = append(hops, fmt.Sprintf("%s@%s:%v", jumpProfile.Username, jumpHost.Address, jumpProfile.Port))
+	}
+	return strings.Join(hops, " -> ")
+}
+
+// GetHostOverridesDescription describes the host overrides of the connection profile (e.g.: *.example.com (user=admin, port=2222))
+func (c ConnectionProfile) GetHostOverridesDescription() string {
+	var overrides []string
+	for _, hostOverride := range c.HostOverrides {
+		var settings []string
+		if len(hostOverride.Username) > 0 {
+			settings = append(settings, "user="+hostOverride.Username)
+		}
+		if hostOverride.Port > 0 {
+			settings = append(settings, "port="+strconv.Itoa(hostOverride.Port))
+		}
+		if len(hostOverride.KeyPath) > 0 {
+			settings = append(settings, "key="+hostOverride.KeyPath)
+		}
+		overrides = append(overrides, fmt.Sprintf("%s (%s)", hostOverride.Pattern, strings.Join(settings, ", ")))
+	}
+	return strings.Join(overrides, ", ")
+}
+
+// GetSecretRefs returns the secret references of the connection profile (including the secrets of the jump hosts and the host overrides)
+func (c ConnectionProfile) GetSecretRefs() []SecretRef {
+	secretRefs := []SecretRef{c.KeyPassphraseRef, c.PasswordRef}
+	for _, jumpHost := range c.JumpHosts {
+		secretRefs = append(secretRefs, jumpHost.KeyPassphraseRef, jumpHost.PasswordRef)
+	}
+	for _, hostOverride := range c.HostOverrides {
+		secretRefs = append(secretRefs, hostOverride.KeyPassphraseRef)
+	}
+	return secretRefs
+}
+
+// AddJumpHost appends a hop to the end of the jump host chain of a connection profile (a proxy address of the profile is converted to the first hop)
+func AddJumpHost(profileName string, jumpHost JumpHost) error {
+	if len(jumpHost.Address) == 0 {
+		return fmt.Errorf("jump host address cannot be empty")
+	}
+	return UpdateConnectionProfile(profileName, func(connectionProfile *ConnectionProfile) error {
+		for _, existingJumpHost := range connectionProfile.GetJumpHosts() {
+			if existingJumpHost.Address == jumpHost.Address {
+				return &RegistryError{Kind: "jump host", ID: jumpHost.Address, Msg: "already defined for connection profile " + profileName}
+			}
+		}
+		connectionProfile.JumpHosts = append(connectionProfile.GetJumpHosts(), jumpHost)
+		connectionProfile.HostJump = true
+		connectionProfile.ProxyAddress = ""
+		return nil
+	})
+}
+
+// RemoveJumpHost removes a hop (by address) from the jump host chain of a connection profile, returns the removed hop
+func RemoveJumpHost(profileName string, address string) (JumpHost, error) {
+	var removed JumpHost
+	err := UpdateConnectionProfile(profileName, func(connectionProfile *ConnectionProfile) error {
+		jumpHosts := make([]JumpHost, 0)
+		found := false
+		for _, jumpHost := range connectionProfile.GetJumpHosts() {
+			if jumpHost.Address == address && !found {
+				removed = jumpHost
+				found = true
+				continue
+			}
+			jumpHosts = append(jumpHosts, jumpHost)
+		}
+		if !found {
+			return &RegistryError{Kind: "jump host", ID: address, Msg: "not found in connection profile " + profileName}
+		}
+		connectionProfile.JumpHosts = jumpHosts
+		connectionProfile.HostJump = len(jumpHosts) > 0
+		connectionProfile.ProxyAddress = ""
+		return nil
+	})
+	return removed, err
+}
+
+// AddHostOverride appends a host override to a connection profile (the first matching override wins, so more specific patterns should be added first)
+func AddHostOverride(profileName string, hostOverride HostOverride) error {
+	if err := ValidateHostOverride(hostOverride); err != nil {
+		return err
+	}
+	return UpdateConnectionProfile(profileName, func(connectionProfile *ConnectionProfile) error {
+		for _, existingHostOverride := range connectionProfile.HostOverrides {
+			if existingHostOverride.Pattern == hostOverride.Pattern {
+				return &RegistryError{Kind: "host override", ID: hostOverride.Pattern, Msg: "already defined for connection profile " + profileName}
+			}
+		}
+		connectionProfile.HostOverrides = append(connectionProfile.HostOverrides, hostOverride)
+		return nil
+	})
+}
+
+// RemoveHostOverride removes a host override (by pattern) from a connection profile, returns the removed host override
+func RemoveHostOverride(profileName string, pattern string) (HostOverride, error) {
+	var removed HostOverride
+	err := UpdateConnectionProfile(profileName, func(connectionProfile *ConnectionProfile) error {
+		hostOverrides := make([]HostOverride, 0)
+		found := false
+		for _, hostOverride := range connectionProfile.HostOverrides {
+			if hostOverride.Pattern == pattern {
+				removed = hostOverride
+				found = true
+				continue
+			}
+			hostOverrides = append(hostOverrides, hostOverride)
+		}
+		if !found {
+			return &RegistryError{Kind: "host override", ID: pattern, Msg: "not found in connection profile " + profileName}
+		}
+		connectionProfile.HostOverrides = hostOverrides
+		return nil
+	})
+	return removed, err
+}
+
+// ValidateHostOverride checks that a host override has a valid pattern and overrides at least one setting
+func ValidateHostOverride(hostOverride HostOverride) error {
+	if len(hostOverride.Pattern) == 0 {
+		return fmt.Errorf("host override pattern cannot be empty")
+	}
+	if _, err := path.Match(hostOverride.Pattern, ""); err != nil {
+		return fmt.Errorf("invalid host override pattern '%s': %v", hostOverride.Pattern, err)
+	}
+	if len(hostOverride.Username) == 0 && hostOverride.Port == 0 && len(hostOverride.KeyPath) == 0 {
+		return fmt.Errorf("host override '%s' does not override anything (set username, port or key)", hostOverride.Pattern)
+	}
+	return nil
+}
+
+// jumpHostProfile creates the connection profile of a jump host (the missing settings are inherited from the connection profile)
+func (c ConnectionProfile) jumpHostProfile(jumpHost JumpHost) ConnectionProfile {
+	jumpProfile := c
+	jumpProfile.ProxyAddress = ""
+	jumpProfile.JumpHosts = nil
+	jumpProfile.HostOverrides = nil
+	jumpProfile.ForwardAgent = false
+	if jumpHost.Port > 0 {
+		jumpProfile.Port = jumpHost.Port
+	}
+	if len(jumpHost.Username) > 0 {
+		jumpProfile.Username = jumpHost.Username
+	}
+	if len(jumpHost.KeyPath) > 0 || len(jumpHost.PasswordRef.Backend) > 0 || jumpHost.UseAgent {
+		jumpProfile.Name = fmt.Sprintf("%s (jump host %s)", c.Name, jumpHost.Address)
+		jumpProfile.KeyPath = jumpHost.KeyPath
+		jumpProfile.CertificatePath = jumpHost.CertificatePath
+		jumpProfile.KeyPassphraseRef = jumpHost.KeyPassphraseRef
+		jumpProfile.PasswordRef = jumpHost.PasswordRef
+		jumpProfile.UseAgent = jumpHost.UseAgent
+	}
+	return jumpProfile
+}
+
+// hostProfile creates the connection profile of a host by applying the matching host overrides (any of the host names can match),
+// like in ssh_config, the first matching override wins for every setting
+func (c ConnectionProfile) hostProfile(hostNames []string) ConnectionProfile {
+	hostProfile := c
+	hostProfile.HostOverrides = nil
+	var portSet, usernameSet, keySet bool
+	for _, hostOverride := range c.HostOverrides {
+		if !matchesAnyHostName(hostOverride.Pattern, hostNames) {
+			continue
+		}
+		if hostOverride.Port > 0 && !portSet {
+			hostProfile.Port = hostOverride.Port
+			portSet = true
+		}
+		if len(hostOverride.Username) > 0 && !usernameSet {
+			hostProfile.Username = hostOverride.Username
+			usernameSet = true
+		}
+		if len(hostOverride.KeyPath) > 0 && !keySet {
+			hostProfile.Name = fmt.Sprintf("%s (key %s)", c.Name, hostOverride.KeyPath)
+			hostProfile.KeyPath = hostOverride.KeyPath
+			hostProfile.CertificatePath = ""
+			hostProfile.KeyPassphraseRef = hostOverride.KeyPassphraseRef
+			keySet = true
+		}
+	}
+	return hostProfile
+}
+
+func matchesAnyHostName(pattern string, hostNames []string) bool {
+	for _, hostName := range hostNames {
+		if matched, _ := path.Match(pattern, hostName); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// getHostProfiles returns the connection profiles per host (with the matching host overrides), agent host names are obtained from Ambari only if there are host overrides
+func (a AmbariRegistry) getHostProfiles(connectionProfile ConnectionProfile, hosts map[string]bool) (map[string]ConnectionProfile, error) {
+	hostProfiles := make(map[string]ConnectionProfile)
+	if len(connectionProfile.HostOverrides) == 0 {
+		for host := range hosts {
+			hostProfiles[host] = connectionProfile
+		}
+		return hostProfiles, nil
+	}
+	agents, err := a.ListAgents()
+	if err != nil {
+		return nil, err
+	}
+	agentHostNames := make(map[string][]string)
+	for _, agent := range agents {
+		hostNames := []string{agent.IP, agent.HostName, agent.PublicHostname}
+		for _, hostName := range hostNames {
+			if len(hostName) > 0 {
+				agentHostNames[hostName] = hostNames
+			}
+		}
+	}
+	for host := range hosts {
+		hostNames, ok := agentHostNames[host]
+		if !ok {
+			hostNames = []string{host}
+		}
+		hostProfiles[host] = connectionProfile.hostProfile(hostNames)
+	}
+	return hostProfiles, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestForEachHostParallelism(t *testing.T) {
+	originalParallelism := sshParallelism
+	defer SetSshParallelism(originalParallelism)
+	SetSshParallelism(3)
+
+	hosts := make(map[string]bool)
+	for i := 1; i <= 10; i++ {
+		hosts[fmt.Sprintf("c72%02d.ambari.apache.org", i)] = true
+	}
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+	var reported []string
+	responses := AmbariRegistry{}.forEachHost(hosts, func(response RemoteResponse) {
+		reported = append(reported, response.Host)
+	}, func(host string) RemoteResponse {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+		return RemoteResponse{StdOut: host, Done: true}
+	})
+	if maxRunning > 3 {
+		t.Errorf("%v hosts were processed concurrently, the limit is 3", maxRunning)
+	}
+	if len(responses) != len(hosts) || len(reported) != len(hosts) {
+		t.Fatalf("expected %v responses and reports, got %v and %v", len(hosts), len(responses), len(reported))
+	}
+	for host := range hosts {
+		response := responses[host]
+		if response.Host != host || response.StdOut != host || response.Duration <= 0 {
+			t.Errorf("unexpected response for %s: %+v", host, response)
+		}
+	}
+}
+
+func TestForEachHostCancelled(t *testing.T) {
+	originalParallelism := sshParallelism
+	defer SetSshParallelism(originalParallelism)
+	SetSshParallelism(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hosts := map[string]bool{"host1": true, "host2": true, "host3": true}
+	responses := AmbariRegistry{}.WithContext(ctx).forEachHost(hosts, nil, func(host string) RemoteResponse {
+		// the first host cancels the operation, the remaining ones should not be started
+		cancel()
+		return RemoteResponse{Done: true}
+	})
+	if !responses["host1"].Succeeded() {
+		t.Errorf("host1 should finish: %+v", responses["host1"])
+	}
+	for _, host := range []string{"host2", "host3"} {
+		if response := responses[host]; response.Succeeded() || response.FailureReason() != context.Canceled.Error() {
+			t.Errorf("%s should be marked as cancelled: %+v", host, response)
+		}
+	}
+	err := checkRemoteResponses("remote command", responses)
+	if err == nil || err.Error() != "remote command failed on 2 host(s): host2 (context canceled), host3 (context canceled)" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRemoteResponseFailureReason(t *testing.T) {
+	tests := []struct {
+		response  RemoteResponse
+		succeeded bool
+		reason    string
+	}{
+		{RemoteResponse{Done: true}, true, ""},
+		{RemoteResponse{Done: true, ExitCode: 2}, false, "exit code 2"},
+		{RemoteResponse{Done: false, ExitCode: -1}, false, "timeout"},
+		{RemoteResponse{ExitCode: -1, Error: "connection refused"}, false, "connection refused"},
+	}
+	for _, test := range tests {
+		if succeeded := test.response.Succeeded(); succeeded != test.succeeded {
+			t.Errorf("%+v: Succeeded() = %v, want %v", test.response, succeeded, test.succeeded)
+		}
+		if reason := test.response.FailureReason(); reason != test.reason {
+			t.Errorf("%+v: FailureReason() = %q, want %q", test.response, reason, test.reason)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+const stackCacheFolderName = "stacks"
+
+// ListStackVersions obtain the available stacks with their versions
+func (a AmbariRegistry) ListStackVersions() ([]StackVersion, error) {
+	request, err := a.CreateGetRequest("stacks?fields=versions/Versions/stack_name,versions/Versions/stack_version,versions/Versions/active", false)
+	if err != nil {
+		return nil, err
+	}
+	ambariItems, err := a.processAmbariItems(request)
+	if err != nil {
+		return nil, err
+	}
+	return ambariItems.ConvertResponse().StackVersions, nil
+}
+
+// GetStackServices obtain the services of a stack version with their components (category, cardinality and dependencies)
+func (a AmbariRegistry) GetStackServices(stack string, version string) ([]StackService, error) {
+	uriSuffix := fmt.Sprintf("stacks/%v/versions/%v/services?fields=StackServices/service_name,components/StackServiceComponents/component_name,"+
+		"components/StackServiceComponents/component_category,components/StackServiceComponents/cardinality,"+
+		"components/dependencies/Dependencies/component_name,components/dependencies/Dependencies/service_name,components/dependencies/Dependencies/scope", stack, version)
+	request, err := a.CreateGetRequest(uriSuffix, false)
+	if err != nil {
+		return nil, err
+	}
+	ambariItems, err := a.processAmbariItems(request)
+	if err != nil {
+		return nil, err
+	}
+	return ambariItems.ConvertResponse().StackServices, nil
+}
+
+// GetStackDefinition obtain the services, components and default configurations of a stack version
+func (a AmbariRegistry) GetStackDefinition(stack string, version string) (StackDefinition, error) {
+	services, err := a.GetStackServices(stack, version)
+	if err != nil {
+		return StackDefinition{}, err
+	}
+	if len(services) == 0 {
+		return StackDefinition{}, fmt.Errorf("stack %s-%s does not exist (or it does not have any services)", stack, version)
+	}
+	configurations, err := a.GetStackDefaultConfigs(stack, version)
+	if err != nil {
+		return StackDefinition{}, err
+	}
+	return StackDefinition{StackName: stack, StackVersion: version, Services: services, Configurations: configurations}, nil
+}
+
+// LoadStackDefinition reads a stack definition json file (see SaveStackDefinition)
+func LoadStackDefinition(file string) (StackDefinition, error) {
+	var definition StackDefinition
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return definition, err
+	}
+	if err := json.Unmarshal(content, &definition); err != nil {
+		return definition, fmt.Errorf("cannot parse stack definition file '%s': %v", file, err)
+	}
+	if len(definition.StackName) == 0 || len(definition.StackVersion) == 0 {
+		return definition, fmt.Errorf("stack definition file '%s' does not contain stack_name and stack_version", file)
+	}
+	return definition, nil
+}
+
+// SaveStackDefinition writes a stack definition to a json file, so it can be used without contacting Ambari
+func SaveStackDefinition(file string, definition StackDefinition) error {
+	content, err := json.MarshalIndent(definition, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, content, 0644)
+}
+
+// GetComponent finds a component of the stack by name
+func (d StackDefinition) GetComponent(name string) (StackComponent, bool) {
+	for _, service := range d.Services {
+		for _, component := range service.Components {
+			if component.ComponentName == name {
+				return component, true
+			}
+		}
+	}
+	return StackComponent{}, false
+}
+
+// GetStackCacheFolder returns the folder of the locally cached stack definitions (~/.ambarictl/stacks), the folder is created if it does not exist
+func GetStackCacheFolder() (string, error) {
+	dbFolder, err := getDbFolder()
+	if err != nil {
+		return "", err
+	}
+	stackCacheFolder := path.Join(dbFolder, stackCacheFolderName)
+	if _, err := os.Stat(stackCacheFolder); os.IsNotExist(err) {
+		if err := os.Mkdir(stackCacheFolder, 0700); err != nil {
+			return "", err
+		}
+	}
+	return stackCacheFolder, nil
+}
+
+// LoadCachedStackDefinition reads a stack definition from the local stack cache, returns false if the stack version is not cached yet
+func LoadCachedStackDefinition(stack string, version string) (StackDefinition, bool, error) {
+	stackCacheFolder, err := GetStackCacheFolder()
+	if err != nil {
+		return StackDefinition{}, false, err
+	}
+	return loadCachedStackDefinition(stackCacheFolder, stack, version)
+}
+
+// CacheStackDefinition saves a stack definition to the local stack cache
+func CacheStackDefinition(definition StackDefinition) error {
+	stackCacheFolder, err := GetStackCacheFolder()
+	if err != nil {
+		return err
+	}
+	return cacheStackDefinition(stackCacheFolder, definition)
+}
+
+// ListCachedStackVersions returns the stack versions that are available in the local stack cache
+func ListCachedStackVersions() ([]StackVersion, error) {
+	stackCacheFolder, err := GetStackCacheFolder()
+	if err != nil {
+		return nil, err
+	}
+	return listCachedStackVersions(stackCacheFolder)
+}
+
+func loadCachedStackDefinition(stackCacheFolder string, stack string, version string) (StackDefinition, bool, error) {
+	stackFile := path.Join(stackCacheFolder, getStackCacheFileName(stack, version))
+	if !exists(stackFile) {
+		return StackDefinition{}, false, nil
+	}
+	definition, err := LoadStackDefinition(stackFile)
+	if err != nil {
+		return definition, false, err
+	}
+	return definition, true, nil
+}
+
+func cacheStackDefinition(stackCacheFolder string, definition StackDefinition) error {
+	content, err := json.MarshalIndent(definition, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(stackCacheFolder, getStackCacheFileName(definition.StackName, definition.StackVersion), content)
+}
+
+func listCachedStackVersions(stackCacheFolder string) ([]StackVersion, error) {
+	files, err := ioutil.ReadDir(stackCacheFolder)
+	if err != nil {
+		return nil, err
+	}
+	var stackVersions []StackVersion
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		stackVersionParts := strings.SplitN(strings.TrimSuffix(file.Name(), ".json"), "-", 2)
+		if len(stackVersionParts) != 2 {
+			continue
+		}
+		stackVersions = append(stackVersions, StackVersion{StackName: stackVersionParts[0], StackVersion: stackVersionParts[1]})
+	}
+	return stackVersions, nil
+}
+
+func getStackCacheFileName(stack string, version string) string {
+	return fmt.Sprintf("%s-%s.json", stack, version)
+}
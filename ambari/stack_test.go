@@ -0,0 +1,125 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testStackDefinition() StackDefinition {
+	return StackDefinition{
+		StackName:    "HDP",
+		StackVersion: "2.6",
+		Services: []StackService{
+			{ServiceName: "HDFS", Components: []StackComponent{
+				{ComponentName: "NAMENODE", ServiceName: "HDFS", Category: "MASTER", Cardinality: "1-2"},
+				{ComponentName: "DATANODE", ServiceName: "HDFS", Category: "SLAVE", Cardinality: "1+",
+					Dependencies: []StackComponentDependency{{ComponentName: "HDFS_CLIENT", ServiceName: "HDFS", Scope: "host"}}},
+			}},
+		},
+		Configurations: map[string]StackConfig{
+			"hdfs-site": {ServiceConfigType: "hdfs-site", ServiceName: "HDFS", Properties: []StackProperty{
+				{Type: "hdfs-site.xml", Name: "dfs.replication", Value: "3"},
+				{Type: "hdfs-site.xml", Name: "dfs.permissions.superusergroup", Value: "hdfs", PropertyType: "GROUP"},
+			}},
+		},
+	}
+}
+
+func TestStackCache(t *testing.T) {
+	folder, err := ioutil.TempDir("", "ambarictl-stacks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	if _, ok, err := loadCachedStackDefinition(folder, "HDP", "2.6"); ok || err != nil {
+		t.Fatalf("empty cache should not contain HDP-2.6 (cached: %v, error: %v)", ok, err)
+	}
+	definition := testStackDefinition()
+	if err := cacheStackDefinition(folder, definition); err != nil {
+		t.Fatal(err)
+	}
+	cached, ok, err := loadCachedStackDefinition(folder, "HDP", "2.6")
+	if err != nil || !ok {
+		t.Fatalf("HDP-2.6 should be cached (cached: %v, error: %v)", ok, err)
+	}
+	if !reflect.DeepEqual(cached, definition) {
+		t.Errorf("cached stack definition differs:\n%+v\nwant:\n%+v", cached, definition)
+	}
+	// refreshing the cache replaces the stack definition
+	definition.Services = definition.Services[:0]
+	if err := cacheStackDefinition(folder, definition); err != nil {
+		t.Fatal(err)
+	}
+	if cached, _, _ := loadCachedStackDefinition(folder, "HDP", "2.6"); len(cached.Services) != 0 {
+		t.Errorf("cached stack definition is not replaced: %+v", cached.Services)
+	}
+
+	// other files of the cache folder are not listed as stack versions
+	for _, name := range []string{"HDF-3.1.json", "notes.txt", "invalid.json"} {
+		if err := ioutil.WriteFile(path.Join(folder, name), []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(path.Join(folder, "HDP-3.0.json"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	stackVersions, err := listCachedStackVersions(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []StackVersion{{StackName: "HDF", StackVersion: "3.1"}, {StackName: "HDP", StackVersion: "2.6"}}
+	if !reflect.DeepEqual(stackVersions, expected) {
+		t.Errorf("listCachedStackVersions() = %+v, want %+v", stackVersions, expected)
+	}
+	// a cached file without stack name and version is reported instead of being used
+	if _, _, err := loadCachedStackDefinition(folder, "HDF", "3.1"); err == nil || !strings.Contains(err.Error(), "does not contain stack_name and stack_version") {
+		t.Errorf("expected an invalid stack definition error, got %v", err)
+	}
+}
+
+func TestStackDefinitionFile(t *testing.T) {
+	folder, err := ioutil.TempDir("", "ambarictl-stacks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	stackFile := path.Join(folder, "stack.json")
+	if err := SaveStackDefinition(stackFile, testStackDefinition()); err != nil {
+		t.Fatal(err)
+	}
+	definition, err := LoadStackDefinition(stackFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	component, ok := definition.GetComponent("DATANODE")
+	if !ok || component.Cardinality != "1+" || len(component.Dependencies) != 1 || component.Dependencies[0].ComponentName != "HDFS_CLIENT" {
+		t.Errorf("GetComponent(DATANODE) = %+v, %v", component, ok)
+	}
+	if _, ok := definition.GetComponent("RESOURCEMANAGER"); ok {
+		t.Errorf("GetComponent(RESOURCEMANAGER) should not find a component")
+	}
+	if err := ioutil.WriteFile(stackFile, []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadStackDefinition(stackFile); err == nil || !strings.Contains(err.Error(), "cannot parse stack definition file") {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+}
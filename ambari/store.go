@@ -0,0 +1,242 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RegistrySchemaVersion is the current version of the ambarictl registry schema
+	RegistrySchemaVersion = 3
+	// RegistryStoreEnv environment variable for selecting the registry store implementation: json (default) or bolt
+	RegistryStoreEnv = "AMBARICTL_REGISTRY_STORE"
+
+	lockTimeout       = 30 * time.Second
+	lockRetryInterval = 100 * time.Millisecond
+)
+
+var (
+	registryStore     RegistryStore
+	registryStoreLock sync.Mutex
+	// registryMigrationTasks are registered by the migration steps, those are run only after the migrated registry data is persisted (e.g.: notices about the changes)
+	registryMigrationTasks []func() error
+)
+
+// registryMigrations contains the schema migration steps, registryMigrations[i] migrates the registry data (of a registry folder) from version i to version i+1
+var registryMigrations = []func(folder string, data *RegistryData) error{
+	migrateLegacyJsonFiles,
+	migratePlainPasswords,
+	migrateHostKeyPolicies,
+}
+
+// RegistryData holds all of the ambarictl registry entries (ambari server entries and connection profiles)
+type RegistryData struct {
+	SchemaVersion      int                 `json:"schema_version"`
+	AmbariServers      []AmbariRegistry    `json:"ambari_servers"`
+	ConnectionProfiles []ConnectionProfile `json:"connection_profiles"`
+}
+
+// RegistryStore represents a storage for the ambarictl registry, implementations should be safe to use from concurrent processes
+type RegistryStore interface {
+	// View runs fn on a consistent snapshot of the registry data, changes made by fn are not persisted
+	View(fn func(data *RegistryData) error) error
+	// Update runs fn in an exclusive transaction, the changes are persisted only if fn returns without error
+	Update(fn func(data *RegistryData) error) error
+}
+
+// SetRegistryStore overrides the registry store that is used by the registry functions
+func SetRegistryStore(store RegistryStore) {
+	registryStoreLock.Lock()
+	defer registryStoreLock.Unlock()
+	registryStore = store
+}
+
+// GetRegistryStore returns the registry store that is used by the registry functions, by default it is selected by the AMBARICTL_REGISTRY_STORE environment variable
+func GetRegistryStore() (RegistryStore, error) {
+	registryStoreLock.Lock()
+	defer registryStoreLock.Unlock()
+	if registryStore != nil {
+		return registryStore, nil
+	}
+	folder, err := getDbFolder()
+	if err != nil {
+		return nil, err
+	}
+	storeType := os.Getenv(RegistryStoreEnv)
+	if len(storeType) == 0 || storeType == "json" {
+		registryStore = NewJsonRegistryStore(folder)
+	} else if storeType == "bolt" {
+		registryStore = NewBoltRegistryStore(folder)
+	} else {
+		return nil, fmt.Errorf("unsupported registry store type '%s' (use 'json' or 'bolt')", storeType)
+	}
+	return registryStore, nil
+}
+
+// migrateRegistryData upgrades the registry data to the current schema version, returns true if any migration step was applied
+func migrateRegistryData(folder string, data *RegistryData) (bool, error) {
+	if data.SchemaVersion > RegistrySchemaVersion {
+		return false, fmt.Errorf("registry schema version %v is newer than the supported version %v, upgrade ambarictl", data.SchemaVersion, RegistrySchemaVersion)
+	}
+	registryMigrationTasks = nil
+	migrated := false
+	for data.SchemaVersion < RegistrySchemaVersion {
+		if err := registryMigrations[data.SchemaVersion](folder, data); err != nil {
+			return migrated, fmt.Errorf("registry schema migration from version %v failed: %v", data.SchemaVersion, err)
+		}
+		data.SchemaVersion++
+		migrated = true
+	}
+	if data.AmbariServers == nil {
+		data.AmbariServers = make([]AmbariRegistry, 0)
+	}
+	if data.ConnectionProfiles == nil {
+		data.ConnectionProfiles = make([]ConnectionProfile, 0)
+	}
+	return migrated, nil
+}
+
+// migrateLegacyJsonFiles imports the entries from the ambari_servers.json and connection_profiles.json files (used before schema version 1)
+func migrateLegacyJsonFiles(folder string, data *RegistryData) error {
+	ambariServersFile := path.Join(folder, ambariServerJsonFileName)
+	if exists(ambariServersFile) {
+		content, err := ioutil.ReadFile(ambariServersFile)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(content, &data.AmbariServers); err != nil {
+			return err
+		}
+	}
+	connectionProfilesFile := path.Join(folder, connectionProfilesJsonFileName)
+	if exists(connectionProfilesFile) {
+		content, err := ioutil.ReadFile(connectionProfilesFile)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(content, &data.ConnectionProfiles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migratePlainPasswords marks the cleartext ambari passwords with the plain secret backend (before schema version 2 there were no secret backends),
+// use 'ambarictl secrets migrate' to move them into the vault. The legacy registry files (with cleartext passwords) are removed after the migrated data is persisted.
+func migratePlainPasswords(folder string, data *RegistryData) error {
+	var entryNames []string
+	for index := range data.AmbariServers {
+		if len(data.AmbariServers[index].Password) > 0 && len(data.AmbariServers[index].PasswordRef.Backend) == 0 {
+			data.AmbariServers[index].PasswordRef = SecretRef{Backend: SecretBackendPlain}
+			entryNames = append(entryNames, data.AmbariServers[index].Name)
+		}
+	}
+	registryMigrationTasks = append(registryMigrationTasks, func() error {
+		removed, err := removeLegacyJsonFiles(folder)
+		if len(removed) > 0 {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("Legacy registry file(s) %s have been migrated and removed", strings.Join(removed, ", ")))
+		}
+		if err != nil {
+			return fmt.Errorf("cannot remove legacy registry file (it contains cleartext passwords): %v", err)
+		}
+		if len(entryNames) > 0 {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("WARNING: passwords of Ambari server entries %s are stored in cleartext in the registry, "+
+				"use 'ambarictl secrets migrate' to move them into the secret vault", strings.Join(entryNames, ", ")))
+		}
+		return nil
+	})
+	return nil
+}
+
+// migrateHostKeyPolicies sets accept-new host key policy for the connection profiles without a host key policy (before schema version 3 the host keys were not verified
+// and a missing policy means strict verification now), so the existing profiles keep working, a warning is printed about the migrated profiles
+func migrateHostKeyPolicies(folder string, data *RegistryData) error {
+	var profileNames []string
+	for index := range data.ConnectionProfiles {
+		if len(data.ConnectionProfiles[index].HostKeyPolicy) == 0 {
+			data.ConnectionProfiles[index].HostKeyPolicy = HostKeyPolicyAcceptNew
+			profileNames = append(profileNames, data.ConnectionProfiles[index].Name)
+		}
+	}
+	if len(profileNames) > 0 {
+		registryMigrationTasks = append(registryMigrationTasks, func() error {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("WARNING: ssh host keys are verified with '%s' policy for connection profile(s) %s (unknown host keys are recorded at the first connection), "+
+				"use 'ambarictl profiles trust' then 'ambarictl profiles policy <profile> %s' to accept only the recorded host keys",
+				HostKeyPolicyAcceptNew, strings.Join(profileNames, ", "), HostKeyPolicyStrict))
+			return nil
+		})
+	}
+	return nil
+}
+
+// runRegistryMigrationTasks runs the tasks of the applied migration steps (it should be called after the migrated registry data is persisted)
+func runRegistryMigrationTasks() error {
+	tasks := registryMigrationTasks
+	registryMigrationTasks = nil
+	for _, task := range tasks {
+		if err := task(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes a file (with 0600 permissions) through a temp file in the same folder, then renames it to its final name
+func writeFileAtomic(folder string, fileName string, content []byte) error {
+	tmpFile, err := ioutil.TempFile(folder, fileName+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpFile.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path.Join(folder, fileName))
+}
+
+func getDbFolder() (string, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	home := usr.HomeDir
+	ambariManagerFolder := path.Join(home, ".ambarictl")
+	if _, err := os.Stat(ambariManagerFolder); os.IsNotExist(err) {
+		if err := os.Mkdir(ambariManagerFolder, 0700); err != nil {
+			return "", err
+		}
+	}
+	return ambariManagerFolder, nil
+}
@@ -0,0 +1,195 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"encoding/json"
+	"path"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const registryBoltFileName = "registry.db"
+
+var (
+	metaBucket               = []byte("meta")
+	ambariServersBucket      = []byte("ambari_servers")
+	connectionProfilesBucket = []byte("connection_profiles")
+	schemaVersionKey         = []byte("schema_version")
+)
+
+// BoltRegistryStore stores the registry data in an embedded (bolt) database, entries are stored by name in separate buckets
+type BoltRegistryStore struct {
+	Folder string
+}
+
+// NewBoltRegistryStore creates an embedded database based registry store in a specific folder
+func NewBoltRegistryStore(folder string) *BoltRegistryStore {
+	return &BoltRegistryStore{Folder: folder}
+}
+
+// View runs fn on the registry data in a read-only transaction, if the registry data was migrated to the current schema version, it is persisted after fn
+func (s *BoltRegistryStore) View(fn func(data *RegistryData) error) error {
+	migrated, err := s.view(fn)
+	if err != nil || !migrated {
+		return err
+	}
+	return s.Update(func(data *RegistryData) error {
+		return nil
+	})
+}
+
+// Update runs fn on the registry data in a read-write transaction, the buckets are rewritten from the updated data
+func (s *BoltRegistryStore) Update(fn func(data *RegistryData) error) error {
+	db, err := s.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		data, _, err := s.read(tx)
+		if err != nil {
+			return err
+		}
+		if err := fn(data); err != nil {
+			return err
+		}
+		return s.write(tx, data)
+	})
+	if err != nil {
+		return err
+	}
+	return runRegistryMigrationTasks()
+}
+
+func (s *BoltRegistryStore) view(fn func(data *RegistryData) error) (bool, error) {
+	db, err := s.open(true)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+	migrated := false
+	err = db.View(func(tx *bolt.Tx) error {
+		data, dataMigrated, err := s.read(tx)
+		if err != nil {
+			return err
+		}
+		migrated = dataMigrated
+		return fn(data)
+	})
+	return migrated, err
+}
+
+// open opens the database file, bolt holds a file lock until the database is closed (shared lock in read-only mode)
+func (s *BoltRegistryStore) open(readOnly bool) (*bolt.DB, error) {
+	dbFile := path.Join(s.Folder, registryBoltFileName)
+	if !exists(dbFile) {
+		readOnly = false
+	}
+	db, err := bolt.Open(dbFile, 0600, &bolt.Options{Timeout: lockTimeout, ReadOnly: readOnly})
+	if err == bolt.ErrTimeout {
+		return nil, ErrLockTimeout
+	}
+	return db, err
+}
+
+func (s *BoltRegistryStore) read(tx *bolt.Tx) (*RegistryData, bool, error) {
+	data := &RegistryData{}
+	if bucket := tx.Bucket(metaBucket); bucket != nil {
+		if version := bucket.Get(schemaVersionKey); version != nil {
+			schemaVersion, err := strconv.Atoi(string(version))
+			if err != nil {
+				return nil, false, err
+			}
+			data.SchemaVersion = schemaVersion
+		}
+	}
+	if bucket := tx.Bucket(ambariServersBucket); bucket != nil {
+		err := bucket.ForEach(func(k, v []byte) error {
+			var ambariServer AmbariRegistry
+			if err := json.Unmarshal(v, &ambariServer); err != nil {
+				return err
+			}
+			data.AmbariServers = append(data.AmbariServers, ambariServer)
+			return nil
+		})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if bucket := tx.Bucket(connectionProfilesBucket); bucket != nil {
+		err := bucket.ForEach(func(k, v []byte) error {
+			var connectionProfile ConnectionProfile
+			if err := json.Unmarshal(v, &connectionProfile); err != nil {
+				return err
+			}
+			data.ConnectionProfiles = append(data.ConnectionProfiles, connectionProfile)
+			return nil
+		})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	migrated, err := migrateRegistryData(s.Folder, data)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, migrated, nil
+}
+
+func (s *BoltRegistryStore) write(tx *bolt.Tx, data *RegistryData) error {
+	for _, bucketName := range [][]byte{metaBucket, ambariServersBucket, connectionProfilesBucket} {
+		if tx.Bucket(bucketName) != nil {
+			if err := tx.DeleteBucket(bucketName); err != nil {
+				return err
+			}
+		}
+	}
+	meta, err := tx.CreateBucket(metaBucket)
+	if err != nil {
+		return err
+	}
+	if err := meta.Put(schemaVersionKey, []byte(strconv.Itoa(data.SchemaVersion))); err != nil {
+		return err
+	}
+	ambariServers, err := tx.CreateBucket(ambariServersBucket)
+	if err != nil {
+		return err
+	}
+	for _, ambariServer := range data.AmbariServers {
+		value, err := json.Marshal(ambariServer)
+		if err != nil {
+			return err
+		}
+		if err := ambariServers.Put([]byte(ambariServer.Name), value); err != nil {
+			return err
+		}
+	}
+	connectionProfiles, err := tx.CreateBucket(connectionProfilesBucket)
+	if err != nil {
+		return err
+	}
+	for _, connectionProfile := range data.ConnectionProfiles {
+		value, err := json.Marshal(connectionProfile)
+		if err != nil {
+			return err
+		}
+		if err := connectionProfiles.Put([]byte(connectionProfile.Name), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
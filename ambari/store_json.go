@@ -0,0 +1,120 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+const (
+	registryJsonFileName = "registry.json"
+	registryLockFileName = "registry.lock"
+)
+
+// JsonRegistryStore stores the registry data in a json file, the access is serialized by a lock file, writes are atomic (write to a temp file + rename)
+type JsonRegistryStore struct {
+	Folder string
+}
+
+// NewJsonRegistryStore creates a json file based registry store in a specific folder
+func NewJsonRegistryStore(folder string) *JsonRegistryStore {
+	return &JsonRegistryStore{Folder: folder}
+}
+
+// View runs fn on the registry data with a shared lock, if the registry data was migrated to the current schema version, it is persisted after fn
+func (s *JsonRegistryStore) View(fn func(data *RegistryData) error) error {
+	migrated, err := s.view(fn)
+	if err != nil || !migrated {
+		return err
+	}
+	return s.Update(func(data *RegistryData) error {
+		return nil
+	})
+}
+
+// Update runs fn on the registry data with an exclusive lock, then writes the data back to the registry file
+func (s *JsonRegistryStore) Update(fn func(data *RegistryData) error) error {
+	lock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+	data, _, err := s.read()
+	if err != nil {
+		return err
+	}
+	if err := fn(data); err != nil {
+		return err
+	}
+	if err := s.write(data); err != nil {
+		return err
+	}
+	return runRegistryMigrationTasks()
+}
+
+func (s *JsonRegistryStore) view(fn func(data *RegistryData) error) (bool, error) {
+	lock, err := s.lock(false)
+	if err != nil {
+		return false, err
+	}
+	defer unlockFile(lock)
+	data, migrated, err := s.read()
+	if err != nil {
+		return false, err
+	}
+	return migrated, fn(data)
+}
+
+func (s *JsonRegistryStore) lock(exclusive bool) (*os.File, error) {
+	lock, err := os.OpenFile(path.Join(s.Folder, registryLockFileName), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(lock, exclusive); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return lock, nil
+}
+
+func (s *JsonRegistryStore) read() (*RegistryData, bool, error) {
+	data := &RegistryData{}
+	registryFile := path.Join(s.Folder, registryJsonFileName)
+	if exists(registryFile) {
+		content, err := ioutil.ReadFile(registryFile)
+		if err != nil {
+			return nil, false, err
+		}
+		if err := json.Unmarshal(content, data); err != nil {
+			return nil, false, err
+		}
+	}
+	migrated, err := migrateRegistryData(s.Folder, data)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, migrated, nil
+}
+
+func (s *JsonRegistryStore) write(data *RegistryData) error {
+	content, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Folder, registryJsonFileName, content)
+}
@@ -0,0 +1,176 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+)
+
+// registryUpdaterEnv is set for the child test processes of TestRegistryStoreConcurrentUpdates: <store type>:<folder>:<process id>
+const registryUpdaterEnv = "AMBARICTL_TEST_REGISTRY_UPDATER"
+
+const registryUpdatesPerProcess = 10
+
+func TestRegistryStoreMigrations(t *testing.T) {
+	tests := []struct {
+		name     string
+		newStore func(folder string) RegistryStore
+	}{
+		{"json", func(folder string) RegistryStore { return NewJsonRegistryStore(folder) }},
+		{"bolt", func(folder string) RegistryStore { return NewBoltRegistryStore(folder) }},
+	}
+	for _, test := range tests {
+		folder, err := ioutil.TempDir("", "ambarictl-registry")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(folder)
+		legacyFiles := map[string]string{
+			ambariServerJsonFileName:       `[{"name":"prod","hostname":"ambari.example.com","port":8080,"username":"admin","password":"admin","active":true}]`,
+			connectionProfilesJsonFileName: `[{"name":"ssh","username":"root","port":22},{"name":"pinned","host_key_policy":"strict"}]`,
+		}
+		for fileName, content := range legacyFiles {
+			if err := ioutil.WriteFile(path.Join(folder, fileName), []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var data RegistryData
+		if err := test.newStore(folder).View(func(registryData *RegistryData) error {
+			data = *registryData
+			return nil
+		}); err != nil {
+			t.Errorf("%s: View() error: %v", test.name, err)
+			continue
+		}
+		if data.SchemaVersion != RegistrySchemaVersion {
+			t.Errorf("%s: schema version = %v, want %v", test.name, data.SchemaVersion, RegistrySchemaVersion)
+		}
+		if len(data.AmbariServers) != 1 || data.AmbariServers[0].Password != "admin" || data.AmbariServers[0].PasswordRef.Backend != SecretBackendPlain {
+			t.Errorf("%s: ambari servers are not migrated: %+v", test.name, data.AmbariServers)
+		}
+		if len(data.ConnectionProfiles) != 2 || data.ConnectionProfiles[0].HostKeyPolicy != HostKeyPolicyAcceptNew || data.ConnectionProfiles[1].HostKeyPolicy != HostKeyPolicyStrict {
+			t.Errorf("%s: connection profiles are not migrated: %+v", test.name, data.ConnectionProfiles)
+		}
+		for fileName := range legacyFiles {
+			if exists(path.Join(folder, fileName)) {
+				t.Errorf("%s: legacy registry file %s is not removed", test.name, fileName)
+			}
+		}
+		// the migrated data is persisted, a new store reads it without the legacy files
+		if err := test.newStore(folder).View(func(registryData *RegistryData) error {
+			data = *registryData
+			return nil
+		}); err != nil {
+			t.Errorf("%s: View() error: %v", test.name, err)
+		} else if len(data.AmbariServers) != 1 || len(data.ConnectionProfiles) != 2 || data.SchemaVersion != RegistrySchemaVersion {
+			t.Errorf("%s: migrated registry data is not persisted: %+v", test.name, data)
+		}
+	}
+}
+
+func TestMigrateRegistryData(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     RegistryData
+		migrated bool
+		err      bool
+	}{
+		{name: "current schema", data: RegistryData{SchemaVersion: RegistrySchemaVersion}},
+		{name: "old schema", data: RegistryData{SchemaVersion: RegistrySchemaVersion - 1, ConnectionProfiles: []ConnectionProfile{{Name: "ssh"}}}, migrated: true},
+		{name: "newer schema", data: RegistryData{SchemaVersion: RegistrySchemaVersion + 1}, err: true},
+	}
+	for _, test := range tests {
+		migrated, err := migrateRegistryData("", &test.data)
+		registryMigrationTasks = nil
+		if (err != nil) != test.err || migrated != test.migrated {
+			t.Errorf("%s: migrateRegistryData() = %v, %v, want migrated: %v, error: %v", test.name, migrated, err, test.migrated, test.err)
+			continue
+		}
+		if !test.err && (test.data.AmbariServers == nil || test.data.ConnectionProfiles == nil) {
+			t.Errorf("%s: empty registry lists are not initialized", test.name)
+		}
+	}
+}
+
+// TestRegistryUpdaterProcess adds ambari server entries from a child process (it does nothing in a normal test run)
+func TestRegistryUpdaterProcess(t *testing.T) {
+	spec := strings.SplitN(os.Getenv(registryUpdaterEnv), ":", 3)
+	if len(spec) != 3 {
+		return
+	}
+	var store RegistryStore = NewJsonRegistryStore(spec[1])
+	if spec[0] == "bolt" {
+		store = NewBoltRegistryStore(spec[1])
+	}
+	for i := 0; i < registryUpdatesPerProcess; i++ {
+		err := store.Update(func(data *RegistryData) error {
+			data.AmbariServers = append(data.AmbariServers, AmbariRegistry{Name: fmt.Sprintf("%s-%d", spec[2], i)})
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRegistryStoreConcurrentUpdates(t *testing.T) {
+	if len(os.Getenv(registryUpdaterEnv)) > 0 {
+		t.Skip("running as a registry updater process")
+	}
+	const processes = 4
+	for _, storeType := range []string{"json", "bolt"} {
+		folder, err := ioutil.TempDir("", "ambarictl-registry")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(folder)
+		var commands []*exec.Cmd
+		for i := 0; i < processes; i++ {
+			command := exec.Command(os.Args[0], "-test.run=^TestRegistryUpdaterProcess$")
+			command.Env = append(os.Environ(), fmt.Sprintf("%s=%s:%s:p%d", registryUpdaterEnv, storeType, folder, i))
+			if err := command.Start(); err != nil {
+				t.Fatal(err)
+			}
+			commands = append(commands, command)
+		}
+		for _, command := range commands {
+			if err := command.Wait(); err != nil {
+				t.Errorf("%s: registry updater process failed: %v", storeType, err)
+			}
+		}
+		var store RegistryStore = NewJsonRegistryStore(folder)
+		if storeType == "bolt" {
+			store = NewBoltRegistryStore(folder)
+		}
+		names := make(map[string]bool)
+		if err := store.View(func(data *RegistryData) error {
+			for _, ambariServer := range data.AmbariServers {
+				names[ambariServer.Name] = true
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		// every update reads and rewrites the whole registry, an update is lost if the writes are not serialized
+		if len(names) != processes*registryUpdatesPerProcess {
+			t.Errorf("%s: %d ambari server entries are stored, want %d", storeType, len(names), processes*registryUpdatesPerProcess)
+		}
+	}
+}
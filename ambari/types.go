@@ -14,27 +14,80 @@
 
 package ambari
 
+import "context"
+
 // AmbariRegistry represents registered ambari server entry details
 type AmbariRegistry struct {
-	Name              string `json:"name"`
-	Hostname          string `json:"hostname"`
-	Port              int    `json:"port"`
-	Username          string `json:"username"`
-	Password          string `json:"password"`
-	Protocol          string `json:"protocol"`
-	Cluster           string `json:"cluster"`
-	Active            bool   `json:"active"`
-	ConnectionProfile string `json:"profile"`
+	Name              string      `json:"name"`
+	Hostname          string      `json:"hostname"`
+	Port              int         `json:"port"`
+	Username          string      `json:"username"`
+	Password          string      `json:"password,omitempty"`
+	PasswordRef       SecretRef   `json:"password_ref,omitempty"`
+	Protocol          string      `json:"protocol"`
+	Cluster           string      `json:"cluster"`
+	Active            bool        `json:"active"`
+	ConnectionProfile string      `json:"profile"`
+	Timeout           int         `json:"timeout,omitempty"`
+	Retries           int         `json:"retries,omitempty"`
+	TLS               TLSSettings `json:"tls,omitempty"`
+	ctx               context.Context
+}
+
+// SecretRef represents a reference for a secret that is stored by a secret backend (plain, vault, env or helper)
+type SecretRef struct {
+	Backend string `json:"backend,omitempty"`
+	Key     string `json:"key,omitempty"`
+}
+
+// TLSSettings represents TLS details for communicating with an Ambari server over https
+type TLSSettings struct {
+	CACertPath     string `json:"ca_cert,omitempty"`
+	ClientCertPath string `json:"client_cert,omitempty"`
+	ClientKeyPath  string `json:"client_key,omitempty"`
+	ServerName     string `json:"server_name,omitempty"`
+	Insecure       bool   `json:"insecure,omitempty"`
 }
 
 // ConnectionProfile represents ssh/connection descriptions which is used to communicate with Ambari server and agents
 type ConnectionProfile struct {
-	Name         string `json:"name"`
-	KeyPath      string `json:"key_path"`
-	Port         int    `json:"port"`
-	Username     string `json:"username"`
-	HostJump     bool   `json:"host_jump"`
-	ProxyAddress string `json:"proxy_address"`
+	Name             string         `json:"name"`
+	KeyPath          string         `json:"key_path"`
+	Port             int            `json:"port"`
+	Username         string         `json:"username"`
+	HostJump         bool           `json:"host_jump"`
+	ProxyAddress     string         `json:"proxy_address"`
+	HostKeyPolicy    string         `json:"host_key_policy,omitempty"`
+	KnownHostsFile   string         `json:"known_hosts_file,omitempty"`
+	CertificatePath  string         `json:"certificate_path,omitempty"`
+	KeyPassphraseRef SecretRef      `json:"key_passphrase_ref,omitempty"`
+	PasswordRef      SecretRef      `json:"password_ref,omitempty"`
+	UseAgent         bool           `json:"use_agent,omitempty"`
+	ForwardAgent     bool           `json:"forward_agent,omitempty"`
+	JumpHosts        []JumpHost     `json:"jump_hosts,omitempty"`
+	HostOverrides    []HostOverride `json:"host_overrides,omitempty"`
+}
+
+// JumpHost one hop of the jump host chain of a connection profile, port and username are inherited from the connection profile if those are not set,
+// the credentials (key, password, agent) are inherited only if none of them is set for the hop
+type JumpHost struct {
+	Address          string    `json:"address"`
+	Port             int       `json:"port,omitempty"`
+	Username         string    `json:"username,omitempty"`
+	KeyPath          string    `json:"key_path,omitempty"`
+	CertificatePath  string    `json:"certificate_path,omitempty"`
+	KeyPassphraseRef SecretRef `json:"key_passphrase_ref,omitempty"`
+	PasswordRef      SecretRef `json:"password_ref,omitempty"`
+	UseAgent         bool      `json:"use_agent,omitempty"`
+}
+
+// HostOverride overrides the ssh username, port or key of a connection profile for the hosts that match a pattern (ip, host name or public host name, e.g.: *.example.com)
+type HostOverride struct {
+	Pattern          string    `json:"pattern"`
+	Port             int       `json:"port,omitempty"`
+	Username         string    `json:"username,omitempty"`
+	KeyPath          string    `json:"key_path,omitempty"`
+	KeyPassphraseRef SecretRef `json:"key_passphrase_ref,omitempty"`
 }
 
 // AmbariItems global items from Ambari rest API response
@@ -49,63 +102,288 @@ type Item map[string]interface{}
 
 // Host agent host details
 type Host struct {
-	HostName       string `json:"host_name,omitempty"`
-	IP             string `json:"ip,omitempty"`
-	PublicHostname string `json:"public_host_name,omitempty"`
-	OSType         string `json:"os_type,omitempty"`
-	OSArch         string `json:"os_arch,omitempty"`
-	UnlimitedJCE   bool   `json:"unlimited_jce,omitempty"`
-	HostState      string `json:"host_state,omitempty"`
+	HostName       string `json:"host_name"`
+	IP             string `json:"ip"`
+	PublicHostname string `json:"public_host_name"`
+	OSType         string `json:"os_type"`
+	OSArch         string `json:"os_arch"`
+	UnlimitedJCE   bool   `json:"unlimited_jce"`
+	HostState      string `json:"host_state"`
 }
 
 // Service ambari managed service info
 type Service struct {
-	ServiceName  string `json:"service_name,omitempty"`
-	ServiceState string `json:"state,omitempty"`
+	ServiceName      string `json:"service_name"`
+	ServiceState     string `json:"state"`
+	MaintenanceState string `json:"maintenance_state"`
 }
 
 // Component ambari managed component details
 type Component struct {
-	ComponentName  string `json:"component_name,omitempty"`
-	ServiceName    string `json:"service_name,omitempty"`
-	ComponentState string `json:"state,omitempty"`
+	ComponentName  string `json:"component_name"`
+	ServiceName    string `json:"service_name"`
+	ComponentState string `json:"state"`
+	Category       string `json:"category"`
 }
 
 // HostComponent ambari managed host component details
 type HostComponent struct {
-	HostComponentName  string `json:"host_component_name,omitempty"`
-	HostComponentState string `json:"state,omitempty"`
-	HostComponntHost   string `json:"host_name,omitempty"`
+	HostComponentName  string `json:"host_component_name"`
+	HostComponentState string `json:"state"`
+	HostComponntHost   string `json:"host_name"`
+	ServiceName        string `json:"service_name"`
+	DesiredState       string `json:"desired_state"`
+	StaleConfigs       bool   `json:"stale_configs"`
+	MaintenanceState   string `json:"maintenance_state"`
+	DesiredAdminState  string `json:"desired_admin_state"`
+}
+
+// Alert represents the current state of an Ambari alert instance
+type Alert struct {
+	ID               int    `json:"id"`
+	DefinitionName   string `json:"definition_name"`
+	Label            string `json:"label"`
+	State            string `json:"state"`
+	ServiceName      string `json:"service_name"`
+	ComponentName    string `json:"component_name"`
+	HostName         string `json:"host_name"`
+	Text             string `json:"text"`
+	MaintenanceState string `json:"maintenance_state"`
+	Timestamp        int64  `json:"original_timestamp"`
+}
+
+// AlertHistory represents a state change of an Ambari alert instance
+type AlertHistory struct {
+	ID             int    `json:"id"`
+	DefinitionName string `json:"definition_name"`
+	Label          string `json:"label"`
+	State          string `json:"state"`
+	ServiceName    string `json:"service_name"`
+	ComponentName  string `json:"component_name"`
+	HostName       string `json:"host_name"`
+	Text           string `json:"text"`
+	Timestamp      int64  `json:"timestamp"`
+}
+
+// AlertDefinition represents an Ambari alert definition (the check which creates the alert instances)
+type AlertDefinition struct {
+	ID            int    `json:"id"`
+	Name          string `json:"name"`
+	Label         string `json:"label"`
+	ServiceName   string `json:"service_name"`
+	ComponentName string `json:"component_name"`
+	Scope         string `json:"scope"`
+	Interval      int    `json:"interval"`
+	Enabled       bool   `json:"enabled"`
 }
 
 // ServiceConfig represents service specific configurations
 type ServiceConfig struct {
-	ServiceConfigType    string     `json:"type,omitempty"`
-	ServiceConfigTag     string     `json:"tag,omitempty"`
-	ServiceConfigVersion float64    `json:"version,omitempty"`
-	Properties           Properties `json:"properties,omitempty"`
+	ServiceConfigType    string     `json:"type"`
+	ServiceConfigTag     string     `json:"tag"`
+	ServiceConfigVersion float64    `json:"version"`
+	Properties           Properties `json:"properties"`
 }
 
 // StackConfig represents stack default configurations (with included service name and service config type)
 type StackConfig struct {
-	ServiceConfigType string          `json:"type,omitempty"`
-	Properties        []StackProperty `json:"properties,omitempty"`
+	ServiceConfigType string          `json:"type"`
+	ServiceName       string          `json:"service_name"`
+	Properties        []StackProperty `json:"properties"`
 }
 
 // StackProperty represents a stack property with default values and attributes
 type StackProperty struct {
-	Type         string `json:"type,omitempty"`
-	Name         string `json:"property_name,omitempty"`
-	Value        string `json:"property_value,omitempty"`
-	PropertyType string `json:"property_type,omitempty"`
+	Type         string            `json:"type"`
+	Name         string            `json:"property_name"`
+	Value        string            `json:"property_value"`
+	PropertyType string            `json:"property_type"`
+	Final        bool              `json:"final"`
+	Attributes   map[string]string `json:"property_value_attributes"`
+}
+
+// StackVersion represents a version of a stack that is available in Ambari
+type StackVersion struct {
+	StackName    string `json:"stack_name"`
+	StackVersion string `json:"stack_version"`
+	Active       bool   `json:"active"`
+}
+
+// StackDefinition holds the services, components and default configurations of a stack version (it can be saved for offline usage)
+type StackDefinition struct {
+	StackName      string                 `json:"stack_name"`
+	StackVersion   string                 `json:"stack_version"`
+	Services       []StackService         `json:"services"`
+	Configurations map[string]StackConfig `json:"configurations"`
+}
+
+// StackService represents a service of a stack version with its components
+type StackService struct {
+	ServiceName string           `json:"service_name"`
+	Components  []StackComponent `json:"components"`
+}
+
+// StackComponent represents a component of a stack service: category (MASTER, SLAVE or CLIENT), cardinality (like 1, 1+, 0-1 or ALL) and dependencies
+type StackComponent struct {
+	ComponentName string                     `json:"component_name"`
+	ServiceName   string                     `json:"service_name"`
+	Category      string                     `json:"category"`
+	Cardinality   string                     `json:"cardinality"`
+	Dependencies  []StackComponentDependency `json:"dependencies"`
+}
+
+// StackComponentDependency represents a component dependency, the scope is host (the components need to be co-located) or cluster
+type StackComponentDependency struct {
+	ComponentName string `json:"component_name"`
+	ServiceName   string `json:"service_name"`
+	Scope         string `json:"scope"`
 }
 
 // Cluster holds installed ambari cluster details
 type Cluster struct {
-	ClusterName         string  `json:"cluster_name,omitempty"`
-	ClusterVersion      string  `json:"version,omitempty"`
-	ClusterTotalHosts   float64 `json:"total_hosts,omitempty"`
-	ClusterSecurityType string  `json:"security_type,omitempty"`
+	ClusterName         string  `json:"cluster_name"`
+	ClusterVersion      string  `json:"version"`
+	ClusterTotalHosts   float64 `json:"total_hosts"`
+	ClusterSecurityType string  `json:"security_type"`
+}
+
+// AmbariRequest represents an (asynchronous) Ambari request with its tasks
+type AmbariRequest struct {
+	ID              int           `json:"id"`
+	Status          string        `json:"request_status,omitempty"`
+	Context         string        `json:"request_context,omitempty"`
+	ProgressPercent float64       `json:"progress_percent,omitempty"`
+	Tasks           []RequestTask `json:"tasks,omitempty"`
+}
+
+// RequestTask represents a host level task of an Ambari request
+type RequestTask struct {
+	ID       int    `json:"id"`
+	HostName string `json:"host_name,omitempty"`
+	Role     string `json:"role,omitempty"`
+	Command  string `json:"command,omitempty"`
+	Status   string `json:"status,omitempty"`
+}
+
+// Configuration represents a config type with a specific tag (properties and property attributes)
+type Configuration struct {
+	Type                 string                       `json:"type"`
+	Tag                  string                       `json:"tag"`
+	Version              float64                      `json:"version,omitempty"`
+	Properties           map[string]string            `json:"properties"`
+	PropertiesAttributes map[string]map[string]string `json:"properties_attributes,omitempty"`
+}
+
+// ServiceConfigVersion represents a version of the configurations of a service (cluster level or config group level)
+type ServiceConfigVersion struct {
+	ServiceName    string          `json:"service_name"`
+	Version        int             `json:"service_config_version"`
+	GroupName      string          `json:"group_name,omitempty"`
+	IsCurrent      bool            `json:"is_current"`
+	Note           string          `json:"service_config_version_note,omitempty"`
+	User           string          `json:"user,omitempty"`
+	CreateTime     int64           `json:"createtime,omitempty"`
+	Configurations []Configuration `json:"configurations,omitempty"`
+}
+
+// ConfigDiff represents the property differences of a config type between 2 configuration sources
+type ConfigDiff struct {
+	Type       string         `json:"type"`
+	Properties []PropertyDiff `json:"properties"`
+}
+
+// PropertyDiff represents an added, removed or changed property
+type PropertyDiff struct {
+	Key    string `json:"key"`
+	Change string `json:"change"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// ConfigUpdate describes a change of a config type: properties to set or delete, optionally for a config group (instead of the cluster defaults)
+type ConfigUpdate struct {
+	ConfigType  string
+	Set         map[string]string
+	Delete      []string
+	ConfigGroup string
+	VersionNote string
+}
+
+// ConfigGroup represents an Ambari config group (configuration overrides for a set of hosts of a service)
+type ConfigGroup struct {
+	ID             int                        `json:"id,omitempty"`
+	ClusterName    string                     `json:"cluster_name,omitempty"`
+	GroupName      string                     `json:"group_name"`
+	Tag            string                     `json:"tag"`
+	Description    string                     `json:"description"`
+	Hosts          []ConfigGroupHost          `json:"hosts"`
+	DesiredConfigs []ConfigGroupDesiredConfig `json:"desired_configs"`
+}
+
+// ConfigGroupHost represents a host of a config group
+type ConfigGroupHost struct {
+	HostName string `json:"host_name"`
+}
+
+// ConfigGroupDesiredConfig represents a config type (with tag) which is overridden by a config group
+type ConfigGroupDesiredConfig struct {
+	Type                 string                       `json:"type"`
+	Tag                  string                       `json:"tag"`
+	Properties           map[string]string            `json:"properties,omitempty"`
+	PropertiesAttributes map[string]map[string]string `json:"properties_attributes,omitempty"`
+	VersionNote          string                       `json:"service_config_version_note,omitempty"`
+}
+
+// Blueprint represents the topology part of an Ambari blueprint (stack and host groups)
+type Blueprint struct {
+	Blueprints BlueprintInfo `json:"Blueprints"`
+	HostGroups []HostGroup   `json:"host_groups"`
+}
+
+// BlueprintInfo holds the name and the stack of a blueprint
+type BlueprintInfo struct {
+	Name         string `json:"blueprint_name,omitempty"`
+	StackName    string `json:"stack_name"`
+	StackVersion string `json:"stack_version"`
+}
+
+// ClusterTemplate represents an Ambari cluster creation template: maps hosts to the host groups of a registered blueprint
+type ClusterTemplate struct {
+	Blueprint                    string                     `json:"blueprint"`
+	DefaultPassword              string                     `json:"default_password,omitempty"`
+	ProvisionAction              string                     `json:"provision_action,omitempty"`
+	ConfigRecommendationStrategy string                     `json:"config_recommendation_strategy,omitempty"`
+	RepositoryVersion            string                     `json:"repository_version,omitempty"`
+	Configurations               []map[string]interface{}   `json:"configurations,omitempty"`
+	Credentials                  []map[string]interface{}   `json:"credentials,omitempty"`
+	Security                     map[string]interface{}     `json:"security,omitempty"`
+	HostGroups                   []ClusterTemplateHostGroup `json:"host_groups"`
+}
+
+// ClusterTemplateHostGroup represents the hosts of a host group in a cluster creation template (host list or host count with an optional predicate)
+type ClusterTemplateHostGroup struct {
+	Name          string                `json:"name"`
+	Hosts         []ClusterTemplateHost `json:"hosts,omitempty"`
+	HostCount     int                   `json:"host_count,omitempty"`
+	HostPredicate string                `json:"host_predicate,omitempty"`
+}
+
+// ClusterTemplateHost represents a host of a host group in a cluster creation template
+type ClusterTemplateHost struct {
+	FQDN     string `json:"fqdn"`
+	RackInfo string `json:"rack_info,omitempty"`
+}
+
+// HostGroup represents a blueprint host group (components that are installed on the hosts of the group)
+type HostGroup struct {
+	Name        string               `json:"name"`
+	Cardinality string               `json:"cardinality,omitempty"`
+	Components  []BlueprintComponent `json:"components"`
+}
+
+// BlueprintComponent represents a component of a blueprint host group
+type BlueprintComponent struct {
+	Name string `json:"name"`
 }
 
 // Properties represents configuration properties (key/value pairs)
@@ -113,11 +391,16 @@ type Properties map[string]interface{}
 
 // Response common type which wraps all of the possible response entry types
 type Response struct {
-	Cluster        Cluster
-	Hosts          []Host
-	Services       []Service
-	Components     []Component
-	HostComponents []HostComponent
-	ServiceConfigs []ServiceConfig
-	StackConfigs   map[string]StackConfig
+	Cluster          Cluster
+	Hosts            []Host
+	Services         []Service
+	Components       []Component
+	HostComponents   []HostComponent
+	ServiceConfigs   []ServiceConfig
+	StackConfigs     map[string]StackConfig
+	StackServices    []StackService
+	StackVersions    []StackVersion
+	Alerts           []Alert
+	AlertHistory     []AlertHistory
+	AlertDefinitions []AlertDefinition
 }
@@ -0,0 +1,259 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambari
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// VaultPassphraseEnv environment variable for providing the secret vault passphrase (otherwise it is asked from the user)
+	VaultPassphraseEnv = "AMBARICTL_VAULT_PASSPHRASE"
+
+	vaultFileName     = "vault.json"
+	vaultLockFileName = "vault.lock"
+	vaultVersion      = 1
+	scryptN           = 1 << 15
+	scryptR           = 8
+	scryptP           = 1
+	vaultKeyLength    = 32
+)
+
+var (
+	vaultPassphrase     []byte
+	vaultPassphraseLock sync.Mutex
+)
+
+// Vault is a local, passphrase protected secret storage (scrypt key derivation + AES-GCM encryption)
+type Vault struct {
+	Folder     string
+	passphrase []byte
+}
+
+type vaultFile struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// OpenVault opens the secret vault of the ambarictl folder, the passphrase is read from AMBARICTL_VAULT_PASSPHRASE or asked from the user (once per process)
+func OpenVault() (*Vault, error) {
+	folder, err := getDbFolder()
+	if err != nil {
+		return nil, err
+	}
+	vault := &Vault{Folder: folder}
+	passphrase, err := getVaultPassphrase(!exists(path.Join(folder, vaultFileName)))
+	if err != nil {
+		return nil, err
+	}
+	vault.passphrase = passphrase
+	if err := vault.view(func(secrets map[string]string) error { return nil }); err != nil {
+		clearVaultPassphrase()
+		return nil, err
+	}
+	return vault, nil
+}
+
+// Get obtain a secret from the vault by key
+func (v *Vault) Get(key string) (string, error) {
+	var value string
+	err := v.view(func(secrets map[string]string) error {
+		secret, ok := secrets[key]
+		if !ok {
+			return &RegistryError{Kind: "secret", ID: key, Msg: "not found in the vault"}
+		}
+		value = secret
+		return nil
+	})
+	return value, err
+}
+
+// Set stores secrets in the vault (overrides the existing values)
+func (v *Vault) Set(values map[string]string) error {
+	return v.update(func(secrets map[string]string) error {
+		for key, value := range values {
+			secrets[key] = value
+		}
+		return nil
+	})
+}
+
+// Delete removes a secret from the vault
+func (v *Vault) Delete(key string) error {
+	return v.update(func(secrets map[string]string) error {
+		delete(secrets, key)
+		return nil
+	})
+}
+
+func (v *Vault) view(fn func(secrets map[string]string) error) error {
+	lock, err := v.lock(false)
+	if err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+	secrets, err := v.read()
+	if err != nil {
+		return err
+	}
+	return fn(secrets)
+}
+
+func (v *Vault) update(fn func(secrets map[string]string) error) error {
+	lock, err := v.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+	secrets, err := v.read()
+	if err != nil {
+		return err
+	}
+	if err := fn(secrets); err != nil {
+		return err
+	}
+	return v.write(secrets)
+}
+
+func (v *Vault) lock(exclusive bool) (*os.File, error) {
+	lock, err := os.OpenFile(path.Join(v.Folder, vaultLockFileName), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(lock, exclusive); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return lock, nil
+}
+
+func (v *Vault) read() (map[string]string, error) {
+	secrets := make(map[string]string)
+	vaultFilePath := path.Join(v.Folder, vaultFileName)
+	if !exists(vaultFilePath) {
+		return secrets, nil
+	}
+	content, err := ioutil.ReadFile(vaultFilePath)
+	if err != nil {
+		return nil, err
+	}
+	var encrypted vaultFile
+	if err := json.Unmarshal(content, &encrypted); err != nil {
+		return nil, err
+	}
+	if encrypted.Version != vaultVersion {
+		return nil, errors.New("unsupported secret vault version, upgrade ambarictl")
+	}
+	gcm, err := createVaultCipher(v.passphrase, encrypted.Salt, encrypted.N, encrypted.R, encrypted.P)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, encrypted.Nonce, encrypted.Data, nil)
+	if err != nil {
+		return nil, ErrVaultDecrypt
+	}
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+func (v *Vault) write(secrets map[string]string) error {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	encrypted := vaultFile{Version: vaultVersion, N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 16)}
+	if _, err := io.ReadFull(rand.Reader, encrypted.Salt); err != nil {
+		return err
+	}
+	gcm, err := createVaultCipher(v.passphrase, encrypted.Salt, encrypted.N, encrypted.R, encrypted.P)
+	if err != nil {
+		return err
+	}
+	encrypted.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, encrypted.Nonce); err != nil {
+		return err
+	}
+	encrypted.Data = gcm.Seal(nil, encrypted.Nonce, plaintext, nil)
+	content, err := json.MarshalIndent(encrypted, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(v.Folder, vaultFileName, content)
+}
+
+func createVaultCipher(passphrase []byte, salt []byte, n int, r int, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, n, r, p, vaultKeyLength)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// getVaultPassphrase returns the cached vault passphrase, or reads it from the environment / user input (a new passphrase is asked twice)
+func getVaultPassphrase(newVault bool) ([]byte, error) {
+	vaultPassphraseLock.Lock()
+	defer vaultPassphraseLock.Unlock()
+	if vaultPassphrase != nil {
+		return vaultPassphrase, nil
+	}
+	passphrase := os.Getenv(VaultPassphraseEnv)
+	if len(passphrase) == 0 {
+		var err error
+		if newVault {
+			if passphrase, err = GetPassword("", "Enter new secret vault passphrase"); err != nil {
+				return nil, err
+			}
+			confirmed, err := GetPassword("", "Confirm secret vault passphrase")
+			if err != nil {
+				return nil, err
+			}
+			if passphrase != confirmed {
+				return nil, errors.New("secret vault passphrases do not match")
+			}
+		} else if passphrase, err = GetPassword("", "Enter secret vault passphrase"); err != nil {
+			return nil, err
+		}
+	}
+	vaultPassphrase = []byte(passphrase)
+	return vaultPassphrase, nil
+}
+
+func clearVaultPassphrase() {
+	vaultPassphraseLock.Lock()
+	defer vaultPassphraseLock.Unlock()
+	vaultPassphrase = nil
+}
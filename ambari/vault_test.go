@@ -0,0 +1,68 @@
+// Copyright 2018 Oliver Szabo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ambari
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestVault(t *testing.T) {
+	folder, err := ioutil.TempDir("", "ambarictl-vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	vault := &Vault{Folder: folder, passphrase: []byte("passphrase")}
+	if err := vault.Set(map[string]string{"ambari/prod": "secret-password", "ambari/dev": "dev-password"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Delete("ambari/dev"); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(path.Join(folder, vaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "secret-password") || strings.Contains(string(content), "ambari/prod") {
+		t.Errorf("vault file contains cleartext secrets: %s", content)
+	}
+	tests := []struct {
+		name       string
+		passphrase string
+		key        string
+		value      string
+		err        string
+	}{
+		{name: "existing secret", passphrase: "passphrase", key: "ambari/prod", value: "secret-password"},
+		{name: "deleted secret", passphrase: "passphrase", key: "ambari/dev", err: "not found in the vault"},
+		{name: "missing secret", passphrase: "passphrase", key: "ambari/missing", err: "not found in the vault"},
+		{name: "wrong passphrase", passphrase: "wrong", key: "ambari/prod", err: ErrVaultDecrypt.Error()},
+	}
+	for _, test := range tests {
+		value, err := (&Vault{Folder: folder, passphrase: []byte(test.passphrase)}).Get(test.key)
+		if len(test.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: Get(%q) error = %v, want %q", test.name, test.key, err, test.err)
+			}
+			continue
+		}
+		if err != nil || value != test.value {
+			t.Errorf("%s: Get(%q) = %q, %v, want %q", test.name, test.key, value, err, test.value)
+		}
+	}
+}
@@ -15,17 +15,26 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/oleewere/ambarictl/ambari"
 	"github.com/olekukonko/tablewriter"
 	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"os/user"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
+	"text/template"
+	"time"
 )
 
 // Version that will be generated during the build as a constant
@@ -49,12 +58,23 @@ func main() {
 		app.Version = app.Version + fmt.Sprintf(" (git short hash: %v)", GitRevString)
 	}
 
+	ctx, cancel := createSignalContext()
+	defer cancel()
+
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "output, o", Value: "table", EnvVar: "AMBARICTL_OUTPUT", Usage: "Output format of the listing commands: table/json/yaml/csv/template"},
+		cli.StringFlag{Name: "template", Usage: "Go text/template for the template output format (executed on the listed items, e.g.: '{{range .}}{{.ServiceName}} {{end}}')"},
+	}
+
 	app.Commands = []cli.Command{}
 	initCommand := cli.Command{
 		Name:  "init",
 		Usage: "Initialize Ambari server database",
 		Action: func(c *cli.Context) error {
-			ambari.CreateAmbariRegistryDb()
+			err := ambari.CreateAmbariRegistryDb()
+			if err != nil {
+				return err
+			}
 			fmt.Println("Ambari registry DB has been initialized.")
 			return nil
 		},
@@ -65,7 +85,10 @@ func main() {
 		Aliases: []string{"ls"},
 		Usage:   "Print all registered Ambari servers",
 		Action: func(c *cli.Context) error {
-			ambariServerEntries := ambari.ListAmbariRegistryEntries()
+			ambariServerEntries, err := ambari.ListAmbariRegistryEntries()
+			if err != nil {
+				return err
+			}
 			var tableData [][]string
 			for _, ambariServer := range ambariServerEntries {
 				activeValue := "false"
@@ -73,10 +96,10 @@ func main() {
 					activeValue = "true"
 				}
 				tableData = append(tableData, []string{ambariServer.Name, ambariServer.Hostname, strconv.Itoa(ambariServer.Port), ambariServer.Protocol,
-					ambariServer.Username, "********", ambariServer.Cluster, ambariServer.ConnectionProfile, activeValue})
+					ambariServer.Username, ambariServer.PasswordRef.String(), ambariServer.Cluster, ambariServer.ConnectionProfile, activeValue})
 			}
-			printTable("AMBARI REGISTRIES:", []string{"Name", "HOSTNAME", "PORT", "PROTOCOL", "USER", "PASSWORD", "CLUSTER", "PROFILE", "ACTIVE"}, tableData, c)
-			return nil
+			return printOutput("AMBARI REGISTRIES:", []string{"Name", "HOSTNAME", "PORT", "PROTOCOL", "USER", "PASSWORD", "CLUSTER", "PROFILE", "ACTIVE"}, tableData,
+				hidePasswords(ambariServerEntries), c)
 		},
 	}
 
@@ -89,44 +112,101 @@ func main() {
 				Aliases: []string{"c"},
 				Usage:   "Create new connection profile",
 				Action: func(c *cli.Context) error {
-					name := ambari.GetStringFlag(c.String("name"), "", "Enter connection profile name")
-					connProfileId := ambari.GetConnectionProfileEntryId(name)
+					name, err := ambari.GetStringFlag(c.String("name"), "", "Enter connection profile name")
+					if err != nil {
+						return err
+					}
+					connProfileId, err := ambari.GetConnectionProfileEntryId(name)
+					if err != nil {
+						return err
+					}
 					if len(connProfileId) > 0 {
-						fmt.Println("Connection profile entry already exists with id " + name)
-						os.Exit(1)
+						return errors.New("Connection profile entry already exists with id " + name)
+					}
+					keyPath := c.String("key_path")
+					if len(keyPath) == 0 && !c.Bool("use_agent") && !c.Bool("forward_agent") && strings.ToLower(c.String("password_backend")) == "none" {
+						keyPath, err = ambari.GetStringFlag(keyPath, "", "Enter ssh key path")
+						if err != nil {
+							return err
+						}
 					}
-					keyPath := ambari.GetStringFlag(c.String("key_path"), "", "Enter ssh key path")
 					usr, err := user.Current()
 					if err != nil {
-						panic(err)
+						return err
 					}
 					home := usr.HomeDir
 					keyPath = strings.Replace(keyPath, "~", home, -1)
 					if len(keyPath) > 0 {
 						if _, err := os.Stat(keyPath); err != nil {
 							if os.IsNotExist(err) {
-								fmt.Println(err)
-								os.Exit(1)
+								return err
 							}
 						}
 					}
-					portStr := ambari.GetStringFlag(c.String("port"), "22", "Enter ssh port")
+					portStr, err := ambari.GetStringFlag(c.String("port"), "22", "Enter ssh port")
+					if err != nil {
+						return err
+					}
 					port, err := strconv.Atoi(portStr)
 					if err != nil {
-						fmt.Println(err)
-						os.Exit(1)
+						return err
+					}
+					userName, err := ambari.GetStringFlag(c.String("username"), "root", "Enter ssh username")
+					if err != nil {
+						return err
+					}
+					hostJumpStr, err := ambari.GetStringFlag(c.String("host_jump"), "n", "Use host jump?")
+					if err != nil {
+						return err
 					}
-					userName := ambari.GetStringFlag(c.String("username"), "root", "Enter ssh username")
-					hostJumpStr := ambari.GetStringFlag(c.String("host_jump"), "n", "Use host jump?")
 					hostJump := ambari.EvaluateBoolValueFromString(hostJumpStr)
 					proxyAddress := ""
 					if hostJump {
-						proxyAddress = ambari.GetStringFlag(c.String("proxy_address"), "none", "Set a proxy address?")
+						proxyAddress, err = ambari.GetStringFlag(c.String("proxy_address"), "none", "Set a proxy address?")
+						if err != nil {
+							return err
+						}
 						if proxyAddress == "none" {
 							proxyAddress = ""
 						}
 					}
-					ambari.RegisterNewConnectionProfile(name, keyPath, port, userName, hostJump, proxyAddress)
+					hostKeyPolicy, err := ambari.GetStringFlag(c.String("host_key_policy"), ambari.HostKeyPolicyStrict, "Host key policy (strict/accept-new/known_hosts)")
+					if err != nil {
+						return err
+					}
+					knownHostsFile := c.String("known_hosts_file")
+					if hostKeyPolicy == ambari.HostKeyPolicyKnownHosts {
+						knownHostsFile, err = ambari.GetStringFlag(knownHostsFile, "", "Enter pinned known_hosts file path")
+						if err != nil {
+							return err
+						}
+					}
+					knownHostsFile = strings.Replace(knownHostsFile, "~", home, -1)
+					if err := ambari.ValidateHostKeyPolicy(hostKeyPolicy, knownHostsFile); err != nil {
+						return err
+					}
+					certificatePath, err := expandPath(c.String("certificate"))
+					if err != nil {
+						return err
+					}
+					var keyPassphraseRef ambari.SecretRef
+					if len(keyPath) > 0 {
+						keyPassphraseRef, err = createProfileSecretRef(name, "key_passphrase", c.String("key_passphrase_backend"), c.String("key_passphrase_ref"))
+						if err != nil {
+							return err
+						}
+					}
+					passwordRef, err := createProfileSecretRef(name, "password", c.String("password_backend"), c.String("password_ref"))
+					if err != nil {
+						return err
+					}
+					connectionProfile := ambari.ConnectionProfile{Name: name, KeyPath: keyPath, Port: port, Username: userName, HostJump: hostJump, ProxyAddress: proxyAddress,
+						HostKeyPolicy: hostKeyPolicy, KnownHostsFile: knownHostsFile, CertificatePath: certificatePath, KeyPassphraseRef: keyPassphraseRef, PasswordRef: passwordRef,
+						UseAgent: c.Bool("use_agent"), ForwardAgent: c.Bool("forward_agent")}
+					err = ambari.RegisterNewConnectionProfile(connectionProfile)
+					if err != nil {
+						return err
+					}
 					fmt.Println("New connection profile entry has been created: " + name)
 					return nil
 				},
@@ -137,6 +217,15 @@ func main() {
 					cli.StringFlag{Name: "username", Usage: "Protocol for Ambar REST API: http/https"},
 					cli.StringFlag{Name: "host_jump", Usage: "User name for Ambari server"},
 					cli.StringFlag{Name: "proxy_address", Usage: "Password for Ambari user"},
+					cli.StringFlag{Name: "host_key_policy", Usage: "Host key verification policy: strict (only known host keys), accept-new (record unknown host keys) or known_hosts (pinned known_hosts file)"},
+					cli.StringFlag{Name: "known_hosts_file", Usage: "known_hosts file for host key verification (default: ~/.ambarictl/known_hosts)"},
+					cli.StringFlag{Name: "certificate", Usage: "OpenSSH user certificate for the ssh key (default: <key_path>-cert.pub if it exists)"},
+					cli.StringFlag{Name: "key_passphrase_backend", Value: ambari.SecretBackendPrompt, Usage: "Secret backend for the passphrase of an encrypted ssh key: prompt/vault/env/helper"},
+					cli.StringFlag{Name: "key_passphrase_ref", Usage: "Environment variable name (env secret backend) or credential helper command (helper secret backend) for the ssh key passphrase"},
+					cli.StringFlag{Name: "password_backend", Value: "none", Usage: "Secret backend for ssh password authentication: none/prompt/vault/env/helper"},
+					cli.StringFlag{Name: "password_ref", Usage: "Environment variable name (env secret backend) or credential helper command (helper secret backend) for the ssh password"},
+					cli.BoolFlag{Name: "use_agent", Usage: "Authenticate with the keys of the ssh agent (SSH_AUTH_SOCK), it is used by default if no key or password is set"},
+					cli.BoolFlag{Name: "forward_agent", Usage: "Forward the ssh agent to the remote hosts"},
 				},
 			},
 			{
@@ -144,17 +233,21 @@ func main() {
 				Aliases: []string{"ls"},
 				Usage:   "Print all connection profile entries",
 				Action: func(c *cli.Context) error {
-					connectionProfiles := ambari.ListConnectionProfileEntries()
+					connectionProfiles, err := ambari.ListConnectionProfileEntries()
+					if err != nil {
+						return err
+					}
 					var tableData [][]string
 					for _, profile := range connectionProfiles {
 						hostJump := "false"
 						if profile.HostJump {
 							hostJump = "true"
 						}
-						tableData = append(tableData, []string{profile.Name, profile.KeyPath, strconv.Itoa(profile.Port), profile.Username, hostJump, profile.ProxyAddress})
+						tableData = append(tableData, []string{profile.Name, profile.KeyPath, strconv.Itoa(profile.Port), profile.Username, hostJump, profile.GetJumpHostsDescription(),
+							profile.GetHostKeyPolicy(), profile.KnownHostsFile, profile.GetAuthDescription(), profile.GetHostOverridesDescription()})
 					}
-					printTable("CONNECTION PROFILES:", []string{"NAME", "KEY", "PORT", "USERNAME", "HOST JUMP", "PROXY ADDRESS"}, tableData, c)
-					return nil
+					return printOutput("CONNECTION PROFILES:", []string{"NAME", "KEY", "PORT", "USERNAME", "HOST JUMP", "JUMP HOSTS", "HOST KEY POLICY", "KNOWN HOSTS", "AUTH", "HOST OVERRIDES"},
+						tableData, connectionProfiles, c)
 				},
 			},
 			{
@@ -163,16 +256,27 @@ func main() {
 				Usage:   "Delete a connection profile entry by id",
 				Action: func(c *cli.Context) error {
 					if len(c.Args()) == 0 {
-						fmt.Println("Provide a profile name argument for use command. e.g.: delete vagrant")
-						os.Exit(1)
+						return errors.New("Provide a profile name argument for use command. e.g.: delete vagrant")
 					}
 					name := c.Args().First()
-					profileEntryId := ambari.GetConnectionProfileEntryId(name)
+					profileEntryId, err := ambari.GetConnectionProfileEntryId(name)
+					if err != nil {
+						return err
+					}
 					if len(profileEntryId) == 0 {
-						fmt.Println("Connection profile entry does not exist with id " + name)
-						os.Exit(1)
+						return errors.New("Connection profile entry does not exist with id " + name)
+					}
+					connectionProfile, err := ambari.GetConnectionProfileById(profileEntryId)
+					if err != nil {
+						return err
+					}
+					if err := deleteVaultSecrets(connectionProfile.GetSecretRefs()...); err != nil {
+						return err
+					}
+					err = ambari.DeRegisterConnectionProfile(profileEntryId)
+					if err != nil {
+						return err
 					}
-					ambari.DeRegisterConnectionProfile(profileEntryId)
 					msg := fmt.Sprintf("Connection profile '%s' has been deleted successfully", profileEntryId)
 					fmt.Println(msg)
 					return nil
@@ -183,11 +287,212 @@ func main() {
 				Aliases: []string{"cl"},
 				Usage:   "Delete all connection profile entries",
 				Action: func(c *cli.Context) error {
-					ambari.DropConnectionProfileRecords()
+					err := ambari.DropConnectionProfileRecords()
+					if err != nil {
+						return err
+					}
 					fmt.Println("All connection profile records has been dropped")
 					return nil
 				},
 			},
+			{
+				Name:  "trust",
+				Usage: "Collect and record the ssh host keys of the agent hosts (uses the connection profile of the active Ambari server entry)",
+				Action: func(c *cli.Context) error {
+					ambariServer, err := getActiveAmbari(ctx)
+					if err != nil {
+						return err
+					}
+					hostKeys, trustErr := ambariServer.TrustHostKeys()
+					var tableData [][]string
+					for _, hostKey := range hostKeys {
+						tableData = append(tableData, []string{hostKey.Host, hostKey.KeyType, hostKey.Fingerprint, strings.ToUpper(hostKey.Status), hostKey.Error})
+					}
+					if hostKeys != nil {
+						if err := printOutput("HOST KEYS:", []string{"HOST", "KEY TYPE", "FINGERPRINT", "STATUS", "ERROR"}, tableData, hostKeys, c); err != nil {
+							return err
+						}
+					}
+					return trustErr
+				},
+			},
+			{
+				Name:      "policy",
+				Usage:     "Set the host key policy of a connection profile: strict (only known host keys), accept-new (record unknown host keys) or known_hosts (pinned known_hosts file)",
+				ArgsUsage: "<profile> <policy>",
+				Action: func(c *cli.Context) error {
+					if len(c.Args()) < 2 {
+						return errors.New("Provide a profile name and a host key policy argument. e.g.: policy vagrant strict")
+					}
+					profileName, err := getProfileArgument(c)
+					if err != nil {
+						return err
+					}
+					knownHostsFile, err := expandPath(c.String("known_hosts_file"))
+					if err != nil {
+						return err
+					}
+					if err := ambari.SetHostKeyPolicy(profileName, c.Args().Get(1), knownHostsFile); err != nil {
+						return err
+					}
+					fmt.Println(fmt.Sprintf("Host key policy of connection profile '%s' has been set to '%s'", profileName, c.Args().Get(1)))
+					return nil
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "known_hosts_file", Usage: "known_hosts file for host key verification (required for known_hosts policy)"},
+				},
+			},
+			{
+				Name:  "jump",
+				Usage: "Manage the jump host chain of a connection profile",
+				Subcommands: []cli.Command{
+					{
+						Name:      "add",
+						Usage:     "Append a jump host to the end of the jump host chain (port, username and credentials are inherited from the profile if those are not set)",
+						ArgsUsage: "<profile>",
+						Action: func(c *cli.Context) error {
+							profileName, err := getProfileArgument(c)
+							if err != nil {
+								return err
+							}
+							address, err := ambari.GetStringFlag(c.String("address"), "", "Enter jump host address")
+							if err != nil {
+								return err
+							}
+							keyPath, err := expandPath(c.String("key_path"))
+							if err != nil {
+								return err
+							}
+							certificatePath, err := expandPath(c.String("certificate"))
+							if err != nil {
+								return err
+							}
+							jumpHost := ambari.JumpHost{Address: address, Port: c.Int("port"), Username: c.String("username"), KeyPath: keyPath,
+								CertificatePath: certificatePath, UseAgent: c.Bool("use_agent")}
+							secretPrefix := "jump_host/" + address + "/"
+							if len(keyPath) > 0 {
+								jumpHost.KeyPassphraseRef, err = createProfileSecretRef(profileName, secretPrefix+"key_passphrase", c.String("key_passphrase_backend"), c.String("key_passphrase_ref"))
+								if err != nil {
+									return err
+								}
+							}
+							jumpHost.PasswordRef, err = createProfileSecretRef(profileName, secretPrefix+"password", c.String("password_backend"), c.String("password_ref"))
+							if err != nil {
+								return err
+							}
+							if err := ambari.AddJumpHost(profileName, jumpHost); err != nil {
+								deleteVaultSecrets(jumpHost.KeyPassphraseRef, jumpHost.PasswordRef)
+								return err
+							}
+							fmt.Println(fmt.Sprintf("Jump host '%s' has been added to connection profile '%s'", address, profileName))
+							return nil
+						},
+						Flags: []cli.Flag{
+							cli.StringFlag{Name: "address", Usage: "Address of the jump host"},
+							cli.IntFlag{Name: "port", Usage: "Ssh port of the jump host (default: port of the profile)"},
+							cli.StringFlag{Name: "username", Usage: "Ssh username for the jump host (default: username of the profile)"},
+							cli.StringFlag{Name: "key_path", Usage: "Ssh key for the jump host"},
+							cli.StringFlag{Name: "certificate", Usage: "OpenSSH user certificate for the ssh key (default: <key_path>-cert.pub if it exists)"},
+							cli.StringFlag{Name: "key_passphrase_backend", Value: ambari.SecretBackendPrompt, Usage: "Secret backend for the passphrase of an encrypted ssh key: prompt/vault/env/helper"},
+							cli.StringFlag{Name: "key_passphrase_ref", Usage: "Environment variable name (env secret backend) or credential helper command (helper secret backend) for the ssh key passphrase"},
+							cli.StringFlag{Name: "password_backend", Value: "none", Usage: "Secret backend for ssh password authentication: none/prompt/vault/env/helper"},
+							cli.StringFlag{Name: "password_ref", Usage: "Environment variable name (env secret backend) or credential helper command (helper secret backend) for the ssh password"},
+							cli.BoolFlag{Name: "use_agent", Usage: "Authenticate with the keys of the ssh agent (SSH_AUTH_SOCK)"},
+						},
+					},
+					{
+						Name:      "remove",
+						Aliases:   []string{"rm"},
+						Usage:     "Remove a jump host from the jump host chain",
+						ArgsUsage: "<profile> <address>",
+						Action: func(c *cli.Context) error {
+							if len(c.Args()) < 2 {
+								return errors.New("Provide a profile name and a jump host address argument. e.g.: remove vagrant bastion.example.com")
+							}
+							profileName, address := c.Args().Get(0), c.Args().Get(1)
+							jumpHost, err := ambari.RemoveJumpHost(profileName, address)
+							if err != nil {
+								return err
+							}
+							if err := deleteVaultSecrets(jumpHost.KeyPassphraseRef, jumpHost.PasswordRef); err != nil {
+								return err
+							}
+							fmt.Println(fmt.Sprintf("Jump host '%s' has been removed from connection profile '%s'", address, profileName))
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "override",
+				Usage: "Manage the per host (or host name pattern) ssh settings of a connection profile",
+				Subcommands: []cli.Command{
+					{
+						Name:      "add",
+						Usage:     "Override username, port or key for the hosts that match a pattern (first matching override wins for every setting)",
+						ArgsUsage: "<profile>",
+						Action: func(c *cli.Context) error {
+							profileName, err := getProfileArgument(c)
+							if err != nil {
+								return err
+							}
+							pattern, err := ambari.GetStringFlag(c.String("pattern"), "", "Enter host pattern (ip, host name or public host name, e.g.: *.example.com)")
+							if err != nil {
+								return err
+							}
+							keyPath, err := expandPath(c.String("key_path"))
+							if err != nil {
+								return err
+							}
+							hostOverride := ambari.HostOverride{Pattern: pattern, Port: c.Int("port"), Username: c.String("username"), KeyPath: keyPath}
+							if err := ambari.ValidateHostOverride(hostOverride); err != nil {
+								return err
+							}
+							if len(keyPath) > 0 {
+								hostOverride.KeyPassphraseRef, err = createProfileSecretRef(profileName, "host_override/"+pattern+"/key_passphrase", c.String("key_passphrase_backend"), c.String("key_passphrase_ref"))
+								if err != nil {
+									return err
+								}
+							}
+							if err := ambari.AddHostOverride(profileName, hostOverride); err != nil {
+								deleteVaultSecrets(hostOverride.KeyPassphraseRef)
+								return err
+							}
+							fmt.Println(fmt.Sprintf("Host override '%s' has been added to connection profile '%s'", pattern, profileName))
+							return nil
+						},
+						Flags: []cli.Flag{
+							cli.StringFlag{Name: "pattern", Usage: "Host pattern, matched against the ip, the host name and the public host name (e.g.: *.example.com)"},
+							cli.IntFlag{Name: "port", Usage: "Ssh port for the matching hosts"},
+							cli.StringFlag{Name: "username", Usage: "Ssh username for the matching hosts"},
+							cli.StringFlag{Name: "key_path", Usage: "Ssh key for the matching hosts"},
+							cli.StringFlag{Name: "key_passphrase_backend", Value: ambari.SecretBackendPrompt, Usage: "Secret backend for the passphrase of an encrypted ssh key: prompt/vault/env/helper"},
+							cli.StringFlag{Name: "key_passphrase_ref", Usage: "Environment variable name (env secret backend) or credential helper command (helper secret backend) for the ssh key passphrase"},
+						},
+					},
+					{
+						Name:      "remove",
+						Aliases:   []string{"rm"},
+						Usage:     "Remove a host override by pattern",
+						ArgsUsage: "<profile> <pattern>",
+						Action: func(c *cli.Context) error {
+							if len(c.Args()) < 2 {
+								return errors.New("Provide a profile name and a host pattern argument. e.g.: remove vagrant '*.example.com'")
+							}
+							profileName, pattern := c.Args().Get(0), c.Args().Get(1)
+							hostOverride, err := ambari.RemoveHostOverride(profileName, pattern)
+							if err != nil {
+								return err
+							}
+							if err := deleteVaultSecrets(hostOverride.KeyPassphraseRef); err != nil {
+								return err
+							}
+							fmt.Println(fmt.Sprintf("Host override '%s' has been removed from connection profile '%s'", pattern, profileName))
+							return nil
+						},
+					},
+				},
+			},
 		},
 	}
 
@@ -197,32 +502,41 @@ func main() {
 		Action: func(c *cli.Context) error {
 			args := c.Args()
 			if len(args) == 0 {
-				fmt.Println("Provide at least 1 argument (<profile>), or 2 (<profile> and <ambariEntry>)")
-				os.Exit(1)
+				return errors.New("Provide at least 1 argument (<profile>), or 2 (<profile> and <ambariEntry>)")
 			}
 			profileId := args.Get(0)
 			var ambariRegistry ambari.AmbariRegistry
+			var err error
 			if len(args) == 1 {
-				ambariRegistry = ambari.GetActiveAmbari()
+				ambariRegistry, err = ambari.GetActiveAmbari()
+				if err != nil {
+					return err
+				}
 				if len(ambariRegistry.Name) == 0 {
-					fmt.Println("No active ambari selected")
-					os.Exit(1)
+					return errors.New("No active ambari selected")
 				}
 			} else {
 				ambariRegistryId := args.Get(1)
-				ambari.GetAmbariById(ambariRegistryId)
+				ambariRegistry, err = ambari.GetAmbariById(ambariRegistryId)
+				if err != nil {
+					return err
+				}
 				if len(ambariRegistry.Name) == 0 {
-					fmt.Println("Cannot find specific ambari server entry")
-					os.Exit(1)
+					return errors.New("Cannot find specific ambari server entry")
 				}
 			}
-			profile := ambari.GetConnectionProfileById(profileId)
+			profile, err := ambari.GetConnectionProfileById(profileId)
+			if err != nil {
+				return err
+			}
 			if len(profile.Name) == 0 {
-				fmt.Println("Cannot find specific connection profile entry")
-				os.Exit(1)
+				return errors.New("Cannot find specific connection profile entry")
 			}
 
-			ambari.SetProfileIdForAmbariEntry(ambariRegistry.Name, profile.Name)
+			err = ambari.SetProfileIdForAmbariEntry(ambariRegistry.Name, profile.Name)
+			if err != nil {
+				return err
+			}
 			msg := fmt.Sprintf("Attach profile '%s' to '%s'", profile.Name, ambariRegistry.Name)
 			fmt.Println(msg)
 			return nil
@@ -233,15 +547,105 @@ func main() {
 		Name:  "hosts",
 		Usage: "Print all registered Ambari agent hosts",
 		Action: func(c *cli.Context) error {
-			ambariRegistry := ambari.GetActiveAmbari()
-			validateActiveAmbari(ambariRegistry)
-			hosts := ambariRegistry.ListAgents()
+			ambariRegistry, err := getActiveAmbari(ctx)
+			if err != nil {
+				return err
+			}
+			hosts, err := ambariRegistry.ListAgents()
+			if err != nil {
+				return err
+			}
 			var tableData [][]string
 			for _, host := range hosts {
 				tableData = append(tableData, []string{host.PublicHostname, host.IP, host.OSType, host.OSArch, strconv.FormatBool(host.UnlimitedJCE), host.HostState})
 			}
-			printTable("HOSTS:", []string{"PUBLIC HOSTNAME", "IP", "OS TYPE", "OS ARCH", "UNLIMITED_JCE", "STATE"}, tableData, c)
-			return nil
+			return printOutput("HOSTS:", []string{"PUBLIC HOSTNAME", "IP", "OS TYPE", "OS ARCH", "UNLIMITED_JCE", "STATE"}, tableData, hosts, c)
+		},
+		Subcommands: []cli.Command{
+			{
+				Name:      "add",
+				Usage:     "Add registered agent hosts to the cluster and install the components of a host group template on them",
+				ArgsUsage: "<host names>",
+				Action: func(c *cli.Context) error {
+					ambariRegistry, err := getActiveAmbari(ctx)
+					if err != nil {
+						return err
+					}
+					hosts, err := getHostArguments(c)
+					if err != nil {
+						return err
+					}
+					if len(c.String("template")) == 0 {
+						return errors.New("It is required to provide --template (-t) flag")
+					}
+					hostGroup, err := ambari.LoadHostGroupTemplate(c.String("template"), c.String("host-group"))
+					if err != nil {
+						return err
+					}
+					if err := ambariRegistry.AddHosts(hosts, hostGroup, !c.Bool("no-start")); err != nil {
+						return err
+					}
+					fmt.Println(fmt.Sprintf("Host(s) %s have been added to the cluster (host group: %s)", strings.Join(hosts, ", "), hostGroup.Name))
+					return nil
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "template, t", Usage: "Host group template file (json): a host group or a blueprint"},
+					cli.StringFlag{Name: "host-group, g", Usage: "Host group name (if the template is a blueprint)"},
+					cli.BoolFlag{Name: "no-start", Usage: "Only install the components, do not start them"},
+				},
+			},
+			{
+				Name:      "decommission",
+				Usage:     "Decommission DATANODE, NODEMANAGER or HBASE_REGIONSERVER components on hosts",
+				ArgsUsage: "<host names>",
+				Action: func(c *cli.Context) error {
+					return decommissionHosts(ctx, c, false)
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "components, c", Usage: "Components to decommission (comma separated), by default all of the supported components of the hosts"},
+				},
+			},
+			{
+				Name:      "recommission",
+				Usage:     "Recommission DATANODE, NODEMANAGER or HBASE_REGIONSERVER components on hosts",
+				ArgsUsage: "<host names>",
+				Action: func(c *cli.Context) error {
+					return decommissionHosts(ctx, c, true)
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "components, c", Usage: "Components to recommission (comma separated), by default all of the supported components of the hosts"},
+				},
+			},
+			{
+				Name:      "remove",
+				Usage:     "Stop the components of hosts, delete their host components and remove the hosts from the cluster",
+				ArgsUsage: "<host names>",
+				Action: func(c *cli.Context) error {
+					ambariRegistry, err := getActiveAmbari(ctx)
+					if err != nil {
+						return err
+					}
+					hosts, err := getHostArguments(c)
+					if err != nil {
+						return err
+					}
+					if !c.Bool("yes") {
+						answer, err := ambari.GetStringFlag("", "n", fmt.Sprintf("Do you want to remove host(s) %s from cluster %s? (y/n)", strings.Join(hosts, ", "), ambariRegistry.Cluster))
+						if err != nil {
+							return err
+						}
+						if !ambari.EvaluateBoolValueFromString(answer) {
+							fmt.Println("Host removal cancelled.")
+							return nil
+						}
+					}
+					return ambariRegistry.RemoveHosts(hosts, c.Bool("force"))
+				},
+				Flags: []cli.Flag{
+					cli.BoolFlag{Name: "force", Usage: "Remove the hosts even if their DATANODE, NODEMANAGER or HBASE_REGIONSERVER components are not decommissioned"},
+					cli.BoolFlag{Name: "yes, y", Usage: "Skip the confirmation"},
+				},
+			},
 		},
 	}
 
@@ -249,15 +653,19 @@ func main() {
 		Name:  "services",
 		Usage: "Print all installed Ambari services",
 		Action: func(c *cli.Context) error {
-			ambariRegistry := ambari.GetActiveAmbari()
-			validateActiveAmbari(ambariRegistry)
-			services := ambariRegistry.ListServices()
+			ambariRegistry, err := getActiveAmbari(ctx)
+			if err != nil {
+				return err
+			}
+			services, err := ambariRegistry.ListServices()
+			if err != nil {
+				return err
+			}
 			var tableData [][]string
 			for _, service := range services {
 				tableData = append(tableData, []string{service.ServiceName, service.ServiceState})
 			}
-			printTable("SERVICES:", []string{"NAME", "STATE"}, tableData, c)
-			return nil
+			return printOutput("SERVICES:", []string{"NAME", "STATE"}, tableData, services, c)
 		},
 	}
 
@@ -265,15 +673,19 @@ func main() {
 		Name:  "components",
 		Usage: "Print all installed Ambari components",
 		Action: func(c *cli.Context) error {
-			ambariRegistry := ambari.GetActiveAmbari()
-			validateActiveAmbari(ambariRegistry)
-			components := ambariRegistry.ListComponents()
+			ambariRegistry, err := getActiveAmbari(ctx)
+			if err != nil {
+				return err
+			}
+			components, err := ambariRegistry.ListComponents()
+			if err != nil {
+				return err
+			}
 			var tableData [][]string
 			for _, component := range components {
 				tableData = append(tableData, []string{component.ComponentName, component.ServiceName, component.ComponentState})
 			}
-			printTable("COMPONENTS:", []string{"NAME", "SERVICE", "STATE"}, tableData, c)
-			return nil
+			return printOutput("COMPONENTS:", []string{"NAME", "SERVICE", "STATE"}, tableData, components, c)
 		},
 	}
 
@@ -281,8 +693,10 @@ func main() {
 		Name:  "hcomponents",
 		Usage: "Print all installed Ambari host components by component name",
 		Action: func(c *cli.Context) error {
-			ambariRegistry := ambari.GetActiveAmbari()
-			validateActiveAmbari(ambariRegistry)
+			ambariRegistry, err := getActiveAmbari(ctx)
+			if err != nil {
+				return err
+			}
 			var param string
 			useHost := false
 			if len(c.String("component")) > 0 {
@@ -291,16 +705,17 @@ func main() {
 				param = c.String("host")
 				useHost = true
 			} else {
-				fmt.Println("Flag '--component' or `--host`with a value is required for 'host-components' action!")
-				os.Exit(1)
+				return errors.New("Flag '--component' or `--host`with a value is required for 'host-components' action!")
+			}
+			components, err := ambariRegistry.ListHostComponents(param, useHost)
+			if err != nil {
+				return err
 			}
-			components := ambariRegistry.ListHostComponents(param, useHost)
 			var tableData [][]string
 			for _, hostComponent := range components {
 				tableData = append(tableData, []string{hostComponent.HostComponentName, hostComponent.HostComponntHost, hostComponent.HostComponentState})
 			}
-			printTable("HOST COMPONENTS: "+param, []string{"NAME", "HOST", "STATE"}, tableData, c)
-			return nil
+			return printOutput("HOST COMPONENTS: "+param, []string{"NAME", "HOST", "STATE"}, tableData, components, c)
 		},
 		Flags: []cli.Flag{
 			cli.StringFlag{Name: "component", Usage: "Component filter for host components"},
@@ -312,31 +727,98 @@ func main() {
 		Name:  "create",
 		Usage: "Register new Ambari server entry",
 		Action: func(c *cli.Context) error {
-			name := ambari.GetStringFlag(c.String("name"), "", "Enter ambari registry name")
-			ambariEntryId := ambari.GetAmbariEntryId(name)
+			name, err := ambari.GetStringFlag(c.String("name"), "", "Enter ambari registry name")
+			if err != nil {
+				return err
+			}
+			ambariEntryId, err := ambari.GetAmbariEntryId(name)
+			if err != nil {
+				return err
+			}
 			if len(ambariEntryId) > 0 {
-				fmt.Println("Ambari registry entry already exists with id " + name)
-				os.Exit(1)
+				return errors.New("Ambari registry entry already exists with id " + name)
+			}
+			host, err := ambari.GetStringFlag(c.String("host"), "", "Enter ambari host name")
+			if err != nil {
+				return err
+			}
+			portStr, err := ambari.GetStringFlag(c.String("port"), "8080", "Enter ambari port")
+			if err != nil {
+				return err
 			}
-			host := ambari.GetStringFlag(c.String("host"), "", "Enter ambari host name")
-			portStr := ambari.GetStringFlag(c.String("port"), "8080", "Enter ambari port")
 			port, err := strconv.Atoi(portStr)
 			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
+				return err
+			}
+			protocol, err := ambari.GetStringFlag(c.String("protocol"), "http", "Enter ambari protocol")
+			if err != nil {
+				return err
 			}
-			protocol := strings.ToLower(ambari.GetStringFlag(c.String("protocol"), "http", "Enter ambari protocol"))
+			protocol = strings.ToLower(protocol)
 			if protocol != "http" && protocol != "https" {
-				fmt.Println("Use 'http' or 'https' value for protocol option")
-				os.Exit(1)
+				return errors.New("Use 'http' or 'https' value for protocol option")
+			}
+			username, err := ambari.GetStringFlag(c.String("username"), "admin", "Enter ambari user")
+			if err != nil {
+				return err
+			}
+			username = strings.ToLower(username)
+			secretBackend := strings.ToLower(c.String("secret_backend"))
+			passwordRefKey := c.String("password_ref")
+			password := ""
+			if secretBackend == ambari.SecretBackendVault {
+				passwordRefKey = ambari.AmbariPasswordVaultKey(name)
+				password, err = ambari.GetPassword(c.String("password"), "Enter ambari user password")
+				if err != nil {
+					return err
+				}
+			} else if secretBackend == ambari.SecretBackendEnv {
+				passwordRefKey, err = ambari.GetStringFlag(passwordRefKey, "", "Enter environment variable name for the ambari user password")
+				if err != nil {
+					return err
+				}
+			} else if secretBackend == ambari.SecretBackendHelper {
+				passwordRefKey, err = ambari.GetStringFlag(passwordRefKey, "", "Enter credential helper command for the ambari user password")
+				if err != nil {
+					return err
+				}
+			} else {
+				return errors.New("Use 'vault', 'env' or 'helper' value for secret_backend option")
+			}
+			cluster, err := ambari.GetStringFlag(c.String("cluster"), "", "Enter ambari cluster")
+			if err != nil {
+				return err
+			}
+
+			tlsSettings := ambari.TLSSettings{ServerName: c.String("server_name"), Insecure: c.Bool("insecure")}
+			if protocol == "https" {
+				if tlsSettings.CACertPath, err = expandPath(c.String("ca_cert")); err != nil {
+					return err
+				}
+				if tlsSettings.ClientCertPath, err = expandPath(c.String("client_cert")); err != nil {
+					return err
+				}
+				if tlsSettings.ClientKeyPath, err = expandPath(c.String("client_key")); err != nil {
+					return err
+				}
+				if _, err := ambari.CreateTLSConfig(tlsSettings); err != nil {
+					return err
+				}
 			}
-			username := strings.ToLower(ambari.GetStringFlag(c.String("username"), "admin", "Enter ambari user"))
-			password := ambari.GetPassword(c.String("password"), "Enter ambari user password")
-			cluster := ambari.GetStringFlag(c.String("cluster"), "", "Enter ambari cluster")
 
-			ambari.DeactiveAllAmbariRegistry()
-			ambari.RegisterNewAmbariEntry(name, host, port, protocol,
-				username, password, cluster)
+			passwordRef, err := ambari.StoreSecret(secretBackend, passwordRefKey, password)
+			if err != nil {
+				return err
+			}
+			err = ambari.DeactiveAllAmbariRegistry()
+			if err != nil {
+				return err
+			}
+			err = ambari.RegisterNewAmbariEntry(name, host, port, protocol,
+				username, passwordRef, cluster, c.Int("timeout"), c.Int("retries"), tlsSettings)
+			if err != nil {
+				return err
+			}
 			fmt.Println("New Ambari server entry has been created: " + name)
 			return nil
 		},
@@ -346,8 +828,17 @@ func main() {
 			cli.StringFlag{Name: "port", Usage: "Port for AmbarisServer"},
 			cli.StringFlag{Name: "protocol", Usage: "Protocol for Ambar REST API: http/https"},
 			cli.StringFlag{Name: "username", Usage: "User name for Ambari server"},
-			cli.StringFlag{Name: "password", Usage: "Password for Ambari user"},
+			cli.StringFlag{Name: "password", Usage: "Password for Ambari user (stored in the secret vault)"},
+			cli.StringFlag{Name: "secret_backend", Value: ambari.SecretBackendVault, Usage: "Secret backend for the Ambari user password: vault/env/helper"},
+			cli.StringFlag{Name: "password_ref", Usage: "Environment variable name (env secret backend) or credential helper command (helper secret backend) for the Ambari user password"},
 			cli.StringFlag{Name: "cluster", Usage: "Cluster name"},
+			cli.IntFlag{Name: "timeout", Value: ambari.DefaultTimeout, Usage: "Response timeout (in seconds) for Ambari REST API calls"},
+			cli.IntFlag{Name: "retries", Value: 3, Usage: "Number of retries for failed Ambari REST API calls (connection errors, 5xx responses)"},
+			cli.StringFlag{Name: "ca_cert", Usage: "CA bundle (PEM) for verifying the Ambari server certificate (https)"},
+			cli.StringFlag{Name: "client_cert", Usage: "Client certificate (PEM) for TLS client authentication (https)"},
+			cli.StringFlag{Name: "client_key", Usage: "Client key (PEM) for TLS client authentication (https)"},
+			cli.StringFlag{Name: "server_name", Usage: "Override server name for verifying the Ambari server certificate (https)"},
+			cli.BoolFlag{Name: "insecure", Usage: "Skip Ambari server certificate verification (https)"},
 		},
 	}
 
@@ -356,16 +847,29 @@ func main() {
 		Usage: "De-register an existing Ambari server entry",
 		Action: func(c *cli.Context) error {
 			if len(c.Args()) == 0 {
-				fmt.Println("Provide a registry name argument for use command. e.g.: delete vagrant")
-				os.Exit(1)
+				return errors.New("Provide a registry name argument for use command. e.g.: delete vagrant")
 			}
 			name := c.Args().First()
-			ambariEntryId := ambari.GetAmbariEntryId(name)
-			if len(ambariEntryId) == 0 {
-				fmt.Println("Ambari registry entry does not exist with id " + name)
-				os.Exit(1)
+			ambariEntry, err := ambari.GetAmbariById(name)
+			if err != nil {
+				return err
+			}
+			if len(ambariEntry.Name) == 0 {
+				return errors.New("Ambari registry entry does not exist with id " + name)
+			}
+			if ambariEntry.PasswordRef.Backend == ambari.SecretBackendVault {
+				vault, err := ambari.OpenVault()
+				if err != nil {
+					return err
+				}
+				if err := vault.Delete(ambariEntry.PasswordRef.Key); err != nil {
+					return err
+				}
+			}
+			err = ambari.DeRegisterAmbariEntry(name)
+			if err != nil {
+				return err
 			}
-			ambari.DeRegisterAmbariEntry(name)
 			fmt.Println("Ambari registry de-registered with id: " + name)
 			return nil
 		},
@@ -379,17 +883,24 @@ func main() {
 		Usage: "Use selected Ambari server",
 		Action: func(c *cli.Context) error {
 			if len(c.Args()) == 0 {
-				fmt.Println("Provide a server entry name argument for use command. e.g.: use vagrant")
-				os.Exit(1)
+				return errors.New("Provide a server entry name argument for use command. e.g.: use vagrant")
 			}
 			name := c.Args().First()
-			ambariEntryId := ambari.GetAmbariEntryId(name)
+			ambariEntryId, err := ambari.GetAmbariEntryId(name)
+			if err != nil {
+				return err
+			}
 			if len(ambariEntryId) == 0 {
-				fmt.Println("Ambari server entry does not exist with id " + name)
-				os.Exit(1)
+				return errors.New("Ambari server entry does not exist with id " + name)
+			}
+			err = ambari.DeactiveAllAmbariRegistry()
+			if err != nil {
+				return err
+			}
+			err = ambari.ActiveAmbariRegistry(name)
+			if err != nil {
+				return err
 			}
-			ambari.DeactiveAllAmbariRegistry()
-			ambari.ActiveAmbariRegistry(name)
 			fmt.Println("Ambari server entry selected with id: " + name)
 			return nil
 		},
@@ -398,11 +909,37 @@ func main() {
 		},
 	}
 
+	secretsCommand := cli.Command{
+		Name:  "secrets",
+		Usage: "Secret backend related commands",
+		Subcommands: []cli.Command{
+			{
+				Name:  "migrate",
+				Usage: "Move cleartext Ambari passwords from the registry into the secret vault",
+				Action: func(c *cli.Context) error {
+					migrated, err := ambari.MigratePlainPasswordsToVault()
+					if err != nil {
+						return err
+					}
+					if len(migrated) == 0 {
+						fmt.Println("No cleartext password found in the registry.")
+						return nil
+					}
+					fmt.Println(fmt.Sprintf("Passwords have been moved into the secret vault for the following entries: %s", strings.Join(migrated, ", ")))
+					return nil
+				},
+			},
+		},
+	}
+
 	clearCommand := cli.Command{
 		Name:  "clear",
 		Usage: "Drop all Ambari server records",
 		Action: func(c *cli.Context) error {
-			ambari.DropAmbariRegistryRecords()
+			err := ambari.DropAmbariRegistryRecords()
+			if err != nil {
+				return err
+			}
 			fmt.Println("Ambari server entries dropped.")
 			return nil
 		},
@@ -412,14 +949,19 @@ func main() {
 		Name:  "show",
 		Usage: "Show active Ambari server details",
 		Action: func(c *cli.Context) error {
-			ambariRegistry := ambari.GetActiveAmbari()
+			ambariRegistry, err := ambari.GetActiveAmbari()
+			if err != nil {
+				return err
+			}
 			var tableData [][]string
+			var ambariRegistries []ambari.AmbariRegistry
 			if len(ambariRegistry.Name) > 0 {
 				tableData = append(tableData, []string{ambariRegistry.Name, ambariRegistry.Hostname, strconv.Itoa(ambariRegistry.Port), ambariRegistry.Protocol,
-					ambariRegistry.Username, "********", ambariRegistry.Cluster, ambariRegistry.ConnectionProfile, "true"})
+					ambariRegistry.Username, ambariRegistry.PasswordRef.String(), ambariRegistry.Cluster, ambariRegistry.ConnectionProfile, "true"})
+				ambariRegistries = append(ambariRegistries, ambariRegistry)
 			}
-			printTable("ACTIVE AMBARI REGISTRY:", []string{"Name", "HOSTNAME", "PORT", "PROTOCOL", "USER", "PASSWORD", "CLUSTER", "PROFILE", "ACTIVE"}, tableData, c)
-			return nil
+			return printOutput("ACTIVE AMBARI REGISTRY:", []string{"Name", "HOSTNAME", "PORT", "PROTOCOL", "USER", "PASSWORD", "CLUSTER", "PROFILE", "ACTIVE"}, tableData,
+				hidePasswords(ambariRegistries), c)
 		},
 	}
 
@@ -431,89 +973,245 @@ func main() {
 				Name:  "versions",
 				Usage: "Print all service config types with versions",
 				Action: func(c *cli.Context) error {
-					ambariRegistry := ambari.GetActiveAmbari()
-					validateActiveAmbari(ambariRegistry)
-					configs := ambariRegistry.ListServiceConfigVersions()
+					ambariRegistry, err := getActiveAmbari(ctx)
+					if err != nil {
+						return err
+					}
+					configs, err := ambariRegistry.ListServiceConfigVersions()
+					if err != nil {
+						return err
+					}
 					var tableData [][]string
 					for _, config := range configs {
 						tableData = append(tableData, []string{config.ServiceConfigType, strconv.FormatFloat(config.ServiceConfigVersion, 'f', -1, 64), config.ServiceConfigTag})
 					}
-					printTable("SERVICE_CONFIGS:", []string{"TYPE", "VERSION", "TAG"}, tableData, c)
-					return nil
+					return printOutput("SERVICE_CONFIGS:", []string{"TYPE", "VERSION", "TAG"}, tableData, configs, c)
 				},
 			},
 			{
 				Name:  "update",
-				Usage: "Update config value for a specific config key of a config type",
+				Usage: "Update (set or delete) config keys of a config type through the Ambari REST API",
 				Action: func(c *cli.Context) error {
-					ambariRegistry := ambari.GetActiveAmbari()
-					validateActiveAmbari(ambariRegistry)
-					if len(c.String("config-type")) == 0 {
-						fmt.Println("Parameter '--config-type' is required")
-						os.Exit(1)
+					ambariRegistry, err := getActiveAmbari(ctx)
+					if err != nil {
+						return err
 					}
-					if len(c.String("config-key")) == 0 {
-						fmt.Println("Parameter '--config-key' is required")
-						os.Exit(1)
+					if len(c.String("type")) == 0 {
+						return errors.New("Parameter '--type' is required")
 					}
-					if len(c.String("config-value")) == 0 {
-						fmt.Println("Parameter '--config-value' is required")
-						os.Exit(1)
+					update := ambari.ConfigUpdate{ConfigType: c.String("type"), Set: make(map[string]string), Delete: c.StringSlice("delete"),
+						ConfigGroup: c.String("group"), VersionNote: c.String("note")}
+					if len(c.String("key")) > 0 {
+						update.Set[c.String("key")] = c.String("value")
 					}
-					ambariRegistry.SetConfig(c.String("type"), c.String("key"), c.String("value"))
-					return nil
+					for _, keyValue := range c.StringSlice("set") {
+						keyValuePair := strings.SplitN(keyValue, "=", 2)
+						if len(keyValuePair) != 2 || len(keyValuePair[0]) == 0 {
+							return fmt.Errorf("Use <key>=<value> format for '--set' parameter (got: '%s')", keyValue)
+						}
+						update.Set[keyValuePair[0]] = keyValuePair[1]
+					}
+					if len(update.Set) == 0 && len(update.Delete) == 0 {
+						return errors.New("Parameter '--key' (with '--value'), '--set' or '--delete' is required")
+					}
+					return ambariRegistry.UpdateConfig(update)
 				},
 				Flags: []cli.Flag{
 					cli.StringFlag{Name: "type, t", Usage: "Configuration type"},
 					cli.StringFlag{Name: "key, k", Usage: "Configuration key"},
 					cli.StringFlag{Name: "value, v", Usage: "Configuration value"},
+					cli.StringSliceFlag{Name: "set, s", Usage: "Configuration key and value to set in <key>=<value> format (can be used multiple times)"},
+					cli.StringSliceFlag{Name: "delete, d", Usage: "Configuration key to delete (can be used multiple times)"},
+					cli.StringFlag{Name: "group, g", Usage: "Config group name (update the config group overrides instead of the cluster level configuration)"},
+					cli.StringFlag{Name: "note, n", Usage: "Service config version note"},
 				},
 			},
 			{
-				Name:  "export",
-				Usage: "Export cluster configuration to a blueprint json",
+				Name:  "diff",
+				Usage: "Print property differences between 2 config sources: current, registry:<name>, version:<n> (with --service) or blueprint:<file>",
 				Action: func(c *cli.Context) error {
-					ambariRegistry := ambari.GetActiveAmbari()
-					validateActiveAmbari(ambariRegistry)
+					ambariRegistry, err := getActiveAmbari(ctx)
+					if err != nil {
+						return err
+					}
+					if len(c.String("from")) == 0 {
+						return errors.New("Parameter '--from' is required")
+					}
+					diffs, err := ambariRegistry.DiffConfigSources(c.String("from"), c.String("to"), strings.ToUpper(c.String("service")), c.StringSlice("type"))
+					if err != nil {
+						return err
+					}
+					output := strings.ToLower(c.GlobalString("output"))
+					if len(output) == 0 || output == "table" {
+						if len(diffs) == 0 {
+							fmt.Println("No differences found.")
+							return nil
+						}
+						fmt.Print(ambari.FormatConfigDiffs(diffs))
+						return nil
+					}
+					var items interface{} = diffs
+					if output == "csv" {
+						type propertyDiffRow struct {
+							Type   string `json:"type"`
+							Key    string `json:"key"`
+							Change string `json:"change"`
+							From   string `json:"from"`
+							To     string `json:"to"`
+						}
+						var rows []propertyDiffRow
+						for _, diff := range diffs {
+							for _, property := range diff.Properties {
+								rows = append(rows, propertyDiffRow{Type: diff.Type, Key: property.Key, Change: property.Change, From: property.From, To: property.To})
+							}
+						}
+						items = rows
+					}
+					return printOutput("CONFIG DIFFERENCES:", nil, nil, items, c)
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "from, f", Usage: "Config source to compare from"},
+					cli.StringFlag{Name: "to, t", Value: "current", Usage: "Config source to compare to"},
+					cli.StringFlag{Name: "service, s", Usage: "Service name for version config sources"},
+					cli.StringSliceFlag{Name: "type", Usage: "Compare only specific config types (can be used multiple times)"},
+				},
+			},
+			{
+				Name:  "rollback",
+				Usage: "Make an earlier service config version the current one (prints the differences and asks for confirmation)",
+				Action: func(c *cli.Context) error {
+					ambariRegistry, err := getActiveAmbari(ctx)
+					if err != nil {
+						return err
+					}
+					service := strings.ToUpper(c.String("service"))
+					if len(service) == 0 {
+						return errors.New("Parameter '--service' is required")
+					}
+					if len(c.String("version")) == 0 && len(c.String("to-tag")) == 0 {
+						return errors.New("Parameter '--version' or '--to-tag' is required")
+					}
+					target, err := ambariRegistry.ResolveServiceConfigVersion(service, c.String("version"), c.String("to-tag"))
+					if err != nil {
+						return err
+					}
+					diffs, current, err := ambariRegistry.DiffServiceConfigRollback(target)
+					if err != nil {
+						return err
+					}
+					if current.Version == target.Version {
+						fmt.Println(fmt.Sprintf("Service config version %v is already the current one for service '%s'", target.Version, service))
+						return nil
+					}
+					fmt.Println(fmt.Sprintf("Rollback service '%s' configs from version %v to version %v (%s):", service, current.Version, target.Version, target.Note))
+					if len(diffs) == 0 {
+						fmt.Println("No differences found.")
+					} else {
+						fmt.Print(ambari.FormatConfigDiffs(diffs))
+					}
+					if !c.Bool("yes") {
+						answer, err := ambari.GetStringFlag("", "n", "Do you want to apply the rollback? (y/n)")
+						if err != nil {
+							return err
+						}
+						if !ambari.EvaluateBoolValueFromString(answer) {
+							fmt.Println("Rollback cancelled.")
+							return nil
+						}
+					}
+					if err := ambariRegistry.RollbackServiceConfig(service, target.Version, c.String("note")); err != nil {
+						return err
+					}
+					fmt.Println(fmt.Sprintf("Service config version %v is the current one for service '%s'", target.Version, service))
+					return nil
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "service, s", Usage: "Service name"},
+					cli.StringFlag{Name: "version, v", Usage: "Service config version to rollback to (a number or 'previous')"},
+					cli.StringFlag{Name: "to-tag", Usage: "Rollback to the service config version which contains a specific config tag"},
+					cli.StringFlag{Name: "note, n", Usage: "Service config version note"},
+					cli.BoolFlag{Name: "yes, y", Usage: "Skip the confirmation"},
+				},
+			},
+			{
+				Name:  "export",
+				Usage: "Export cluster configuration to a blueprint json",
+				Action: func(c *cli.Context) error {
+					ambariRegistry, err := getActiveAmbari(ctx)
+					if err != nil {
+						return err
+					}
 					var blueprint []byte
 					if c.Bool("minimal") {
-						clusterInfo := ambariRegistry.GetClusterInfo()
+						clusterInfo, err := ambariRegistry.GetClusterInfo()
+						if err != nil {
+							return err
+						}
 						if len(clusterInfo.ClusterVersion) > 0 {
 							splittedString := strings.Split(clusterInfo.ClusterVersion, "-")
 							stackName := splittedString[0]
 							stackVersion := splittedString[1]
-							stackDefaults := ambariRegistry.GetStackDefaultConfigs(stackName, stackVersion)
-							largeBlueprint := ambariRegistry.ExportBlueprintAsMap()
-							blueprint = ambariRegistry.GetMinimalBlueprint(largeBlueprint, stackDefaults)
-							if len(c.String("file")) > 0 {
-								err := ioutil.WriteFile(c.String("file"), formatJson(blueprint).Bytes(), 0644)
-								if err != nil {
-									fmt.Println(err)
-									os.Exit(1)
-								}
-								return nil
+							stack, err := loadStackDefinition(ctx, stackName, stackVersion, "", false)
+							if err != nil {
+								return err
+							}
+							largeBlueprint, err := ambariRegistry.ExportBlueprintAsMap()
+							if err != nil {
+								return err
+							}
+							options := ambari.MinimalBlueprintOptions{Keep: c.StringSlice("keep"), Redact: c.Bool("redact")}
+							blueprint, err = ambariRegistry.GetMinimalBlueprint(largeBlueprint, stack.Configurations, options)
+							if err != nil {
+								return err
+							}
+							formattedBlueprint, err := ambari.FormatJson(blueprint)
+							if err != nil {
+								return err
 							}
+							blueprint = formattedBlueprint.Bytes()
 						} else {
-							fmt.Println("Cannot find a cluster with a name and version for Ambari servrer")
-							os.Exit(1)
+							return errors.New("Cannot find a cluster with a name and version for Ambari servrer")
 						}
 					} else {
-						blueprint = ambariRegistry.ExportBlueprint()
-						if len(c.String("file")) > 0 {
-							err := ioutil.WriteFile(c.String("file"), blueprint, 0644)
-							if err != nil {
-								fmt.Println(err)
-								os.Exit(1)
-							}
-							return nil
+						if len(c.StringSlice("keep")) > 0 || c.Bool("redact") {
+							return errors.New("--keep and --redact options can be used only with --minimal")
+						}
+						blueprint, err = ambariRegistry.ExportBlueprint()
+						if err != nil {
+							return err
 						}
 					}
-					printJson(blueprint)
-					return nil
+					if len(c.String("template-file")) > 0 {
+						rewriter, err := ambari.CreateHostNameRewriter(c.String("host-mapping"), c.String("host-pattern"))
+						if err != nil {
+							return err
+						}
+						template, err := ambariRegistry.CreateClusterTemplate(blueprint, c.String("blueprint-name"), rewriter)
+						if err != nil {
+							return err
+						}
+						templateContent, err := json.MarshalIndent(template, "", "  ")
+						if err != nil {
+							return err
+						}
+						if err := ioutil.WriteFile(c.String("template-file"), templateContent, 0644); err != nil {
+							return err
+						}
+					}
+					if len(c.String("file")) > 0 {
+						return ioutil.WriteFile(c.String("file"), blueprint, 0644)
+					}
+					return printJson(blueprint)
 				},
 				Flags: []cli.Flag{
 					cli.StringFlag{Name: "file, f", Usage: "File output for the generated JSON"},
-					cli.BoolFlag{Name: "minimal, m", Usage: "Use minimal configuration"},
+					cli.StringFlag{Name: "template-file, t", Usage: "File output for a cluster creation template that maps the current hosts to the host groups of the blueprint"},
+					cli.StringFlag{Name: "blueprint-name", Usage: "Blueprint name that is used in the cluster creation template (default: <cluster>-blueprint)"},
+					cli.StringFlag{Name: "host-mapping", Usage: "File with old and new host name pairs (one pair per line) for rewriting the hosts of the cluster creation template"},
+					cli.StringFlag{Name: "host-pattern", Usage: "Rewrite the hosts of the cluster creation template with a regexp and a replacement, e.g.: '(.*)\\.prod\\.example\\.com=$1.test.example.com'"},
+					cli.BoolFlag{Name: "minimal, m", Usage: "Use minimal configuration (only properties, attributes and host group configurations that differ from the stack defaults)"},
+					cli.StringSliceFlag{Name: "keep", Usage: "Always emit the properties that match a pattern (<config type>/<property> or <property>, e.g.: 'core-site/fs.*'), can be used multiple times"},
+					cli.BoolFlag{Name: "redact", Usage: "Remove password properties from the minimal blueprint (use default_password in the cluster creation template)"},
 				},
 			},
 		},
@@ -523,15 +1221,426 @@ func main() {
 		Name:  "cluster",
 		Usage: "Print Ambari managed cluster details",
 		Action: func(c *cli.Context) error {
-			ambariRegistry := ambari.GetActiveAmbari()
-			validateActiveAmbari(ambariRegistry)
-			clusterInfo := ambariRegistry.GetClusterInfo()
+			ambariRegistry, err := getActiveAmbari(ctx)
+			if err != nil {
+				return err
+			}
+			clusterInfo, err := ambariRegistry.GetClusterInfo()
+			if err != nil {
+				return err
+			}
 			var tableData [][]string
 			if len(ambariRegistry.Name) > 0 {
 				tableData = append(tableData, []string{clusterInfo.ClusterName, clusterInfo.ClusterVersion, clusterInfo.ClusterSecurityType, strconv.FormatFloat(clusterInfo.ClusterTotalHosts, 'f', -1, 64)})
 			}
-			printTable("CLUSTER INFO:", []string{"Name", "VERSION", "SECURITY", "TOTAL HOSTS"}, tableData, c)
-			return nil
+			return printOutput("CLUSTER INFO:", []string{"Name", "VERSION", "SECURITY", "TOTAL HOSTS"}, tableData, clusterInfo, c)
+		},
+		Subcommands: []cli.Command{
+			{
+				Name:  "create",
+				Usage: "Create the cluster of the active Ambari server entry from a blueprint and a cluster creation template (or clone the topology of an other registry entry)",
+				Action: func(c *cli.Context) error {
+					ambariRegistry, err := getActiveAmbari(ctx)
+					if err != nil {
+						return err
+					}
+					var blueprintContent []byte
+					var template ambari.ClusterTemplate
+					if len(c.String("from-registry")) > 0 {
+						if len(c.String("blueprint")) > 0 {
+							return errors.New("--blueprint (-b) and --from-registry flags cannot be used together")
+						}
+						if len(c.String("template")) > 0 && len(c.String("hosts")) > 0 {
+							return errors.New("--template (-t) and --hosts flags cannot be used together")
+						}
+						if len(c.String("template")) == 0 && len(c.String("hosts")) == 0 {
+							return errors.New("It is required to provide --template (-t) or --hosts flag with --from-registry")
+						}
+						var hosts []string
+						if len(c.String("hosts")) > 0 {
+							hosts = strings.Split(c.String("hosts"), ",")
+						}
+						blueprintContent, template, err = ambariRegistry.CloneClusterTopology(c.String("from-registry"), hosts)
+						if err != nil {
+							return err
+						}
+					} else {
+						if len(c.String("blueprint")) == 0 || len(c.String("template")) == 0 {
+							return errors.New("It is required to provide --blueprint (-b) and --template (-t) flags (or --from-registry)")
+						}
+						_, blueprintContent, err = ambari.LoadBlueprintFile(c.String("blueprint"))
+						if err != nil {
+							return err
+						}
+					}
+					if len(c.String("template")) > 0 {
+						if template, err = ambari.LoadClusterTemplate(c.String("template")); err != nil {
+							return err
+						}
+					}
+					if len(c.String("default-password")) > 0 {
+						template.DefaultPassword = c.String("default-password")
+					}
+					fmt.Println(fmt.Sprintf("Create cluster '%s' on %s (%s)", ambariRegistry.Cluster, ambariRegistry.Hostname, ambari.FormatClusterTemplateHosts(template)))
+					if !c.Bool("yes") {
+						answer, err := ambari.GetStringFlag("", "n", "Do you want to create the cluster? (y/n)")
+						if err != nil {
+							return err
+						}
+						if !ambari.EvaluateBoolValueFromString(answer) {
+							fmt.Println("Cluster creation cancelled.")
+							return nil
+						}
+					}
+					if err := ambariRegistry.CreateCluster(c.String("blueprint-name"), blueprintContent, template); err != nil {
+						return err
+					}
+					fmt.Println(fmt.Sprintf("Cluster '%s' has been created", ambariRegistry.Cluster))
+					return nil
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "blueprint, b", Usage: "Blueprint json file"},
+					cli.StringFlag{Name: "template, t", Usage: "Cluster creation template json file (host group - host mapping)"},
+					cli.StringFlag{Name: "blueprint-name, n", Usage: "Register the blueprint with this name (default: name from the template / blueprint or <cluster>-blueprint)"},
+					cli.StringFlag{Name: "from-registry", Usage: "Clone the blueprint (and the host group sizes) of the cluster of an other registry entry"},
+					cli.StringFlag{Name: "hosts", Usage: "Hosts of the new cluster (comma separated) for --from-registry, assigned to the host groups in order (instead of --template)"},
+					cli.StringFlag{Name: "default-password", Usage: "Default password for the password properties that are missing from the blueprint", EnvVar: "AMBARICTL_DEFAULT_PASSWORD"},
+					cli.BoolFlag{Name: "yes, y", Usage: "Skip the confirmation"},
+				},
+			},
+		},
+	}
+
+	blueprintCommand := cli.Command{
+		Name:  "blueprint",
+		Usage: "Blueprint related commands",
+		Subcommands: []cli.Command{
+			{
+				Name:      "validate",
+				Usage:     "Validate a blueprint json file before submitting it (structure, host groups, components, configurations, co-location rules and passwords)",
+				ArgsUsage: "<blueprint file>",
+				Action: func(c *cli.Context) error {
+					if len(c.Args()) == 0 {
+						return errors.New("Provide a blueprint file argument")
+					}
+					content, err := ioutil.ReadFile(c.Args().First())
+					if err != nil {
+						return err
+					}
+					var stack ambari.StackDefinition
+					if stackName, stackVersion := ambari.GetBlueprintStack(content); len(stackName) > 0 && len(stackVersion) > 0 {
+						if stack, err = loadStackDefinition(ctx, stackName, stackVersion, c.String("stack-file"), false); err != nil {
+							return err
+						}
+					}
+					issues := ambari.ValidateBlueprint(content, stack)
+					var tableData [][]string
+					for _, issue := range issues {
+						tableData = append(tableData, []string{issue.Severity, issue.Location, issue.Message})
+					}
+					if err := printOutput("BLUEPRINT ISSUES:", []string{"SEVERITY", "LOCATION", "MESSAGE"}, tableData, issues, c); err != nil {
+						return err
+					}
+					errorCount, warningCount := ambari.CountBlueprintIssues(issues)
+					output := strings.ToLower(c.GlobalString("output"))
+					if len(output) == 0 || output == "table" {
+						fmt.Println(fmt.Sprintf("%v error(s), %v warning(s)", errorCount, warningCount))
+					}
+					if errorCount > 0 {
+						return &ambari.BlueprintValidationError{Errors: errorCount, Warnings: warningCount}
+					}
+					return nil
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "stack-file", Usage: "Stack definition json file: it is used without contacting Ambari if it exists, otherwise it is created from the stack of the active Ambari server (default: local stack cache)"},
+				},
+			},
+		},
+	}
+
+	stacksCommand := cli.Command{
+		Name:  "stacks",
+		Usage: "Browse stack definitions (services, components and default configurations), the stack versions are cached locally",
+		Subcommands: []cli.Command{
+			{
+				Name:  "list",
+				Usage: "Print the available stacks and versions",
+				Action: func(c *cli.Context) error {
+					var stackVersions []ambari.StackVersion
+					var err error
+					if c.Bool("cached") {
+						stackVersions, err = ambari.ListCachedStackVersions()
+					} else {
+						ambariRegistry, activeErr := getActiveAmbari(ctx)
+						if activeErr != nil {
+							return activeErr
+						}
+						stackVersions, err = ambariRegistry.ListStackVersions()
+					}
+					if err != nil {
+						return err
+					}
+					var tableData [][]string
+					for _, stackVersion := range stackVersions {
+						if c.Bool("cached") {
+							tableData = append(tableData, []string{stackVersion.StackName, stackVersion.StackVersion})
+						} else {
+							tableData = append(tableData, []string{stackVersion.StackName, stackVersion.StackVersion, strconv.FormatBool(stackVersion.Active)})
+						}
+					}
+					if c.Bool("cached") {
+						return printOutput("CACHED STACKS:", []string{"STACK", "VERSION"}, tableData, stackVersions, c)
+					}
+					return printOutput("STACKS:", []string{"STACK", "VERSION", "ACTIVE"}, tableData, stackVersions, c)
+				},
+				Flags: []cli.Flag{
+					cli.BoolFlag{Name: "cached", Usage: "Print the stack versions of the local stack cache (without contacting Ambari)"},
+				},
+			},
+			{
+				Name:      "services",
+				Usage:     "Print the services and components of a stack version with their category and cardinality",
+				ArgsUsage: "[<stack>-<version>] (default: stack version of the active cluster)",
+				Action: func(c *cli.Context) error {
+					stackName, stackVersion, err := getStackArguments(ctx, c)
+					if err != nil {
+						return err
+					}
+					stack, err := loadStackDefinition(ctx, stackName, stackVersion, "", c.Bool("refresh"))
+					if err != nil {
+						return err
+					}
+					serviceFilter := make(map[string]bool)
+					for _, service := range strings.Split(c.String("services"), ",") {
+						if len(service) > 0 {
+							serviceFilter[strings.ToUpper(service)] = true
+						}
+					}
+					var components []ambari.StackComponent
+					var tableData [][]string
+					for _, service := range stack.Services {
+						if len(serviceFilter) > 0 && !serviceFilter[service.ServiceName] {
+							continue
+						}
+						for _, component := range service.Components {
+							components = append(components, component)
+							tableData = append(tableData, []string{service.ServiceName, component.ComponentName, component.Category, component.Cardinality})
+						}
+					}
+					return printOutput(fmt.Sprintf("STACK SERVICES (%s-%s):", stackName, stackVersion), []string{"SERVICE", "COMPONENT", "CATEGORY", "CARDINALITY"}, tableData, components, c)
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "services, s", Usage: "Filter on (comma separated) service names"},
+					cli.BoolFlag{Name: "refresh", Usage: "Obtain the stack version from Ambari instead of the local stack cache"},
+				},
+			},
+			{
+				Name:      "configs",
+				Usage:     "Print the config types of a stack version, or the default properties (with property types) of a config type",
+				ArgsUsage: "[<stack>-<version>] (default: stack version of the active cluster)",
+				Action: func(c *cli.Context) error {
+					stackName, stackVersion, err := getStackArguments(ctx, c)
+					if err != nil {
+						return err
+					}
+					stack, err := loadStackDefinition(ctx, stackName, stackVersion, "", c.Bool("refresh"))
+					if err != nil {
+						return err
+					}
+					configType := c.String("type")
+					if len(configType) == 0 {
+						var configTypes []string
+						for configType := range stack.Configurations {
+							configTypes = append(configTypes, configType)
+						}
+						sort.Strings(configTypes)
+						var stackConfigs []ambari.StackConfig
+						var tableData [][]string
+						for _, configType := range configTypes {
+							stackConfig := stack.Configurations[configType]
+							stackConfigs = append(stackConfigs, stackConfig)
+							tableData = append(tableData, []string{configType, stackConfig.ServiceName, strconv.Itoa(len(stackConfig.Properties))})
+						}
+						return printOutput(fmt.Sprintf("STACK CONFIG TYPES (%s-%s):", stackName, stackVersion), []string{"TYPE", "SERVICE", "PROPERTIES"}, tableData, stackConfigs, c)
+					}
+					stackConfig, ok := stack.Configurations[configType]
+					if !ok {
+						return fmt.Errorf("Config type '%s' does not exist in stack %s-%s", configType, stackName, stackVersion)
+					}
+					properties := stackConfig.Properties
+					sort.Slice(properties, func(i, j int) bool {
+						return properties[i].Name < properties[j].Name
+					})
+					var tableData [][]string
+					for _, property := range properties {
+						tableData = append(tableData, []string{property.Name, property.Value, property.PropertyType})
+					}
+					return printOutput(fmt.Sprintf("STACK DEFAULTS (%s-%s, %s):", stackName, stackVersion, configType), []string{"PROPERTY", "DEFAULT VALUE", "PROPERTY TYPE"}, tableData, properties, c)
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "type, t", Usage: "Config type (e.g.: hdfs-site)"},
+					cli.BoolFlag{Name: "refresh", Usage: "Obtain the stack version from Ambari instead of the local stack cache"},
+				},
+			},
+		},
+	}
+
+	healthCommand := cli.Command{
+		Name:  "health",
+		Usage: "Print the health issues of the cluster (hosts, services, host components, stale configs and alerts), exit code is non-zero on CRITICAL issues",
+		Action: func(c *cli.Context) error {
+			ambariRegistry, err := getActiveAmbari(ctx)
+			if err != nil {
+				return err
+			}
+			report, err := ambariRegistry.GetHealthReport()
+			if err != nil {
+				return err
+			}
+			var tableData [][]string
+			for _, issue := range report.Issues {
+				tableData = append(tableData, []string{issue.Severity, issue.Type, issue.Name, issue.Host, issue.State, issue.Message})
+			}
+			output := strings.ToLower(c.GlobalString("output"))
+			var items interface{} = report
+			if output == "csv" {
+				items = report.Issues
+			}
+			if err := printOutput("CLUSTER HEALTH:", []string{"SEVERITY", "TYPE", "NAME", "HOST", "STATE", "MESSAGE"}, tableData, items, c); err != nil {
+				return err
+			}
+			if len(output) == 0 || output == "table" {
+				fmt.Println(fmt.Sprintf("Checked %v hosts, %v services, %v host components and %v active alerts - status: %s (%v critical, %v warning, %v info)",
+					report.Hosts, report.Services, report.HostComponents, report.Alerts, report.Status(),
+					report.Count(ambari.HealthCritical), report.Count(ambari.HealthWarning), report.Count(ambari.HealthInfo)))
+			}
+			return report.Check(c.String("fail-on"))
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "fail-on", Value: ambari.HealthCritical, Usage: "Exit with non-zero code if there are issues with this (or higher) severity: CRITICAL, WARNING or INFO"},
+		},
+	}
+
+	alertFilterFlags := []cli.Flag{
+		cli.StringFlag{Name: "state", Usage: "Filter on alert states: OK, WARNING, CRITICAL, UNKNOWN (comma separated)"},
+		cli.StringFlag{Name: "services, s", Usage: "Filter on services (comma separated)"},
+		cli.StringFlag{Name: "hosts", Usage: "Filter on host names (comma separated)"},
+		cli.StringFlag{Name: "definitions, d", Usage: "Filter on alert definition names (comma separated)"},
+	}
+
+	alertsCommand := cli.Command{
+		Name:  "alerts",
+		Usage: "Alerts and maintenance mode related commands",
+		Subcommands: []cli.Command{
+			{
+				Name:    "list",
+				Aliases: []string{"ls"},
+				Usage:   "Print current alerts (by default only the WARNING, CRITICAL and UNKNOWN ones)",
+				Action: func(c *cli.Context) error {
+					ambariRegistry, err := getActiveAmbari(ctx)
+					if err != nil {
+						return err
+					}
+					filter := createAlertFilter(c)
+					if len(filter.States) == 0 && !c.Bool("all") {
+						filter.States = []string{ambari.AlertStateWarning, ambari.AlertStateCritical, ambari.AlertStateUnknown}
+					}
+					alerts, err := ambariRegistry.ListAlerts(filter)
+					if err != nil {
+						return err
+					}
+					var tableData [][]string
+					for _, alert := range alerts {
+						tableData = append(tableData, []string{alert.State, alert.Label, alert.ServiceName, alert.ComponentName, alert.HostName, alert.MaintenanceState,
+							formatTimestamp(alert.Timestamp), alert.Text})
+					}
+					return printOutput("ALERTS:", []string{"STATE", "LABEL", "SERVICE", "COMPONENT", "HOST", "MAINTENANCE", "SINCE", "TEXT"}, tableData, alerts, c)
+				},
+				Flags: append(alertFilterFlags, cli.BoolFlag{Name: "all", Usage: "Print OK alerts as well"}),
+			},
+			{
+				Name:  "history",
+				Usage: "Print alert state changes (newest first)",
+				Action: func(c *cli.Context) error {
+					ambariRegistry, err := getActiveAmbari(ctx)
+					if err != nil {
+						return err
+					}
+					alertHistory, err := ambariRegistry.ListAlertHistory(createAlertFilter(c), c.Int("limit"))
+					if err != nil {
+						return err
+					}
+					var tableData [][]string
+					for _, historyEntry := range alertHistory {
+						tableData = append(tableData, []string{formatTimestamp(historyEntry.Timestamp), historyEntry.State, historyEntry.Label, historyEntry.ServiceName,
+							historyEntry.ComponentName, historyEntry.HostName, historyEntry.Text})
+					}
+					return printOutput("ALERT HISTORY:", []string{"TIME", "STATE", "LABEL", "SERVICE", "COMPONENT", "HOST", "TEXT"}, tableData, alertHistory, c)
+				},
+				Flags: append(alertFilterFlags, cli.IntFlag{Name: "limit", Value: 50, Usage: "Maximum number of history entries"}),
+			},
+			{
+				Name:  "definitions",
+				Usage: "Print alert definitions",
+				Action: func(c *cli.Context) error {
+					ambariRegistry, err := getActiveAmbari(ctx)
+					if err != nil {
+						return err
+					}
+					alertDefinitions, err := ambariRegistry.ListAlertDefinitions()
+					if err != nil {
+						return err
+					}
+					var tableData [][]string
+					for _, alertDefinition := range alertDefinitions {
+						tableData = append(tableData, []string{alertDefinition.Name, alertDefinition.Label, alertDefinition.ServiceName, alertDefinition.ComponentName,
+							alertDefinition.Scope, strconv.Itoa(alertDefinition.Interval), strconv.FormatBool(alertDefinition.Enabled)})
+					}
+					return printOutput("ALERT DEFINITIONS:", []string{"NAME", "LABEL", "SERVICE", "COMPONENT", "SCOPE", "INTERVAL", "ENABLED"}, tableData, alertDefinitions, c)
+				},
+			},
+			{
+				Name:      "enable",
+				Usage:     "Enable alert definitions by name",
+				ArgsUsage: "<definition> [<definition>...]",
+				Action: func(c *cli.Context) error {
+					return setAlertDefinitionsEnabled(ctx, c, true)
+				},
+			},
+			{
+				Name:      "disable",
+				Usage:     "Disable alert definitions by name",
+				ArgsUsage: "<definition> [<definition>...]",
+				Action: func(c *cli.Context) error {
+					return setAlertDefinitionsEnabled(ctx, c, false)
+				},
+			},
+			{
+				Name:      "maintenance",
+				Usage:     "Turn on or off maintenance mode for components (on all or specific hosts), services or hosts",
+				ArgsUsage: "on|off",
+				Action: func(c *cli.Context) error {
+					ambariRegistry, err := getActiveAmbari(ctx)
+					if err != nil {
+						return err
+					}
+					mode := strings.ToLower(c.Args().First())
+					if mode != "on" && mode != "off" {
+						return errors.New("Provide 'on' or 'off' argument. e.g.: maintenance on -s HDFS")
+					}
+					filter := ambari.CreateFilter(strings.ToUpper(c.String("services")), strings.ToUpper(c.String("components")), c.String("hosts"), false)
+					if err := ambariRegistry.SetMaintenanceMode(filter, mode == "on"); err != nil {
+						return err
+					}
+					fmt.Println(fmt.Sprintf("Maintenance mode has been turned %s", mode))
+					return nil
+				},
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "services, s", Usage: "Services (comma separated)"},
+					cli.StringFlag{Name: "components, c", Usage: "Components (comma separated), use with --hosts to change only specific hosts"},
+					cli.StringFlag{Name: "hosts", Usage: "Host names (comma separated)"},
+				},
+			},
 		},
 	}
 
@@ -539,8 +1648,10 @@ func main() {
 		Name:  "run",
 		Usage: "Execute commands on all (or specific) hosts",
 		Action: func(c *cli.Context) error {
-			ambariServer := ambari.GetActiveAmbari()
-			validateActiveAmbari(ambariServer)
+			ambariServer, err := getActiveAmbari(ctx)
+			if err != nil {
+				return err
+			}
 			args := c.Args()
 			command := ""
 			for _, arg := range args {
@@ -548,15 +1659,22 @@ func main() {
 			}
 			filter := ambari.CreateFilter(strings.ToUpper(c.String("services")),
 				strings.ToUpper(c.String("components")), c.String("hosts"), c.Bool("server"))
-			hosts := ambariServer.GetFilteredHosts(filter)
-			ambariServer.RunRemoteHostCommand(command, hosts, filter.Server)
-			return nil
+			hosts, err := ambariServer.GetFilteredHosts(filter)
+			if err != nil {
+				return err
+			}
+			ambari.SetSshParallelism(c.Int("parallel"))
+			ambari.SetRemoteCommandTimeout(time.Duration(c.Int("timeout")) * time.Second)
+			_, err = ambariServer.RunRemoteHostCommand(command, hosts, filter.Server)
+			return err
 		},
 		Flags: []cli.Flag{
 			cli.BoolFlag{Name: "server", Usage: "Filter on ambari-server"},
 			cli.StringFlag{Name: "services, s", Usage: "Filter on services (comma separated)"},
 			cli.StringFlag{Name: "components, c", Usage: "Filter on components (comma separated)"},
 			cli.StringFlag{Name: "hosts", Usage: "Filter on hosts (comma separated)"},
+			cli.IntFlag{Name: "parallel, p", Value: ambari.DefaultSshParallelism, Usage: "Maximum number of hosts where the command runs at the same time", EnvVar: "AMBARICTL_SSH_PARALLEL"},
+			cli.IntFlag{Name: "timeout", Value: int(ambari.DefaultRemoteCommandTimeout.Seconds()), Usage: "Timeout of the command on one host (seconds)"},
 		},
 	}
 
@@ -564,28 +1682,42 @@ func main() {
 		Name:  "command",
 		Usage: "Execute ambari commands on Ambari server (START/STOP/RESTART/SERVICE_CHECK)",
 		Action: func(c *cli.Context) error {
-			ambariServer := ambari.GetActiveAmbari()
-			validateActiveAmbari(ambariServer)
+			ambariServer, err := getActiveAmbari(ctx)
+			if err != nil {
+				return err
+			}
 			args := c.Args()
 			command := ""
 			for _, arg := range args {
 				command += arg
 			}
 			if len(c.String("services")) == 0 && len(c.String("components")) == 0 {
-				fmt.Println("It is required to provide --components (-c) or --services (-s) flag")
-				os.Exit(1)
+				return errors.New("It is required to provide --components (-c) or --services (-s) flag")
 			}
 			if command == "SERVICE_CHECK" && len(c.String("services")) == 0 {
-				fmt.Println("Service check can be performed only on services, not components")
-				os.Exit(1)
+				return errors.New("Service check can be performed only on services, not components")
 			}
 			filter := ambari.CreateFilter(strings.ToUpper(c.String("services")),
 				strings.ToUpper(c.String("components")), "", false)
-			ambariServer.RunAmbariServiceCommand(command, filter, len(filter.Services) > 0, len(filter.Components) > 0)
+			if c.Bool("rolling") {
+				if strings.ToUpper(command) != "RESTART" {
+					return errors.New("Rolling mode can be used only with RESTART command")
+				}
+				rolling, parseErr := ambari.ParseRollingRestart(c.String("batch-size"), time.Duration(c.Int("batch-wait"))*time.Second, c.Int("max-failures"))
+				if parseErr != nil {
+					return parseErr
+				}
+				err = ambariServer.RollingRestartServiceOrComponent(filter, len(filter.Services) > 0, len(filter.Components) > 0, rolling)
+			} else {
+				err = ambariServer.RunAmbariServiceCommand(command, filter, len(filter.Services) > 0, len(filter.Components) > 0)
+			}
+			if err != nil {
+				return err
+			}
 			if len(c.String("components")) > 0 {
-				fmt.Println(fmt.Sprintf("Command %s has been sent to %s (components)", command, c.String("components")))
+				fmt.Println(fmt.Sprintf("Command %s has been finished on %s (components)", command, c.String("components")))
 			} else if len(c.String("services")) > 0 {
-				fmt.Println(fmt.Sprintf("Command %s has been sent to %s (services)", command, c.String("services")))
+				fmt.Println(fmt.Sprintf("Command %s has been finished on %s (services)", command, c.String("services")))
 			}
 
 			return nil
@@ -593,6 +1725,10 @@ func main() {
 		Flags: []cli.Flag{
 			cli.StringFlag{Name: "services, s", Usage: "Filter on services (comma separated)"},
 			cli.StringFlag{Name: "components, c", Usage: "Filter on components (comma separated)"},
+			cli.BoolFlag{Name: "rolling", Usage: "Restart the host components in batches of hosts (only for RESTART, services: non-client components)"},
+			cli.StringFlag{Name: "batch-size", Value: ambari.DefaultRollingBatchSize, Usage: "Number (or percentage, like 25%) of hosts in a rolling restart batch"},
+			cli.IntFlag{Name: "batch-wait", Usage: "Wait time between rolling restart batches (seconds)"},
+			cli.IntFlag{Name: "max-failures", Usage: "Number of failed hosts that are tolerated before aborting the rolling restart"},
 		},
 	}
 
@@ -600,15 +1736,18 @@ func main() {
 		Name:  "playbook",
 		Usage: "Execute a list of commands defined in playbook file(s)",
 		Action: func(c *cli.Context) error {
-			ambariServer := ambari.GetActiveAmbari()
-			validateActiveAmbari(ambariServer)
+			ambariServer, err := getActiveAmbari(ctx)
+			if err != nil {
+				return err
+			}
 			if len(c.String("file")) == 0 {
-				fmt.Println("Provide -f or --file parameter")
-				os.Exit(1)
+				return errors.New("Provide -f or --file parameter")
 			}
-			playbook := ambari.LoadPlaybookFile(c.String("file"), c.String("vars"))
-			ambariServer.ExecutePlaybook(playbook)
-			return nil
+			playbook, err := ambari.LoadPlaybookFile(c.String("file"), c.String("vars"))
+			if err != nil {
+				return err
+			}
+			return ambariServer.ExecutePlaybook(playbook)
 		},
 		Flags: []cli.Flag{
 			cli.StringFlag{Name: "file, f", Usage: "Playbook file"},
@@ -620,15 +1759,20 @@ func main() {
 		Name:  "logs",
 		Usage: "Download logs from Ambari agents",
 		Action: func(c *cli.Context) error {
-			ambariServer := ambari.GetActiveAmbari()
+			ambariServer, err := getActiveAmbari(ctx)
+			if err != nil {
+				return err
+			}
 			if len(c.String("destination")) == 0 {
-				fmt.Println("Provide --destination parameter")
-				os.Exit(1)
+				return errors.New("Provide --destination parameter")
 			}
 			filter := ambari.CreateFilter(strings.ToUpper(c.String("services")),
 				strings.ToUpper(c.String("components")), c.String("hosts"), c.Bool("server"))
-			ambariServer.DownloadLogs(c.String("destination"), filter)
-			return nil
+			logFilter, err := ambari.ParseLogFilter(c.String("since"), c.String("until"), c.String("pattern"), c.String("max-size"))
+			if err != nil {
+				return err
+			}
+			return ambariServer.DownloadLogs(c.String("destination"), filter, logFilter)
 		},
 		Flags: []cli.Flag{
 			cli.StringFlag{Name: "destination, d", Usage: "Download destination"},
@@ -636,6 +1780,10 @@ func main() {
 			cli.StringFlag{Name: "services, s", Usage: "Filter on services (comma separated)"},
 			cli.StringFlag{Name: "components, c", Usage: "Filter on components (comma separated)"},
 			cli.StringFlag{Name: "hosts", Usage: "Filter on hosts (comma separated)"},
+			cli.StringFlag{Name: "since", Usage: "Download only log files modified after a time (e.g.: 12h, 2006-01-02, '2006-01-02 15:04' or RFC3339)"},
+			cli.StringFlag{Name: "until", Usage: "Download only log files modified before a time (e.g.: 1h, 2006-01-02, '2006-01-02 15:04' or RFC3339)"},
+			cli.StringFlag{Name: "pattern, p", Usage: "Download only log files with matching file names (e.g.: '*.log')"},
+			cli.StringFlag{Name: "max-size", Usage: "Skip log files larger than this size (e.g.: 100M)"},
 		},
 	}
 
@@ -656,16 +1804,122 @@ func main() {
 	app.Commands = append(app.Commands, listHostComponentsCommand)
 	app.Commands = append(app.Commands, configsCommand)
 	app.Commands = append(app.Commands, clusterCommand)
+	app.Commands = append(app.Commands, blueprintCommand)
+	app.Commands = append(app.Commands, stacksCommand)
+	app.Commands = append(app.Commands, healthCommand)
+	app.Commands = append(app.Commands, alertsCommand)
 	app.Commands = append(app.Commands, logsCommand)
+	app.Commands = append(app.Commands, secretsCommand)
 	app.Commands = append(app.Commands, clearCommand)
 
 	err := app.Run(os.Args)
+	cancel()
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
+// loadStackDefinition reads the stack definition from a file if it exists, otherwise it obtains it from the active Ambari server (and saves it if a file is provided)
+func loadStackDefinition(ctx context.Context, stack string, version string, stackFile string, refresh bool) (ambari.StackDefinition, error) {
+	if !refresh {
+		if len(stackFile) > 0 {
+			if _, err := os.Stat(stackFile); err == nil {
+				return ambari.LoadStackDefinition(stackFile)
+			}
+		} else {
+			definition, ok, err := ambari.LoadCachedStackDefinition(stack, version)
+			if err != nil || ok {
+				return definition, err
+			}
+		}
+	}
+	ambariRegistry, err := getActiveAmbari(ctx)
+	if err != nil {
+		return ambari.StackDefinition{}, err
+	}
+	definition, err := ambariRegistry.GetStackDefinition(stack, version)
+	if err != nil {
+		return definition, err
+	}
+	if err := ambari.CacheStackDefinition(definition); err != nil {
+		return definition, err
+	}
+	if len(stackFile) > 0 {
+		if err := ambari.SaveStackDefinition(stackFile, definition); err != nil {
+			return definition, err
+		}
+		fmt.Println(fmt.Sprintf("Stack definition %s-%s has been saved to %s", stack, version, stackFile))
+	}
+	return definition, nil
+}
+
+func getStackArguments(ctx context.Context, c *cli.Context) (string, string, error) {
+	var stackVersion string
+	if len(c.Args()) > 1 {
+		return c.Args().Get(0), c.Args().Get(1), nil
+	} else if len(c.Args()) == 1 {
+		stackVersion = c.Args().First()
+	} else {
+		ambariRegistry, err := getActiveAmbari(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		clusterInfo, err := ambariRegistry.GetClusterInfo()
+		if err != nil {
+			return "", "", err
+		}
+		if len(clusterInfo.ClusterVersion) == 0 {
+			return "", "", errors.New("Cannot find the stack version of the active cluster, provide a <stack>-<version> argument")
+		}
+		stackVersion = clusterInfo.ClusterVersion
+	}
+	stackVersionParts := strings.SplitN(stackVersion, "-", 2)
+	if len(stackVersionParts) != 2 || len(stackVersionParts[0]) == 0 || len(stackVersionParts[1]) == 0 {
+		return "", "", fmt.Errorf("Invalid stack version '%s' (use <stack>-<version> or <stack> <version>, e.g.: HDP-2.6)", stackVersion)
+	}
+	return stackVersionParts[0], stackVersionParts[1], nil
+}
+
+func getHostArguments(c *cli.Context) ([]string, error) {
+	var hosts []string
+	for _, arg := range c.Args() {
+		for _, host := range strings.Split(arg, ",") {
+			if len(host) > 0 {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("Provide at least one host name argument")
+	}
+	return hosts, nil
+}
+
+func decommissionHosts(ctx context.Context, c *cli.Context, recommission bool) error {
+	ambariRegistry, err := getActiveAmbari(ctx)
+	if err != nil {
+		return err
+	}
+	hosts, err := getHostArguments(c)
+	if err != nil {
+		return err
+	}
+	var components []string
+	if len(c.String("components")) > 0 {
+		components = strings.Split(strings.ToUpper(c.String("components")), ",")
+	}
+	if err := ambariRegistry.DecommissionHosts(hosts, components, recommission); err != nil {
+		return err
+	}
+	if recommission {
+		fmt.Println(fmt.Sprintf("Host(s) %s have been recommissioned", strings.Join(hosts, ", ")))
+	} else {
+		fmt.Println(fmt.Sprintf("Host(s) %s have been decommissioned", strings.Join(hosts, ", ")))
+	}
+	return nil
+}
+
 func printTable(title string, headers []string, data [][]string, c *cli.Context) {
 	fmt.Println(title)
 	if len(data) > 0 {
@@ -684,23 +1938,275 @@ func printTable(title string, headers []string, data [][]string, c *cli.Context)
 	}
 }
 
-func printJson(b []byte) {
-	fmt.Println(formatJson(b).String())
+// printOutput prints the listed items in the selected output format (global --output flag), table data is used for the table format
+func printOutput(title string, headers []string, tableData [][]string, items interface{}, c *cli.Context) error {
+	if value := reflect.ValueOf(items); value.Kind() == reflect.Slice && value.IsNil() {
+		items = reflect.MakeSlice(value.Type(), 0, 0).Interface()
+	}
+	switch output := strings.ToLower(c.GlobalString("output")); output {
+	case "", "table":
+		printTable(title, headers, tableData, c)
+		return nil
+	case "json":
+		itemsJson, err := json.Marshal(items)
+		if err != nil {
+			return err
+		}
+		return printJson(itemsJson)
+	case "yaml":
+		genericItems, err := toGenericValue(items)
+		if err != nil {
+			return err
+		}
+		itemsYaml, err := yaml.Marshal(genericItems)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(itemsYaml))
+		return nil
+	case "csv":
+		return printCsv(items)
+	case "template":
+		if len(c.GlobalString("template")) == 0 {
+			return errors.New("--template flag is required for the template output format")
+		}
+		outputTemplate, err := template.New("output").Parse(c.GlobalString("template"))
+		if err != nil {
+			return err
+		}
+		return outputTemplate.Execute(os.Stdout, items)
+	default:
+		return fmt.Errorf("unsupported output format '%s' (use table, json, yaml, csv or template)", output)
+	}
+}
+
+// printCsv prints items (a slice of structs or a struct) as csv, the columns are the json field names of the struct
+func printCsv(items interface{}) error {
+	value := reflect.ValueOf(items)
+	if value.Kind() != reflect.Slice {
+		value = reflect.ValueOf([]interface{}{items})
+	}
+	itemType := reflect.TypeOf(items)
+	if itemType.Kind() == reflect.Slice {
+		itemType = itemType.Elem()
+	}
+	var columns []string
+	for i := 0; i < itemType.NumField(); i++ {
+		field := itemType.Field(i)
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+		columns = append(columns, name)
+	}
+	writer := csv.NewWriter(os.Stdout)
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+	for i := 0; i < value.Len(); i++ {
+		genericItem, err := toGenericValue(value.Index(i).Interface())
+		if err != nil {
+			return err
+		}
+		fields, _ := genericItem.(map[string]interface{})
+		var record []string
+		for _, column := range columns {
+			switch fieldValue := fields[column].(type) {
+			case nil:
+				record = append(record, "")
+			case string:
+				record = append(record, fieldValue)
+			case float64:
+				record = append(record, strconv.FormatFloat(fieldValue, 'f', -1, 64))
+			case bool:
+				record = append(record, strconv.FormatBool(fieldValue))
+			default:
+				fieldJson, err := json.Marshal(fieldValue)
+				if err != nil {
+					return err
+				}
+				record = append(record, string(fieldJson))
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// toGenericValue converts a value to maps / slices through json, so the json field names are used in every structured output format
+func toGenericValue(value interface{}) (interface{}, error) {
+	valueJson, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var genericValue interface{}
+	err = json.Unmarshal(valueJson, &genericValue)
+	return genericValue, err
+}
+
+// hidePasswords removes the (plain) passwords from ambari server entries before printing them
+func hidePasswords(ambariServers []ambari.AmbariRegistry) []ambari.AmbariRegistry {
+	result := make([]ambari.AmbariRegistry, 0)
+	for _, ambariServer := range ambariServers {
+		ambariServer.Password = ""
+		result = append(result, ambariServer)
+	}
+	return result
 }
 
-func formatJson(b []byte) *bytes.Buffer {
-	var out bytes.Buffer
-	err := json.Indent(&out, b, "", "    ")
+func printJson(b []byte) error {
+	formattedJson, err := ambari.FormatJson(b)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return err
 	}
-	return &out
+	fmt.Println(formattedJson.String())
+	return nil
 }
 
-func validateActiveAmbari(ambariServer ambari.AmbariRegistry) {
+func getActiveAmbari(ctx context.Context) (ambari.AmbariRegistry, error) {
+	ambariServer, err := ambari.GetActiveAmbari()
+	if err != nil {
+		return ambariServer, err
+	}
 	if len(ambariServer.Name) == 0 {
-		fmt.Println("No active ambari server selected. (see 'use' command)")
-		os.Exit(1)
+		return ambariServer, errors.New("No active ambari server selected. (see 'use' command)")
+	}
+	ambariServer, err = ambariServer.ResolveSecrets()
+	if err != nil {
+		return ambariServer, err
+	}
+	return ambariServer.WithContext(ctx), nil
+}
+
+// expandPath replaces '~' with the home directory of the current user, and checks that the file exists
+func expandPath(filePath string) (string, error) {
+	if len(filePath) == 0 {
+		return filePath, nil
+	}
+	usr, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	filePath = strings.Replace(filePath, "~", usr.HomeDir, -1)
+	if _, err := os.Stat(filePath); err != nil {
+		return "", err
+	}
+	return filePath, nil
+}
+
+// createProfileSecretRef creates a secret reference for a connection profile secret, for the vault backend the secret is asked from the user and stored in the vault
+func createProfileSecretRef(profileName string, secret string, backend string, ref string) (ambari.SecretRef, error) {
+	description := strings.NewReplacer("_", " ", "/", " ").Replace(secret)
+	switch backend = strings.ToLower(backend); backend {
+	case "", "none":
+		return ambari.SecretRef{}, nil
+	case ambari.SecretBackendPrompt:
+		return ambari.StoreSecret(backend, fmt.Sprintf("ssh %s of connection profile '%s'", description, profileName), "")
+	case ambari.SecretBackendVault:
+		value, err := ambari.GetPassword("", "Enter ssh "+description)
+		if err != nil {
+			return ambari.SecretRef{}, err
+		}
+		return ambari.StoreSecret(backend, ambari.ConnectionProfileVaultKey(profileName, secret), value)
+	}
+	return ambari.StoreSecret(backend, ref, "")
+}
+
+// createAlertFilter creates an alert filter from the (comma separated) alert filter flags
+func createAlertFilter(c *cli.Context) ambari.AlertFilter {
+	splitFlag := func(name string) []string {
+		if len(c.String(name)) == 0 {
+			return nil
+		}
+		return strings.Split(c.String(name), ",")
+	}
+	return ambari.AlertFilter{States: splitFlag("state"), Services: splitFlag("services"), Hosts: splitFlag("hosts"), Definitions: splitFlag("definitions")}
+}
+
+// setAlertDefinitionsEnabled enables or disables the alert definitions from the arguments
+func setAlertDefinitionsEnabled(ctx context.Context, c *cli.Context, enabled bool) error {
+	if len(c.Args()) == 0 {
+		return errors.New("Provide at least 1 alert definition name argument. e.g.: namenode_cpu")
 	}
+	ambariRegistry, err := getActiveAmbari(ctx)
+	if err != nil {
+		return err
+	}
+	for _, definition := range c.Args() {
+		if err := ambariRegistry.SetAlertDefinitionEnabled(definition, enabled); err != nil {
+			return err
+		}
+		if enabled {
+			fmt.Println(fmt.Sprintf("Alert definition '%s' has been enabled", definition))
+		} else {
+			fmt.Println(fmt.Sprintf("Alert definition '%s' has been disabled", definition))
+		}
+	}
+	return nil
+}
+
+// formatTimestamp formats an Ambari timestamp (milliseconds since epoch)
+func formatTimestamp(timestamp int64) string {
+	if timestamp == 0 {
+		return ""
+	}
+	return time.Unix(0, timestamp*int64(time.Millisecond)).Format("2006-01-02 15:04:05")
+}
+
+// deleteVaultSecrets removes the vault backed secrets (other secret references are ignored)
+func deleteVaultSecrets(secretRefs ...ambari.SecretRef) error {
+	for _, secretRef := range secretRefs {
+		if secretRef.Backend == ambari.SecretBackendVault {
+			vault, err := ambari.OpenVault()
+			if err != nil {
+				return err
+			}
+			if err := vault.Delete(secretRef.Key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// getProfileArgument returns the connection profile name from the first argument (the profile has to exist)
+func getProfileArgument(c *cli.Context) (string, error) {
+	if len(c.Args()) == 0 {
+		return "", errors.New("Provide a profile name argument. e.g.: add vagrant")
+	}
+	profileName := c.Args().First()
+	profileEntryId, err := ambari.GetConnectionProfileEntryId(profileName)
+	if err != nil {
+		return "", err
+	}
+	if len(profileEntryId) == 0 {
+		return "", &ambari.RegistryError{Kind: "connection profile", ID: profileName, Msg: "not found"}
+	}
+	return profileEntryId, nil
+}
+
+// createSignalContext creates a context that is cancelled on the first interrupt (Ctrl-C) or terminate signal
+func createSignalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			fmt.Fprintln(os.Stderr, "Interrupted, cancelling in-flight requests...")
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	return ctx, cancel
 }